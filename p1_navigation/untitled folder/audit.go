@@ -0,0 +1,160 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/config"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// auditTimeout bounds the write of an event, it's written after the lookup
+// even if the caller is gone so it doesn't use the caller's context
+const auditTimeout = 3 * time.Second
+
+// defaultCheckpointEvery is how many events a checkpoint seals when config doesn't say
+const defaultCheckpointEvery = 1000
+
+var ErrAuditUnsupported = errors.New("store doesn't keep an audit trail")
+
+// auditStore is implemented by the stores that keep the access trail,
+// store/memory, store/sqlite and store/mssql
+type auditStore interface {
+	Audit() audit.Store
+}
+
+// newAuditLog returns the trail of s configured by conf.Audit,
+// the checkpoints are only signed if there's a signing key
+func newAuditLog(s audit.Store, conf *config.Config) (*audit.Log, error) {
+	l, err := audit.New(s, []byte(conf.Audit.HashKey))
+	if err != nil {
+		return nil, err
+	}
+	key, err := audit.ParseSigningKey(conf.Audit.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		every := conf.Audit.CheckpointEvery
+		if every == 0 {
+			every = defaultCheckpointEvery
+		}
+		l.SealWith(key, every)
+	}
+	return l, nil
+}
+
+// recordAccess appends the event of a lookup of the id by the caller of ctx.
+// a failed write is logged, the lookup is answered anyway
+func (c *Controller) recordAccess(ctx context.Context, op, id, source string, found bool, err error) {
+	if c.audit == nil {
+		return
+	}
+	actx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+
+	if _, aerr := c.audit.Record(actx, audit.FromContext(ctx), op, id, source, accessResult(found, err), ""); aerr != nil {
+		c.log.Error(ctx, "audit event not recorded", logging.String("operation", op), logging.Err(aerr))
+	}
+}
+
+// accessResult is the audit result of a lookup that returned err
+func accessResult(found bool, err error) string {
+	switch err {
+	case nil:
+		if found {
+			return audit.ResultFound
+		}
+		return audit.ResultNotFound
+	case ErrNotFound, store.ErrNotFound:
+		return audit.ResultNotFound
+	case ErrConsentDenied:
+		return audit.ResultDenied
+	case ErrSearchInput, ErrBadArgs, ErrBadNameFormat, ErrBadNationalID, ErrBadIqamaID, ErrBadBirthDate, ErrPurposeOfUse,
+		ErrUnknownPatientType, ErrBadExpiryDate, ErrBadBirthOrder, ErrNotNewborn:
+		return audit.ResultInvalid
+	case ErrUnknownIDType, ErrNationalIDChecksum, ErrIqamaIDChecksum, ErrBadBorderNumber, ErrBadGCCID, ErrGCCIDChecksum,
+		ErrUnknownGCCCountry, ErrBadVisaNumber, ErrBadPassportNumber, ErrMissingPassportState:
+		return audit.ResultInvalid
+	case ErrCanceled, ErrTimeout:
+		return audit.ResultCanceled
+	}
+	return audit.ResultError
+}
+
+// AuditEvents returns the events q selects, the latest first
+func (c *Controller) AuditEvents(ctx context.Context, q *audit.Query) ([]audit.Event, error) {
+	if c.audit == nil {
+		return nil, ErrAuditUnsupported
+	}
+
+	events, err := c.audit.Query(ctx, q)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "audit events: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+	return events, nil
+}
+
+// VerifyAudit walks the whole trail, see audit.Verify
+func (c *Controller) VerifyAudit(ctx context.Context) (*audit.Report, error) {
+	if c.audit == nil {
+		return nil, ErrAuditUnsupported
+	}
+
+	r, err := c.audit.Verify(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		c.log.Error(ctx, "verify audit: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+	return r, nil
+}
+
+// CheckpointAudit signs a checkpoint of the head of the trail
+func (c *Controller) CheckpointAudit(ctx context.Context) (*audit.Checkpoint, error) {
+	if c.audit == nil {
+		return nil, ErrAuditUnsupported
+	}
+
+	cp, err := c.audit.Checkpoint(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err != audit.ErrEmpty && err != audit.ErrNoSigner {
+		c.log.Error(ctx, "checkpoint audit: update failed", logging.Err(err))
+		return nil, ErrUpdateInfo
+	}
+	return cp, err
+}
+
+// AuditAdmin returns the controller as an audit.Admin to mount audit.NewHandler,
+// nil if the store doesn't keep the trail
+func (c *Controller) AuditAdmin() audit.Admin {
+	if c.audit == nil {
+		return nil
+	}
+	return auditAdmin{c}
+}
+
+type auditAdmin struct {
+	c *Controller
+}
+
+func (a auditAdmin) Events(ctx context.Context, q *audit.Query) ([]audit.Event, error) {
+	return a.c.AuditEvents(ctx, q)
+}
+
+func (a auditAdmin) Verify(ctx context.Context) (*audit.Report, error) {
+	return a.c.VerifyAudit(ctx)
+}
+
+func (a auditAdmin) Checkpoint(ctx context.Context) (*audit.Checkpoint, error) {
+	return a.c.CheckpointAudit(ctx)
+}
@@ -0,0 +1,359 @@
+// Package audit keeps the trail of who looked up which person and why.
+//
+// each lookup of a patient or practitioner appends an Event: the caller, the purpose of use,
+// the operation, the id queried, the data source that answered and the result. the id is kept
+// as an HMAC so the trail doesn't hold the ids itself, a compliance officer finds the events
+// of an id by sending it to Query which hashes it with the same key. events are never updated
+// nor removed.
+//
+// each event is chained to the previous one by its SHA-256 Hash, and the head of the chain is
+// sealed every so often by an ed25519 signed Checkpoint. Verify walks the chain and reports
+// the missing, edited and unlinked events, see chain.go
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// data sources that answered a lookup
+const (
+	SourceDB      = "db"
+	SourceYakeen  = "yakeen"
+	SourceNIC     = "nic"
+	SourceGateway = "gateway"
+	SourceSCFHS   = "scfhs"
+	// SourceConsent is the consent policy, its events are the decisions of what's released
+	SourceConsent = "consent"
+	// SourcePseudonym is the pseudonyms of the analytics consumers, its events are the re-identifications
+	SourcePseudonym = "pseudonym"
+)
+
+// results of a lookup
+const (
+	ResultFound    = "found"
+	ResultNotFound = "not_found"
+	// ResultInvalid is a query the registry or the source rejected
+	ResultInvalid = "invalid"
+	// ResultCanceled is a caller gone or out of time
+	ResultCanceled = "canceled"
+	ResultError    = "error"
+	// ResultDenied is a lookup the consent policy refused
+	ResultDenied = "denied"
+	// ResultPermitted is a consent decision releasing the patient, its Detail says what's released
+	ResultPermitted = "permitted"
+)
+
+// headers FromRequest reads
+const (
+	HeaderCaller        = "X-Caller-ID"
+	HeaderPurpose       = "X-Purpose-Of-Use"
+	HeaderCorrelationID = "X-Correlation-ID"
+	HeaderRole          = "X-Caller-Role"
+	headerRequestID     = "X-Request-ID"
+)
+
+const (
+	defaultCount = 100
+	maxCount     = 1000
+)
+
+var (
+	ErrNoKey    = errors.New("audit key is empty")
+	ErrBadQuery = errors.New("since and until are RFC 3339 times, count and offset positive numbers")
+	// ErrConflict is an event appended with a Seq that isn't the next one, another writer got there first
+	ErrConflict = errors.New("audit event isn't the next in the trail")
+	ErrEmpty    = errors.New("audit trail is empty")
+	ErrNoSigner = errors.New("audit checkpoints need a signing key")
+)
+
+// Access is who is looking up and why, it's carried by the context of the request
+type Access struct {
+	// Caller is the authenticated client e.g. the oauth consumer or the HL7 sending facility
+	Caller string
+	// Purpose is the purpose of use e.g. TREAT, HPAYMT (HL7 v3 PurposeOfUse)
+	Purpose string
+	// CorrelationID ties the events to the request in the logs of the caller
+	CorrelationID string
+	// Role is the role of the user of the caller e.g. clerk, it picks the projection of the responses.
+	// it isn't recorded
+	Role string
+}
+
+type accessKey struct{}
+
+// NewContext returns ctx carrying a, the log lines of ctx have its correlation id and caller
+func NewContext(ctx context.Context, a Access) context.Context {
+	ctx = logging.NewContext(ctx, logging.String("correlation_id", a.CorrelationID), logging.String("caller", a.Caller))
+	return context.WithValue(ctx, accessKey{}, a)
+}
+
+// FromContext returns the Access of ctx, empty if there's none
+func FromContext(ctx context.Context) Access {
+	a, _ := ctx.Value(accessKey{}).(Access)
+	return a
+}
+
+// FromRequest reads the Access of r from its headers, the correlation id is X-Request-ID
+// if there's no X-Correlation-ID. the caller has to be set by the auth in front of the api,
+// not by the client
+func FromRequest(r *http.Request) Access {
+	a := Access{
+		Caller:        r.Header.Get(HeaderCaller),
+		Purpose:       r.Header.Get(HeaderPurpose),
+		CorrelationID: r.Header.Get(HeaderCorrelationID),
+		Role:          r.Header.Get(HeaderRole),
+	}
+	if a.CorrelationID == "" {
+		a.CorrelationID = r.Header.Get(headerRequestID)
+	}
+	return a
+}
+
+// Event is an access to the registry
+type Event struct {
+	// Seq is the position of the event in the trail from 1
+	Seq           int64     `json:"seq" db:"Seq"`
+	Time          time.Time `json:"time" db:"Time"`
+	Caller        string    `json:"caller" db:"Caller"`
+	Purpose       string    `json:"purpose" db:"Purpose"`
+	CorrelationID string    `json:"correlation_id" db:"CorrelationID"`
+	Operation     string    `json:"operation" db:"Operation"`
+	// IDHash is the HMAC of the id queried, see Log.HashID
+	IDHash string `json:"id_hash" db:"IDHash"`
+	Source string `json:"source" db:"Source"`
+	Result string `json:"result" db:"Result"`
+	// Detail is more on the result e.g. the categories a consent decision released
+	Detail string `json:"detail,omitempty" db:"Detail"`
+
+	// PrevHash is the Hash of the event before, "" for the first one
+	PrevHash string `json:"prev_hash" db:"PrevHash"`
+	// Hash is the hex SHA-256 of the fields above, see ComputeHash
+	Hash string `json:"hash" db:"Hash"`
+}
+
+// Filter selects events, empty fields match any
+type Filter struct {
+	Caller        string
+	Purpose       string
+	CorrelationID string
+	Operation     string
+	IDHash        string
+	Source        string
+	Result        string
+	// Since is inclusive and Until exclusive
+	Since time.Time
+	Until time.Time
+
+	Offset int
+	// Count is the page size, 100 if 0 and at most 1000
+	Count int
+}
+
+// Matches tells if e is selected by f, for the stores that filter in memory
+func (f *Filter) Matches(e *Event) bool {
+	for _, c := range [][2]string{
+		{f.Caller, e.Caller}, {f.Purpose, e.Purpose}, {f.CorrelationID, e.CorrelationID},
+		{f.Operation, e.Operation}, {f.IDHash, e.IDHash}, {f.Source, e.Source}, {f.Result, e.Result},
+	} {
+		if c[0] != "" && c[0] != c[1] {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Limit returns the page size of f
+func (f *Filter) Limit() int {
+	switch {
+	case f.Count <= 0:
+		return defaultCount
+	case f.Count > maxCount:
+		return maxCount
+	}
+	return f.Count
+}
+
+// Store keeps the events and the checkpoints, it only appends
+type Store interface {
+	// Append adds e at the end of the trail, ErrConflict if e.Seq isn't the last Seq + 1
+	Append(ctx context.Context, e *Event) error
+	// Query returns the events f selects, the latest first
+	Query(ctx context.Context, f *Filter) ([]Event, error)
+	// Last returns the last event, nil if the trail is empty
+	Last(ctx context.Context) (*Event, error)
+	// Range returns at most n events after the Seq, in order
+	Range(ctx context.Context, after int64, n int) ([]Event, error)
+
+	AddCheckpoint(ctx context.Context, cp *Checkpoint) error
+	// Checkpoints returns the checkpoints in order
+	Checkpoints(ctx context.Context) ([]Checkpoint, error)
+}
+
+// Log records the events in a Store, chaining each to the last one.
+// it's safe for concurrent use, a Store written by other processes too is
+// caught up with on ErrConflict
+type Log struct {
+	store Store
+	key   []byte
+	now   func() time.Time
+
+	// sealing, see SealWith
+	signer ed25519.PrivateKey
+	every  int64
+
+	log *logging.Logger
+
+	mu sync.Mutex
+	// head is the last event appended, nil until it's read from the store
+	head *Event
+}
+
+// New returns a Log appending to s, key is the secret of the id hashes.
+// changing it makes the events recorded before unreachable by id
+func New(s Store, key []byte) (*Log, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	return &Log{store: s, key: key, now: time.Now}, nil
+}
+
+// HashID is the hex HMAC-SHA256 of the id, trimmed and upper cased
+func (l *Log) HashID(id string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(strings.ToUpper(strings.TrimSpace(id))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SealWith makes the Log sign a checkpoint of the head every n events, none if n is 0.
+// the key also signs the checkpoints asked for with Checkpoint
+func (l *Log) SealWith(key ed25519.PrivateKey, n int) {
+	l.signer, l.every = key, int64(n)
+}
+
+// SetLogger sets the logger of the checkpoints that failed, the events are in the trail
+func (l *Log) SetLogger(log *logging.Logger) {
+	l.log = log
+}
+
+// Record appends the event of the access a to the id, chained to the last event
+func (l *Log) Record(ctx context.Context, a Access, operation, id, source, result, detail string) (*Event, error) {
+	e := &Event{
+		// the stores keep microseconds at most, the hash has to survive the round trip
+		Time:          l.now().UTC().Truncate(time.Microsecond),
+		Caller:        a.Caller,
+		Purpose:       a.Purpose,
+		CorrelationID: a.CorrelationID,
+		Operation:     operation,
+		Source:        source,
+		Result:        result,
+		Detail:        detail,
+	}
+	if id != "" {
+		e.IDHash = l.HashID(id)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// once more if another writer appended since the head was read
+	var err error
+	for try := 0; try < 2; try++ {
+		if l.head == nil || err == ErrConflict {
+			if l.head, err = l.store.Last(ctx); err != nil {
+				return nil, err
+			}
+		}
+		e.Seq, e.PrevHash = 1, ""
+		if l.head != nil {
+			e.Seq, e.PrevHash = l.head.Seq+1, l.head.Hash
+		}
+		e.Hash = e.ComputeHash()
+		if err = l.store.Append(ctx, e); err != ErrConflict {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	head := *e
+	l.head = &head
+
+	if l.signer != nil && l.every > 0 && e.Seq%l.every == 0 {
+		// a missed checkpoint is covered by the next one
+		if _, err := l.seal(ctx, e); err != nil {
+			l.log.Error(ctx, "audit checkpoint not sealed", logging.Err(err))
+		}
+	}
+	return e, nil
+}
+
+// Checkpoint signs the head of the trail now e.g. from a cron job,
+// so the last events don't wait for the next periodic one
+func (l *Log) Checkpoint(ctx context.Context) (*Checkpoint, error) {
+	if l.signer == nil {
+		return nil, ErrNoSigner
+	}
+	head, err := l.store.Last(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, ErrEmpty
+	}
+	return l.seal(ctx, head)
+}
+
+func (l *Log) seal(ctx context.Context, head *Event) (*Checkpoint, error) {
+	cp := &Checkpoint{Seq: head.Seq, Hash: head.Hash, Time: l.now().UTC().Truncate(time.Microsecond)}
+	cp.sign(l.signer)
+	if err := l.store.AddCheckpoint(ctx, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Verify walks the whole trail, the checkpoint signatures are checked
+// with the public key of SealWith if there's one
+func (l *Log) Verify(ctx context.Context) (*Report, error) {
+	var pub ed25519.PublicKey
+	if l.signer != nil {
+		pub = l.signer.Public().(ed25519.PublicKey)
+	}
+	return Verify(ctx, l.store, pub)
+}
+
+// Query is the Filter a compliance officer sends, by the id itself
+type Query struct {
+	Filter
+	ID string
+}
+
+// Query returns the events q selects, the latest first
+func (l *Log) Query(ctx context.Context, q *Query) ([]Event, error) {
+	f := q.Filter
+	if q.ID != "" {
+		f.IDHash = l.HashID(q.ID)
+	}
+	events, err := l.store.Query(ctx, &f)
+	if events == nil && err == nil {
+		events = []Event{}
+	}
+	return events, err
+}
@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// verifyBatch is the number of events read at a time by Verify and Export
+const verifyBatch = 1000
+
+// kinds of the problems Verify finds
+const (
+	// ProblemGap is events missing before the Seq
+	ProblemGap = "gap"
+	// ProblemEdited is an event whose Hash isn't the hash of its fields
+	ProblemEdited = "edited"
+	// ProblemUnlinked is an event whose PrevHash isn't the Hash of the event before,
+	// the one before was edited and rehashed or this one was inserted
+	ProblemUnlinked = "unlinked"
+	// ProblemCheckpoint is a checkpoint that doesn't match the event it sealed,
+	// the chain was rewritten up to it
+	ProblemCheckpoint = "checkpoint_mismatch"
+	// ProblemSignature is a checkpoint not signed by the key
+	ProblemSignature = "bad_signature"
+	// ProblemTruncated is a checkpoint past the last event, the tail was removed
+	ProblemTruncated = "truncated"
+)
+
+var (
+	ErrBadSigningKey = errors.New("audit signing key is the base64 of a 32 byte ed25519 seed")
+	ErrBadPublicKey  = errors.New("audit public key is the base64 of a 32 byte ed25519 key")
+)
+
+// ComputeHash is the hex SHA-256 of the fields of e and its PrevHash, each prefixed
+// with its length so they can't run into each other
+func (e *Event) ComputeHash() string {
+	h := sha256.New()
+	for _, f := range []string{
+		strconv.FormatInt(e.Seq, 10), e.Time.UTC().Format(time.RFC3339Nano),
+		e.Caller, e.Purpose, e.CorrelationID, e.Operation, e.IDHash, e.Source, e.Result, e.Detail, e.PrevHash,
+	} {
+		fmt.Fprintf(h, "%d:%s", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checkpoint seals the trail up to the event Seq, whose Hash covers all the events before it
+type Checkpoint struct {
+	Seq  int64     `json:"seq" db:"Seq"`
+	Hash string    `json:"hash" db:"Hash"`
+	Time time.Time `json:"time" db:"Time"`
+	// Signature is the base64 ed25519 signature of the fields above
+	Signature string `json:"signature" db:"Signature"`
+}
+
+func (cp *Checkpoint) message() []byte {
+	return []byte(fmt.Sprintf("nhic audit checkpoint\n%d\n%s\n%s", cp.Seq, cp.Hash, cp.Time.UTC().Format(time.RFC3339Nano)))
+}
+
+func (cp *Checkpoint) sign(key ed25519.PrivateKey) {
+	cp.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, cp.message()))
+}
+
+// Valid tells if cp is signed by the key
+func (cp *Checkpoint) Valid(pub ed25519.PublicKey) bool {
+	sig, err := base64.StdEncoding.DecodeString(cp.Signature)
+	return err == nil && len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, cp.message(), sig)
+}
+
+// ParseSigningKey reads the base64 ed25519 seed of the checkpoints, nil if s is empty
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrBadSigningKey
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKey reads the base64 ed25519 public key the checkpoints are verified with
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, ErrBadPublicKey
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// Problem is something wrong Verify found at the event Seq
+type Problem struct {
+	Seq    int64  `json:"seq"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// Report is what Verify found
+type Report struct {
+	// Events is the number of events read, Last the Seq of the last one
+	Events int64 `json:"events"`
+	Last   int64 `json:"last"`
+	// Checkpoints is the number of checkpoints, Sealed the Seq of the last one that matched
+	Checkpoints int   `json:"checkpoints"`
+	Sealed      int64 `json:"sealed"`
+	// Signed tells if the signatures were checked
+	Signed   bool      `json:"signed"`
+	Problems []Problem `json:"problems"`
+}
+
+// OK tells if nothing was found wrong
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) add(seq int64, kind, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{Seq: seq, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Verify walks the trail of s in order and reports the missing, edited and unlinked events
+// and the checkpoints that don't match. the signatures are checked if pub isn't nil, without them
+// a trail rewritten from the start can't be told from the original
+func Verify(ctx context.Context, s Store, pub ed25519.PublicKey) (*Report, error) {
+	cps, err := s.Checkpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{Checkpoints: len(cps), Signed: pub != nil, Problems: []Problem{}}
+	bySeq := make(map[int64][]Checkpoint, len(cps))
+	for _, cp := range cps {
+		if pub != nil && !cp.Valid(pub) {
+			r.add(cp.Seq, ProblemSignature, "checkpoint of %s isn't signed by the key", cp.Time.Format(time.RFC3339))
+			continue
+		}
+		bySeq[cp.Seq] = append(bySeq[cp.Seq], cp)
+	}
+
+	var prev *Event
+	for after := int64(0); ; {
+		events, err := s.Range(ctx, after, verifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for i := range events {
+			e := &events[i]
+			want := int64(1)
+			if prev != nil {
+				want = prev.Seq + 1
+			}
+			switch {
+			case e.Seq != want:
+				r.add(e.Seq, ProblemGap, "events %d to %d are missing", want, e.Seq-1)
+			case prev == nil && e.PrevHash != "", prev != nil && e.PrevHash != prev.Hash:
+				r.add(e.Seq, ProblemUnlinked, "prev_hash isn't the hash of event %d", want-1)
+			}
+			if e.ComputeHash() != e.Hash {
+				r.add(e.Seq, ProblemEdited, "hash doesn't match the fields")
+			}
+			for _, cp := range bySeq[e.Seq] {
+				if cp.Hash != e.Hash {
+					r.add(e.Seq, ProblemCheckpoint, "checkpoint of %s sealed another hash", cp.Time.Format(time.RFC3339))
+				} else if e.Seq > r.Sealed {
+					r.Sealed = e.Seq
+				}
+			}
+			delete(bySeq, e.Seq)
+			r.Events++
+			r.Last = e.Seq
+			prev = e
+		}
+		after = events[len(events)-1].Seq
+	}
+
+	// checkpoints of events that aren't there
+	for _, cp := range cps {
+		if _, ok := bySeq[cp.Seq]; !ok {
+			continue
+		}
+		if cp.Seq > r.Last {
+			r.add(cp.Seq, ProblemTruncated, "sealed at %s but the trail ends at %d", cp.Time.Format(time.RFC3339), r.Last)
+		} else {
+			r.add(cp.Seq, ProblemCheckpoint, "sealed event is missing")
+		}
+		delete(bySeq, cp.Seq)
+	}
+	return r, nil
+}
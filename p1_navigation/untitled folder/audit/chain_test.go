@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+// fakeStore is a Store in slices, like store/memory
+type fakeStore struct {
+	events []Event
+	cps    []Checkpoint
+}
+
+func (s *fakeStore) Append(ctx context.Context, e *Event) error {
+	var last int64
+	if n := len(s.events); n > 0 {
+		last = s.events[n-1].Seq
+	}
+	if e.Seq != last+1 {
+		return ErrConflict
+	}
+	s.events = append(s.events, *e)
+	return nil
+}
+
+func (s *fakeStore) Query(ctx context.Context, f *Filter) ([]Event, error) {
+	list := []Event{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if f.Matches(&s.events[i]) {
+			list = append(list, s.events[i])
+		}
+	}
+	return list, nil
+}
+
+func (s *fakeStore) Last(ctx context.Context) (*Event, error) {
+	if len(s.events) == 0 {
+		return nil, nil
+	}
+	e := s.events[len(s.events)-1]
+	return &e, nil
+}
+
+func (s *fakeStore) Range(ctx context.Context, after int64, n int) ([]Event, error) {
+	list := []Event{}
+	for _, e := range s.events {
+		if e.Seq > after && len(list) < n {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+func (s *fakeStore) AddCheckpoint(ctx context.Context, cp *Checkpoint) error {
+	s.cps = append(s.cps, *cp)
+	return nil
+}
+
+func (s *fakeStore) Checkpoints(ctx context.Context) ([]Checkpoint, error) {
+	return append([]Checkpoint{}, s.cps...), nil
+}
+
+// rechain rehashes the events from i on as a forger would
+func (s *fakeStore) rechain(i int) {
+	for ; i < len(s.events); i++ {
+		s.events[i].PrevHash = ""
+		if i > 0 {
+			s.events[i].PrevHash = s.events[i-1].Hash
+		}
+		s.events[i].Hash = s.events[i].ComputeHash()
+	}
+}
+
+var testSeed = []byte("0123456789abcdef0123456789abcdef")
+
+// trail returns a store with 6 events, sealed every 2
+func trail(t *testing.T) *fakeStore {
+	s := &fakeStore{}
+	l, err := New(s, []byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SealWith(ed25519.NewKeyFromSeed(testSeed), 2)
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	for _, id := range []string{"1012345672", "2034567897", "", "1012345672", "3012345678", "1012345672"} {
+		if _, err := l.Record(context.Background(), Access{Caller: "his-1", Purpose: "TREAT"}, "get_patient", id, SourceDB, ResultFound, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	pub := ed25519.NewKeyFromSeed(testSeed).Public().(ed25519.PublicKey)
+	otherPub := ed25519.NewKeyFromSeed([]byte("fedcba9876543210fedcba9876543210")).Public().(ed25519.PublicKey)
+
+	type problem struct {
+		seq  int64
+		kind string
+	}
+	tests := []struct {
+		name   string
+		tamper func(s *fakeStore)
+		pub    ed25519.PublicKey
+		want   []problem
+		sealed int64
+	}{
+		{"intact", func(s *fakeStore) {}, pub, nil, 6},
+		{"intact unsigned", func(s *fakeStore) {}, nil, nil, 6},
+		{"edited", func(s *fakeStore) { s.events[2].Result = ResultNotFound }, pub,
+			[]problem{{3, ProblemEdited}}, 6},
+		{"edited and rehashed", func(s *fakeStore) {
+			s.events[2].Result = ResultNotFound
+			s.events[2].Hash = s.events[2].ComputeHash()
+		}, pub, []problem{{4, ProblemUnlinked}}, 6},
+		{"removed", func(s *fakeStore) { s.events = append(s.events[:2], s.events[3:]...) }, pub,
+			[]problem{{4, ProblemGap}}, 6},
+		{"inserted", func(s *fakeStore) {
+			e := s.events[1]
+			e.Seq, e.Caller = 3, "forger"
+			e.Hash = e.ComputeHash()
+			s.events = append(s.events[:2], append([]Event{e}, s.events[2:]...)...)
+		}, pub, []problem{{3, ProblemUnlinked}, {3, ProblemGap}}, 6},
+		{"truncated", func(s *fakeStore) { s.events = s.events[:4] }, pub,
+			[]problem{{6, ProblemTruncated}}, 4},
+		{"rewritten from the start", func(s *fakeStore) {
+			s.events[0].Caller = "forger"
+			s.rechain(0)
+		}, pub, []problem{{2, ProblemCheckpoint}, {4, ProblemCheckpoint}, {6, ProblemCheckpoint}}, 0},
+		{"signed by another key", func(s *fakeStore) {}, otherPub,
+			[]problem{{2, ProblemSignature}, {4, ProblemSignature}, {6, ProblemSignature}}, 0},
+		{"forged checkpoint", func(s *fakeStore) {
+			cp := s.cps[0]
+			cp.Seq = 3
+			s.cps = append(s.cps, cp)
+		}, pub, []problem{{3, ProblemSignature}}, 6},
+	}
+	for _, tt := range tests {
+		s := trail(t)
+		tt.tamper(s)
+		r, err := Verify(context.Background(), s, tt.pub)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []problem
+		for _, p := range r.Problems {
+			got = append(got, problem{p.Seq, p.Kind})
+		}
+		if len(got) != len(tt.want) || r.OK() != (len(tt.want) == 0) || r.Sealed != tt.sealed || r.Signed != (tt.pub != nil) {
+			t.Errorf("%s: got %v sealed %d, want %v sealed %d", tt.name, got, r.Sealed, tt.want, tt.sealed)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRecordCatchesUp(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeStore{}
+	a, _ := New(s, []byte("k"))
+	b, _ := New(s, []byte("k"))
+	for i, l := range []*Log{a, b, a, a, b} {
+		e, err := l.Record(ctx, Access{}, "get_patient", "1012345672", SourceDB, ResultFound, "")
+		if err != nil || e.Seq != int64(i+1) {
+			t.Fatalf("event %d: %+v %v", i+1, e, err)
+		}
+	}
+	if r, err := Verify(ctx, s, nil); err != nil || !r.OK() || r.Events != 5 {
+		t.Fatalf("verify: %+v %v", r, err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeStore{}
+	l, _ := New(s, []byte("k"))
+	if _, err := l.Checkpoint(ctx); err != ErrNoSigner {
+		t.Fatalf("without a signing key: %v", err)
+	}
+	l.SealWith(ed25519.NewKeyFromSeed(testSeed), 0)
+	if _, err := l.Checkpoint(ctx); err != ErrEmpty {
+		t.Fatalf("empty trail: %v", err)
+	}
+	e, _ := l.Record(ctx, Access{}, "get_patient", "1012345672", SourceDB, ResultFound, "")
+	cp, err := l.Checkpoint(ctx)
+	if err != nil || cp.Seq != e.Seq || cp.Hash != e.Hash || !cp.Valid(l.signer.Public().(ed25519.PublicKey)) {
+		t.Fatalf("checkpoint: %+v %v", cp, err)
+	}
+	if len(s.cps) != 1 {
+		t.Fatalf("%d checkpoints, 0 is none sealed every n events", len(s.cps))
+	}
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CEF header of the events
+const (
+	cefVendor  = "Lean"
+	cefProduct = "NHIC"
+	cefVersion = "1"
+)
+
+// Writer writes the events exported to a SIEM
+type Writer interface {
+	Write(e *Event) error
+}
+
+// NewNDJSONWriter writes each event as a json line
+func NewNDJSONWriter(w io.Writer) Writer {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(e *Event) error {
+	return w.enc.Encode(e)
+}
+
+// NewCEFWriter writes each event as a CEF line in one Write of w,
+// a *syslog.Writer sends each as a syslog message
+func NewCEFWriter(w io.Writer) Writer {
+	return &cefWriter{w: w}
+}
+
+type cefWriter struct {
+	w io.Writer
+}
+
+func (w *cefWriter) Write(e *Event) error {
+	_, err := io.WriteString(w.w, CEF(e)+"\n")
+	return err
+}
+
+// CEF returns e in the ArcSight Common Event Format, the signature id is the operation
+//
+//	CEF:0|Lean|NHIC|1|get_patient|get_patient found|3|rt=1609459200000 suser=his-1 outcome=found ...
+func CEF(e *Event) string {
+	severity := 3
+	switch e.Result {
+	case ResultInvalid, ResultError:
+		severity = 5
+	}
+	header := []string{
+		"CEF:0", cefHeader(cefVendor), cefHeader(cefProduct), cefHeader(cefVersion),
+		cefHeader(e.Operation), cefHeader(e.Operation + " " + e.Result), strconv.Itoa(severity),
+	}
+	ext := []struct{ k, v string }{
+		{"rt", strconv.FormatInt(e.Time.UnixNano()/1e6, 10)},
+		{"externalId", strconv.FormatInt(e.Seq, 10)},
+		{"suser", e.Caller},
+		{"outcome", e.Result},
+		{"msg", e.Detail},
+		{"cs1Label", "purposeOfUse"}, {"cs1", e.Purpose},
+		{"cs2Label", "correlationId"}, {"cs2", e.CorrelationID},
+		{"cs3Label", "idHash"}, {"cs3", e.IDHash},
+		{"cs4Label", "source"}, {"cs4", e.Source},
+		{"cs5Label", "hash"}, {"cs5", e.Hash},
+		{"cs6Label", "prevHash"}, {"cs6", e.PrevHash},
+	}
+	pairs := make([]string, 0, len(ext))
+	for _, x := range ext {
+		if x.v != "" {
+			pairs = append(pairs, x.k+"="+cefExtension(x.v))
+		}
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(pairs, " ")
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func cefHeader(s string) string    { return cefHeaderEscaper.Replace(s) }
+func cefExtension(s string) string { return cefExtensionEscaper.Replace(s) }
+
+// Export writes the events of s after the Seq in order, it returns the Seq of the last one written
+// to pass as after next time
+func Export(ctx context.Context, s Store, after int64, w Writer) (int64, error) {
+	for {
+		events, err := s.Range(ctx, after, verifyBatch)
+		if err != nil {
+			return after, err
+		}
+		if len(events) == 0 {
+			return after, nil
+		}
+		for i := range events {
+			if err := w.Write(&events[i]); err != nil {
+				return after, fmt.Errorf("export event %d: %w", events[i].Seq, err)
+			}
+			after = events[i].Seq
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// Admin is what the compliance api needs, the controller implements it
+type Admin interface {
+	Events(ctx context.Context, q *Query) ([]Event, error)
+	Verify(ctx context.Context) (*Report, error)
+	Checkpoint(ctx context.Context) (*Checkpoint, error)
+}
+
+// NewHandler returns the compliance api logging to log, paths are relative to where it's mounted
+//
+//	GET  /events?id=1012345672&caller=&purpose=&operation=&source=&result=&correlation_id=
+//	            &since=2021-01-01T00:00:00Z&until=&count=100&offset=0
+//	GET  /verify       walks the chain, 200 with the report even if it found problems
+//	POST /checkpoints  signs a checkpoint of the head now
+//
+//	mux.Handle("/admin/audit/", http.StripPrefix("/admin/audit", audit.NewHandler(admin, logger)))
+//
+// it's meant for compliance officers, mount it behind the admin auth
+func NewHandler(a Admin, log *logging.Logger) http.Handler {
+	return &handler{a: a, log: log}
+}
+
+type handler struct {
+	a   Admin
+	log *logging.Logger
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+
+	var (
+		v   interface{}
+		err error
+	)
+	switch {
+	case path == "events" && r.Method == http.MethodGet:
+		var q *Query
+		if q, err = parseQuery(r); err == nil {
+			v, err = h.a.Events(r.Context(), q)
+		}
+	case path == "verify" && r.Method == http.MethodGet:
+		v, err = h.a.Verify(r.Context())
+	case path == "checkpoints" && r.Method == http.MethodPost:
+		v, err = h.a.Checkpoint(r.Context())
+	case path == "events" || path == "verify" || path == "checkpoints":
+		h.writeJSON(r.Context(), w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.writeJSON(r.Context(), w, statusOf(err), map[string]string{"error": err.Error()})
+		return
+	}
+	h.writeJSON(r.Context(), w, http.StatusOK, v)
+}
+
+func parseQuery(r *http.Request) (*Query, error) {
+	v := r.URL.Query()
+	q := &Query{
+		ID: v.Get("id"),
+		Filter: Filter{
+			Caller:        v.Get("caller"),
+			Purpose:       v.Get("purpose"),
+			CorrelationID: v.Get("correlation_id"),
+			Operation:     v.Get("operation"),
+			Source:        v.Get("source"),
+			Result:        v.Get("result"),
+		},
+	}
+	var err error
+	for _, t := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if s := v.Get(t.name); s != "" {
+			if *t.dst, err = time.Parse(time.RFC3339, s); err != nil {
+				return nil, ErrBadQuery
+			}
+		}
+	}
+	for _, n := range []struct {
+		name string
+		dst  *int
+	}{{"count", &q.Count}, {"offset", &q.Offset}} {
+		if s := v.Get(n.name); s != "" {
+			if *n.dst, err = strconv.Atoi(s); err != nil || *n.dst < 0 {
+				return nil, ErrBadQuery
+			}
+		}
+	}
+	return q, nil
+}
+
+// statusOf maps the errors of Admin, errors that aren't the package's
+// are already generic e.g. the controller's
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrBadQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrEmpty):
+		return http.StatusConflict
+	case errors.Is(err, ErrNoSigner):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *handler) writeJSON(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warn(ctx, "response not written", logging.Err(err))
+	}
+}
@@ -0,0 +1,174 @@
+// nhic-audit checks and exports the audit trail of the patient and practitioner lookups
+// kept in a SQLite or MSSQL store, -db is a sqlserver:// url for MSSQL
+//
+//	$ go run ./cmd/nhic-audit verify -db file:nhic.db -public-key $AUDIT_PUBLIC_KEY
+//	$ go run ./cmd/nhic-audit verify -db "sqlserver://user:pass@db:1433?database=NHIC" -public-key $AUDIT_PUBLIC_KEY
+//	$ go run ./cmd/nhic-audit export -db file:nhic.db -format ndjson -out audit.ndjson -after 0
+//	$ go run ./cmd/nhic-audit export -db file:nhic.db -syslog udp://siem.local:514 -after 1200
+//
+// verify prints the report as json and exits with 1 if it found problems.
+// export appends the events after the seq and prints the seq of the last one to pass as -after next time,
+// to syslog the events are CEF
+//
+//	$ go run ./cmd/nhic-audit keygen # signing_key for config and the public key verify needs
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"net/url"
+	"os"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/store/mssql"
+	"gitlab.lean/leandevclan/nhic/store/sqlite"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "verify":
+		verify(os.Args[2:])
+	case "export":
+		export(os.Args[2:])
+	case "keygen":
+		keygen()
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: nhic-audit verify|export|keygen [flags]")
+	os.Exit(2)
+}
+
+// trail is the store the audit trail is read from
+type trail interface {
+	Audit() audit.Store
+	Close() error
+}
+
+// open opens the MSSQL db of a sqlserver:// dsn, the SQLite one otherwise
+func open(dsn string) (trail, error) {
+	if strings.HasPrefix(dsn, "sqlserver://") {
+		s, err := mssql.New(dsn, nil)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s, err := sqlite.New(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func verify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dsn := fs.String("db", "file:nhic.db", "SQLite db or sqlserver:// url of the store")
+	pubKey := fs.String("public-key", "", "base64 ed25519 public key of the checkpoints, their signatures aren't checked without it")
+	fs.Parse(args)
+
+	var pub ed25519.PublicKey
+	if *pubKey != "" {
+		var err error
+		if pub, err = audit.ParsePublicKey(*pubKey); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s, err := open(*dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	r, err := audit.Verify(context.Background(), s.Audit(), pub)
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(r)
+	if !r.OK() {
+		s.Close()
+		os.Exit(1)
+	}
+}
+
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dsn := fs.String("db", "file:nhic.db", "SQLite db or sqlserver:// url of the store")
+	format := fs.String("format", "ndjson", "ndjson or cef")
+	out := fs.String("out", "-", "file the events are appended to, - is stdout")
+	sysl := fs.String("syslog", "", "syslog server e.g. udp://siem.local:514, the events are sent as CEF instead of written to -out")
+	after := fs.Int64("after", 0, "seq of the last event exported before")
+	fs.Parse(args)
+
+	var w audit.Writer
+	if *sysl != "" {
+		u, err := url.Parse(*sysl)
+		if err != nil || u.Host == "" {
+			log.Fatal("-syslog is network://host:port")
+		}
+		sw, err := syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_AUTH, "nhic")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sw.Close()
+		w = audit.NewCEFWriter(sw)
+	} else {
+		var f io.Writer = os.Stdout
+		if *out != "-" {
+			file, err := os.OpenFile(*out, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			f = file
+		}
+		switch *format {
+		case "ndjson":
+			w = audit.NewNDJSONWriter(f)
+		case "cef":
+			w = audit.NewCEFWriter(f)
+		default:
+			log.Fatal("-format is ndjson or cef")
+		}
+	}
+
+	s, err := open(*dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	last, err := audit.Export(context.Background(), s.Audit(), *after, w)
+	// the seq reached is printed even on error so the next run doesn't export twice
+	fmt.Fprintln(os.Stderr, "last seq", last)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func keygen() {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("signing_key", base64.StdEncoding.EncodeToString(priv.Seed()))
+	fmt.Println("public_key ", base64.StdEncoding.EncodeToString(pub))
+}
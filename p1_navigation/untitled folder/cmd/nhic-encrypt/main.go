@@ -0,0 +1,127 @@
+// nhic-encrypt manages the key file of the encrypted patient columns and re-encrypts
+// the patients kept in a SQLite or MSSQL store, -db is a sqlserver:// url for MSSQL
+//
+//	$ go run ./cmd/nhic-encrypt rotate -keys keys.json -id 2026-10
+//	$ ENCRYPTION_INDEX_KEY=... go run ./cmd/nhic-encrypt reencrypt -db file:nhic.db -keys keys.json -columns id_number,mobile_number
+//
+// rotate adds a new key to the key file, or creates it, and makes it primary. the service reads the new key
+// on restart, then reencrypt moves the rows to it, the old key is removed from the file after that.
+// reencrypt also encrypts the rows written before a column was encrypted and decrypts the ones no longer in -columns,
+// it prints how many rows it wrote
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/encryption"
+	"gitlab.lean/leandevclan/nhic/store/mssql"
+	"gitlab.lean/leandevclan/nhic/store/sqlite"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "rotate":
+		rotate(os.Args[2:])
+	case "reencrypt":
+		reencrypt(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: nhic-encrypt rotate|reencrypt [flags]")
+	os.Exit(2)
+}
+
+func rotate(args []string) {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	path := fs.String("keys", "keys.json", "key file")
+	id := fs.String("id", "", "id of the new key e.g. the month it's made primary")
+	fs.Parse(args)
+	if *id == "" {
+		log.Fatal("-id is required")
+	}
+
+	k, err := encryption.LoadKeyFile(*path)
+	if os.IsNotExist(err) {
+		k, err = &encryption.KeyFile{}, nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := k.Rotate(*id); err != nil {
+		log.Fatal(err)
+	}
+	if err := k.Save(*path); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(os.Stderr, "primary key", k.Primary())
+}
+
+// encrypted is the store the patients are re-encrypted in
+type encrypted interface {
+	Encrypt(cols *encryption.Columns)
+	Reencrypt(ctx context.Context) (int, error)
+	Close() error
+}
+
+// open opens the MSSQL db of a sqlserver:// dsn, the SQLite one otherwise
+func open(dsn string) (encrypted, error) {
+	if strings.HasPrefix(dsn, "sqlserver://") {
+		s, err := mssql.New(dsn, nil)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s, err := sqlite.New(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func reencrypt(args []string) {
+	fs := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	dsn := fs.String("db", "file:nhic.db", "SQLite db or sqlserver:// url of the store")
+	path := fs.String("keys", "keys.json", "key file")
+	columns := fs.String("columns", "", "encrypted columns, comma separated, the encryption.columns of config")
+	fs.Parse(args)
+
+	k, err := encryption.LoadKeyFile(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var names []string
+	if *columns != "" {
+		names = strings.Split(*columns, ",")
+	}
+	// the blind index key is a secret, it isn't passed as a flag
+	cols, err := encryption.NewColumns(encryption.NewCipher(k), []byte(os.Getenv("ENCRYPTION_INDEX_KEY")), names)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := open(*dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	s.Encrypt(cols)
+
+	n, err := s.Reencrypt(context.Background())
+	// the rows written are printed even on error, running it again goes on from there
+	fmt.Fprintln(os.Stderr, "reencrypted", n)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
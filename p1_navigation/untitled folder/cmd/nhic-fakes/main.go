@@ -0,0 +1,67 @@
+// nhic-fakes serves stand-ins for Yakeen, NIC, SCFHS and the OAuth token endpoint
+// for local development, run it and point STG_GATEWAY_URL and the scfhs url at it
+//
+//	$ go run ./cmd/nhic-fakes -addr :8090 -fixtures httptest/testdata/fixtures.json
+//
+// faults can be injected at runtime
+//
+//	$ curl -X POST localhost:8090/_fakes/fault -d '{"route": "/yakeen/GetCitizenInfo", "fault": {"status": 503}}'
+//	$ curl -X POST localhost:8090/_fakes/fault -d '{"route": "/yakeen/GetCitizenInfo", "fault": {}}' # clear
+//	$ curl -X POST localhost:8090/_fakes/reload # reread the fixtures file
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+
+	"gitlab.lean/leandevclan/nhic/httptest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	path := flag.String("fixtures", "httptest/testdata/fixtures.json", "path of the fixtures file")
+	flag.Parse()
+
+	fx, err := httptest.LoadFixtures(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fakes := httptest.NewHandler(fx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", fakes)
+	mux.HandleFunc("/_fakes/fault", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Route string         `json:"route"`
+			Fault httptest.Fault `json:"fault"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fakes.SetFault(req.Route, req.Fault)
+		log.Printf("fault on %s: %+v", req.Route, req.Fault)
+	})
+	mux.HandleFunc("/_fakes/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fx, err := httptest.LoadFixtures(*path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fakes.SetFixtures(fx)
+		log.Println("fixtures reloaded from", *path)
+	})
+
+	log.Println("nhic-fakes listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,152 @@
+package nhic
+
+// Compat responses of the kinds that aren't citizens or expats,
+// v1 and v2 return the same shape
+
+// CompatNames are the names shared by the shapes below
+type CompatNames struct {
+	FirstNameAr       *string
+	SecondNameAr      *string
+	ThirdNameAr       *string
+	LastNameAr        *string
+	EnglishFirstName  *string
+	EnglishSecondName *string
+	EnglishThirdName  *string
+	EnglishLastName   *string
+	// EnglishNameSource is authoritative or generated, see store.Patient.NameEnSource
+	EnglishNameSource *string
+}
+
+// CompatBorder is returned for visitors and pilgrims looked up by border number
+type CompatBorder struct {
+	HealthID        *string
+	IDType          *string
+	IDNumber        *string
+	PassportNumber  *string
+	DateOfBirth     *string
+	Age             *int
+	Gender          *string
+	Nationality     *string
+	NationalityCode *string
+	CompatNames
+}
+
+// CompatVisitor is returned for visitors looked up by visit visa
+type CompatVisitor struct {
+	HealthID        *string
+	IDType          *string
+	IDNumber        *string
+	PassportNumber  *string
+	BorderNumber    *string
+	DateOfBirth     *string
+	Age             *int
+	Gender          *string
+	Nationality     *string
+	NationalityCode *string
+	CompatNames
+}
+
+// CompatGCC is returned for gcc nationals, IDCountry is the member that issued IDNumber
+type CompatGCC struct {
+	HealthID        *string
+	IDType          *string
+	IDNumber        *string
+	IDCountry       *string
+	DateOfBirth     *string
+	Age             *int
+	Gender          *string
+	Nationality     *string
+	NationalityCode *string
+	CompatNames
+}
+
+// CompatNewborn is returned for newborns, they have no id of their own
+type CompatNewborn struct {
+	HealthID        *string
+	IDType          *string
+	GuardianID      *string
+	BirthOrder      *string
+	DateOfBirth     *string
+	Age             *int
+	Gender          *string
+	Nationality     *string
+	NationalityCode *string
+	CompatNames
+}
+
+// compatVisitor returns the Compat shape of the kinds in this file
+func (c *Controller) compatVisitor(pq *PatientQuery, cp *compat) interface{} {
+	pnt := cp.pnt
+	names := CompatNames{
+		FirstNameAr:       c.SetDefaultValue(pnt.FirstNameAr, nil),
+		SecondNameAr:      c.SetDefaultValue(pnt.SecondNameAr, nil),
+		ThirdNameAr:       c.SetDefaultValue(pnt.ThirdNameAr, nil),
+		LastNameAr:        c.SetDefaultValue(pnt.LastNameAr, nil),
+		EnglishFirstName:  c.SetDefaultValue(pnt.FirstNameEn, nil),
+		EnglishSecondName: c.SetDefaultValue(pnt.SecondNameEn, nil),
+		EnglishThirdName:  c.SetDefaultValue(pnt.ThirdNameEn, nil),
+		EnglishLastName:   c.SetDefaultValue(pnt.LastNameEn, nil),
+		EnglishNameSource: c.SetDefaultValue(pnt.NameEnSource, nil),
+	}
+	healthID := c.SetDefaultValue(pnt.HealthID, nil)
+	idType := c.SetDefaultValue(kindIDType(pq.Kind()), nil)
+	dob := c.SetDefaultValue(dateString(pnt.DateOfBirthG), nil)
+	gender := c.SetDefaultValue(pnt.Gender, nil)
+	nationality := c.SetDefaultValue(pnt.Nationality, nil)
+	nationalityCode := c.SetDefaultValue(pnt.NationalityCode, nil)
+
+	switch pq.Kind() {
+	case KindBorder:
+		return CompatBorder{
+			HealthID:        healthID,
+			IDType:          idType,
+			IDNumber:        cp.id,
+			PassportNumber:  c.SetDefaultValue(pnt.PassportNumber, nil),
+			DateOfBirth:     dob,
+			Age:             cp.age,
+			Gender:          gender,
+			Nationality:     nationality,
+			NationalityCode: nationalityCode,
+			CompatNames:     names,
+		}
+	case KindVisitor:
+		return CompatVisitor{
+			HealthID:        healthID,
+			IDType:          idType,
+			IDNumber:        cp.id,
+			PassportNumber:  c.SetDefaultValue(pnt.PassportNumber, nil),
+			BorderNumber:    c.SetDefaultValue(pnt.BorderNumber, nil),
+			DateOfBirth:     dob,
+			Age:             cp.age,
+			Gender:          gender,
+			Nationality:     nationality,
+			NationalityCode: nationalityCode,
+			CompatNames:     names,
+		}
+	case KindGCC:
+		return CompatGCC{
+			HealthID:        healthID,
+			IDType:          idType,
+			IDNumber:        cp.id,
+			IDCountry:       c.SetDefaultValue(pnt.IDCountry, &pq.Country),
+			DateOfBirth:     dob,
+			Age:             cp.age,
+			Gender:          gender,
+			Nationality:     nationality,
+			NationalityCode: nationalityCode,
+			CompatNames:     names,
+		}
+	}
+	return CompatNewborn{
+		HealthID:        healthID,
+		IDType:          idType,
+		GuardianID:      cp.id,
+		BirthOrder:      c.SetDefaultValue(pnt.BirthOrder, nil),
+		DateOfBirth:     dob,
+		Age:             cp.age,
+		Gender:          gender,
+		Nationality:     nationality,
+		NationalityCode: nationalityCode,
+		CompatNames:     names,
+	}
+}
@@ -0,0 +1,117 @@
+// Package config reads the config of the app from a json file,
+// ${VAR} and $VAR in it are replaced by the env vars, see the Config.json part of the README
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Consumer is an Apigee app, its key and secret get the oauth tokens
+type Consumer struct {
+	Key    string `json:"key"`
+	Secret string `json:"secret"`
+	Name   string `json:"name"`
+}
+
+// GatewayLookups is the contract of the gateway lookups of border numbers, visit visas,
+// gcc nationals and newborns. it isn't published yet so nothing is assumed:
+// a lookup is only served once its path is set
+type GatewayLookups struct {
+	// lookup (border_number, visa, gcc_national, newborn) -> path on the gateway
+	Paths map[string]string `json:"paths"`
+	// errorCode of a 400 when the birth date or the id don't match, other 400s are upstream errors
+	BadDOBCode string `json:"bad_dob_code"`
+	BadIDCode  string `json:"bad_id_code"`
+}
+
+type Config struct {
+	DB struct {
+		Host     string `json:"host"`
+		User     string `json:"user"`
+		Password string `json:"password"`
+		Port     string `json:"port"`
+		Name     string `json:"name"`
+	} `json:"db"`
+
+	Gateway struct {
+		URL     string         `json:"url"`
+		Token   string         `json:"token"`
+		Lookups GatewayLookups `json:"lookups"`
+	} `json:"gateway"`
+
+	Oauth struct {
+		Consumers *[]Consumer `json:"consumer"`
+		DBPath    string      `json:"db_path"`
+	} `json:"oauth"`
+
+	Nic struct {
+		CallerID string `json:"caller_id"`
+	} `json:"nic"`
+
+	Auth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auth"`
+
+	Scfhs struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	} `json:"scfhs"`
+
+	Features []string `json:"features"`
+
+	// identity sources of each endpoint in lookup order, after the db
+	Identity map[string][]string `json:"identity"`
+
+	Logging struct {
+		Level string `json:"level"`
+	} `json:"logging"`
+
+	// max duration of each controller operation as a go duration e.g. "5s"
+	Deadlines map[string]string `json:"deadlines"`
+
+	Audit struct {
+		HashKey         string `json:"hash_key"`
+		SigningKey      string `json:"signing_key"`
+		CheckpointEvery int    `json:"checkpoint_every"`
+	} `json:"audit"`
+
+	Consent struct {
+		Callers  map[string][]string `json:"callers"`
+		Purposes map[string][]string `json:"purposes"`
+	} `json:"consent"`
+
+	// view -> entity -> field -> visible, masked or omitted
+	Projection map[string]map[string]map[string]string `json:"projection"`
+
+	Pseudonym struct {
+		Key       string   `json:"key"`
+		Consumers []string `json:"consumers"`
+		// the principals allowed to re-identify, as the server authenticates them, see pseudonym.Authenticator
+		Reidentifiers []string `json:"reidentifiers"`
+	} `json:"pseudonym"`
+
+	// patient columns encrypted at rest, none without columns
+	Encryption struct {
+		KeyFile  string   `json:"key_file"`
+		IndexKey string   `json:"index_key"`
+		Columns  []string `json:"columns"`
+	} `json:"encryption"`
+}
+
+// New reads the config at path
+func New(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &Config{}
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(b))), conf); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return conf, nil
+}
@@ -0,0 +1,164 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/consent"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+var (
+	ErrPurposeOfUse       = errors.New("purpose of use is missing or unknown")
+	ErrConsentDenied      = errors.New("release denied by the consent policy")
+	ErrConsentUnsupported = errors.New("store doesn't keep consent directives")
+)
+
+// consentStore is implemented by the stores that keep the directives of the patients,
+// store/memory, store/sqlite and store/mssql
+type consentStore interface {
+	Consents() consent.Store
+}
+
+// purposeOf returns the purpose of use the caller of ctx declared, or its default one.
+// a denied purpose is recorded as a decision on the id. without a policy there's no purpose
+func (c *Controller) purposeOf(ctx context.Context, op, id string) (consent.Purpose, error) {
+	if c.consent == nil {
+		return "", nil
+	}
+	a := audit.FromContext(ctx)
+	pur, err := c.consent.Purpose(a.Caller, a.Purpose)
+	switch err {
+	case nil:
+		return pur, nil
+	case consent.ErrDenied:
+		c.recordDecision(ctx, op, id, audit.ResultDenied, "purpose "+a.Purpose+" not allowed")
+		return "", ErrConsentDenied
+	}
+	return "", ErrPurposeOfUse
+}
+
+// release returns the copy of pnt the caller of ctx may see for the purpose, the decision is recorded.
+// ErrConsentDenied if the patient withheld everything from them. without a policy everything is released.
+// the analytics callers get the pseudonyms of the ids, see pseudonyms.go
+func (c *Controller) release(ctx context.Context, op string, pur consent.Purpose, pnt *store.Patient) (*store.Patient, error) {
+	if c.consent == nil {
+		return c.pseudonymize(ctx, pnt)
+	}
+	var dirs []consent.Directive
+	if c.consents != nil && pnt.IDNumber != nil {
+		var err error
+		dirs, err = c.consents.Directives(ctx, *pnt.IDNumber)
+		if cerr := ctxErr(ctx); err != nil && cerr != nil {
+			return nil, cerr
+		} else if err != nil {
+			// without the directives nothing is released
+			c.log.Error(ctx, "release: consent directives lookup failed", logging.Err(err))
+			return nil, ErrLookingUpInfo
+		}
+	}
+
+	var id string
+	if pnt.IDNumber != nil {
+		id = *pnt.IDNumber
+	}
+	dec, err := c.consent.Decide(audit.FromContext(ctx).Caller, pur, dirs)
+	if err != nil {
+		c.recordDecision(ctx, op, id, audit.ResultDenied, dec.String())
+		return nil, ErrConsentDenied
+	}
+	c.recordDecision(ctx, op, id, audit.ResultPermitted, dec.String())
+
+	released := *pnt
+	dec.Apply(&released)
+	return c.pseudonymize(ctx, &released)
+}
+
+// releaseAll is release for the patients of a search, the denied ones are left out
+func (c *Controller) releaseAll(ctx context.Context, op string, pur consent.Purpose, pnts []store.Patient) ([]store.Patient, error) {
+	out := make([]store.Patient, 0, len(pnts))
+	for i := range pnts {
+		p, err := c.release(ctx, op, pur, &pnts[i])
+		if err == ErrConsentDenied {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, nil
+}
+
+// recordDecision appends the consent decision on the id to the audit trail
+func (c *Controller) recordDecision(ctx context.Context, op, id, result, detail string) {
+	if c.audit == nil {
+		return
+	}
+	actx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+
+	if _, aerr := c.audit.Record(actx, audit.FromContext(ctx), op, id, audit.SourceConsent, result, detail); aerr != nil {
+		c.log.Error(ctx, "audit event not recorded", logging.String("operation", op), logging.Err(aerr))
+	}
+}
+
+// ConsentDirectives returns the directives of the patient in the order they were added
+func (c *Controller) ConsentDirectives(ctx context.Context, idNumber string) ([]consent.Directive, error) {
+	if c.consents == nil {
+		return nil, ErrConsentUnsupported
+	}
+
+	dirs, err := c.consents.Directives(ctx, idNumber)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "consent directives: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+	return dirs, nil
+}
+
+// AddConsentDirective keeps the directive of the patient, it applies to the next lookups
+func (c *Controller) AddConsentDirective(ctx context.Context, d *consent.Directive) (*consent.Directive, error) {
+	if c.consents == nil {
+		return nil, ErrConsentUnsupported
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	d.CreatedAt = time.Now().UTC()
+
+	err := c.consents.AddDirective(ctx, d)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		c.log.Error(ctx, "add consent directive: update failed", logging.Err(err))
+		return nil, ErrUpdateInfo
+	}
+	return d, nil
+}
+
+// ConsentAdmin returns the controller as a consent.Admin to mount consent.NewHandler,
+// nil if the store doesn't keep the directives
+func (c *Controller) ConsentAdmin() consent.Admin {
+	if c.consents == nil {
+		return nil
+	}
+	return consentAdmin{c}
+}
+
+type consentAdmin struct {
+	c *Controller
+}
+
+func (a consentAdmin) Directives(ctx context.Context, idNumber string) ([]consent.Directive, error) {
+	return a.c.ConsentDirectives(ctx, idNumber)
+}
+
+func (a consentAdmin) AddDirective(ctx context.Context, d *consent.Directive) (*consent.Directive, error) {
+	return a.c.AddConsentDirective(ctx, d)
+}
@@ -0,0 +1,306 @@
+// Package consent decides which fields of a patient are released to a caller.
+//
+// the caller declares a purpose of use. the Policy says which purposes each caller may declare
+// and which categories of fields (names, contact, ...) each purpose gets. the patient can then
+// withhold categories, or everything, from a purpose or a caller with a Directive. the Decision
+// is applied to the patient before it's returned, the fields withheld are removed
+package consent
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Purpose is why the caller looks a patient up
+type Purpose string
+
+// purposes of use
+const (
+	Treatment    Purpose = "treatment"
+	Payment      Purpose = "payment"
+	PublicHealth Purpose = "public_health"
+	Registration Purpose = "registration"
+)
+
+// Category is a group of fields released together, see fields.go
+type Category string
+
+// categories of the fields of store.Patient
+const (
+	// Identity is the ids and the record keeping fields, without them nothing is released
+	Identity     Category = "identity"
+	Names        Category = "names"
+	Demographics Category = "demographics"
+	// Documents is the id card, passport, visa and border number details
+	Documents Category = "documents"
+	Contact   Category = "contact"
+	// Employment is the occupation and the sponsor
+	Employment Category = "employment"
+)
+
+var (
+	// ErrNoPurpose is a caller without a purpose nor a default one
+	ErrNoPurpose       = errors.New("purpose of use is required")
+	ErrUnknownPurpose  = errors.New("purpose of use is treatment, payment, public_health or registration")
+	ErrUnknownCategory = errors.New("category is identity, names, demographics, documents, contact or employment")
+	// ErrDenied is a purpose the caller may not declare, or a patient who withheld everything from it
+	ErrDenied     = errors.New("release denied by the consent policy")
+	ErrNoIDNumber = errors.New("directive needs the id number of the patient")
+	ErrNoReason   = errors.New("directive needs a reason")
+)
+
+// aliases are the HL7 v3 PurposeOfUse codes of the purposes
+var aliases = map[string]Purpose{"TREAT": Treatment, "HPAYMT": Payment, "PUBHLTH": PublicHealth}
+
+// Categories are all the categories
+var Categories = []Category{Identity, Names, Demographics, Documents, Contact, Employment}
+
+// DefaultPurposes are the categories each purpose gets when config doesn't say
+var DefaultPurposes = map[Purpose][]Category{
+	Treatment:    Categories,
+	Registration: Categories,
+	// the sponsor pays the insurance of the expats, nobody is called about a claim
+	Payment: {Identity, Names, Demographics, Documents, Employment},
+	// contact tracing
+	PublicHealth: {Identity, Names, Demographics, Contact},
+}
+
+// ParsePurpose returns the purpose named s or its HL7 v3 code, "" if s is empty
+func ParsePurpose(s string) (Purpose, error) {
+	s = strings.TrimSpace(s)
+	if p, ok := aliases[strings.ToUpper(s)]; ok {
+		return p, nil
+	}
+	switch p := Purpose(strings.ToLower(s)); p {
+	case "", Treatment, Payment, PublicHealth, Registration:
+		return p, nil
+	}
+	return "", ErrUnknownPurpose
+}
+
+func parseCategory(s string) (Category, error) {
+	c := Category(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range Categories {
+		if c == known {
+			return c, nil
+		}
+	}
+	return "", ErrUnknownCategory
+}
+
+// Directive is a patient withholding categories of their fields. empty Purpose and Caller are any,
+// empty Categories are all of them
+type Directive struct {
+	IDNumber   string       `json:"id_number" db:"IDNumber"`
+	Purpose    Purpose      `json:"purpose,omitempty" db:"Purpose"`
+	Caller     string       `json:"caller,omitempty" db:"Caller"`
+	Categories CategoryList `json:"categories,omitempty" db:"Categories"`
+	Reason     string       `json:"reason" db:"Reason"`
+	CreatedAt  time.Time    `json:"created_at" db:"CreatedAt"`
+}
+
+// applies tells if d is about the caller and the purpose
+func (d *Directive) applies(caller string, p Purpose) bool {
+	return (d.Purpose == "" || d.Purpose == p) && (d.Caller == "" || d.Caller == caller)
+}
+
+// Validate checks d and normalizes its purpose and categories
+func (d *Directive) Validate() error {
+	d.IDNumber = strings.TrimSpace(d.IDNumber)
+	if d.IDNumber == "" {
+		return ErrNoIDNumber
+	}
+	if strings.TrimSpace(d.Reason) == "" {
+		return ErrNoReason
+	}
+	p, err := ParsePurpose(string(d.Purpose))
+	if err != nil {
+		return err
+	}
+	d.Purpose = p
+	for i, c := range d.Categories {
+		if d.Categories[i], err = parseCategory(string(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CategoryList is stored as the comma separated categories
+type CategoryList []Category
+
+func (l CategoryList) Value() (driver.Value, error) {
+	s := make([]string, len(l))
+	for i, c := range l {
+		s[i] = string(c)
+	}
+	return strings.Join(s, ","), nil
+}
+
+func (l *CategoryList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("consent: can't scan %T into CategoryList", src)
+	}
+	*l = nil
+	for _, c := range strings.Split(s, ",") {
+		if c != "" {
+			*l = append(*l, Category(c))
+		}
+	}
+	return nil
+}
+
+// Store keeps the directives of the patients, store/memory and store/sqlite implement it
+type Store interface {
+	// Directives returns the directives of the id number in the order they were added
+	Directives(ctx context.Context, idNumber string) ([]Directive, error)
+	AddDirective(ctx context.Context, d *Directive) error
+}
+
+// Policy is which purposes each caller may declare and which categories each purpose gets
+type Policy struct {
+	// callers that aren't listed use "*", without it they may declare any purpose
+	callers  map[string][]Purpose
+	purposes map[Purpose][]Category
+}
+
+// NewPolicy reads the policy from config: the purposes of each caller, the first one is used
+// when the caller declares none, and the categories of the purposes that don't get the DefaultPurposes
+func NewPolicy(callers map[string][]string, purposes map[string][]string) (*Policy, error) {
+	p := &Policy{callers: make(map[string][]Purpose, len(callers)), purposes: make(map[Purpose][]Category)}
+	for k, v := range DefaultPurposes {
+		p.purposes[k] = v
+	}
+	for caller, names := range callers {
+		for _, n := range names {
+			pur, err := ParsePurpose(n)
+			if err != nil || pur == "" {
+				return nil, fmt.Errorf("consent purposes of %s: %w", caller, ErrUnknownPurpose)
+			}
+			p.callers[caller] = append(p.callers[caller], pur)
+		}
+	}
+	for name, cats := range purposes {
+		pur, err := ParsePurpose(name)
+		if err != nil || pur == "" {
+			return nil, fmt.Errorf("consent categories of %s: %w", name, ErrUnknownPurpose)
+		}
+		list := []Category{}
+		for _, s := range cats {
+			c, err := parseCategory(s)
+			if err != nil {
+				return nil, fmt.Errorf("consent categories of %s: %w", name, err)
+			}
+			list = append(list, c)
+		}
+		p.purposes[pur] = list
+	}
+	return p, nil
+}
+
+// Purpose returns the purpose the caller declared, or its default one if it declared none.
+// ErrDenied if the caller may not declare it
+func (p *Policy) Purpose(caller, declared string) (Purpose, error) {
+	pur, err := ParsePurpose(declared)
+	if err != nil {
+		return "", err
+	}
+	allowed, ok := p.callers[caller]
+	if !ok {
+		allowed, ok = p.callers["*"]
+	}
+	if pur == "" {
+		if len(allowed) == 0 {
+			return "", ErrNoPurpose
+		}
+		return allowed[0], nil
+	}
+	if !ok {
+		return pur, nil
+	}
+	for _, a := range allowed {
+		if a == pur {
+			return pur, nil
+		}
+	}
+	return "", ErrDenied
+}
+
+// Decision is what's released of a patient to the caller for the purpose
+type Decision struct {
+	Caller   string
+	Purpose  Purpose
+	Released []Category
+	// Withheld are the categories the purpose gets but the patient withheld
+	Withheld []Category
+}
+
+// Decide returns what's released of the patient with the directives to the caller for the purpose,
+// ErrDenied if the patient withheld the identity (or everything)
+func (p *Policy) Decide(caller string, pur Purpose, dirs []Directive) (*Decision, error) {
+	withheld := make(map[Category]bool)
+	for _, d := range dirs {
+		if !d.applies(caller, pur) {
+			continue
+		}
+		if len(d.Categories) == 0 {
+			for _, c := range Categories {
+				withheld[c] = true
+			}
+		}
+		for _, c := range d.Categories {
+			withheld[c] = true
+		}
+	}
+
+	dec := &Decision{Caller: caller, Purpose: pur}
+	for _, c := range p.purposes[pur] {
+		if withheld[c] {
+			dec.Withheld = append(dec.Withheld, c)
+		} else {
+			dec.Released = append(dec.Released, c)
+		}
+	}
+	if !dec.releases(Identity) {
+		return dec, ErrDenied
+	}
+	return dec, nil
+}
+
+func (d *Decision) releases(c Category) bool {
+	for _, r := range d.Released {
+		if r == c {
+			return true
+		}
+	}
+	return false
+}
+
+// String is the decision as the audit trail keeps it e.g. "payment released identity,names withheld contact"
+func (d *Decision) String() string {
+	join := func(cats []Category) string {
+		s := make([]string, len(cats))
+		for i, c := range cats {
+			s[i] = string(c)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	out := string(d.Purpose) + " released " + join(d.Released)
+	if len(d.Withheld) > 0 {
+		out += " withheld " + join(d.Withheld)
+	}
+	return out
+}
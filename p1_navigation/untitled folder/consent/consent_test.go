@@ -0,0 +1,261 @@
+package consent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func TestParsePurpose(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Purpose
+		err  error
+	}{
+		{"treatment", Treatment, nil},
+		{" Public_Health ", PublicHealth, nil},
+		{"HPAYMT", Payment, nil},
+		{"treat", Treatment, nil},
+		{"", "", nil},
+		{"fun", "", ErrUnknownPurpose},
+	}
+	for _, tt := range tests {
+		if got, err := ParsePurpose(tt.in); got != tt.want || err != tt.err {
+			t.Errorf("%q: got %q %v, want %q %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Directive
+		err  error
+	}{
+		{"everything from everyone", Directive{IDNumber: " 1000000008 ", Reason: "form"}, nil},
+		{"categories of a purpose", Directive{IDNumber: "1000000008", Purpose: "PUBHLTH", Categories: CategoryList{"Contact"}, Reason: "form"}, nil},
+		{"no id number", Directive{Reason: "form"}, ErrNoIDNumber},
+		{"no reason", Directive{IDNumber: "1000000008", Reason: " "}, ErrNoReason},
+		{"unknown purpose", Directive{IDNumber: "1000000008", Purpose: "fun", Reason: "form"}, ErrUnknownPurpose},
+		{"unknown category", Directive{IDNumber: "1000000008", Categories: CategoryList{"x"}, Reason: "form"}, ErrUnknownCategory},
+	}
+	for _, tt := range tests {
+		if err := tt.d.Validate(); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	d := Directive{IDNumber: " 1000000008", Purpose: "PUBHLTH", Categories: CategoryList{" Contact"}, Reason: "form"}
+	if d.Validate(); d.IDNumber != "1000000008" || d.Purpose != PublicHealth || d.Categories[0] != Contact {
+		t.Errorf("not normalized %+v", d)
+	}
+}
+
+func TestCategoryList(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want CategoryList
+	}{
+		{"string", "names,contact", CategoryList{Names, Contact}},
+		{"bytes", []byte("contact"), CategoryList{Contact}},
+		{"empty", "", nil},
+		{"null", nil, nil},
+	}
+	for _, tt := range tests {
+		var l CategoryList
+		if err := l.Scan(tt.src); err != nil || !reflect.DeepEqual(l, tt.want) {
+			t.Errorf("%s: got %v %v, want %v", tt.name, l, err, tt.want)
+		}
+	}
+	var l CategoryList
+	if err := l.Scan(1); err == nil {
+		t.Error("scanned an int")
+	}
+	if v, _ := (CategoryList{Names, Contact}).Value(); v != "names,contact" {
+		t.Errorf("value %v", v)
+	}
+}
+
+func TestPolicyPurpose(t *testing.T) {
+	p, err := NewPolicy(map[string][]string{"his": {"treatment", "payment"}, "ins": {"HPAYMT"}, "*": {"registration"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, _ := NewPolicy(nil, nil)
+
+	tests := []struct {
+		name     string
+		p        *Policy
+		caller   string
+		declared string
+		want     Purpose
+		err      error
+	}{
+		{"declared", p, "his", "payment", Payment, nil},
+		{"default of the caller", p, "ins", "", Payment, nil},
+		{"not allowed", p, "ins", "treatment", "", ErrDenied},
+		{"unknown caller uses *", p, "lab", "", Registration, nil},
+		{"unknown caller not allowed", p, "lab", "treatment", "", ErrDenied},
+		{"unknown purpose", p, "his", "fun", "", ErrUnknownPurpose},
+		{"no callers, any purpose", open, "his", "TREAT", Treatment, nil},
+		{"no callers, no default", open, "his", "", "", ErrNoPurpose},
+	}
+	for _, tt := range tests {
+		if got, err := tt.p.Purpose(tt.caller, tt.declared); got != tt.want || err != tt.err {
+			t.Errorf("%s: got %q %v, want %q %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		callers  map[string][]string
+		purposes map[string][]string
+		err      error
+	}{
+		{"defaults", nil, nil, nil},
+		{"categories of a purpose", nil, map[string][]string{"payment": {"identity", "names"}}, nil},
+		{"unknown purpose of a caller", map[string][]string{"his": {"fun"}}, nil, ErrUnknownPurpose},
+		{"empty purpose of a caller", map[string][]string{"his": {""}}, nil, ErrUnknownPurpose},
+		{"unknown purpose", nil, map[string][]string{"fun": {"names"}}, ErrUnknownPurpose},
+		{"unknown category", nil, map[string][]string{"payment": {"x"}}, ErrUnknownCategory},
+	}
+	for _, tt := range tests {
+		if _, err := NewPolicy(tt.callers, tt.purposes); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	p, err := NewPolicy(nil, map[string][]string{"registration": {"identity", "names"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		caller  string
+		purpose Purpose
+		dirs    []Directive
+		want    string
+		err     error
+	}{
+		{"no directives", "his", Payment, nil, "payment released demographics,documents,employment,identity,names", nil},
+		{"purpose from config", "his", Registration, nil, "registration released identity,names", nil},
+		{"contact withheld from public health", "moh", PublicHealth, []Directive{{Purpose: PublicHealth, Categories: CategoryList{Contact}}},
+			"public_health released demographics,identity,names withheld contact", nil},
+		{"directive of another purpose", "moh", PublicHealth, []Directive{{Purpose: Payment, Categories: CategoryList{Names}}},
+			"public_health released contact,demographics,identity,names", nil},
+		{"directive of another caller", "his", Treatment, []Directive{{Caller: "ins"}},
+			"treatment released contact,demographics,documents,employment,identity,names", nil},
+		{"everything withheld from the caller", "ins", Payment, []Directive{{Caller: "ins"}},
+			"payment released  withheld demographics,documents,employment,identity,names", ErrDenied},
+	}
+	for _, tt := range tests {
+		d, err := p.Decide(tt.caller, tt.purpose, tt.dirs)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if d.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, d.String(), tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	// every field has a category, or it's never released, but the ones kept by the stores
+	pt := reflect.TypeOf(store.Patient{})
+	for i := 0; i < pt.NumField(); i++ {
+		if pt.Field(i).Tag.Get("json") != "-" && CategoryOf(pt.Field(i).Name) == "" {
+			t.Errorf("%s has no category", pt.Field(i).Name)
+		}
+	}
+
+	p := &store.Patient{IDNumber: sp("1000000008"), FirstNameAr: sp("محمد"), Gender: sp("ذكر"),
+		PassportNumber: sp("A1234567"), MobileNumber: sp("0500000000"), SponsorNumber: sp("7000000001")}
+	(&Decision{Released: []Category{Identity, Names, Employment}}).Apply(p)
+
+	tests := []struct {
+		name     string
+		field    *string
+		released bool
+	}{
+		{"identity", p.IDNumber, true},
+		{"names", p.FirstNameAr, true},
+		{"employment", p.SponsorNumber, true},
+		{"demographics", p.Gender, false},
+		{"documents", p.PassportNumber, false},
+		{"contact", p.MobileNumber, false},
+	}
+	for _, tt := range tests {
+		if (tt.field != nil) != tt.released {
+			t.Errorf("%s: got %v, want released %v", tt.name, tt.field, tt.released)
+		}
+	}
+}
+
+// fakeAdmin keeps the directives added
+type fakeAdmin struct {
+	dirs []Directive
+}
+
+func (f *fakeAdmin) Directives(ctx context.Context, idNumber string) ([]Directive, error) {
+	var out []Directive
+	for _, d := range f.dirs {
+		if d.IDNumber == idNumber {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeAdmin) AddDirective(ctx context.Context, d *Directive) (*Directive, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	f.dirs = append(f.dirs, *d)
+	return d, nil
+}
+
+func TestHandler(t *testing.T) {
+	a := &fakeAdmin{}
+	h := NewHandler(a, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"add", http.MethodPost, "/patients/1000000008/directives", `{"purpose":"HPAYMT","categories":["contact"],"reason":"form"}`, http.StatusOK},
+		{"list", http.MethodGet, "/patients/1000000008/directives", "", http.StatusOK},
+		{"unknown category", http.MethodPost, "/patients/1000000008/directives", `{"categories":["x"],"reason":"form"}`, http.StatusBadRequest},
+		{"no reason", http.MethodPost, "/patients/1000000008/directives", `{}`, http.StatusBadRequest},
+		{"malformed body", http.MethodPost, "/patients/1000000008/directives", `{`, http.StatusBadRequest},
+		{"delete", http.MethodDelete, "/patients/1000000008/directives", "", http.StatusMethodNotAllowed},
+		{"unknown path", http.MethodGet, "/patients/1000000008", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.code {
+			t.Errorf("%s: got %d, want %d: %s", tt.name, rec.Code, tt.code, rec.Body.String())
+		}
+	}
+	if len(a.dirs) != 1 || a.dirs[0].IDNumber != "1000000008" || a.dirs[0].Purpose != Payment {
+		t.Errorf("directives %+v", a.dirs)
+	}
+}
@@ -0,0 +1,52 @@
+package consent
+
+import (
+	"reflect"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// fields are the categories of the fields of store.Patient by field name.
+// a field that isn't here is never released, give the new fields a category
+var fields = map[string]Category{
+	"LogId": Identity, "ErrorMsg": Identity, "Msg": Identity, "ReservedHealthID": Identity, "HealthID": Identity,
+	"SearchID": Identity, "ClientIdentifierId": Identity, "IDType": Identity, "IDNumber": Identity,
+	"TransactionID": Identity, "PatientStatus": Identity,
+
+	"FirstNameAr": Names, "SecondNameAr": Names, "ThirdNameAr": Names, "LastNameAr": Names, "SubtribeName": Names,
+	"FirstNameEn": Names, "SecondNameEn": Names, "ThirdNameEn": Names, "LastNameEn": Names, "NameEnSource": Names,
+	"FullNameAr": Names, "FullNameEn": Names,
+
+	"DateG": Demographics, "DateH": Demographics, "DateOfBirthG": Demographics, "DateOfBirthH": Demographics,
+	"Age": Demographics, "Gender": Demographics, "GenderSpecified": Demographics, "Nationality": Demographics,
+	"NationalityCode": Demographics, "PlaceOfBirth": Demographics, "MaritalStatus": Demographics,
+	"MaritalStatusCode": Demographics, "IsDead": Demographics, "BloodType": Demographics,
+
+	"IDExpiryDate": Documents, "IDIssueDate": Documents, "IDIssuePlace": Documents, "PassportNumber": Documents,
+	"BorderNumber": Documents, "VisaNumber": Documents, "IDCountry": Documents, "GuardianID": Documents,
+	"BirthOrder": Documents, "HifizaIssueDate": Documents, "HifizaNumber": Documents,
+
+	"MobileNumber": Contact, "PhoneNumber": Contact, "EmailAddress": Contact,
+
+	"Occupation": Employment, "OccupationCode": Employment, "SponsorNumber": Employment,
+}
+
+// CategoryOf returns the category of the store.Patient field, "" if it has none
+func CategoryOf(field string) Category {
+	return fields[field]
+}
+
+// Apply removes the fields of p the decision doesn't release
+func (d *Decision) Apply(p *store.Patient) {
+	released := make(map[Category]bool, len(d.Released))
+	for _, c := range d.Released {
+		released[c] = true
+	}
+	v := reflect.ValueOf(p).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !released[fields[t.Field(i).Name]] {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package consent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// Admin is what the directives api needs, the controller implements it
+type Admin interface {
+	Directives(ctx context.Context, idNumber string) ([]Directive, error)
+	AddDirective(ctx context.Context, d *Directive) (*Directive, error)
+}
+
+// NewHandler returns the directives api logging to log, paths are relative to where it's mounted
+//
+//	GET  /patients/{id}/directives
+//	POST /patients/{id}/directives  {"purpose": "payment", "categories": ["contact"], "reason": "signed opt-out form 2021-03"}
+//
+//	mux.Handle("/admin/consent/", http.StripPrefix("/admin/consent", consent.NewHandler(admin, logger)))
+//
+// it's meant for the registration staff, mount it behind the admin auth
+func NewHandler(a Admin, log *logging.Logger) http.Handler {
+	return &handler{a: a, log: log}
+}
+
+type handler struct {
+	a   Admin
+	log *logging.Logger
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "patients" || parts[2] != "directives" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		v   interface{}
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		v, err = h.a.Directives(r.Context(), parts[1])
+	case http.MethodPost:
+		var d Directive
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			h.writeJSON(r.Context(), w, http.StatusBadRequest, map[string]string{"error": "malformed body"})
+			return
+		}
+		d.IDNumber = parts[1]
+		v, err = h.a.AddDirective(r.Context(), &d)
+	default:
+		h.writeJSON(r.Context(), w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+	if err != nil {
+		h.writeJSON(r.Context(), w, statusOf(err), map[string]string{"error": err.Error()})
+		return
+	}
+	h.writeJSON(r.Context(), w, http.StatusOK, v)
+}
+
+// statusOf maps the errors of Admin, errors that aren't the package's
+// are already generic e.g. the controller's
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownPurpose), errors.Is(err, ErrUnknownCategory),
+		errors.Is(err, ErrNoIDNumber), errors.Is(err, ErrNoReason):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *handler) writeJSON(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warn(ctx, "response not written", logging.Err(err))
+	}
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/hijri"
+)
+
+// DateLayout is how a Date is written to json and a hijri one to the db, the layout Yakeen uses
+const DateLayout = "02-01-2006"
+
+// ISODateLayout is how a gregorian Date is written to the db, sql date columns
+// read it the same whatever the language of the login, unlike dd-mm-yyyy
+const ISODateLayout = "2006-01-02"
+
+var ErrBadDate = errors.New("malformed date")
+
+// Calendar a Date is written in
+type Calendar uint8
+
+const (
+	Gregorian Calendar = iota + 1
+	Hijri
+)
+
+func (c Calendar) String() string {
+	switch c {
+	case Gregorian:
+		return "gregorian"
+	case Hijri:
+		return "hijri"
+	}
+	return "unknown"
+}
+
+// Date is a day tagged with the calendar it's written in.
+// the calendar is told by the year when parsing, hijri years are below 1700.
+//
+// it reads the layouts we get from upstreams and the db: 02-01-2006, 2006-01-02,
+// 2006-01-02T15:04:05 and the same with slashes, sql date columns are read as gregorian.
+// it's written as dd-mm-yyyy, but for gregorian dates in the db, see Value.
+// an empty string or NULL is the zero Date.
+// hijri dates out of the umm al-qura table e.g. births before 1356 are kept as written,
+// only converting them to gregorian fails
+type Date struct {
+	Calendar Calendar
+	Year     int
+	Month    int
+	Day      int
+}
+
+// NewDate returns the Date if it exists in the calendar
+func NewDate(cal Calendar, year, month, day int) (Date, error) {
+	d := Date{Calendar: cal, Year: year, Month: month, Day: day}
+	return d, d.Validate()
+}
+
+// DateOf returns the gregorian day of t, in t's location
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{Calendar: Gregorian, Year: y, Month: int(m), Day: d}
+}
+
+// ParseDate reads s in any of the layouts Date accepts
+func ParseDate(s string) (Date, error) {
+	y, m, d, err := hijri.Split(s)
+	if err != nil {
+		return Date{}, fmt.Errorf("%w %q", ErrBadDate, s)
+	}
+	cal := Gregorian
+	if hijri.IsHijriYear(y) {
+		cal = Hijri
+	}
+	date, err := NewDate(cal, y, m, d)
+	if err != nil {
+		return Date{}, fmt.Errorf("%w %q: %v", ErrBadDate, s, err)
+	}
+	return date, nil
+}
+
+// ParseDatePtr is ParseDate for the optional dates we get from upstreams,
+// nil or empty strings return nil
+func ParseDatePtr(s *string) (*Date, error) {
+	if s == nil || *s == "" {
+		return nil, nil
+	}
+	d, err := ParseDate(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// Validate returns an error if the day doesn't exist in d's calendar,
+// out of the umm al-qura table a hijri day only needs a month of 1-12 and a day of 1-30
+func (d Date) Validate() error {
+	switch d.Calendar {
+	case Hijri:
+		_, err := hijri.New(d.Year, d.Month, d.Day)
+		if err == hijri.ErrOutOfRange && d.Year > 0 {
+			if d.Month < 1 || d.Month > 12 || d.Day < 1 || d.Day > 30 {
+				return hijri.ErrInvalid
+			}
+			return nil
+		}
+		return err
+	case Gregorian:
+		t := time.Date(d.Year, time.Month(d.Month), d.Day, 0, 0, 0, 0, time.UTC)
+		// time.Date normalizes e.g. 31-02 to 03-03
+		if t.Year() != d.Year || int(t.Month()) != d.Month || t.Day() != d.Day {
+			return hijri.ErrInvalid
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown calendar %d", d.Calendar)
+}
+
+// Time returns the gregorian day of d at 00:00 UTC
+func (d Date) Time() (time.Time, error) {
+	switch d.Calendar {
+	case Hijri:
+		return hijri.Date{Year: d.Year, Month: d.Month, Day: d.Day}.Time()
+	case Gregorian:
+		return time.Date(d.Year, time.Month(d.Month), d.Day, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown calendar %d", d.Calendar)
+}
+
+// Gregorian returns d in the gregorian calendar
+func (d Date) Gregorian() (Date, error) {
+	if d.Calendar == Gregorian {
+		return d, nil
+	}
+	t, err := d.Time()
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(t), nil
+}
+
+// Hijri returns d in the hijri calendar,
+// it fails for gregorian days outside the umm al-qura table
+func (d Date) Hijri() (Date, error) {
+	if d.Calendar == Hijri {
+		return d, nil
+	}
+	t, err := d.Time()
+	if err != nil {
+		return Date{}, err
+	}
+	h, err := hijri.FromTime(t)
+	if err != nil {
+		return Date{}, err
+	}
+	return Date{Calendar: Hijri, Year: h.Year, Month: h.Month, Day: h.Day}, nil
+}
+
+// String formats d as dd-mm-yyyy in its own calendar, the zero Date is ""
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%02d-%02d-%04d", d.Day, d.Month, d.Year)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == nil || *s == "" {
+		*d = Date{}
+		return nil
+	}
+	v, err := ParseDate(*s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Value writes a gregorian d as yyyy-mm-dd for the date columns and a hijri one
+// as dd-mm-yyyy for the string columns, the zero Date as NULL
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	if d.Calendar == Gregorian {
+		return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day), nil
+	}
+	return d.String(), nil
+}
+
+// Scan reads a date column, or a string one in any of the layouts Date accepts
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = DateOf(v)
+		return nil
+	case []byte:
+		return d.scanString(string(v))
+	case string:
+		return d.scanString(v)
+	}
+	return fmt.Errorf("can't scan %T into a Date", src)
+}
+
+func (d *Date) scanString(s string) error {
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+	v, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
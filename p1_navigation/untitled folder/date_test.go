@@ -0,0 +1,121 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Date
+		err  bool
+	}{
+		{"15-07-1405", Date{Hijri, 1405, 7, 15}, false},
+		{"1405/07/15", Date{Hijri, 1405, 7, 15}, false},
+		{"1985-04-06", Date{Gregorian, 1985, 4, 6}, false},
+		{"1963-07-21T00:00:00", Date{Gregorian, 1963, 7, 21}, false},
+		// out of the umm al-qura table, kept as written
+		{"12-03-1340", Date{Hijri, 1340, 3, 12}, false},
+		{"30-12-1320", Date{Hijri, 1320, 12, 30}, false},
+		{"31-03-1340", Date{}, true},
+		{"12-13-1340", Date{}, true},
+		{"30-01-1445", Date{}, true},
+		{"31-02-1990", Date{}, true},
+		{"1990-02", Date{}, true},
+		{"", Date{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%q: got %+v %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestDateConversions(t *testing.T) {
+	tests := []struct {
+		in        string
+		gregorian string
+		hijri     string
+	}{
+		{"15-07-1405", "06-04-1985", "15-07-1405"},
+		{"06-04-1985", "06-04-1985", "15-07-1405"},
+		{"12-03-1340", "", "12-03-1340"},
+		{"01-01-1920", "01-01-1920", ""},
+	}
+	for _, tt := range tests {
+		d, err := ParseDate(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+		g, err := d.Gregorian()
+		if (err != nil) != (tt.gregorian == "") || g.String() != tt.gregorian {
+			t.Errorf("%s to gregorian: got %s %v", tt.in, g, err)
+		}
+		h, err := d.Hijri()
+		if (err != nil) != (tt.hijri == "") || h.String() != tt.hijri {
+			t.Errorf("%s to hijri: got %s %v", tt.in, h, err)
+		}
+	}
+}
+
+func TestDateJSONAndScan(t *testing.T) {
+	var v struct {
+		Birth  *Date `json:"birth"`
+		Expiry *Date `json:"expiry"`
+	}
+	if err := json.Unmarshal([]byte(`{"birth":"1340-03-12","expiry":""}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Birth.String() != "12-03-1340" || v.Birth.Calendar != Hijri || !v.Expiry.IsZero() {
+		t.Errorf("got %+v %+v", v.Birth, v.Expiry)
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) != `{"birth":"12-03-1340","expiry":null}` {
+		t.Errorf("got %s %v", b, err)
+	}
+
+	var d Date
+	for _, src := range []interface{}{"12-03-1340", []byte("12-03-1340")} {
+		if err := d.Scan(src); err != nil || d != (Date{Hijri, 1340, 3, 12}) {
+			t.Errorf("scan %v: got %+v %v", src, d, err)
+		}
+	}
+	if err := d.Scan(time.Date(1985, 4, 6, 0, 0, 0, 0, time.UTC)); err != nil || d != (Date{Gregorian, 1985, 4, 6}) {
+		t.Errorf("scan time: got %+v %v", d, err)
+	}
+	if err := d.Scan(nil); err != nil || !d.IsZero() {
+		t.Errorf("scan nil: got %+v %v", d, err)
+	}
+	if err := d.Scan("31-02-1990"); err == nil {
+		t.Error("scan 31-02-1990: no error")
+	}
+}
+
+func TestDateValue(t *testing.T) {
+	tests := []struct {
+		in   Date
+		want interface{}
+	}{
+		{Date{Gregorian, 1985, 4, 6}, "1985-04-06"},
+		{Date{Gregorian, 2030, 12, 31}, "2030-12-31"},
+		{Date{Hijri, 1405, 7, 15}, "15-07-1405"},
+		{Date{}, nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.in.Value()
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: got %v %v, want %v", tt.in, got, err, tt.want)
+			continue
+		}
+		if got == nil {
+			continue
+		}
+		var back Date
+		if err := back.Scan(got); err != nil || back != tt.in {
+			t.Errorf("%+v: scanned back %+v %v", tt.in, back, err)
+		}
+	}
+}
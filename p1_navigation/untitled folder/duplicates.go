@@ -0,0 +1,380 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/match"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+var ErrDuplicatesUnsupported = errors.New("store doesn't keep a duplicates review queue")
+
+// duplicateStore is implemented by the stores that keep the review queue
+// of the duplicate patients, store/memory, store/sqlite and store/mssql
+type duplicateStore interface {
+	Duplicates() match.Store
+}
+
+// patientLister is implemented by the stores small enough to be scanned whole,
+// store/memory and store/sqlite
+type patientLister interface {
+	ListPatients(ctx context.Context) (*[]store.Patient, error)
+}
+
+// patientScanner is implemented by the stores too big to list their patients in memory, store/mssql.
+// the duplicates scan reads them one at a time for their blocking keys, then the patients of each block
+type patientScanner interface {
+	ScanPatients(ctx context.Context, fn func(pnt *store.Patient) error) error
+	GetPatientsByID(ctx context.Context, ids []string) (*[]store.Patient, error)
+}
+
+// blockingKeys returns the blocking keys of all the stored patients and a func reading the patients
+// of a group of match.Blocks, ok is false if the store can't be scanned
+func (c *Controller) blockingKeys(ctx context.Context) (keys []match.Keys, read func(group []int) ([]*store.Patient, error), ok bool, err error) {
+	if l, ok := c.store.(patientLister); ok {
+		pnts, err := l.ListPatients(ctx)
+		if err != nil {
+			return nil, nil, true, err
+		}
+		keys = make([]match.Keys, len(*pnts))
+		for i := range *pnts {
+			keys[i] = match.KeysOf(&(*pnts)[i])
+		}
+		return keys, func(group []int) ([]*store.Patient, error) {
+			list := make([]*store.Patient, len(group))
+			for n, i := range group {
+				list[n] = &(*pnts)[i]
+			}
+			return list, nil
+		}, true, nil
+	}
+
+	sc, ok := c.store.(patientScanner)
+	if !ok {
+		return nil, nil, false, nil
+	}
+	err = sc.ScanPatients(ctx, func(pnt *store.Patient) error {
+		keys = append(keys, match.KeysOf(pnt))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, true, err
+	}
+	return keys, func(group []int) ([]*store.Patient, error) {
+		ids := make([]string, 0, len(group))
+		for _, i := range group {
+			if keys[i].IDNumber != "" {
+				ids = append(ids, keys[i].IDNumber)
+			}
+		}
+		pnts, err := sc.GetPatientsByID(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string]*store.Patient, len(*pnts))
+		for i := range *pnts {
+			byID[str((*pnts)[i].IDNumber)] = &(*pnts)[i]
+		}
+		// a patient removed since the scan is nil
+		list := make([]*store.Patient, len(group))
+		for n, i := range group {
+			list[n] = byID[keys[i].IDNumber]
+		}
+		return list, nil
+	}, true, nil
+}
+
+// FindDuplicates scores the pairs of stored patients that share a blocking key
+// and queues the ones that may be the same person for review
+func (c *Controller) FindDuplicates(ctx context.Context) (*match.ScanResult, error) {
+	if c.duplicates == nil {
+		return nil, ErrDuplicatesUnsupported
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opFindDuplicates)
+	defer cancel()
+
+	keys, read, ok, err := c.blockingKeys(ctx)
+	if !ok {
+		return nil, ErrDuplicatesUnsupported
+	}
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "find duplicates: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+
+	res := &match.ScanResult{Patients: len(keys)}
+	now := time.Now()
+	seen := map[[2]string]bool{}
+	for _, group := range match.Blocks(keys) {
+		pnts, err := read(group)
+		if cerr := ctxErr(ctx); err != nil && cerr != nil {
+			return nil, cerr
+		} else if err != nil {
+			c.log.Error(ctx, "find duplicates: lookup failed", logging.Err(err))
+			return nil, ErrLookingUpInfo
+		}
+		for i := 0; i < len(pnts); i++ {
+			for j := i + 1; j < len(pnts); j++ {
+				a, b := pnts[i], pnts[j]
+				if a == nil || b == nil || str(a.IDNumber) == "" || str(b.IDNumber) == "" {
+					continue
+				}
+				pair := [2]string{*a.IDNumber, *b.IDNumber}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				if seen[pair] {
+					continue
+				}
+				seen[pair] = true
+				res.Pairs++
+				queued, err := c.queueDuplicate(ctx, a, b, now)
+				if err != nil {
+					return nil, err
+				}
+				if queued {
+					res.Queued++
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// queueDuplicate scores the pair and queues it for review if they may be the same person
+func (c *Controller) queueDuplicate(ctx context.Context, a, b *store.Patient, now time.Time) (bool, error) {
+	s := c.matcher.Score(a, b)
+	if s.Class == match.Unlikely {
+		return false, nil
+	}
+	queued, err := c.duplicates.Put(ctx, match.NewCandidate(*a.IDNumber, *b.IDNumber, s, now))
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return false, cerr
+	} else if err != nil {
+		c.log.Error(ctx, "find duplicates: update failed", logging.Err(err))
+		return false, ErrUpdateInfo
+	}
+	return queued, nil
+}
+
+// ListDuplicates returns the candidates of the review queue with the status, all of them if it's empty
+func (c *Controller) ListDuplicates(ctx context.Context, status match.Status) ([]match.Candidate, error) {
+	if c.duplicates == nil {
+		return nil, ErrDuplicatesUnsupported
+	}
+	list, err := c.duplicates.List(ctx, status)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		c.log.Error(ctx, "list duplicates: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+	return list, nil
+}
+
+// GetDuplicate returns the candidate of the review queue
+func (c *Controller) GetDuplicate(ctx context.Context, id string) (*match.Candidate, error) {
+	if c.duplicates == nil {
+		return nil, ErrDuplicatesUnsupported
+	}
+	cand, err := c.duplicates.Get(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err != match.ErrNotFound {
+		c.log.Error(ctx, "get duplicate: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+	return cand, err
+}
+
+// ResolveDuplicate applies the decision of the reviewer on the candidate:
+//
+//	link     the other record gets the health id of the survivor and keeps its id number,
+//	         e.g. the iqama record of a naturalized citizen
+//	merge    the fields the survivor is missing are copied from the other record which is removed,
+//	         e.g. a record added with a typo. a later lookup of its id number returns the survivor
+//	dismiss  they're different people
+//
+// the health id of the other record is released in both cases
+func (c *Controller) ResolveDuplicate(ctx context.Context, id string, r *match.Resolution) (*match.Candidate, error) {
+	cand, err := c.GetDuplicate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Validate(cand); err != nil {
+		return nil, err
+	}
+
+	cand.Reason = r.Reason
+	cand.UpdatedAt = time.Now()
+	switch r.Action {
+	case match.ActionDismiss:
+		cand.Status = match.Dismissed
+	case match.ActionLink:
+		cand.Status, cand.Survivor = match.Linked, r.Survivor
+		err = c.linkPatients(ctx, r.Survivor, cand.Other(r.Survivor), r.Reason, false)
+	case match.ActionMerge:
+		cand.Status, cand.Survivor = match.Merged, r.Survivor
+		err = c.linkPatients(ctx, r.Survivor, cand.Other(r.Survivor), r.Reason, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.duplicates.Resolve(ctx, cand)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err != match.ErrState && err != match.ErrNotFound {
+		c.log.Error(ctx, "resolve duplicate: update failed", logging.Err(err))
+		return nil, ErrUpdateInfo
+	} else if err != nil {
+		return nil, err
+	}
+	return cand, nil
+}
+
+// linkPatients gives the other record the health id of the survivor, or folds it into the survivor
+// if merge, and releases the health id it had
+func (c *Controller) linkPatients(ctx context.Context, survivorID, otherID, reason string, merge bool) error {
+	merger, canMerge := c.store.(patientMerger)
+	if merge && !canMerge {
+		return ErrDuplicatesUnsupported
+	}
+
+	survivor, err := c.store.GetPatientByID(ctx, survivorID)
+	if err == nil {
+		var other *store.Patient
+		other, err = c.store.GetPatientByID(ctx, otherID)
+		if err == nil {
+			err = c.relink(ctx, merger, survivor, other, reason, merge)
+		}
+	}
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return cerr
+	} else if err == store.ErrNotFound {
+		return match.ErrGone
+	} else if err != nil && err != match.ErrNoHealthID {
+		c.log.Error(ctx, "link patients: update failed", logging.Err(err))
+		return ErrUpdateInfo
+	}
+	return err
+}
+
+func (c *Controller) relink(ctx context.Context, merger patientMerger, survivor, other *store.Patient, reason string, merge bool) error {
+	healthID := str(survivor.HealthID)
+	if healthID == "" {
+		return match.ErrNoHealthID
+	}
+	otherHealthID := str(other.HealthID)
+
+	if merge {
+		if patch := absorb(survivor, other); patch != nil {
+			if err := c.store.UpdatesPatient(ctx, patch); err != nil {
+				return err
+			}
+		}
+		if err := merger.MergePatient(ctx, *other.IDNumber, healthID); err != nil {
+			return err
+		}
+	} else if otherHealthID != healthID {
+		if err := c.store.UpdatesPatient(ctx, &store.Patient{IDNumber: other.IDNumber, HealthID: &healthID}); err != nil {
+			return err
+		}
+	}
+
+	if c.healthIDs == nil || otherHealthID == "" || otherHealthID == healthID {
+		return nil
+	}
+	_, err := c.healthIDs.Release(ctx, otherHealthID, "duplicate of "+healthID+": "+reason)
+	switch err {
+	case nil, healthid.ErrState, healthid.ErrNotFound, healthid.ErrMalformed, healthid.ErrChecksum:
+		// already released, or issued before the allocator
+		return nil
+	}
+	return err
+}
+
+// absorb returns the update giving the survivor the fields it's missing from other, nil if there's none.
+// the id numbers and health ids aren't copied
+func absorb(survivor, other *store.Patient) *store.Patient {
+	patch := &store.Patient{IDNumber: survivor.IDNumber}
+	changed := false
+	fill := func(dst **string, have, from *string) {
+		if strings.TrimSpace(str(have)) == "" && strings.TrimSpace(str(from)) != "" {
+			*dst = from
+			changed = true
+		}
+	}
+	fill(&patch.FirstNameAr, survivor.FirstNameAr, other.FirstNameAr)
+	fill(&patch.SecondNameAr, survivor.SecondNameAr, other.SecondNameAr)
+	fill(&patch.ThirdNameAr, survivor.ThirdNameAr, other.ThirdNameAr)
+	fill(&patch.LastNameAr, survivor.LastNameAr, other.LastNameAr)
+	fill(&patch.FirstNameEn, survivor.FirstNameEn, other.FirstNameEn)
+	fill(&patch.SecondNameEn, survivor.SecondNameEn, other.SecondNameEn)
+	fill(&patch.ThirdNameEn, survivor.ThirdNameEn, other.ThirdNameEn)
+	fill(&patch.LastNameEn, survivor.LastNameEn, other.LastNameEn)
+	fill(&patch.Gender, survivor.Gender, other.Gender)
+	fill(&patch.PlaceOfBirth, survivor.PlaceOfBirth, other.PlaceOfBirth)
+	fill(&patch.MaritalStatus, survivor.MaritalStatus, other.MaritalStatus)
+	fill(&patch.MaritalStatusCode, survivor.MaritalStatusCode, other.MaritalStatusCode)
+	fill(&patch.BloodType, survivor.BloodType, other.BloodType)
+	fill(&patch.MobileNumber, survivor.MobileNumber, other.MobileNumber)
+	fill(&patch.PhoneNumber, survivor.PhoneNumber, other.PhoneNumber)
+	fill(&patch.EmailAddress, survivor.EmailAddress, other.EmailAddress)
+	fill(&patch.PassportNumber, survivor.PassportNumber, other.PassportNumber)
+	if (survivor.DateOfBirthG == nil || survivor.DateOfBirthG.IsZero()) && other.DateOfBirthG != nil && !other.DateOfBirthG.IsZero() {
+		patch.DateOfBirthG, changed = other.DateOfBirthG, true
+	}
+	if (survivor.DateOfBirthH == nil || survivor.DateOfBirthH.IsZero()) && other.DateOfBirthH != nil && !other.DateOfBirthH.IsZero() {
+		patch.DateOfBirthH, changed = other.DateOfBirthH, true
+	}
+	if !changed {
+		return nil
+	}
+	return patch
+}
+
+// DuplicatesAdmin returns the controller as a match.Admin to mount match.NewHandler,
+// nil if the store doesn't keep the review queue
+func (c *Controller) DuplicatesAdmin() match.Admin {
+	if c.duplicates == nil {
+		return nil
+	}
+	return duplicatesAdmin{c}
+}
+
+type duplicatesAdmin struct {
+	c *Controller
+}
+
+func (a duplicatesAdmin) Scan(ctx context.Context) (*match.ScanResult, error) {
+	return a.c.FindDuplicates(ctx)
+}
+
+func (a duplicatesAdmin) List(ctx context.Context, status match.Status) ([]match.Candidate, error) {
+	return a.c.ListDuplicates(ctx, status)
+}
+
+func (a duplicatesAdmin) Get(ctx context.Context, id string) (*match.Candidate, error) {
+	return a.c.GetDuplicate(ctx, id)
+}
+
+func (a duplicatesAdmin) Resolve(ctx context.Context, id string, r *match.Resolution) (*match.Candidate, error) {
+	return a.c.ResolveDuplicate(ctx, id, r)
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,38 @@
+package nhic
+
+import (
+	"errors"
+
+	"gitlab.lean/leandevclan/nhic/config"
+	"gitlab.lean/leandevclan/nhic/encryption"
+)
+
+var ErrEncryptionUnsupported = errors.New("store doesn't encrypt the patients")
+
+// encryptedStore is implemented by the stores that encrypt the patient columns at rest,
+// store/sqlite and store/mssql
+type encryptedStore interface {
+	Encrypt(cols *encryption.Columns)
+}
+
+// encryptStore makes s encrypt the columns of conf.Encryption, nothing if there are none.
+// ErrEncryptionUnsupported if s can't, the columns would be written in clear text
+func encryptStore(s Store, conf *config.Config) error {
+	if len(conf.Encryption.Columns) == 0 {
+		return nil
+	}
+	es, ok := s.(encryptedStore)
+	if !ok {
+		return ErrEncryptionUnsupported
+	}
+	keys, err := encryption.LoadKeyFile(conf.Encryption.KeyFile)
+	if err != nil {
+		return err
+	}
+	cols, err := encryption.NewColumns(encryption.NewCipher(keys), []byte(conf.Encryption.IndexKey), conf.Encryption.Columns)
+	if err != nil {
+		return err
+	}
+	es.Encrypt(cols)
+	return nil
+}
@@ -0,0 +1,137 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// the columns of store.Patient that can be encrypted by json name,
+// none of them is searched by anything but the id number, which has the blind index
+var encryptable = []string{
+	"id_number", "guardian_id", "passport_number", "border_number", "visa_number", "hifiza_number",
+	"sponsor_number", "mobile_number", "phone_number", "email_address",
+}
+
+// idNumber is the column with the blind index
+const idNumber = "id_number"
+
+var ErrUnknownColumn = errors.New("column can't be encrypted, it's one of " + strings.Join(encryptable, ", "))
+
+// fieldIndex is the index of each encryptable field in store.Patient
+var fieldIndex = func() map[string]int {
+	t := reflect.TypeOf(store.Patient{})
+	m := make(map[string]int, len(encryptable))
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		for _, e := range encryptable {
+			if name == e {
+				m[name] = i
+			}
+		}
+	}
+	return m
+}()
+
+// Columns encrypts the configured columns of the patients
+type Columns struct {
+	c     *Cipher
+	index *Index
+	// encrypted columns by json name
+	names map[string]bool
+}
+
+// NewColumns returns the Columns encrypting names by c, encrypting id_number needs the key of its blind index
+func NewColumns(c *Cipher, indexKey []byte, names []string) (*Columns, error) {
+	cs := &Columns{c: c, names: make(map[string]bool, len(names))}
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if _, ok := fieldIndex[n]; !ok {
+			return nil, fmt.Errorf("encryption of %s: %w", n, ErrUnknownColumn)
+		}
+		cs.names[n] = true
+	}
+	if cs.names[idNumber] {
+		index, err := NewIndex(indexKey)
+		if err != nil {
+			return nil, err
+		}
+		cs.index = index
+	}
+	return cs, nil
+}
+
+// IDIndex returns the blind index of the id number, "" if id_number isn't encrypted
+func (cs *Columns) IDIndex(id string) string {
+	if cs.index == nil {
+		return ""
+	}
+	return cs.index.Of(idNumber, id)
+}
+
+// Seal returns a copy of pnt to write, with the columns encrypted and the blind index of the id number.
+// the values already encrypted are copied as they are
+func (cs *Columns) Seal(ctx context.Context, pnt *store.Patient) (*store.Patient, error) {
+	cp := *pnt
+	v := reflect.ValueOf(&cp).Elem()
+	for name := range cs.names {
+		f := v.Field(fieldIndex[name])
+		if f.IsNil() || Encrypted(f.Elem().String()) {
+			continue
+		}
+		s, err := cs.c.Encrypt(ctx, name, f.Elem().String())
+		if err != nil {
+			return nil, err
+		}
+		f.Set(reflect.ValueOf(&s))
+	}
+	if cs.index != nil && pnt.IDNumber != nil && !Encrypted(*pnt.IDNumber) {
+		x := cs.IDIndex(*pnt.IDNumber)
+		cp.IDNumberIndex = &x
+	}
+	return &cp, nil
+}
+
+// Open decrypts the columns of pnt read from the store, all of the encrypted ones
+// even if they're no longer configured
+func (cs *Columns) Open(ctx context.Context, pnt *store.Patient) error {
+	v := reflect.ValueOf(pnt).Elem()
+	for name, i := range fieldIndex {
+		f := v.Field(i)
+		if f.IsNil() || !Encrypted(f.Elem().String()) {
+			continue
+		}
+		s, err := cs.c.Decrypt(ctx, name, f.Elem().String())
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(&s))
+	}
+	return nil
+}
+
+// Stale tells if pnt, as it's read from the store, has a column to encrypt, to re-encrypt with the primary key
+// or to decrypt because it's no longer configured
+func (cs *Columns) Stale(pnt *store.Patient) bool {
+	v := reflect.ValueOf(pnt).Elem()
+	for name, i := range fieldIndex {
+		f := v.Field(i)
+		if f.IsNil() {
+			continue
+		}
+		s := f.Elem().String()
+		if cs.names[name] && cs.c.Stale(s) || !cs.names[name] && Encrypted(s) {
+			return true
+		}
+	}
+	return cs.index != nil && pnt.IDNumberIndex == nil
+}
+
+// Encrypts tells if the column is encrypted
+func (cs *Columns) Encrypts(name string) bool {
+	return cs.names[name]
+}
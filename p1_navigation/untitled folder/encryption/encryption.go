@@ -0,0 +1,225 @@
+// Package encryption encrypts the sensitive columns of the patients before the store writes them.
+//
+// it's envelope encryption: the values are encrypted with AES-256-GCM by a data key the process
+// generates, the data key is encrypted (wrapped) by a key encryption key of a KeyProvider, a KMS or
+// the KeyFile, and kept wrapped next to each value. rotating the key encryption key is making a new one
+// primary, the values wrapped with the old one are still read and Stale tells which to re-encrypt.
+//
+// an encrypted column can't be looked up, the id number gets a blind index: the HMAC-SHA256 of the id
+// with a key of its own, equal ids have equal indexes and the index doesn't tell the id
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// prefix of the encrypted values, enc:v1:<key id>:<wrapped data key>:<nonce and ciphertext>
+const prefix = "enc:v1:"
+
+// a data key encrypts this many values before the next one is generated,
+// well below the 2^32 random nonces GCM allows per key
+const maxUses = 1 << 20
+
+var (
+	ErrUnknownKey = errors.New("no key encryption key with the id")
+	ErrMalformed  = errors.New("malformed encrypted value")
+	ErrNoIndexKey = errors.New("blind index key is empty")
+)
+
+var encoding = base64.RawURLEncoding
+
+// KeyProvider keeps the key encryption keys, the data keys are sent to it to be wrapped
+// and unwrapped and the keys never leave it. KeyFile implements it, a KMS client can too
+type KeyProvider interface {
+	// Primary returns the id of the key Wrap uses
+	Primary() string
+	// Wrap encrypts the data key with the primary key and returns its id
+	Wrap(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped by the key of the id
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Cipher encrypts the values, it's safe for concurrent use
+type Cipher struct {
+	p KeyProvider
+
+	mu sync.Mutex
+	// the data key of the new values, it's replaced after maxUses or when the primary key changes
+	dek  *dataKey
+	uses int
+	// unwrapped data keys by key id and wrapped key, so the provider is asked once per data key
+	unwrapped map[string]cipher.AEAD
+}
+
+type dataKey struct {
+	keyID   string
+	wrapped string
+	aead    cipher.AEAD
+}
+
+// NewCipher returns the Cipher of the key encryption keys of p
+func NewCipher(p KeyProvider) *Cipher {
+	return &Cipher{p: p, unwrapped: make(map[string]cipher.AEAD)}
+}
+
+// Encrypted tells if s is a value encrypted by a Cipher
+func Encrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Encrypt returns plaintext encrypted, column is authenticated with it so a value
+// copied to another column doesn't decrypt
+func (c *Cipher) Encrypt(ctx context.Context, column, plaintext string) (string, error) {
+	dk, err := c.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, dk.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := dk.aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return prefix + dk.keyID + ":" + dk.wrapped + ":" + encoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of s, values that aren't encrypted are returned as they are
+// e.g. the rows written before the column was encrypted
+func (c *Cipher) Decrypt(ctx context.Context, column, s string) (string, error) {
+	if !Encrypted(s) {
+		return s, nil
+	}
+	keyID, wrapped, sealed, err := parse(s)
+	if err != nil {
+		return "", err
+	}
+	aead, err := c.unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	ns := aead.NonceSize()
+	if len(sealed) < ns {
+		return "", ErrMalformed
+	}
+	plain, err := aead.Open(nil, sealed[:ns], sealed[ns:], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", column, err)
+	}
+	return string(plain), nil
+}
+
+// Stale tells if s isn't encrypted or its data key isn't wrapped by the primary key,
+// re-encrypting it moves it to the primary key
+func (c *Cipher) Stale(s string) bool {
+	if !Encrypted(s) {
+		return true
+	}
+	keyID, _, _, err := parse(s)
+	return err != nil || keyID != c.p.Primary()
+}
+
+func (c *Cipher) dataKey(ctx context.Context) (*dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dek != nil && c.uses < maxUses && c.dek.keyID == c.p.Primary() {
+		c.uses++
+		return c.dek, nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := c.p.Wrap(ctx, dek)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(keyID, ":") {
+		return nil, fmt.Errorf("key id %q: %w", keyID, ErrUnknownKey)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	c.dek = &dataKey{keyID: keyID, wrapped: encoding.EncodeToString(wrapped), aead: aead}
+	c.uses = 1
+	return c.dek, nil
+}
+
+func (c *Cipher) unwrap(ctx context.Context, keyID string, wrapped []byte) (cipher.AEAD, error) {
+	k := keyID + ":" + string(wrapped)
+	c.mu.Lock()
+	aead, ok := c.unwrapped[k]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	dek, err := c.p.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err = newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.unwrapped[k] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+// parse splits an encrypted value in the key id, the wrapped data key and the nonce with the ciphertext
+func parse(s string) (keyID string, wrapped, sealed []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(s, prefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+	if wrapped, err = encoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if sealed, err = encoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, sealed, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Index computes the blind indexes of the values looked up by exact match
+type Index struct {
+	key []byte
+}
+
+// NewIndex returns the Index of the secret key, it's a different key than the key encryption keys
+// and it isn't rotated with them, a new one means indexing every row again
+func NewIndex(key []byte) (*Index, error) {
+	if len(key) == 0 {
+		return nil, ErrNoIndexKey
+	}
+	return &Index{key: key}, nil
+}
+
+// Of returns the blind index of the value of the column, the value is trimmed and upper cased
+func (x *Index) Of(column, value string) string {
+	mac := hmac.New(sha256.New, x.key)
+	mac.Write([]byte(column + ":" + strings.ToUpper(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,184 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func newKeyFile(t *testing.T, ids ...string) *KeyFile {
+	k := &KeyFile{}
+	for _, id := range ids {
+		if err := k.Rotate(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return k
+}
+
+func TestCipher(t *testing.T) {
+	ctx := context.Background()
+	c := NewCipher(newKeyFile(t, "k1"))
+
+	a, err := c.Encrypt(ctx, "id_number", "1012345672")
+	if err != nil || !Encrypted(a) || strings.Contains(a, "1012345672") || !strings.HasPrefix(a, "enc:v1:k1:") {
+		t.Fatalf("encrypt: %s %v", a, err)
+	}
+	b, _ := c.Encrypt(ctx, "id_number", "1012345672")
+	if a == b {
+		t.Fatal("same ciphertext twice")
+	}
+
+	tests := []struct {
+		name   string
+		column string
+		value  string
+		want   string
+		err    error
+	}{
+		{"encrypted", "id_number", a, "1012345672", nil},
+		{"clear text", "id_number", "1012345672", "1012345672", nil},
+		{"other column", "mobile_number", a, "", errors.New("")},
+		{"malformed", "id_number", "enc:v1:k1:abc", "", ErrMalformed},
+		{"not base64", "id_number", "enc:v1:k1:!!:!!", "", ErrMalformed},
+		{"unknown key", "id_number", strings.Replace(a, ":k1:", ":k9:", 1), "", ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		got, err := c.Decrypt(ctx, tt.column, tt.value)
+		if got != tt.want || (err == nil) != (tt.err == nil) {
+			t.Errorf("%s: got %q %v", tt.name, got, err)
+		} else if tt.err != nil && tt.err.Error() != "" && !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewColumns(NewCipher(newKeyFile(t, "k1")), nil, []string{"first_name_ar"}); !errors.Is(err, ErrUnknownColumn) {
+		t.Fatalf("unknown column: %v", err)
+	}
+	if _, err := NewColumns(NewCipher(newKeyFile(t, "k1")), nil, []string{"id_number"}); err != ErrNoIndexKey {
+		t.Fatalf("id_number without an index key: %v", err)
+	}
+	cols, err := NewColumns(NewCipher(newKeyFile(t, "k1")), []byte("index"), []string{" ID_Number", "mobile_number"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pnt := &store.Patient{IDNumber: sp("1012345672"), MobileNumber: sp("0501234567"), PhoneNumber: sp("0111234567"), FirstNameAr: sp("محمد")}
+	sealed, err := cols.Seal(ctx, pnt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		v         *string
+		encrypted bool
+	}{
+		{"id_number", sealed.IDNumber, true},
+		{"mobile_number", sealed.MobileNumber, true},
+		{"phone_number", sealed.PhoneNumber, false},
+		{"first_name_ar", sealed.FirstNameAr, false},
+		{"guardian_id", sealed.GuardianID, false},
+	}
+	for _, tt := range tests {
+		if tt.v != nil && Encrypted(*tt.v) != tt.encrypted {
+			t.Errorf("%s: sealed %q", tt.name, *tt.v)
+		}
+	}
+	if *pnt.IDNumber != "1012345672" {
+		t.Fatal("seal changed the patient")
+	}
+	if sealed.IDNumberIndex == nil || *sealed.IDNumberIndex != cols.IDIndex(" 1012345672") || *sealed.IDNumberIndex == "1012345672" {
+		t.Fatalf("blind index %v", sealed.IDNumberIndex)
+	}
+	again, _ := cols.Seal(ctx, sealed)
+	if *again.IDNumber != *sealed.IDNumber {
+		t.Fatal("sealed twice")
+	}
+
+	opened := *sealed
+	if err := cols.Open(ctx, &opened); err != nil {
+		t.Fatal(err)
+	}
+	if *opened.IDNumber != "1012345672" || *opened.MobileNumber != "0501234567" || *opened.PhoneNumber != "0111234567" {
+		t.Fatalf("open: %+v", opened)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := newKeyFile(t, "2025-01")
+	if err := keys.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Rotate("2025-01"); err == nil {
+		t.Fatal("rotated to an existing key")
+	}
+
+	old, err := NewColumns(NewCipher(keys), []byte("index"), []string{"id_number", "mobile_number"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, _ := old.Seal(ctx, &store.Patient{IDNumber: sp("1012345672"), MobileNumber: sp("0501234567")})
+	if old.Stale(row) {
+		t.Fatal("stale before the rotation")
+	}
+
+	// a new primary key, the service restarts with the file
+	if err := keys.Rotate("2026-10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKeyFile(path)
+	if err != nil || loaded.Primary() != "2026-10" {
+		t.Fatalf("load: %v %v", loaded, err)
+	}
+	cols, _ := NewColumns(NewCipher(loaded), []byte("index"), []string{"id_number"})
+
+	tests := []struct {
+		name  string
+		row   *store.Patient
+		stale bool
+	}{
+		{"wrapped by the old key", row, true},
+		{"clear text", &store.Patient{IDNumber: sp("1012345672")}, true},
+		{"no longer encrypted", &store.Patient{IDNumber: row.IDNumber, IDNumberIndex: row.IDNumberIndex, MobileNumber: row.MobileNumber}, true},
+		{"empty", &store.Patient{}, true},
+	}
+	for _, tt := range tests {
+		if got := cols.Stale(tt.row); got != tt.stale {
+			t.Errorf("%s: stale %v", tt.name, got)
+		}
+	}
+
+	// re-encrypting is opening with either key and sealing with the primary one
+	pnt := *row
+	if err := cols.Open(ctx, &pnt); err != nil || *pnt.IDNumber != "1012345672" || *pnt.MobileNumber != "0501234567" {
+		t.Fatalf("open with the old key: %+v %v", pnt, err)
+	}
+	moved, err := cols.Seal(ctx, &pnt)
+	if err != nil || !strings.HasPrefix(*moved.IDNumber, "enc:v1:2026-10:") || Encrypted(*moved.MobileNumber) {
+		t.Fatalf("reencrypt: %+v %v", moved, err)
+	}
+	if cols.Stale(moved) || *moved.IDNumberIndex != *row.IDNumberIndex {
+		t.Fatalf("stale after reencrypt: %+v", moved)
+	}
+
+	// the old key is dropped from the file once nothing is wrapped by it
+	if _, err := NewCipher(newKeyFile(t, "2026-10")).Decrypt(ctx, "id_number", *row.IDNumber); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("old key removed: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+var ErrKeyFile = errors.New("key file needs a primary key and 32 byte keys with ids without ':'")
+
+// KeyFile is a KeyProvider of keys kept in a local json file, readable by the service only
+//
+//	{"primary": "2026-10", "keys": {"2025-01": "<base64 32 bytes>", "2026-10": "<base64 32 bytes>"}}
+//
+// the keys that aren't primary only unwrap, they're kept until nothing is wrapped by them
+type KeyFile struct {
+	primary string
+	keys    map[string][]byte
+}
+
+type keyFileJSON struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadKeyFile reads the keys of the file at path
+func LoadKeyFile(path string) (*KeyFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kj keyFileJSON
+	if err := json.Unmarshal(b, &kj); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	k := &KeyFile{primary: kj.Primary, keys: make(map[string][]byte, len(kj.Keys))}
+	for id, s := range kj.Keys {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s key %s: %w", path, id, err)
+		}
+		k.keys[id] = key
+	}
+	if err := k.validate(); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return k, nil
+}
+
+func (k *KeyFile) validate() error {
+	if _, ok := k.keys[k.primary]; !ok {
+		return ErrKeyFile
+	}
+	for id, key := range k.keys {
+		if id == "" || strings.Contains(id, ":") || len(key) != 32 {
+			return ErrKeyFile
+		}
+	}
+	return nil
+}
+
+// Rotate adds a new key with the id and makes it primary, the file isn't written until Save
+func (k *KeyFile) Rotate(id string) error {
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("key %s already exists", id)
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	if k.keys == nil {
+		k.keys = make(map[string][]byte)
+	}
+	k.keys[id] = key
+	k.primary = id
+	return k.validate()
+}
+
+// Save writes the keys to the file at path, only the owner can read it
+func (k *KeyFile) Save(path string) error {
+	kj := keyFileJSON{Primary: k.primary, Keys: make(map[string]string, len(k.keys))}
+	for id, key := range k.keys {
+		kj.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+	b, err := json.MarshalIndent(kj, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// Primary returns the id of the key the new data keys are wrapped with
+func (k *KeyFile) Primary() string {
+	return k.primary
+}
+
+// Wrap encrypts the data key with the primary key
+func (k *KeyFile) Wrap(ctx context.Context, dek []byte) (string, []byte, error) {
+	aead, err := newAEAD(k.keys[k.primary])
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return k.primary, aead.Seal(nonce, nonce, dek, []byte(k.primary)), nil
+}
+
+// Unwrap decrypts a data key wrapped by the key of the id
+func (k *KeyFile) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s: %w", keyID, ErrUnknownKey)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	ns := aead.NonceSize()
+	if len(wrapped) < ns {
+		return nil, ErrMalformed
+	}
+	return aead.Open(nil, wrapped[:ns], wrapped[ns:], []byte(keyID))
+}
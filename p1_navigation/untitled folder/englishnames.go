@@ -0,0 +1,61 @@
+package nhic
+
+import (
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/store"
+	"gitlab.lean/leandevclan/nhic/translit"
+)
+
+// fillEnglishNames transliterates the parts of the english name prsn left blank from the arabic ones,
+// e.g. Yakeen often returns citizens without it. the last name is from the subtribe name
+// if there's no family name. pnt.NameEnSource is generated if any part was transliterated
+func fillEnglishNames(prsn *Person, pnt *store.Patient) {
+	lastAr := pnt.LastNameAr
+	if blank(lastAr) {
+		lastAr = pnt.SubtribeName
+	}
+	parts := []struct {
+		en      **string
+		fromSrc *string
+		ar      *string
+	}{
+		{&pnt.FirstNameEn, prsn.FirstNameEn, pnt.FirstNameAr},
+		{&pnt.SecondNameEn, prsn.SecondNameEn, pnt.SecondNameAr},
+		{&pnt.ThirdNameEn, prsn.ThirdNameEn, pnt.ThirdNameAr},
+		{&pnt.LastNameEn, prsn.LastNameEn, lastAr},
+	}
+
+	authoritative, generated, kept := false, false, false
+	for _, p := range parts {
+		switch {
+		case !blank(p.fromSrc):
+			authoritative = true
+		case p.fromSrc == nil && !blank(*p.en):
+			// from the db, the source doesn't return english names
+			kept = true
+		case !blank(p.ar):
+			en := translit.Name(*p.ar)
+			*p.en = &en
+			generated = true
+		}
+	}
+
+	var src string
+	switch {
+	case generated:
+		src = store.NameSourceGenerated
+	case authoritative:
+		src = store.NameSourceAuthoritative
+	case kept && pnt.NameEnSource == nil:
+		// stored before the names were generated, so from a source
+		src = store.NameSourceAuthoritative
+	default:
+		return
+	}
+	pnt.NameEnSource = &src
+}
+
+func blank(s *string) bool {
+	return s == nil || strings.TrimSpace(*s) == ""
+}
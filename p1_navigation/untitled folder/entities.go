@@ -39,10 +39,10 @@ type Practitioner struct {
 	LastNameEn   *string `json:"last_name_en,omitempty" db:"LastNameEn"`
 	FullNameEn   *string `json:"full_name_en,omitempty"`
 
-	IDIssueDate        *string `json:"id_issue_date,omitempty"`
+	IDIssueDate        *Date   `json:"id_issue_date,omitempty"`
 	BirthDate_original *string `json:"birth_date_original"`
-	BirthDate_G        *string `json:"birth_date_gregorian"`
-	BirthDate_H        *string `json:"birth_date_hirji"`
+	BirthDate_G        *Date   `json:"birth_date_gregorian"`
+	BirthDate_H        *Date   `json:"birth_date_hirji"`
 
 	Gender_ar   *string `json:"gender_ar,omitempty" db:"Gender_ar"`
 	Gender_en   *string `json:"gender_en,omitempty" db:"Gender_en"`
@@ -57,7 +57,7 @@ type Practitioner struct {
 	Email                       *string `json:"email,omitempty"`
 	Department                  *string `json:"department,omitempty"`
 	InsuranceCompany            *string `json:"insurance_company,omitempty"`
-	InsuranceExpiryDate         *string `json:"insurance_expiry_date,omitempty"`
+	InsuranceExpiryDate         *Date   `json:"insurance_expiry_date,omitempty"`
 	EstablishmentName           *string `json:"establishment_name" db:"establishment_name"`
 	EstablishmentType           *string `json:"establishment_type,omitempty" db:"establishment_type"`
 	EstablishmentSector         *string `json:"establishment_sector,omitempty" db:"establishment_sector"`
@@ -70,19 +70,19 @@ type Practitioner struct {
 	Gender                      *string `json:"gender,omitempty"`
 	Nationality                 *string `json:"nationality,omitempty"`
 	Religion                    *string `json:"religion"`
-	BirthDateH                  *string `json:"birth_date_h,omitempty"`
-	BirthDateG                  *string `json:"birth_date_g,omitempty"`
+	BirthDateH                  *Date   `json:"birth_date_h,omitempty"`
+	BirthDateG                  *Date   `json:"birth_date_g,omitempty"`
 	License                     *string `json:"license,omitempty"`
-	LicenseIssueDate            *string `json:"license_issue_date,omitempty" db:"LicenseIssueDate"`
-	LicenseExpiryDate           *string `json:"license_expiry_date,omitempty" db:"LicenseExpiryDate"`
-	SCFHSRegistrationIssueDate  *string `json:"scfhs_registration_issue_date,omitempty" db:"SCFHSRegistrationIssueDate"`
-	SCFHSRegistrationExpiryDate *string `json:"scfhs_registration_expiry_date,omitempty" db:"SCFHSRegistrationExpiryDate"`
+	LicenseIssueDate            *Date   `json:"license_issue_date,omitempty" db:"LicenseIssueDate"`
+	LicenseExpiryDate           *Date   `json:"license_expiry_date,omitempty" db:"LicenseExpiryDate"`
+	SCFHSRegistrationIssueDate  *Date   `json:"scfhs_registration_issue_date,omitempty" db:"SCFHSRegistrationIssueDate"`
+	SCFHSRegistrationExpiryDate *Date   `json:"scfhs_registration_expiry_date,omitempty" db:"SCFHSRegistrationExpiryDate"`
 	SCFHSRegistrationNumber     *string `json:"scfhs_registration_number,omitempty" db:"SCFHSRegistrationNumber"`
 
 	IDType           *string `json:"id_type,omitempty" db:"IDType"`
 	IDNumber         *string `json:"id_number,omitempty" db:"IDNumber"`
 	ExpirationStatus *string `json:"expiration_status,omitempty" db:"ExpirationStatus"`
-	IDExpiryDate     *string `json:"id_expiry_date,omitempty"`
+	IDExpiryDate     *Date   `json:"id_expiry_date,omitempty"`
 
 	LicenseNumber *string `json:"license_number"`
 	Legacy_job    *string `json:"-"`
@@ -103,6 +103,14 @@ type Practitioner struct {
 	UniversityFaculty   *string `json:"university_faculty"`
 }
 
+// sources of Patient.NameEnSource
+const (
+	// NameSourceAuthoritative is an english name returned by the identity source
+	NameSourceAuthoritative = "authoritative"
+	// NameSourceGenerated is an english name transliterated from the arabic one, at least a part of it
+	NameSourceGenerated = "generated"
+)
+
 type Patient struct {
 	// these fields are returned when there's no match for the patient on our db
 	LogId            *string `json:"log_id,omitempty"`
@@ -111,16 +119,29 @@ type Patient struct {
 	ReservedHealthID *string `json:"reserved_health_id,omitempty"`
 	HealthID         *string `json:"health_id,omitempty" db:"HealthId"`
 	SearchID         *string `json:"search_id,omitempty" db:"SearchID"`
-	DateG            *string `json:"date_g,omitempty" db:"DateG"`
-	DateH            *string `json:"date_h,omitempty" db:"DateH"`
+	DateG            *Date   `json:"date_g,omitempty" db:"DateG"`
+	DateH            *Date   `json:"date_h,omitempty" db:"DateH"`
 
 	//CamelCase is fine
 	ClientIdentifierId *string `json:"ClientIdentifierId,omitempty" db:"ClientIdentifierId"`
 	IDType             *string `json:"id_type,omitempty" db:"IdType"`
 	IDNumber           *string `json:"id_number,omitempty" db:"IdNumber"`
-	IDExpiryDate       *string `json:"id_expiry_date,omitempty" db:"IDExpiryDate"`
-	IDIssueDate        *string `json:"id_issue_date,omitempty" db:"IDIssueDate"`
+	IDExpiryDate       *Date   `json:"id_expiry_date,omitempty" db:"IDExpiryDate"`
+	IDIssueDate        *Date   `json:"id_issue_date,omitempty" db:"IDIssueDate"`
 	IDIssuePlace       *string `json:"id_issue_place,omitempty" db:"ID_Place"`
+	// IDNumberIndex is the blind index of IDNumber when it's encrypted, see package encryption
+	IDNumberIndex *string `json:"-" db:"IdNumberIndex"`
+	// RowUpdatedAt is set by the stores on every write of the patient
+	RowUpdatedAt *string `json:"-" db:"RowUpdatedAt"`
+
+	// visitors, gcc nationals and newborns, IDNumber is the border number, visa or gcc id
+	// newborns are stored under NB-<guardian id>-<yyyymmdd>-<birth order>
+	PassportNumber *string `json:"passport_number,omitempty" db:"PassportNumber"`
+	BorderNumber   *string `json:"border_number,omitempty" db:"BorderNumber"`
+	VisaNumber     *string `json:"visa_number,omitempty" db:"VisaNumber"`
+	IDCountry      *string `json:"id_country,omitempty" db:"IdCountry"`
+	GuardianID     *string `json:"guardian_id,omitempty" db:"GuardianId"`
+	BirthOrder     *string `json:"birth_order,omitempty" db:"BirthOrder"`
 
 	BloodType *string `json:"blood_type,omitempty"`
 
@@ -141,12 +162,12 @@ type Patient struct {
 	TransactionID   *string `json:"transaction_id,omitempty" db:"TransactionID"`
 	GenderSpecified *string `json:"gender_specified,omitempty" db:"GenderSpecified"`
 
-	HifizaIssueDate *string `json:"hifiza_issue_date,omitempty" db:"HifizaIssueDate"`
+	HifizaIssueDate *Date   `json:"hifiza_issue_date,omitempty" db:"HifizaIssueDate"`
 	HifizaNumber    *string `json:"hifiza_number,omitempty" db:"HifizaNumber"`
 
 	PlaceOfBirth *string `json:"place_of_birth,omitempty" db:"PlaceOfBirth"`
-	DateOfBirthG *string `json:"date_of_birth_g,omitempty" db:"DateOfBirthG"`
-	DateOfBirthH *string `json:"date_of_birth_h,omitempty" db:"DateOfBirthH"`
+	DateOfBirthG *Date   `json:"date_of_birth_g,omitempty" db:"DateOfBirthG"`
+	DateOfBirthH *Date   `json:"date_of_birth_h,omitempty" db:"DateOfBirthH"`
 
 	Gender *string `json:"gender,omitempty" db:"Gender"`
 
@@ -160,6 +181,12 @@ type Patient struct {
 	SecondNameEn *string `json:"second_name_en,omitempty" db:"EnglishSecondName"`
 	ThirdNameEn  *string `json:"third_name_en,omitempty" db:"EnglishThirdName"`
 	LastNameEn   *string `json:"last_name_en,omitempty" db:"EnglishLastName"`
+	// NameEnSource tells where the english name is from, NameSourceAuthoritative or NameSourceGenerated
+	NameEnSource *string `json:"name_en_source,omitempty" db:"EnglishNameSource"`
+
+	// full names aren't stored, the controller writes them from the parts, see nhic.PatientFullNames
+	FullNameAr *string `json:"full_name_ar,omitempty" db:"-"`
+	FullNameEn *string `json:"full_name_en,omitempty" db:"-"`
 
 	IsDead        *string `json:"is_dead,omitempty" db:"IsDead"`
 	SponsorNumber *string `json:"sponsor_number,omitempty" db:"SponsorNumber"`
@@ -187,9 +214,13 @@ type Establishment struct {
 	IsMigrated    *string `json:"migrated" db:"isMigrated"`
 	IsDeleted     *string `json:"deleted" db:"IsDeleted"`
 
+	CRNumber            *string `json:"cr_number,omitempty" db:"CR_Number"`
+	CREstablishmentName *string `json:"cr_establishment_name,omitempty" db:"CR_EstablishmentName"`
+	SourceSystem        *string `json:"source_system,omitempty" db:"SourceSystem"`
+
 	LicenseNumber         *string `json:"license_number,omitempty" db:"LicenseNumber"`
-	IssueDate             *string `json:"issue_date,omitempty" db:"Issue_Date"`
-	ExpiryDate            *string `json:"expiry_date,omitempty" db:"Expiry_Date"`
+	IssueDate             *Date   `json:"issue_date,omitempty" db:"Issue_Date"`
+	ExpiryDate            *Date   `json:"expiry_date,omitempty" db:"Expiry_Date"`
 	NameAr                *string `json:"name_ar,omitempty"`
 	NameEn                *string `json:"name_en,omitempty"`
 	SehaID                *string `json:"seha_id,omitempty"`
@@ -250,7 +281,7 @@ type Establishment struct {
 	TechnicalSupervisorName              *string `json:"technical_supervisor_name,omitempty" db:"TechnicalSupervisorName"`
 	TechnicalSupervisorCategory          *string `json:"technical_supervisor_category" db:"TechnicalSupervisorCategory"`
 	TechnicalSupervisorSpeciality        *string `json:"technical_supervisor_speciality" db:"TechnicalSupervisorSpeciality"`
-	TechnicalSupervisorLicenseExpiryDate *string `json:"technical_supervisor_license_expiry_date,omitempty" db:"TechnicalSupervisorLicenseExpiryDate"`
+	TechnicalSupervisorLicenseExpiryDate *Date   `json:"technical_supervisor_license_expiry_date,omitempty" db:"TechnicalSupervisorLicenseExpiryDate"`
 	AdministrativeDirectorName           *string `json:"administrative_director_name,omitempty" db:"AdministrativeDirectorName"`
 }
 
@@ -288,97 +319,15 @@ type EstablishmentV2 struct {
 	TotalHospitalBeds *string `json:"total_hospital_beds" db:"TotalHospitalBeds"`
 	TeachingStatus    *string `json:"teaching_status" db:"TeachingStatus"`
 	The700Number      *string `json:"the_700_number" db:"The700Number"`
-}
-type Establishments struct {
-	ErrorMsg *string `json:"error_msg,omitempty"`
-	Msg      *string `json:"msg,omitempty" db:"Msg"`
-
-	EntityType       *string `json:"entity_type,omitempty"`
-	EntitySpeciality *string `json:"entity_speciality,omitempty"`
 
-	ID             *string `json:"-" db:"id"`
-	Code           *string `json:"code" db:"Code"`
-	MOHID          *string `json:"-" db:"MOHID"`
-	OrganizationID *string `json:"organization_id" db:"OrganizationId"`
-	LegacyEntityID *string `json:"-" db:"legacy_entityId"`
-
-	RowInsertedAt *string `json:"-" db:"RowInseartedAt"`
-	RowUpdatedAt  *string `json:"-" db:"RowUpdatedAt"`
-	RowDeletedAt  *string `json:"-" db:"RowDeletedAt"`
-	IsMigrated    *string `json:"-" db:"isMigrated"`
-	IsDeleted     *string `json:"-" db:"IsDeleted"`
-
-	CRNumber            *string `json:"-" db:"CR_Number"`
-	CREstablishmentName *string `json:"-" db:"CR_EstablishmentName"`
-	SourceSystem        *string `json:"-" db:"SourceSystem"`
-
-	NotificationEmail     *string `json:"-" db:"NotificationEmail"`
-	LicenseNumber         *string `json:"-" db:"LicenseNumber"`
-	IssueDate             *string `json:"-" db:"Issue_Date"`
-	ExpiryDate            *string `json:"-" db:"Expiry_Date"`
-	NameAr                *string `json:"name_ar,omitempty"`
-	NameEn                *string `json:"name_en,omitempty"`
-	SehaID                *string `json:"seha_id,omitempty"`
-	BedsCount             *string `json:"beds_count,omitempty"`
-	Longitude             *string `json:"longitude,omitempty"`
-	Latitude              *string `json:"latitude,omitempty"`
-	MapURL                *string `json:"-" db:"MapUrl"`
-	SehaHealthDirectory   *string `json:"-" db:"SehaHealth_Directory"`
-	LevelOfCare           *string `json:"level_of_care" db:"level_of_care"`
-	TypeOfCare            *string `json:"type_of_care" db:"type_of_care"`
-	TypeOfCareCode        *string `json:"type_of_care_code" db:"type_of_care_code"`
-	HealthDirectoryAr     *string `json:"health_directory_ar" db:"Health_Directory_ar"`
-	HealthDirectoryEn     *string `json:"health_directory_en" db:"Health_Directory_en"`
-	HealthDirectorySehaID *string `json:"health_directory_seha_id" db:"Health_Directory_SehaID"`
-	SectorAr              *string `json:"sector_ar" db:"sector_ar"`
-	SectorEn              *string `json:"sector_en" db:"sector_en"`
-	SectorCode            *string `json:"sector_code" db:"sector_code"`
-	EntityTypeAr          *string `json:"-" db:"entity_type_ar"`
-	EntityTypeEn          *string `json:"-" db:"entity_type_en"`
-	EntityTypeCode        *string `json:"-" db:"entity_type_code"`
-	Website               *string `json:"-" db:"website"`
-	PhoneNumber           *string `json:"-" db:"phone_number"`
-	Email                 *string `json:"-" db:"email"`
-
-	OldHLSEntityType     *string `json:"-" db:"OldHlsEntityType"`
-	OldHLSEntityTypeID   *string `json:"-" db:"OldHlsEntityTypeId"`
-	OldHLSSpeciality     *string `json:"-" db:"OldHlsSpeciality"`
-	OldHLSSpecialityID   *string `json:"-" db:"OldHlsSpecialityId"`
-	NewHLSEntityType     *string `json:"-" db:"NewHlsEntityType"`
-	NewHLSEntityTypeID   *string `json:"-" db:"NewHlsEntityTypeId"`
-	NewHLSEntityTypeCode *string `json:"-" db:"NewHlsEntityTypeCode"`
-	NewHLSSpeciality     *string `json:"-" db:"NewHlsSpeciality"`
-	NewHLSSpecialityID   *string `json:"-" db:"NewHlsSpecialityId"`
-
-	HLSEstablishmentID                   *string `json:"-" db:"hls_establishment_id"`
-	HLSEstablishmentLicenceID            *string `json:"-" db:"hls_establishment_licence_id"`
-	CityAr                               *string `json:"city_ar" db:"city_ar"`
-	CityEn                               *string `json:"city_en" db:"city_en"`
-	CityCode                             *string `json:"city_code" db:"city_code"`
-	RegionAr                             *string `json:"region_ar" db:"region_ar"`
-	RegionEn                             *string `json:"region_en" db:"region_en"`
-	RegionCode                           *string `json:"region_code" db:"region_code"`
-	LocationCode                         *string `json:"location_code" db:"location_code"`
-	FullAddress                          *string `json:"-"`
-	Address                              *string `json:"-"`
-	AddressBuildingNumber                *string `json:"-" db:"Address_BuildingNumber"`
-	AddressStreetName                    *string `json:"-" db:"Address_StreetName"`
-	AddressBlockNumber                   *string `json:"-" db:"Address_BlockNumber"`
-	AddressDistrictName                  *string `json:"-" db:"Address_DistrictName"`
-	AddressPostalCode                    *string `json:"-" db:"Address_PostalCode"`
-	AddressCity                          *string `json:"-" db:"Address_City"`
-	OwnerName                            *string `json:"-" db:"OwnerName"`
-	SystemManagerNameAr                  *string `json:"-" db:"SystemManagerNameAr"`
-	SystemManagerIDNumber                *string `json:"-" db:"SystemManagerIDNumber"`
-	SystemManagerMobileNumber            *string `json:"-" db:"SystemManagerMobileNumber"`
-	SystemManagerEmail                   *string `json:"-" db:"SystemManagerEmail"`
-	TechnicalSupervisorName              *string `json:"-" db:"TechnicalSupervisorName"`
-	TechnicalSupervisorCategory          *string `json:"-" db:"TechnicalSupervisorCategory"`
-	TechnicalSupervisorSpeciality        *string `json:"-" db:"TechnicalSupervisorSpeciality"`
-	TechnicalSupervisorLicenseExpiryDate *string `json:"-" db:"TechnicalSupervisorLicenseExpiryDate"`
-	AdministrativeDirectorName           *string `json:"-" db:"AdministrativeDirectorName"`
+	// deleting the establishment deletes its v2 row too
+	IsDeleted *string `json:"-" db:"IsDeleted"`
 }
 
+// Establishments is an Establishment of the GetEstablishments list, what the consumers see
+// of each is the establishments projection, see the projection package
+type Establishments = Establishment
+
 // Errors related to Establishment
 var (
 	ErrEmptyCode           = errors.New("code can't be empty in establishment")
@@ -0,0 +1,203 @@
+package nhic
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	earthRadiusKm = 6371.0
+)
+
+// EstablishmentQuery filters and pages the establishments,
+// the zero value is the first page of all of them ordered by organization id
+type EstablishmentQuery struct {
+	// Name is the start of a word of the arabic or english name, or any part of it if NameContains
+	Name         string
+	NameContains bool
+	// City is the start of the city in arabic or english
+	City string
+	// Type is the code of the entity type, sector, type of care or level of care
+	Type string
+	// Near keeps the establishments within the distance, closest first
+	Near *Near
+
+	Offset int
+	// Count is the page size, defaultPageSize if 0 and at most maxPageSize
+	Count int
+}
+
+// Near is a point and a distance in km
+type Near struct {
+	Latitude  float64
+	Longitude float64
+	Distance  float64
+}
+
+// EstablishmentPage is a page of the establishments matching an EstablishmentQuery
+type EstablishmentPage struct {
+	Establishments []store.Establishments
+	// Total is the number of matches in all the pages
+	Total  int
+	Offset int
+	Count  int
+}
+
+// SearchEstablishments returns the page of the establishments matching q.
+// the store returns all of them, they're filtered here
+func (c *Controller) SearchEstablishments(ctx context.Context, q *EstablishmentQuery) (*EstablishmentPage, error) {
+	ctx, cancel := c.withDeadline(ctx, opGetEstablishments)
+	defer cancel()
+
+	ests, err := c.store.GetEstablishments(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
+		return nil, ErrSearchInput
+	} else if err != nil && err != store.ErrNotFound {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "search establishments: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+
+	var all []store.Establishments
+	if ests != nil {
+		all = *ests
+	}
+	type match struct {
+		est      store.Establishments
+		distance float64
+	}
+	var matches []match
+	for _, est := range all {
+		if !q.matches(&est) {
+			continue
+		}
+		m := match{est: est}
+		if q.Near != nil {
+			lat, lng, ok := coordinates(&est)
+			if !ok {
+				continue
+			}
+			m.distance = distanceKm(q.Near.Latitude, q.Near.Longitude, lat, lng)
+			if m.distance > q.Near.Distance {
+				continue
+			}
+		}
+		matches = append(matches, m)
+	}
+	if q.Near != nil {
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+	}
+
+	page := &EstablishmentPage{Total: len(matches), Establishments: []store.Establishments{}}
+	var end int
+	page.Offset, page.Count, end = pageWindow(q.Offset, q.Count, len(matches))
+	for _, m := range matches[page.Offset:end] {
+		page.Establishments = append(page.Establishments, m.est)
+	}
+	return page, nil
+}
+
+// pageWindow clamps the offset and count of a page of total results,
+// the page is [offset, end)
+func pageWindow(offset, count, total int) (int, int, int) {
+	if count <= 0 {
+		count = defaultPageSize
+	} else if count > maxPageSize {
+		count = maxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	} else if offset > total {
+		offset = total
+	}
+	end := offset + count
+	if end > total {
+		end = total
+	}
+	return offset, count, end
+}
+
+func (q *EstablishmentQuery) matches(est *store.Establishments) bool {
+	if q.Name != "" && !matchString(q.Name, q.NameContains, est.NameEn, est.NameAr) {
+		return false
+	}
+	if q.City != "" && !matchString(q.City, false, est.CityEn, est.CityAr, est.AddressCity) {
+		return false
+	}
+	if q.Type != "" {
+		found := false
+		for _, code := range []*string{est.EntityTypeCode, est.SectorCode, est.TypeOfCareCode, est.LevelOfCare} {
+			if code != nil && strings.EqualFold(*code, q.Type) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchString tells if one of the values has a word starting with s, or contains s,
+// ignoring the case
+func matchString(s string, contains bool, values ...*string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		lv := strings.ToLower(*v)
+		if contains {
+			if strings.Contains(lv, s) {
+				return true
+			}
+			continue
+		}
+		// s can be more than one word e.g. "king fahad"
+		words := strings.Fields(lv)
+		for i := range words {
+			if strings.HasPrefix(strings.Join(words[i:], " "), s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// coordinates are the latitude and longitude of est, the db has them as strings
+func coordinates(est *store.Establishments) (lat, lng float64, ok bool) {
+	if est.Latitude == nil || est.Longitude == nil {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(*est.Latitude), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(*est.Longitude), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// distanceKm is the great circle distance by the haversine formula
+func distanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,123 @@
+// Package fhir serves the registry as a FHIR R4 server, it maps the store entities
+// to FHIR resources and looks them up through the controller like the Compat endpoints do.
+//
+// only the elements the registry has are written, everything is read only
+package fhir
+
+// the data types used by the resources, only the elements we write
+// see https://hl7.org/fhir/R4/datatypes.html
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	Use    string           `json:"use,omitempty"`
+	Type   *CodeableConcept `json:"type,omitempty"`
+	System string           `json:"system,omitempty"`
+	Value  string           `json:"value,omitempty"`
+}
+
+type HumanName struct {
+	Extension []Extension `json:"extension,omitempty"`
+	Use       string      `json:"use,omitempty"`
+	Text      string      `json:"text,omitempty"`
+	Family    string      `json:"family,omitempty"`
+	Given     []string    `json:"given,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Address struct {
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+// Extension has the value types we use, at most one is set
+type Extension struct {
+	URL                  string           `json:"url"`
+	Extension            []Extension      `json:"extension,omitempty"`
+	ValueCode            string           `json:"valueCode,omitempty"`
+	ValueString          string           `json:"valueString,omitempty"`
+	ValueCodeableConcept *CodeableConcept `json:"valueCodeableConcept,omitempty"`
+}
+
+// Bundle is the result of a search
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int           `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string       `json:"fullUrl,omitempty"`
+	Resource interface{}  `json:"resource"`
+	Search   *EntrySearch `json:"search,omitempty"`
+}
+
+type EntrySearch struct {
+	Mode string `json:"mode"`
+	// Score is how close the name is in the searches by name, from 0 to 1
+	Score float64 `json:"score,omitempty"`
+}
+
+// OperationOutcome is the body of the errors
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+type Issue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// code systems and extensions of the base spec
+const (
+	systemIdentifierType = "http://terminology.hl7.org/CodeSystem/v2-0203"
+	systemMaritalStatus  = "http://terminology.hl7.org/CodeSystem/v3-MaritalStatus"
+	systemNullFlavor     = "http://terminology.hl7.org/CodeSystem/v3-NullFlavor"
+	systemCountry        = "urn:iso:std:iso:3166"
+
+	extLanguage    = "http://hl7.org/fhir/StructureDefinition/language"
+	extNationality = "http://hl7.org/fhir/StructureDefinition/patient-nationality"
+)
+
+// FHIR dates are gregorian yyyy-mm-dd
+const dateLayout = "2006-01-02"
@@ -0,0 +1,445 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+const contentType = "application/fhir+json"
+
+var (
+	errUnsupportedSystem = errors.New("identifier system isn't supported")
+	errMissingIdentifier = errors.New("identifier is required")
+	errNear              = errors.New("near must be latitude|longitude|distance|units, units km or m")
+	errNearLocation      = errors.New("near is only searched on Location")
+	errPaging            = errors.New("_count and _offset must be positive numbers")
+)
+
+// defaultNearKm is the distance of near when it has only the point
+const defaultNearKm = 10
+
+// Controller is what the handler needs from *nhic.Controller
+type Controller interface {
+	GetPatient(ctx context.Context, pq *nhic.PatientQuery) (*store.Patient, error)
+	GetPatientByID(ctx context.Context, id string) (*store.Patient, error)
+	GetPatientByHealthID(ctx context.Context, healthID string) (*store.Patient, error)
+	SearchPatients(ctx context.Context, q *nhic.PatientSearchQuery) (*nhic.PatientPage, error)
+	SearchPatientNames(ctx context.Context, q *nhic.NameSearchQuery) (*nhic.PatientMatchPage, error)
+	GetPractitioner(ctx context.Context, id string) (*store.Practitioner, error)
+	SearchPractitionerNames(ctx context.Context, q *nhic.NameSearchQuery) (*nhic.PractitionerMatchPage, error)
+	GetEstablishment(ctx context.Context, id string) (*store.Establishment, error)
+	GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error)
+	GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error)
+	SearchEstablishments(ctx context.Context, q *nhic.EstablishmentQuery) (*nhic.EstablishmentPage, error)
+}
+
+// Handler serves the FHIR api, paths are relative to where it's mounted
+//
+//	GET /Patient/{id}                                   read, id is the id number
+//	GET /Patient?identifier={system}|{value}&birthdate=  search
+//	GET /Patient?family=&given=&birthdate=&gender=      PDQm, stored patients only
+//	GET /Patient?name=&birthdate=&gender=               ranked by how close the name is, stored patients only
+//	GET /Patient/$ihe-pix?sourceIdentifier={system}|{value}&targetSystem=
+//	GET /Practitioner/{id}
+//	GET /Practitioner?identifier={system}|{value}
+//	GET /Practitioner?name=&birthdate=&gender=          ranked like Patient, stored practitioners only
+//	GET /PractitionerRole/{id}                          same id as the practitioner
+//	GET /PractitionerRole?practitioner=Practitioner/{id}
+//	GET /Organization/{id}                              id is the organization id
+//	GET /Organization?name=&address-city=&type=&_count=&_offset=
+//	GET /Location/{id}                                  same id as the organization
+//	GET /Location?name=&address-city=&type=&near={lat}|{lng}|{distance}|{units}&_count=&_offset=
+type Handler struct {
+	c Controller
+	// base is the url the handler is mounted at e.g. https://nhic.example/fhir,
+	// used in the fullUrl of the search results
+	base string
+	log  *logging.Logger
+}
+
+// NewHandler returns a Handler looking the resources up through c and logging to log,
+// base is the url it's mounted at
+func NewHandler(c Controller, base string, log *logging.Logger) *Handler {
+	return &Handler{c: c, base: strings.TrimSuffix(base, "/"), log: log}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeOutcome(r.Context(), w, http.StatusMethodNotAllowed, "not-supported", "the registry is read only")
+		return
+	}
+	// the lookups are audited with the caller and purpose of the request,
+	// unless the auth in front of the api already set them
+	if audit.FromContext(r.Context()) == (audit.Access{}) {
+		r = r.WithContext(audit.NewContext(r.Context(), audit.FromRequest(r)))
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	switch {
+	case len(parts) == 1 && parts[0] == "Patient":
+		h.searchPatient(w, r)
+	case len(parts) == 2 && parts[0] == "Patient" && parts[1] == "$ihe-pix":
+		h.pix(w, r)
+	case len(parts) == 2 && parts[0] == "Patient":
+		h.readPatient(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "Practitioner" && q.Get("identifier") == "" && q.Get("name") != "":
+		h.searchPractitionerNames(w, r)
+	case len(parts) == 1 && parts[0] == "Practitioner":
+		id, err := practitionerID(q.Get("identifier"))
+		if err != nil {
+			h.writeOutcome(r.Context(), w, http.StatusBadRequest, "not-supported", err.Error())
+			return
+		}
+		h.searchPractitioner(w, r, id, "Practitioner")
+	case len(parts) == 2 && parts[0] == "Practitioner":
+		h.readPractitioner(w, r, parts[1], "Practitioner")
+	case len(parts) == 1 && parts[0] == "PractitionerRole":
+		h.searchPractitioner(w, r, strings.TrimPrefix(q.Get("practitioner"), "Practitioner/"), "PractitionerRole")
+	case len(parts) == 2 && parts[0] == "PractitionerRole":
+		h.readPractitioner(w, r, parts[1], "PractitionerRole")
+	case len(parts) == 1 && (parts[0] == "Organization" || parts[0] == "Location"):
+		h.searchEstablishments(w, r, parts[0])
+	case len(parts) == 2 && (parts[0] == "Organization" || parts[0] == "Location"):
+		h.readEstablishment(w, r, parts[1], parts[0])
+	default:
+		h.writeOutcome(r.Context(), w, http.StatusNotFound, "not-found", "unknown resource type or path")
+	}
+}
+
+// readPatient returns the patient stored under the id number, it doesn't call the identity sources
+// since a read has no birth date, search finds patients that aren't stored yet
+func (h *Handler) readPatient(w http.ResponseWriter, r *http.Request, id string) {
+	pnt, err := h.c.GetPatientByID(r.Context(), id)
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	h.writeResource(r.Context(), w, http.StatusOK, PatientFromStore(pnt))
+}
+
+// searchPatient looks the patient up by identifier and birthdate like GET /patient does,
+// id-country is the member that issued a gcc id. without an identifier it's a PDQm
+// search by demographics, or by name
+func (h *Handler) searchPatient(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("identifier") == "" {
+		if q.Get("name") != "" {
+			h.searchPatientNames(w, r)
+			return
+		}
+		if q.Get("family") != "" || q.Get("given") != "" || q.Get("birthdate") != "" {
+			h.searchDemographics(w, r)
+			return
+		}
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "required", errMissingIdentifier.Error())
+		return
+	}
+	pq, err := patientQuery(q.Get("identifier"), q.Get("birthdate"), q.Get("id-country"))
+	if err != nil {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "not-supported", err.Error())
+		return
+	}
+	if err := pq.Validate(); err != nil {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset"}
+	pnt, err := h.c.GetPatient(r.Context(), pq)
+	if err != nil && !isNotFound(err) {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	if err == nil && pnt != nil {
+		p := PatientFromStore(pnt)
+		bundle.Total = 1
+		bundle.Entry = []BundleEntry{{
+			FullURL:  h.base + "/Patient/" + p.ID,
+			Resource: p,
+			Search:   &EntrySearch{Mode: "match"},
+		}}
+	}
+	h.writeResource(r.Context(), w, http.StatusOK, bundle)
+}
+
+// readPractitioner returns the Practitioner or PractitionerRole of the id number,
+// GetPractitioner adds it from SCFHS if it isn't stored
+func (h *Handler) readPractitioner(w http.ResponseWriter, r *http.Request, id, resourceType string) {
+	pract, err := h.getPractitioner(r.Context(), id)
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	h.writeResource(r.Context(), w, http.StatusOK, practitionerResource(pract, resourceType))
+}
+
+func (h *Handler) searchPractitioner(w http.ResponseWriter, r *http.Request, id, resourceType string) {
+	if id == "" {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "required", errMissingIdentifier.Error())
+		return
+	}
+
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset"}
+	pract, err := h.getPractitioner(r.Context(), id)
+	if err != nil && !isNotFound(err) {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	if err == nil {
+		bundle.Total = 1
+		bundle.Entry = []BundleEntry{{
+			FullURL:  h.base + "/" + resourceType + "/" + id,
+			Resource: practitionerResource(pract, resourceType),
+			Search:   &EntrySearch{Mode: "match"},
+		}}
+	}
+	h.writeResource(r.Context(), w, http.StatusOK, bundle)
+}
+
+// getPractitioner is Controller.GetPractitioner with a missing practitioner as store.ErrNotFound
+func (h *Handler) getPractitioner(ctx context.Context, id string) (*store.Practitioner, error) {
+	pract, err := h.c.GetPractitioner(ctx, id)
+	if err == nil && (pract == nil || pract.IDNumber == nil) {
+		return nil, store.ErrNotFound
+	}
+	return pract, err
+}
+
+func practitionerResource(pract *store.Practitioner, resourceType string) interface{} {
+	if resourceType == "PractitionerRole" {
+		return PractitionerRoleFromStore(pract)
+	}
+	return PractitionerFromStore(pract)
+}
+
+// practitionerID reads the identifier search param of Practitioner, practitioners are
+// looked up by national id or iqama, with or without the system
+func practitionerID(identifier string) (string, error) {
+	parts := strings.SplitN(identifier, "|", 2)
+	if len(parts) == 1 {
+		return identifier, nil
+	}
+	if parts[0] != SystemNationalID && parts[0] != SystemIqama {
+		return "", errUnsupportedSystem
+	}
+	return parts[1], nil
+}
+
+// readEstablishment returns the Organization or Location of the organization id
+func (h *Handler) readEstablishment(w http.ResponseWriter, r *http.Request, id, resourceType string) {
+	est, err := h.c.GetEstablishment(r.Context(), id)
+	if err == nil && est == nil {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	// the v2 row only adds the 700 number, the resource is written without it if it's missing
+	v2, err := h.c.GetEstablishmentV2(r.Context(), id)
+	if err != nil && !isNotFound(err) {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	h.writeResource(r.Context(), w, http.StatusOK, establishmentResource(est, v2, resourceType))
+}
+
+// searchEstablishments returns a page of the Organizations or Locations,
+// the bundle links to the next and previous pages
+func (h *Handler) searchEstablishments(w http.ResponseWriter, r *http.Request, resourceType string) {
+	q, err := establishmentQuery(r.URL.Query(), resourceType)
+	if err != nil {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	page, err := h.c.SearchEstablishments(r.Context(), q)
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	v2s, err := h.c.GetEstablishmentsV2(r.Context())
+	if err != nil && !isNotFound(err) {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	byID := map[string]*store.EstablishmentV2{}
+	if v2s != nil {
+		for i := range *v2s {
+			byID[str((*v2s)[i].OrganizationID)] = &(*v2s)[i]
+		}
+	}
+
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Total: page.Total}
+	for i := range page.Establishments {
+		est := &page.Establishments[i]
+		id := str(est.OrganizationID)
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			FullURL:  h.base + "/" + resourceType + "/" + id,
+			Resource: establishmentResource(est, byID[id], resourceType),
+			Search:   &EntrySearch{Mode: "match"},
+		})
+	}
+	bundle.Link = h.pageLinks(r.URL.Query(), resourceType, page.Offset, page.Count, page.Total)
+	h.writeResource(r.Context(), w, http.StatusOK, bundle)
+}
+
+func establishmentResource(est *store.Establishments, v2 *store.EstablishmentV2, resourceType string) interface{} {
+	if resourceType == "Location" {
+		return LocationFromStore(est, v2)
+	}
+	return OrganizationFromStore(est, v2)
+}
+
+// pageLinks are the self, previous and next links of a page, with the params of the search
+func (h *Handler) pageLinks(params url.Values, resourceType string, offset, count, total int) []BundleLink {
+	link := func(relation string, offset int) BundleLink {
+		params.Set("_offset", strconv.Itoa(offset))
+		params.Set("_count", strconv.Itoa(count))
+		return BundleLink{Relation: relation, URL: h.base + "/" + resourceType + "?" + params.Encode()}
+	}
+
+	links := []BundleLink{link("self", offset)}
+	if offset > 0 {
+		prev := offset - count
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link("previous", prev))
+	}
+	if offset+count < total {
+		links = append(links, link("next", offset+count))
+	}
+	return links
+}
+
+// establishmentQuery reads the search params of Organization and Location,
+// near is only searched by Location since an Organization has no position
+func establishmentQuery(params url.Values, resourceType string) (*nhic.EstablishmentQuery, error) {
+	q := &nhic.EstablishmentQuery{
+		Name: params.Get("name"),
+		City: params.Get("address-city"),
+	}
+	if name := params.Get("name:contains"); name != "" {
+		q.Name, q.NameContains = name, true
+	}
+	// system|code or the code alone, the codes don't overlap between the systems
+	if t := strings.SplitN(params.Get("type"), "|", 2); len(t) == 2 {
+		q.Type = t[1]
+	} else {
+		q.Type = t[0]
+	}
+
+	var err error
+	if q.Offset, q.Count, err = paging(params); err != nil {
+		return nil, err
+	}
+
+	if near := params.Get("near"); near != "" {
+		if resourceType != "Location" {
+			return nil, errNearLocation
+		}
+		if q.Near, err = nearParam(near); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// paging reads _offset and _count, they're 0 if missing
+func paging(params url.Values) (offset, count int, err error) {
+	if v := params.Get("_count"); v != "" {
+		if count, err = strconv.Atoi(v); err != nil || count < 0 {
+			return 0, 0, errPaging
+		}
+	}
+	if v := params.Get("_offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errPaging
+		}
+	}
+	return offset, count, nil
+}
+
+// nearParam reads latitude|longitude|distance|units, the distance is in km
+func nearParam(near string) (*nhic.Near, error) {
+	parts := strings.Split(near, "|")
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, errNear
+	}
+	n := &nhic.Near{Distance: defaultNearKm}
+	var err error
+	if n.Latitude, err = strconv.ParseFloat(parts[0], 64); err != nil || n.Latitude < -90 || n.Latitude > 90 {
+		return nil, errNear
+	}
+	if n.Longitude, err = strconv.ParseFloat(parts[1], 64); err != nil || n.Longitude < -180 || n.Longitude > 180 {
+		return nil, errNear
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if n.Distance, err = strconv.ParseFloat(parts[2], 64); err != nil || n.Distance < 0 {
+			return nil, errNear
+		}
+	}
+	if len(parts) == 4 {
+		switch parts[3] {
+		case "km", "":
+		case "m":
+			n.Distance /= 1000
+		default:
+			return nil, errNear
+		}
+	}
+	return n, nil
+}
+
+func isNotFound(err error) bool {
+	return err == nhic.ErrNotFound || err == store.ErrNotFound
+}
+
+// writeErr writes the OperationOutcome of a controller error,
+// unexpected errors are logged and not written
+func (h *Handler) writeErr(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case isNotFound(err):
+		h.writeOutcome(ctx, w, http.StatusNotFound, "not-found", "resource not found")
+	case err == nhic.ErrSearchInput, err == nhic.ErrBadArgs, err == nhic.ErrBadBirthDate, err == nhic.ErrBadGender,
+		err == nhic.ErrPurposeOfUse:
+		h.writeOutcome(ctx, w, http.StatusBadRequest, "invalid", err.Error())
+	case err == nhic.ErrConsentDenied:
+		h.writeOutcome(ctx, w, http.StatusForbidden, "forbidden", err.Error())
+	case err == nhic.ErrSearchUnsupported, err == nhic.ErrHealthIDsUnsupported, err == nhic.ErrNameSearchUnsupported:
+		h.writeOutcome(ctx, w, http.StatusNotImplemented, "not-supported", err.Error())
+	case err == nhic.ErrTimeout:
+		h.writeOutcome(ctx, w, http.StatusGatewayTimeout, "timeout", err.Error())
+	default:
+		// e.g. SCFHS errors are returned as is by GetPractitioner
+		h.log.Error(ctx, "fhir: lookup failed", logging.Err(err))
+		h.writeOutcome(ctx, w, http.StatusInternalServerError, "exception", "internal error")
+	}
+}
+
+func (h *Handler) writeOutcome(ctx context.Context, w http.ResponseWriter, status int, code, diagnostics string) {
+	h.writeResource(ctx, w, status, &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []Issue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	})
+}
+
+func (h *Handler) writeResource(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warn(ctx, "fhir: response not written", logging.Err(err))
+	}
+}
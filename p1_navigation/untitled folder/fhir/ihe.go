@@ -0,0 +1,134 @@
+package fhir
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// the IHE profiles on top of Patient, see https://profiles.ihe.net/ITI/PIXm and https://profiles.ihe.net/ITI/PDQm
+
+var (
+	errSourceIdentifier = errors.New("sourceIdentifier must be {system}|{value} of the health id, national id or iqama")
+	errTargetSystem     = errors.New("targetSystem isn't one of the health id, national id or iqama")
+)
+
+// pixSystems are the identifier domains PIXm cross-references, by system
+var pixSystems = map[string]nhic.IDType{
+	SystemHealthID:   "",
+	SystemNationalID: nhic.IDTypeNationalID,
+	SystemIqama:      nhic.IDTypeIqama,
+}
+
+// Parameters is the result of an operation, see https://hl7.org/fhir/R4/parameters.html
+type Parameters struct {
+	ResourceType string      `json:"resourceType"`
+	Parameter    []Parameter `json:"parameter,omitempty"`
+}
+
+type Parameter struct {
+	Name            string      `json:"name"`
+	ValueIdentifier *Identifier `json:"valueIdentifier,omitempty"`
+	ValueReference  *Reference  `json:"valueReference,omitempty"`
+}
+
+// pix is the PIXm $ihe-pix operation, it translates the source identifier to the identifiers
+// of the same patient in the other domains, or in the targetSystem ones.
+// only the patients stored in the registry are cross-referenced
+func (h *Handler) pix(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	source := strings.SplitN(q.Get("sourceIdentifier"), "|", 2)
+	if len(source) != 2 || source[1] == "" {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", errSourceIdentifier.Error())
+		return
+	}
+	idType, ok := pixSystems[source[0]]
+	if !ok {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "code-invalid", errSourceIdentifier.Error())
+		return
+	}
+	targets := map[string]bool{}
+	for _, t := range q["targetSystem"] {
+		if _, ok := pixSystems[t]; !ok {
+			// PIXm answers unknown target domains with 403
+			h.writeOutcome(r.Context(), w, http.StatusForbidden, "code-invalid", errTargetSystem.Error())
+			return
+		}
+		targets[t] = true
+	}
+
+	var pnt *store.Patient
+	var err error
+	if source[0] == SystemHealthID {
+		pnt, err = h.c.GetPatientByHealthID(r.Context(), source[1])
+	} else {
+		pq := &nhic.PatientQuery{ID: source[1], IDType: string(idType)}
+		if err := pq.ValidateID(); err != nil {
+			h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		pnt, err = h.c.GetPatientByID(r.Context(), source[1])
+	}
+	if err == nil && pnt == nil {
+		err = nhic.ErrNotFound
+	}
+	if err == healthid.ErrMalformed || err == healthid.ErrChecksum {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	} else if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+
+	params := &Parameters{ResourceType: "Parameters"}
+	for _, id := range registryIdentifiers(pnt.HealthID, pnt.IDType, pnt.IDNumber) {
+		if id.System == source[0] || (len(targets) > 0 && !targets[id.System]) {
+			continue
+		}
+		id := Identifier{System: id.System, Value: id.Value}
+		params.Parameter = append(params.Parameter, Parameter{Name: "targetIdentifier", ValueIdentifier: &id})
+	}
+	params.Parameter = append(params.Parameter, Parameter{
+		Name:           "targetId",
+		ValueReference: &Reference{Reference: h.base + "/Patient/" + str(pnt.IDNumber)},
+	})
+	h.writeResource(r.Context(), w, http.StatusOK, params)
+}
+
+// searchDemographics is the PDQm search by family, given, birthdate and gender,
+// it's paged like the establishments
+func (h *Handler) searchDemographics(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := &nhic.PatientSearchQuery{
+		Family:    params.Get("family"),
+		Given:     params.Get("given"),
+		BirthDate: params.Get("birthdate"),
+		Gender:    params.Get("gender"),
+	}
+	var err error
+	if q.Offset, q.Count, err = paging(params); err != nil {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	page, err := h.c.SearchPatients(r.Context(), q)
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Total: page.Total}
+	for i := range page.Patients {
+		p := PatientFromStore(&page.Patients[i])
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			FullURL:  h.base + "/Patient/" + p.ID,
+			Resource: p,
+			Search:   &EntrySearch{Mode: "match"},
+		})
+	}
+	bundle.Link = h.pageLinks(params, "Patient", page.Offset, page.Count, page.Total)
+	h.writeResource(r.Context(), w, http.StatusOK, bundle)
+}
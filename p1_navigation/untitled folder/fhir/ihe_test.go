@@ -0,0 +1,80 @@
+package fhir
+
+import (
+	"net/http"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func TestPIX(t *testing.T) {
+	h := NewHandler(&fakeController{pnt: &store.Patient{IDNumber: sp("1000000008"), HealthID: sp("ID10000084583721")}}, "http://nhic.example/fhir", nil)
+	pix := "/Patient/$ihe-pix?sourceIdentifier="
+
+	tests := []struct {
+		name    string
+		path    string
+		code    int
+		targets []string
+	}{
+		{"by health id", pix + SystemHealthID + "|ID10000084583721", http.StatusOK, []string{SystemNationalID}},
+		{"by national id", pix + SystemNationalID + "|1000000008", http.StatusOK, []string{SystemHealthID}},
+		{"target system", pix + SystemNationalID + "|1000000008&targetSystem=" + SystemIqama, http.StatusOK, nil},
+		{"unknown target system", pix + SystemNationalID + "|1000000008&targetSystem=urn:x", http.StatusForbidden, nil},
+		{"unknown source system", pix + "urn:x|1", http.StatusBadRequest, nil},
+		{"no value", pix + SystemNationalID + "|", http.StatusBadRequest, nil},
+		{"other health id", pix + SystemHealthID + "|ID10000000000016", http.StatusNotFound, nil},
+		{"bad checksum", pix + SystemNationalID + "|1000000007", http.StatusBadRequest, nil},
+		{"not stored", pix + SystemNationalID + "|1000000016", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		code, v := get(h, tt.path)
+		if code != tt.code {
+			t.Errorf("%s: got %d, want %d: %v", tt.name, code, tt.code, v)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		// the identifiers, then the reference of the patient
+		params := v["parameter"].([]interface{})
+		if len(params) != len(tt.targets)+1 {
+			t.Errorf("%s: got %v", tt.name, params)
+			continue
+		}
+		for i, target := range tt.targets {
+			id := params[i].(map[string]interface{})["valueIdentifier"].(map[string]interface{})
+			if id["system"] != target {
+				t.Errorf("%s: got %v, want %s", tt.name, id["system"], target)
+			}
+		}
+	}
+}
+
+func TestPDQ(t *testing.T) {
+	c := &fakeController{pnt: &store.Patient{IDNumber: sp("1000000008"), FirstNameEn: sp("Ali")}}
+	h := NewHandler(c, "http://nhic.example/fhir", nil)
+
+	tests := []struct {
+		name string
+		path string
+		err  error
+		code int
+	}{
+		{"birth date alone", "/Patient?birthdate=1985-04-06", nil, http.StatusOK},
+		{"bad gender", "/Patient?family=ali&gender=x", nhic.ErrBadGender, http.StatusBadRequest},
+		{"bad count", "/Patient?family=ali&_count=x", nil, http.StatusBadRequest},
+		{"store can't search", "/Patient?family=ali", nhic.ErrSearchUnsupported, http.StatusNotImplemented},
+		{"family and gender", "/Patient?family=ali&gender=male&_count=10", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		c.err = tt.err
+		if code, v := get(h, tt.path); code != tt.code {
+			t.Errorf("%s: got %d, want %d: %v", tt.name, code, tt.code, v)
+		}
+	}
+	if c.patients.Family != "ali" || c.patients.Gender != "male" || c.patients.Count != 10 {
+		t.Errorf("query %+v", c.patients)
+	}
+}
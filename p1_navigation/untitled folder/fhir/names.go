@@ -0,0 +1,76 @@
+package fhir
+
+import (
+	"net/http"
+	"net/url"
+
+	"gitlab.lean/leandevclan/nhic"
+)
+
+// searchPatientNames is the search by name, the closest names first with their score
+func (h *Handler) searchPatientNames(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q, err := nameQuery(params)
+	if err != nil {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	page, err := h.c.SearchPatientNames(r.Context(), q)
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Total: page.Total}
+	for i := range page.Matches {
+		p := PatientFromStore(&page.Matches[i].Patient)
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			FullURL:  h.base + "/Patient/" + p.ID,
+			Resource: p,
+			Search:   &EntrySearch{Mode: "match", Score: page.Matches[i].Score},
+		})
+	}
+	bundle.Link = h.pageLinks(params, "Patient", page.Offset, page.Count, page.Total)
+	h.writeResource(r.Context(), w, http.StatusOK, bundle)
+}
+
+// searchPractitionerNames is searchPatientNames for the practitioners
+func (h *Handler) searchPractitionerNames(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q, err := nameQuery(params)
+	if err != nil {
+		h.writeOutcome(r.Context(), w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	page, err := h.c.SearchPractitionerNames(r.Context(), q)
+	if err != nil {
+		h.writeErr(r.Context(), w, err)
+		return
+	}
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Total: page.Total}
+	for i := range page.Matches {
+		pract := &page.Matches[i].Practitioner
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			FullURL:  h.base + "/Practitioner/" + str(pract.IDNumber),
+			Resource: practitionerResource(pract, "Practitioner"),
+			Search:   &EntrySearch{Mode: "match", Score: page.Matches[i].Score},
+		})
+	}
+	bundle.Link = h.pageLinks(params, "Practitioner", page.Offset, page.Count, page.Total)
+	h.writeResource(r.Context(), w, http.StatusOK, bundle)
+}
+
+// nameQuery reads name, birthdate, gender and the paging params
+func nameQuery(params url.Values) (*nhic.NameSearchQuery, error) {
+	q := &nhic.NameSearchQuery{
+		Name:      params.Get("name"),
+		BirthDate: params.Get("birthdate"),
+		Gender:    params.Get("gender"),
+	}
+	var err error
+	if q.Offset, q.Count, err = paging(params); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
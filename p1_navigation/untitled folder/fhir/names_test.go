@@ -0,0 +1,44 @@
+package fhir
+
+import (
+	"net/http"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func TestNameSearch(t *testing.T) {
+	c := &fakeController{pnt: &store.Patient{IDNumber: sp("1000000008"), FirstNameEn: sp("Mohammed")},
+		pract: &store.Practitioner{IDNumber: sp("2000000006"), FirstNameEn: sp("Sara")}}
+	h := NewHandler(c, "http://nhic.example/fhir", nil)
+
+	tests := []struct {
+		name  string
+		path  string
+		err   error
+		code  int
+		score float64
+	}{
+		{"patient", "/Patient?name=muhammad&gender=male", nil, http.StatusOK, 0.97},
+		{"practitioner", "/Practitioner?name=sara", nil, http.StatusOK, 0.9},
+		{"bad gender", "/Patient?name=muhammad&gender=x", nhic.ErrBadGender, http.StatusBadRequest, 0},
+		{"bad offset", "/Patient?name=muhammad&_offset=x", nil, http.StatusBadRequest, 0},
+		{"store can't search", "/Practitioner?name=sara", nhic.ErrNameSearchUnsupported, http.StatusNotImplemented, 0},
+	}
+	for _, tt := range tests {
+		c.err = tt.err
+		code, v := get(h, tt.path)
+		if code != tt.code {
+			t.Errorf("%s: got %d, want %d: %v", tt.name, code, tt.code, v)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		entry := v["entry"].([]interface{})[0].(map[string]interface{})
+		if score := entry["search"].(map[string]interface{})["score"]; score != tt.score {
+			t.Errorf("%s: score %v, want %v", tt.name, score, tt.score)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package fhir
+
+import (
+	"strconv"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+const (
+	SystemOrganizationID = "urn:nhic:organization-id"
+	// MOH establishment code
+	SystemEstablishmentCode = "urn:nhic:establishment-code"
+	// NPHIES provider license system
+	SystemProviderLicense = "http://nphies.sa/license/provider-license"
+	SystemSehaID          = "urn:nhic:seha-id"
+
+	systemEntityType  = "urn:nhic:entity-type"
+	systemSector      = "urn:nhic:sector"
+	systemTypeOfCare  = "urn:nhic:type-of-care"
+	systemLevelOfCare = "urn:nhic:level-of-care"
+)
+
+// Organization is the FHIR R4 Organization, see https://hl7.org/fhir/R4/organization.html
+type Organization struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Active       bool              `json:"active"`
+	Type         []CodeableConcept `json:"type,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Alias        []string          `json:"alias,omitempty"`
+	Telecom      []ContactPoint    `json:"telecom,omitempty"`
+	Address      []Address         `json:"address,omitempty"`
+}
+
+// Location is the FHIR R4 Location of an establishment, see https://hl7.org/fhir/R4/location.html
+type Location struct {
+	ResourceType         string            `json:"resourceType"`
+	ID                   string            `json:"id,omitempty"`
+	Status               string            `json:"status,omitempty"`
+	Name                 string            `json:"name,omitempty"`
+	Alias                []string          `json:"alias,omitempty"`
+	Type                 []CodeableConcept `json:"type,omitempty"`
+	Telecom              []ContactPoint    `json:"telecom,omitempty"`
+	Address              *Address          `json:"address,omitempty"`
+	Position             *Position         `json:"position,omitempty"`
+	ManagingOrganization *Reference        `json:"managingOrganization,omitempty"`
+}
+
+type Position struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+}
+
+// OrganizationFromStore maps est, its id is the organization id. v2 adds the 700 number, it can be nil
+func OrganizationFromStore(est *store.Establishments, v2 *store.EstablishmentV2) *Organization {
+	o := &Organization{
+		ResourceType: "Organization",
+		ID:           str(est.OrganizationID),
+		Identifier:   establishmentIdentifiers(est),
+		Active:       true,
+		Telecom:      establishmentTelecom(est, v2),
+	}
+	o.Name, o.Alias = establishmentName(est)
+	if t := codeable(systemEntityType, est.EntityTypeCode, est.EntityTypeEn, est.EntityTypeAr); t != nil {
+		o.Type = append(o.Type, *t)
+	}
+	if t := codeable(systemSector, est.SectorCode, est.SectorEn, est.SectorAr); t != nil {
+		o.Type = append(o.Type, *t)
+	}
+	if a := establishmentAddress(est); a != nil {
+		o.Address = []Address{*a}
+	}
+	return o
+}
+
+// LocationFromStore maps the place of est, it has the same id as its Organization
+func LocationFromStore(est *store.Establishments, v2 *store.EstablishmentV2) *Location {
+	id := str(est.OrganizationID)
+	l := &Location{
+		ResourceType: "Location",
+		ID:           id,
+		Status:       "active",
+		Telecom:      establishmentTelecom(est, v2),
+		Address:      establishmentAddress(est),
+		Position:     position(est),
+	}
+	l.Name, l.Alias = establishmentName(est)
+	l.ManagingOrganization = &Reference{Reference: "Organization/" + id, Display: l.Name}
+	if t := codeable(systemTypeOfCare, est.TypeOfCareCode, est.TypeOfCare, nil); t != nil {
+		l.Type = append(l.Type, *t)
+	}
+	if t := codeable(systemLevelOfCare, est.LevelOfCare, est.LevelOfCare, nil); t != nil {
+		l.Type = append(l.Type, *t)
+	}
+	return l
+}
+
+func establishmentIdentifiers(est *store.Establishments) []Identifier {
+	var ids []Identifier
+	for _, id := range []struct {
+		system string
+		value  *string
+	}{
+		{SystemOrganizationID, est.OrganizationID},
+		{SystemEstablishmentCode, est.Code},
+		{SystemProviderLicense, est.LicenseNumber},
+		{SystemSehaID, est.SehaID},
+	} {
+		if v := str(id.value); v != "" {
+			ids = append(ids, Identifier{System: id.system, Value: v})
+		}
+	}
+	return ids
+}
+
+// establishmentName is the english name with the arabic one as alias, or the arabic one alone
+func establishmentName(est *store.Establishments) (string, []string) {
+	en, ar := strings.TrimSpace(str(est.NameEn)), strings.TrimSpace(str(est.NameAr))
+	if en == "" {
+		return ar, nil
+	}
+	if ar == "" {
+		return en, nil
+	}
+	return en, []string{ar}
+}
+
+func establishmentTelecom(est *store.Establishments, v2 *store.EstablishmentV2) []ContactPoint {
+	var telecom []ContactPoint
+	add := func(system string, value *string) {
+		if v := strings.TrimSpace(str(value)); v != "" {
+			telecom = append(telecom, ContactPoint{System: system, Value: v, Use: "work"})
+		}
+	}
+	add("phone", est.PhoneNumber)
+	if v2 != nil {
+		add("phone", v2.The700Number)
+	}
+	add("email", est.Email)
+	add("url", est.Website)
+	return telecom
+}
+
+func establishmentAddress(est *store.Establishments) *Address {
+	a := &Address{
+		Use:        "work",
+		Type:       "physical",
+		Text:       strings.TrimSpace(str(est.FullAddress)),
+		District:   str(est.AddressDistrictName),
+		City:       str(est.AddressCity),
+		State:      str(est.RegionEn),
+		PostalCode: str(est.AddressPostalCode),
+	}
+	if a.City == "" {
+		a.City = str(est.CityEn)
+	}
+	if line := strings.TrimSpace(str(est.AddressBuildingNumber) + " " + str(est.AddressStreetName)); line != "" {
+		a.Line = []string{line}
+	}
+	if a.Text == "" && a.City == "" && len(a.Line) == 0 {
+		return nil
+	}
+	a.Country = "SA"
+	return a
+}
+
+func position(est *store.Establishments) *Position {
+	if est.Latitude == nil || est.Longitude == nil {
+		return nil
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(*est.Latitude), 64)
+	if err != nil {
+		return nil
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(*est.Longitude), 64)
+	if err != nil {
+		return nil
+	}
+	return &Position{Latitude: lat, Longitude: lng}
+}
@@ -0,0 +1,131 @@
+package fhir
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func TestOrganizationFromStore(t *testing.T) {
+	est := &store.Establishment{OrganizationID: sp("10001"), Code: sp("H-1"), NameEn: sp("Noor Hospital"), NameAr: sp("مستشفى النور"),
+		PhoneNumber: sp("0111234567"), EntityTypeCode: sp("HOSP"), EntityTypeEn: sp("Hospital"), CityEn: sp("Riyadh"),
+		AddressBuildingNumber: sp("12"), AddressStreetName: sp("King Fahd Rd"), Latitude: sp(" 24.7 "), Longitude: sp("46.6")}
+	v2 := &store.EstablishmentV2{OrganizationID: sp("10001"), The700Number: sp("920000000")}
+	o, l := OrganizationFromStore(est, v2), LocationFromStore(est, nil)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"id", o.ID, "10001"},
+		{"code", o.Identifier[1].System + "|" + o.Identifier[1].Value, SystemEstablishmentCode + "|H-1"},
+		{"english name", o.Name, "Noor Hospital"},
+		{"arabic alias", o.Alias[0], "مستشفى النور"},
+		{"700 number", len(o.Telecom), 2},
+		{"type", o.Type[0].Coding[0].Code, "HOSP"},
+		{"city falls back to the english one", o.Address[0].City, "Riyadh"},
+		{"line", o.Address[0].Line[0], "12 King Fahd Rd"},
+		{"location of the organization", l.ManagingOrganization.Reference, "Organization/10001"},
+		{"no v2", len(l.Telecom), 1},
+		{"position", l.Position.Latitude, 24.7},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if l := LocationFromStore(&store.Establishment{OrganizationID: sp("1"), Latitude: sp("x"), Longitude: sp("46.6")}, nil); l.Position != nil || l.Address != nil {
+		t.Errorf("bad position %+v", l)
+	}
+}
+
+func TestNearParam(t *testing.T) {
+	tests := []struct {
+		near     string
+		distance float64
+		err      error
+	}{
+		{"24.7|46.6", defaultNearKm, nil},
+		{"24.7|46.6|5", 5, nil},
+		{"24.7|46.6|500|m", 0.5, nil},
+		{"24.7|46.6||km", defaultNearKm, nil},
+		{"24.7", 0, errNear},
+		{"91|46.6", 0, errNear},
+		{"24.7|46.6|5|mi", 0, errNear},
+		{"24.7|46.6|-1", 0, errNear},
+	}
+	for _, tt := range tests {
+		n, err := nearParam(tt.near)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.near, err, tt.err)
+		} else if err == nil && n.Distance != tt.distance {
+			t.Errorf("%s: got %v km, want %v", tt.near, n.Distance, tt.distance)
+		}
+	}
+}
+
+func TestEstablishmentQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		params       string
+		resourceType string
+		err          error
+	}{
+		{"name and city", "name=noor&address-city=riyadh", "Organization", nil},
+		{"type with the system", "type=urn:nhic:entity-type|HOSP", "Organization", nil},
+		{"near", "near=24.7|46.6&_count=10&_offset=20", "Location", nil},
+		{"near an organization", "near=24.7|46.6", "Organization", errNearLocation},
+		{"bad count", "_count=x", "Location", errPaging},
+		{"negative offset", "_offset=-1", "Location", errPaging},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.params)
+		q, err := establishmentQuery(params, tt.resourceType)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && params.Get("type") != "" && q.Type != "HOSP" {
+			t.Errorf("%s: type %q", tt.name, q.Type)
+		}
+	}
+}
+
+func TestEstablishmentHandler(t *testing.T) {
+	c := &fakeController{est: &store.Establishment{OrganizationID: sp("10001"), NameEn: sp("Noor Hospital")},
+		v2: &store.EstablishmentV2{OrganizationID: sp("10001"), The700Number: sp("920000000")}}
+	h := NewHandler(c, "http://nhic.example/fhir", nil)
+
+	tests := []struct {
+		name  string
+		path  string
+		code  int
+		links []string
+	}{
+		{"read", "/Organization/10001", http.StatusOK, nil},
+		{"read location", "/Location/10001", http.StatusOK, nil},
+		{"not found", "/Location/10002", http.StatusNotFound, nil},
+		{"first page", "/Organization?name=noor", http.StatusOK, []string{"self", "next"}},
+		{"middle page", "/Location?near=24.7|46.6&_offset=20", http.StatusOK, []string{"self", "previous", "next"}},
+		{"last page", "/Location?_offset=40&_count=10", http.StatusOK, []string{"self", "previous"}},
+		{"near an organization", "/Organization?near=24.7|46.6", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		code, v := get(h, tt.path)
+		if code != tt.code {
+			t.Errorf("%s: got %d, want %d: %v", tt.name, code, tt.code, v)
+			continue
+		}
+		links, _ := v["link"].([]interface{})
+		if len(links) != len(tt.links) {
+			t.Errorf("%s: links %v", tt.name, links)
+			continue
+		}
+		for i, l := range links {
+			if rel := l.(map[string]interface{})["relation"]; rel != tt.links[i] {
+				t.Errorf("%s: link %d is %v, want %s", tt.name, i, rel, tt.links[i])
+			}
+		}
+	}
+}
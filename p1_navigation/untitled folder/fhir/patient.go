@@ -0,0 +1,249 @@
+package fhir
+
+import (
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// identifier systems, the NPHIES ones for the registry ids and ours for the health id
+const (
+	SystemHealthID     = "urn:nhic:health-id"
+	SystemNationalID   = "http://nphies.sa/identifier/nationalid"
+	SystemIqama        = "http://nphies.sa/identifier/iqama"
+	SystemBorderNumber = "http://nphies.sa/identifier/bordernumber"
+	SystemVisa         = "http://nphies.sa/identifier/visa"
+	SystemGCCID        = "http://nphies.sa/identifier/gccid"
+	SystemPassport     = "http://nphies.sa/identifier/passportnumber"
+)
+
+// extNameSource is on the english name, store.NameSourceAuthoritative or NameSourceGenerated
+const extNameSource = "urn:nhic:name-source"
+
+// Patient is the FHIR R4 Patient, see https://hl7.org/fhir/R4/patient.html
+type Patient struct {
+	ResourceType    string           `json:"resourceType"`
+	ID              string           `json:"id,omitempty"`
+	Extension       []Extension      `json:"extension,omitempty"`
+	Identifier      []Identifier     `json:"identifier,omitempty"`
+	Name            []HumanName      `json:"name,omitempty"`
+	Gender          string           `json:"gender,omitempty"`
+	BirthDate       string           `json:"birthDate,omitempty"`
+	DeceasedBoolean *bool            `json:"deceasedBoolean,omitempty"`
+	MaritalStatus   *CodeableConcept `json:"maritalStatus,omitempty"`
+}
+
+// idSystem is how an id family is written as an Identifier
+type idSystem struct {
+	system  string
+	code    string
+	display string
+	idType  nhic.IDType
+}
+
+// by store.Patient.IDType, the ids of newborns are the guardian's and aren't written
+var idSystems = map[string]idSystem{
+	"NationalId":   {system: SystemNationalID, code: "NI", display: "National unique individual identifier", idType: nhic.IDTypeNationalID},
+	"Iqama":        {system: SystemIqama, code: "PRC", display: "Permanent Resident Card Number", idType: nhic.IDTypeIqama},
+	"BorderNumber": {system: SystemBorderNumber, display: "Border Number", idType: nhic.IDTypeBorderNumber},
+	"VisitVisa":    {system: SystemVisa, code: "VS", display: "Visa", idType: nhic.IDTypeVisa},
+	"GCCID":        {system: SystemGCCID, code: "NI", display: "National unique individual identifier", idType: nhic.IDTypeGCCID},
+}
+
+// marital statuses as yakeen writes them in arabic or english, by the v3 code
+var maritalStatuses = map[string][]string{
+	"S": {"single", "أعزب", "عزباء"},
+	"M": {"married", "متزوج", "متزوجة"},
+	"D": {"divorced", "مطلق", "مطلقة"},
+	"W": {"widowed", "أرمل", "أرملة"},
+}
+
+// PatientFromStore maps pnt to a Patient, its id is the id number pnt is stored under
+func PatientFromStore(pnt *store.Patient) *Patient {
+	p := &Patient{
+		ResourceType:  "Patient",
+		ID:            str(pnt.IDNumber),
+		Identifier:    patientIdentifiers(pnt),
+		Gender:        gender(str(pnt.Gender)),
+		MaritalStatus: maritalStatus(str(pnt.MaritalStatus)),
+	}
+
+	if name := humanName("ar", pnt.FirstNameAr, pnt.SecondNameAr, pnt.ThirdNameAr, pnt.LastNameAr); name != nil {
+		p.Name = append(p.Name, *name)
+	}
+	if name := humanName("en", pnt.FirstNameEn, pnt.SecondNameEn, pnt.ThirdNameEn, pnt.LastNameEn); name != nil {
+		if src := str(pnt.NameEnSource); src != "" {
+			name.Extension = append(name.Extension, Extension{URL: extNameSource, ValueCode: src})
+		}
+		p.Name = append(p.Name, *name)
+	}
+
+	birth := pnt.DateOfBirthG
+	if birth == nil || birth.IsZero() {
+		birth = pnt.DateOfBirthH
+	}
+	p.BirthDate = date(birth)
+
+	if pnt.IsDead != nil {
+		dead := *pnt.IsDead == "1" || strings.EqualFold(*pnt.IsDead, "true")
+		p.DeceasedBoolean = &dead
+	}
+
+	if code := str(pnt.NationalityCode); code != "" {
+		p.Extension = append(p.Extension, Extension{
+			URL: extNationality,
+			Extension: []Extension{{
+				URL: "code",
+				ValueCodeableConcept: &CodeableConcept{
+					Coding: []Coding{{System: systemCountry, Code: code, Display: str(pnt.Nationality)}},
+				},
+			}},
+		})
+	}
+	return p
+}
+
+func patientIdentifiers(pnt *store.Patient) []Identifier {
+	ids := registryIdentifiers(pnt.HealthID, pnt.IDType, pnt.IDNumber)
+	if n := str(pnt.PassportNumber); n != "" {
+		ids = append(ids, Identifier{Use: "secondary", Type: identifierType("PPN", "Passport number"), System: SystemPassport, Value: n})
+	}
+	// visitors by visa have a border number too
+	if n := str(pnt.BorderNumber); n != "" && n != str(pnt.IDNumber) {
+		ids = append(ids, Identifier{Use: "secondary", Type: identifierType("", "Border Number"), System: SystemBorderNumber, Value: n})
+	}
+	return ids
+}
+
+// registryIdentifiers are the health id and the id number written by the system of idType
+func registryIdentifiers(healthID, idType, idNumber *string) []Identifier {
+	var ids []Identifier
+	if hid := str(healthID); hid != "" {
+		ids = append(ids, Identifier{
+			Use:    "usual",
+			Type:   identifierType("MR", "Medical record number"),
+			System: SystemHealthID,
+			Value:  hid,
+		})
+	}
+
+	t := str(idType)
+	if t == "" {
+		// older rows don't have it, national ids and iqamas are told by the first digit
+		switch {
+		case strings.HasPrefix(str(idNumber), "1"):
+			t = "NationalId"
+		case strings.HasPrefix(str(idNumber), "2"):
+			t = "Iqama"
+		}
+	}
+	if sys, ok := idSystems[t]; ok && str(idNumber) != "" {
+		ids = append(ids, Identifier{
+			Use:    "official",
+			Type:   identifierType(sys.code, sys.display),
+			System: sys.system,
+			Value:  *idNumber,
+		})
+	}
+	return ids
+}
+
+func identifierType(code, display string) *CodeableConcept {
+	if code == "" {
+		return &CodeableConcept{Text: display}
+	}
+	return &CodeableConcept{Coding: []Coding{{System: systemIdentifierType, Code: code, Display: display}}, Text: display}
+}
+
+// humanName is the official name in lang, nil if there's no part of it
+func humanName(lang string, first, second, third, last *string) *HumanName {
+	var given []string
+	for _, s := range []*string{first, second, third} {
+		if v := strings.TrimSpace(str(s)); v != "" {
+			given = append(given, v)
+		}
+	}
+	family := strings.TrimSpace(str(last))
+	if len(given) == 0 && family == "" {
+		return nil
+	}
+
+	text := strings.Join(given, " ")
+	if family != "" {
+		text = strings.TrimSpace(text + " " + family)
+	}
+	return &HumanName{
+		Extension: []Extension{{URL: extLanguage, ValueCode: lang}},
+		Use:       "official",
+		Text:      text,
+		Family:    family,
+		Given:     given,
+	}
+}
+
+// gender maps the gender of yakeen, nic and the gateway: M/F, male/female or 1/2
+func gender(g string) string {
+	switch strings.ToLower(strings.TrimSpace(g)) {
+	case "m", "male", "1", "ذكر":
+		return "male"
+	case "f", "female", "2", "أنثى":
+		return "female"
+	case "":
+		return ""
+	}
+	return "unknown"
+}
+
+func maritalStatus(s string) *CodeableConcept {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	for code, names := range maritalStatuses {
+		for _, n := range names {
+			if strings.EqualFold(s, n) {
+				return &CodeableConcept{Coding: []Coding{{System: systemMaritalStatus, Code: code}}, Text: s}
+			}
+		}
+	}
+	return &CodeableConcept{Coding: []Coding{{System: systemNullFlavor, Code: "UNK", Display: "unknown"}}, Text: s}
+}
+
+// date is d as a FHIR date, "" if it's missing or out of the calendar range
+func date(d *store.Date) string {
+	if d == nil || d.IsZero() {
+		return ""
+	}
+	t, err := d.Time()
+	if err != nil {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// patientQuery reads the identifier search param, system|value or value alone for
+// national ids and iqamas. country is the member of a gcc id
+func patientQuery(identifier, birthDate, country string) (*nhic.PatientQuery, error) {
+	pq := &nhic.PatientQuery{BirthDate: birthDate, Country: country}
+	parts := strings.SplitN(identifier, "|", 2)
+	if len(parts) == 1 {
+		pq.ID = identifier
+		return pq, nil
+	}
+	pq.ID = parts[1]
+	for _, sys := range idSystems {
+		if sys.system == parts[0] {
+			pq.IDType = string(sys.idType)
+			return pq, nil
+		}
+	}
+	return nil, errUnsupportedSystem
+}
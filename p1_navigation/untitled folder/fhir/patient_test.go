@@ -0,0 +1,250 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func parseDate(s string) *store.Date {
+	d, err := store.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return &d
+}
+
+// fakeController has one record of each kind, the others aren't found
+type fakeController struct {
+	pnt   *store.Patient
+	pract *store.Practitioner
+	est   *store.Establishment
+	v2    *store.EstablishmentV2
+	// err is returned by all the lookups if set
+	err error
+	// the last searches
+	establishments *nhic.EstablishmentQuery
+	patients       *nhic.PatientSearchQuery
+	names          *nhic.NameSearchQuery
+}
+
+func (f *fakeController) GetPatient(ctx context.Context, pq *nhic.PatientQuery) (*store.Patient, error) {
+	return f.GetPatientByID(ctx, pq.ID)
+}
+
+func (f *fakeController) GetPatientByID(ctx context.Context, id string) (*store.Patient, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.pnt == nil || id != str(f.pnt.IDNumber) {
+		return nil, store.ErrNotFound
+	}
+	return f.pnt, nil
+}
+
+func (f *fakeController) GetPatientByHealthID(ctx context.Context, healthID string) (*store.Patient, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.pnt == nil || healthID != str(f.pnt.HealthID) {
+		return nil, nhic.ErrNotFound
+	}
+	return f.pnt, nil
+}
+
+func (f *fakeController) SearchPatients(ctx context.Context, q *nhic.PatientSearchQuery) (*nhic.PatientPage, error) {
+	f.patients = q
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &nhic.PatientPage{Patients: []store.Patient{*f.pnt}, Total: 1, Count: 20}, nil
+}
+
+func (f *fakeController) SearchPatientNames(ctx context.Context, q *nhic.NameSearchQuery) (*nhic.PatientMatchPage, error) {
+	f.names = q
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &nhic.PatientMatchPage{Matches: []nhic.PatientMatch{{Patient: *f.pnt, Score: 0.97}}, Total: 1, Count: 20}, nil
+}
+
+func (f *fakeController) GetPractitioner(ctx context.Context, id string) (*store.Practitioner, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	// like the controller, a practitioner SCFHS doesn't know is empty
+	if f.pract == nil || id != str(f.pract.IDNumber) {
+		return &store.Practitioner{}, nil
+	}
+	return f.pract, nil
+}
+
+func (f *fakeController) SearchPractitionerNames(ctx context.Context, q *nhic.NameSearchQuery) (*nhic.PractitionerMatchPage, error) {
+	f.names = q
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &nhic.PractitionerMatchPage{Matches: []nhic.PractitionerMatch{{Practitioner: *f.pract, Score: 0.9}}, Total: 1, Count: 20}, nil
+}
+
+func (f *fakeController) GetEstablishment(ctx context.Context, id string) (*store.Establishment, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.est == nil || id != str(f.est.OrganizationID) {
+		return nil, nil
+	}
+	return f.est, nil
+}
+
+func (f *fakeController) GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error) {
+	if f.v2 == nil || id != str(f.v2.OrganizationID) {
+		return nil, store.ErrNotFound
+	}
+	return f.v2, nil
+}
+
+func (f *fakeController) GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error) {
+	if f.v2 == nil {
+		return nil, store.ErrNotFound
+	}
+	return &[]store.EstablishmentV2{*f.v2}, nil
+}
+
+func (f *fakeController) SearchEstablishments(ctx context.Context, q *nhic.EstablishmentQuery) (*nhic.EstablishmentPage, error) {
+	f.establishments = q
+	if f.err != nil {
+		return nil, f.err
+	}
+	count := q.Count
+	if count == 0 {
+		count = 20
+	}
+	return &nhic.EstablishmentPage{Establishments: []store.Establishments{*f.est}, Total: 45, Offset: q.Offset, Count: count}, nil
+}
+
+// get serves the path and decodes the resource written
+func get(h http.Handler, path string) (int, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var v map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &v)
+	return rec.Code, v
+}
+
+func TestPatientFromStore(t *testing.T) {
+	p := PatientFromStore(&store.Patient{IDNumber: sp("1000000008"), HealthID: sp("ID10000084583721"),
+		FirstNameAr: sp("علي"), SecondNameAr: sp("محمد"), LastNameAr: sp("القحطاني"), FirstNameEn: sp("Ali"), LastNameEn: sp("Alqahtani"),
+		NameEnSource: sp(store.NameSourceGenerated), Gender: sp("ذكر"), DateOfBirthH: parseDate("15-07-1405"), IsDead: sp("0"),
+		MaritalStatus: sp("متزوج"), NationalityCode: sp("SAU"), PassportNumber: sp("A1234567")})
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"id", p.ID, "1000000008"},
+		{"health id", p.Identifier[0].System + "|" + p.Identifier[0].Value, SystemHealthID + "|ID10000084583721"},
+		{"id number by its first digit", p.Identifier[1].System, SystemNationalID},
+		{"passport", p.Identifier[2].System + "|" + p.Identifier[2].Value, SystemPassport + "|A1234567"},
+		{"arabic name", p.Name[0].Text, "علي محمد القحطاني"},
+		{"english family name", p.Name[1].Family, "Alqahtani"},
+		{"english name source", p.Name[1].Extension[1].ValueCode, store.NameSourceGenerated},
+		{"gender", p.Gender, "male"},
+		{"hijri birth date in gregorian", p.BirthDate, "1985-04-06"},
+		{"alive", *p.DeceasedBoolean, false},
+		{"marital status", p.MaritalStatus.Coding[0].Code, "M"},
+		{"nationality", p.Extension[0].Extension[0].ValueCodeableConcept.Coding[0].Code, "SAU"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestGender(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"M", "male"},
+		{" female ", "female"},
+		{"2", "female"},
+		{"أنثى", "female"},
+		{"", ""},
+		{"x", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := gender(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPatientQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		id         string
+		idType     string
+		err        error
+	}{
+		{"value alone", "1000000008", "1000000008", "", nil},
+		{"national id", SystemNationalID + "|1000000008", "1000000008", string(nhic.IDTypeNationalID), nil},
+		{"gcc id", SystemGCCID + "|784199012345671", "784199012345671", string(nhic.IDTypeGCCID), nil},
+		{"unknown system", "urn:x|1000000008", "", "", errUnsupportedSystem},
+	}
+	for _, tt := range tests {
+		pq, err := patientQuery(tt.identifier, "15-07-1405", "")
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && (pq.ID != tt.id || pq.IDType != tt.idType) {
+			t.Errorf("%s: got %+v", tt.name, pq)
+		}
+	}
+}
+
+func TestPatientHandler(t *testing.T) {
+	c := &fakeController{pnt: &store.Patient{IDNumber: sp("1000000008"), FirstNameEn: sp("Ali")}}
+	h := NewHandler(c, "http://nhic.example/fhir/", nil)
+
+	tests := []struct {
+		name  string
+		path  string
+		code  int
+		total float64
+	}{
+		{"read", "/Patient/1000000008", http.StatusOK, 0},
+		{"read not stored", "/Patient/2000000006", http.StatusNotFound, 0},
+		{"search", "/Patient?identifier=" + SystemNationalID + "|1000000008&birthdate=15-07-1405", http.StatusOK, 1},
+		{"search not found", "/Patient?identifier=1000000016&birthdate=15-07-1405", http.StatusOK, 0},
+		{"bad checksum", "/Patient?identifier=1000000007&birthdate=15-07-1405", http.StatusBadRequest, 0},
+		{"unknown system", "/Patient?identifier=urn:x|1&birthdate=15-07-1405", http.StatusBadRequest, 0},
+		{"no identifier", "/Patient", http.StatusBadRequest, 0},
+		{"unknown resource", "/Encounter/1", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		code, v := get(h, tt.path)
+		if code != tt.code {
+			t.Errorf("%s: got %d, want %d: %v", tt.name, code, tt.code, v)
+		} else if v["resourceType"] == "Bundle" && v["total"] != tt.total {
+			t.Errorf("%s: total %v", tt.name, v["total"])
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/Patient", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Content-Type") != contentType {
+		t.Errorf("post: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,170 @@
+package fhir
+
+import (
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+const (
+	// SCFHS registration numbers, NPHIES practitioner license system
+	SystemSCFHSRegistration = "http://nphies.sa/license/practitioner-license"
+
+	systemSCFHSCategory  = "urn:nhic:scfhs:category"
+	systemSCFHSSpecialty = "urn:nhic:scfhs:specialty"
+)
+
+// Practitioner is the FHIR R4 Practitioner, see https://hl7.org/fhir/R4/practitioner.html
+type Practitioner struct {
+	ResourceType  string          `json:"resourceType"`
+	ID            string          `json:"id,omitempty"`
+	Identifier    []Identifier    `json:"identifier,omitempty"`
+	Name          []HumanName     `json:"name,omitempty"`
+	Gender        string          `json:"gender,omitempty"`
+	BirthDate     string          `json:"birthDate,omitempty"`
+	Qualification []Qualification `json:"qualification,omitempty"`
+}
+
+type Qualification struct {
+	Identifier []Identifier    `json:"identifier,omitempty"`
+	Code       CodeableConcept `json:"code"`
+	Period     *Period         `json:"period,omitempty"`
+}
+
+// PractitionerRole is the FHIR R4 PractitionerRole, see https://hl7.org/fhir/R4/practitionerrole.html.
+// a practitioner has one role, at the establishment of its SCFHS affiliation
+type PractitionerRole struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Active       *bool             `json:"active,omitempty"`
+	Period       *Period           `json:"period,omitempty"`
+	Practitioner *Reference        `json:"practitioner,omitempty"`
+	Organization *Reference        `json:"organization,omitempty"`
+	Code         []CodeableConcept `json:"code,omitempty"`
+	Specialty    []CodeableConcept `json:"specialty,omitempty"`
+}
+
+// PractitionerFromStore maps pract to a Practitioner, its id is the id number.
+// the SCFHS category and specialty are qualifications valid for the license window
+func PractitionerFromStore(pract *store.Practitioner) *Practitioner {
+	p := &Practitioner{
+		ResourceType: "Practitioner",
+		ID:           str(pract.IDNumber),
+		Identifier:   practitionerIdentifiers(pract),
+		Gender:       practitionerGender(pract),
+	}
+
+	if name := humanName("ar", pract.FirstNameAr, pract.SecondNameAr, pract.ThirdNameAr, pract.LastNameAr); name != nil {
+		p.Name = append(p.Name, *name)
+	}
+	if name := humanName("en", pract.FirstNameEn, pract.SecondNameEn, pract.ThirdNameEn, pract.LastNameEn); name != nil {
+		p.Name = append(p.Name, *name)
+	}
+
+	for _, d := range []*store.Date{pract.BirthDate_G, pract.BirthDateG, pract.BirthDate_H, pract.BirthDateH} {
+		if p.BirthDate = date(d); p.BirthDate != "" {
+			break
+		}
+	}
+
+	var regID []Identifier
+	if n := str(pract.SCFHSRegistrationNumber); n != "" {
+		regID = []Identifier{{Type: identifierType("MD", "Medical License number"), System: SystemSCFHSRegistration, Value: n}}
+	}
+	period := licensePeriod(pract)
+	if code := codeable(systemSCFHSCategory, pract.SCFHSCategoryCode, pract.SCFHSCategoryEn, pract.SCFHSCategoryAr); code != nil {
+		p.Qualification = append(p.Qualification, Qualification{Identifier: regID, Code: *code, Period: period})
+	}
+	if code := codeable(systemSCFHSSpecialty, pract.SCFHSSpecialityCode, pract.SCFHSSpecialityEn, pract.SCFHSSpecialityAr); code != nil {
+		p.Qualification = append(p.Qualification, Qualification{Identifier: regID, Code: *code, Period: period})
+	}
+	return p
+}
+
+// PractitionerRoleFromStore maps the affiliation of pract, its id is the practitioner's.
+// it's active while the license hasn't expired
+func PractitionerRoleFromStore(pract *store.Practitioner) *PractitionerRole {
+	id := str(pract.IDNumber)
+	role := &PractitionerRole{
+		ResourceType: "PractitionerRole",
+		ID:           id,
+		Period:       licensePeriod(pract),
+		Practitioner: &Reference{Reference: "Practitioner/" + id, Display: displayName(pract)},
+	}
+	if role.Period != nil && role.Period.End != "" {
+		active := role.Period.End >= time.Now().Format(dateLayout)
+		role.Active = &active
+	}
+	if org := str(pract.EstablishmentOrgID); org != "" {
+		role.Organization = &Reference{Reference: "Organization/" + org, Display: str(pract.EstablishmentName)}
+	}
+	if code := codeable(systemSCFHSCategory, pract.SCFHSCategoryCode, pract.SCFHSCategoryEn, pract.SCFHSCategoryAr); code != nil {
+		role.Code = []CodeableConcept{*code}
+	}
+	if code := codeable(systemSCFHSSpecialty, pract.SCFHSSpecialityCode, pract.SCFHSSpecialityEn, pract.SCFHSSpecialityAr); code != nil {
+		role.Specialty = []CodeableConcept{*code}
+	}
+	return role
+}
+
+func practitionerIdentifiers(pract *store.Practitioner) []Identifier {
+	ids := registryIdentifiers(pract.HealthID, pract.IDType, pract.IDNumber)
+	if n := str(pract.SCFHSRegistrationNumber); n != "" {
+		ids = append(ids, Identifier{
+			Use:    "official",
+			Type:   identifierType("MD", "Medical License number"),
+			System: SystemSCFHSRegistration,
+			Value:  n,
+		})
+	}
+	return ids
+}
+
+// practitionerGender reads the SCFHS gender, code 1/2 or the english name
+func practitionerGender(pract *store.Practitioner) string {
+	for _, g := range []*string{pract.Gender_code, pract.Gender_en, pract.Gender} {
+		if v := gender(str(g)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// licensePeriod is the SCFHS registration window, or the license dates of older rows
+func licensePeriod(pract *store.Practitioner) *Period {
+	start, end := date(pract.SCFHSRegistrationIssueDate), date(pract.SCFHSRegistrationExpiryDate)
+	if start == "" && end == "" {
+		start, end = date(pract.LicenseIssueDate), date(pract.LicenseExpiryDate)
+	}
+	if start == "" && end == "" {
+		return nil
+	}
+	return &Period{Start: start, End: end}
+}
+
+// codeable is a coded value with its english display, the text falls back to the arabic name.
+// nil if none of them is set
+func codeable(system string, code, nameEn, nameAr *string) *CodeableConcept {
+	if str(code) == "" && str(nameEn) == "" && str(nameAr) == "" {
+		return nil
+	}
+	text := str(nameEn)
+	if text == "" {
+		text = str(nameAr)
+	}
+	cc := &CodeableConcept{Text: text}
+	if str(code) != "" {
+		cc.Coding = []Coding{{System: system, Code: *code, Display: str(nameEn)}}
+	}
+	return cc
+}
+
+func displayName(pract *store.Practitioner) string {
+	if name := humanName("en", pract.FirstNameEn, pract.SecondNameEn, pract.ThirdNameEn, pract.LastNameEn); name != nil {
+		return name.Text
+	}
+	if name := humanName("ar", pract.FirstNameAr, pract.SecondNameAr, pract.ThirdNameAr, pract.LastNameAr); name != nil {
+		return name.Text
+	}
+	return ""
+}
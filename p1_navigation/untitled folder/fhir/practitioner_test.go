@@ -0,0 +1,83 @@
+package fhir
+
+import (
+	"net/http"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func TestPractitionerFromStore(t *testing.T) {
+	pract := &store.Practitioner{IDNumber: sp("2000000006"), HealthID: sp("ID10000000000016"), IDType: sp("Iqama"),
+		FirstNameEn: sp("Sara"), LastNameEn: sp("Ali"), FirstNameAr: sp("سارة"), Gender_code: sp("2"), BirthDate_G: parseDate("01-02-1990"),
+		SCFHSRegistrationNumber: sp("12345"), SCFHSCategoryCode: sp("C1"), SCFHSCategoryEn: sp("Doctor"), SCFHSSpecialityAr: sp("قلب"),
+		SCFHSRegistrationIssueDate: parseDate("01-01-2020"), SCFHSRegistrationExpiryDate: parseDate("01-01-2000"),
+		EstablishmentOrgID: sp("10001"), EstablishmentName: sp("Noor Hospital")}
+	p, role := PractitionerFromStore(pract), PractitionerRoleFromStore(pract)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"id", p.ID, "2000000006"},
+		{"iqama", p.Identifier[1].System, SystemIqama},
+		{"license", p.Identifier[2].System + "|" + p.Identifier[2].Value, SystemSCFHSRegistration + "|12345"},
+		{"gender code", p.Gender, "female"},
+		{"birth date", p.BirthDate, "1990-02-01"},
+		{"category", p.Qualification[0].Code.Coding[0].Code, "C1"},
+		{"specialty without a code", p.Qualification[1].Code.Text, "قلب"},
+		{"license window", p.Qualification[0].Period.Start, "2020-01-01"},
+		{"role of the practitioner", role.Practitioner.Reference + " " + role.Practitioner.Display, "Practitioner/2000000006 Sara Ali"},
+		{"role organization", role.Organization.Reference, "Organization/10001"},
+		{"expired license", *role.Active, false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestPractitionerID(t *testing.T) {
+	tests := []struct {
+		identifier string
+		want       string
+		err        error
+	}{
+		{"1000000008", "1000000008", nil},
+		{SystemNationalID + "|1000000008", "1000000008", nil},
+		{SystemIqama + "|2000000006", "2000000006", nil},
+		{SystemGCCID + "|784199012345671", "", errUnsupportedSystem},
+	}
+	for _, tt := range tests {
+		if got, err := practitionerID(tt.identifier); got != tt.want || err != tt.err {
+			t.Errorf("%s: got %q %v, want %q %v", tt.identifier, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestPractitionerHandler(t *testing.T) {
+	h := NewHandler(&fakeController{pract: &store.Practitioner{IDNumber: sp("1000000008"), FirstNameEn: sp("Sara")}}, "http://nhic.example/fhir", nil)
+
+	tests := []struct {
+		name         string
+		path         string
+		code         int
+		resourceType string
+	}{
+		{"read", "/Practitioner/1000000008", http.StatusOK, "Practitioner"},
+		{"read role", "/PractitionerRole/1000000008", http.StatusOK, "PractitionerRole"},
+		{"unknown to SCFHS", "/Practitioner/1000000016", http.StatusNotFound, "OperationOutcome"},
+		{"search", "/Practitioner?identifier=" + SystemNationalID + "|1000000008", http.StatusOK, "Bundle"},
+		{"search role", "/PractitionerRole?practitioner=Practitioner/1000000008", http.StatusOK, "Bundle"},
+		{"unknown system", "/Practitioner?identifier=urn:x|1", http.StatusBadRequest, "OperationOutcome"},
+		{"no identifier", "/PractitionerRole", http.StatusBadRequest, "OperationOutcome"},
+	}
+	for _, tt := range tests {
+		code, v := get(h, tt.path)
+		if code != tt.code || v["resourceType"] != tt.resourceType {
+			t.Errorf("%s: got %d %v, want %d %s", tt.name, code, v["resourceType"], tt.code, tt.resourceType)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package nhic
+
+import (
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/names"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// PatientFullNames sets FullNameAr and FullNameEn of pnt from its name parts in the format,
+// the subtribe is the arabic family name if there's none. the controller writes them Formal
+// except GetPatient which takes PatientQuery.NameFormat
+func PatientFullNames(pnt *store.Patient, f names.Format) {
+	female := isFemale(pnt.Gender)
+	pnt.FullNameAr = optional(names.Parts{
+		First: str(pnt.FirstNameAr), Second: str(pnt.SecondNameAr), Third: str(pnt.ThirdNameAr),
+		Family: str(pnt.LastNameAr), Subtribe: str(pnt.SubtribeName), Female: female,
+	}.Full(f))
+	pnt.FullNameEn = optional(names.Parts{
+		First: str(pnt.FirstNameEn), Second: str(pnt.SecondNameEn), Third: str(pnt.ThirdNameEn),
+		Family: str(pnt.LastNameEn), Female: female,
+	}.Full(f))
+}
+
+// PractitionerFullNames is PatientFullNames for a practitioner, they have no subtribe
+func PractitionerFullNames(p *store.Practitioner, f names.Format) {
+	female := isFemale(p.Gender) || isFemale(p.Gender_en) || isFemale(p.Gender_code)
+	p.FullNameAr = optional(names.Parts{
+		First: str(p.FirstNameAr), Second: str(p.SecondNameAr), Third: str(p.ThirdNameAr),
+		Family: str(p.LastNameAr), Female: female,
+	}.Full(f))
+	p.FullNameEn = optional(names.Parts{
+		First: str(p.FirstNameEn), Second: str(p.SecondNameEn), Third: str(p.ThirdNameEn),
+		Family: str(p.LastNameEn), Female: female,
+	}.Full(f))
+}
+
+func isFemale(g *string) bool {
+	v := strings.TrimSpace(str(g))
+	for _, s := range store.GenderValues("female") {
+		if v != "" && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// optional is nil for ""
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
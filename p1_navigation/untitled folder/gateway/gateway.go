@@ -0,0 +1,188 @@
+// Package gateway calls the registry lookups on the api gateway that the yakeen and nic
+// packages don't cover: border numbers, visit visas, gcc nationals and newborns.
+//
+// their contract isn't published yet, the paths and the error codes come from config
+// and a lookup without a path isn't served
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/config"
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// Lookup names a lookup in config.GatewayLookups.Paths
+type Lookup string
+
+const (
+	LookupBorderNumber Lookup = "border_number"
+	LookupVisa         Lookup = "visa"
+	LookupGCCNational  Lookup = "gcc_national"
+	LookupNewborn      Lookup = "newborn"
+)
+
+var (
+	ErrBadDOB        = errors.New("birth date doesn't match the id")
+	ErrBadID         = errors.New("id not found")
+	ErrUpstream      = errors.New("gateway returned an error")
+	ErrNotConfigured = errors.New("gateway lookup has no path in config")
+	ErrUnknownLookup = errors.New("unknown gateway lookup")
+	ErrMalformedPath = errors.New("gateway lookup path must start with /")
+)
+
+// Person is the record returned by all the lookups, fields the lookup doesn't have are empty.
+// birth dates are gregorian dd-mm-yyyy, like yakeen expats
+type Person struct {
+	ID              string `json:"id"`
+	BirthDate       string `json:"birth_date"`
+	Gender          string `json:"gender"`
+	Nationality     string `json:"nationality"`
+	NationalityCode string `json:"nationality_code"`
+	PassportNumber  string `json:"passport_number,omitempty"`
+	VisaNumber      string `json:"visa_number,omitempty"`
+	BorderNumber    string `json:"border_number,omitempty"`
+	GuardianID      string `json:"guardian_id,omitempty"`
+	BirthOrder      int    `json:"birth_order,omitempty"`
+
+	FirstNameAr  string `json:"first_name_ar"`
+	SecondNameAr string `json:"second_name_ar"`
+	ThirdNameAr  string `json:"third_name_ar"`
+	LastNameAr   string `json:"last_name_ar"`
+
+	FirstNameEn  string `json:"first_name_en"`
+	SecondNameEn string `json:"second_name_en"`
+	ThirdNameEn  string `json:"third_name_en"`
+	LastNameEn   string `json:"last_name_en"`
+}
+
+type Gateway struct {
+	token   string
+	url     string
+	lookups config.GatewayLookups
+	client  *http.Client
+	log     *logging.Logger
+}
+
+func New(token, url string, lookups config.GatewayLookups) (*Gateway, error) {
+	if url == "" {
+		return nil, errors.New("gateway url is missing")
+	}
+	for name, path := range lookups.Paths {
+		switch Lookup(name) {
+		case LookupBorderNumber, LookupVisa, LookupGCCNational, LookupNewborn:
+		default:
+			return nil, fmt.Errorf("%w %q", ErrUnknownLookup, name)
+		}
+		if path != "" && path[0] != '/' {
+			return nil, fmt.Errorf("%w: %s %q", ErrMalformedPath, name, path)
+		}
+	}
+	return &Gateway{
+		token:   token,
+		url:     url,
+		lookups: lookups,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Serves tells if the lookup has a path in config
+func (g *Gateway) Serves(l Lookup) bool {
+	return g.lookups.Paths[string(l)] != ""
+}
+
+// SetLogger sets the logger of the calls, the ids and birth dates of the lookups aren't logged
+func (g *Gateway) SetLogger(l *logging.Logger) {
+	g.log = l.With(logging.String("client", "gateway"))
+}
+
+// GetBorderNumber looks up a visitor or pilgrim by border number
+func (g *Gateway) GetBorderNumber(ctx context.Context, borderNumber, birthDate string) (*Person, error) {
+	return g.get(ctx, LookupBorderNumber, url.Values{
+		"id":         {borderNumber},
+		"birth_date": {birthDate},
+	})
+}
+
+// GetVisitor looks up a visitor by visit visa number
+func (g *Gateway) GetVisitor(ctx context.Context, visaNumber, birthDate string) (*Person, error) {
+	return g.get(ctx, LookupVisa, url.Values{
+		"id":         {visaNumber},
+		"birth_date": {birthDate},
+	})
+}
+
+// GetGCCNational looks up a gcc national by the id issued by country (ISO alpha-3)
+func (g *Gateway) GetGCCNational(ctx context.Context, country, id, birthDate string) (*Person, error) {
+	return g.get(ctx, LookupGCCNational, url.Values{
+		"id":         {id},
+		"country":    {country},
+		"birth_date": {birthDate},
+	})
+}
+
+// GetNewborn looks up a newborn without an id by the guardian's national id or iqama,
+// the birth date and the birth order for twins
+func (g *Gateway) GetNewborn(ctx context.Context, guardianID, birthDate string, order int) (*Person, error) {
+	return g.get(ctx, LookupNewborn, url.Values{
+		"id":          {guardianID},
+		"birth_date":  {birthDate},
+		"birth_order": {strconv.Itoa(order)},
+	})
+}
+
+func (g *Gateway) get(ctx context.Context, l Lookup, params url.Values) (*Person, error) {
+	path := g.lookups.Paths[string(l)]
+	if path == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotConfigured, l)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+
+	start := time.Now()
+	res, err := g.client.Do(req)
+	if err != nil {
+		// the url has the id and the birth date
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = g.url + path
+		}
+		g.log.Warn(ctx, "gateway call failed", logging.String("path", path), logging.Err(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+	g.log.Debug(ctx, "gateway call", logging.String("path", path), logging.Int("status", res.StatusCode),
+		logging.Duration("took", time.Since(start)))
+
+	if res.StatusCode == http.StatusBadRequest {
+		var e struct {
+			ErrorCode string `json:"errorCode"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&e); err == nil && e.ErrorCode != "" {
+			switch e.ErrorCode {
+			case g.lookups.BadDOBCode:
+				return nil, ErrBadDOB
+			case g.lookups.BadIDCode:
+				return nil, ErrBadID
+			}
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrUpstream, path, res.Status)
+	}
+
+	p := &Person{}
+	if err := json.NewDecoder(res.Body).Decode(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/config"
+)
+
+func TestNewLookups(t *testing.T) {
+	tests := []struct {
+		paths map[string]string
+		err   error
+	}{
+		{nil, nil},
+		{map[string]string{"visa": "/visa", "newborn": ""}, nil},
+		{map[string]string{"passport": "/passport"}, ErrUnknownLookup},
+		{map[string]string{"visa": "visa"}, ErrMalformedPath},
+	}
+	for _, tt := range tests {
+		_, err := New("tok", "http://gateway", config.GatewayLookups{Paths: tt.paths})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v: got %v, want %v", tt.paths, err, tt.err)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "3000000001":
+			w.Write([]byte(`{"id": "3000000001", "birth_date": "01-01-1990"}`))
+		case "3000000002":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode": "DOB_MISMATCH"}`))
+		case "3000000003":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode": "something_else"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode": "ID_UNKNOWN"}`))
+		}
+	}))
+	defer srv.Close()
+
+	g, err := New("tok", srv.URL, config.GatewayLookups{
+		Paths:      map[string]string{"border_number": "/border"},
+		BadDOBCode: "DOB_MISMATCH",
+		BadIDCode:  "ID_UNKNOWN",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Serves(LookupBorderNumber) || g.Serves(LookupVisa) {
+		t.Error("serves the lookups without a path")
+	}
+
+	tests := []struct {
+		id  string
+		err error
+	}{
+		{"3000000001", nil},
+		{"3000000002", ErrBadDOB},
+		{"3000000003", ErrUpstream},
+		{"3000000004", ErrBadID},
+	}
+	for _, tt := range tests {
+		p, err := g.GetBorderNumber(context.Background(), tt.id, "01-01-1990")
+		if !errors.Is(err, tt.err) || (err == nil && p.ID != tt.id) {
+			t.Errorf("%s: got %+v %v, want %v", tt.id, p, err, tt.err)
+		}
+	}
+	if _, err := g.GetVisitor(context.Background(), "6000000000", "01-01-1990"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("visa: got %v", err)
+	}
+}
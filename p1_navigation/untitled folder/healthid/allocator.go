@@ -0,0 +1,147 @@
+package healthid
+
+import (
+	"context"
+	"time"
+)
+
+// concurrent reservations for the same id number are retried this many times
+const maxAttempts = 3
+
+// Allocator reserves, binds, releases and reissues health ids
+type Allocator struct {
+	s   Store
+	now func() time.Time
+}
+
+// New returns an Allocator keeping its records in s
+func New(s Store) *Allocator {
+	return &Allocator{s: s, now: time.Now}
+}
+
+// Get returns the record of the health id
+func (a *Allocator) Get(ctx context.Context, healthID string) (*Record, error) {
+	if err := Validate(healthID); err != nil {
+		return nil, err
+	}
+	return a.s.Get(ctx, healthID)
+}
+
+// Reserve returns the health id of the id number, the one reserved or bound to it
+// or a new one. calling it again for the same id number returns the same id
+func (a *Allocator) Reserve(ctx context.Context, idNumber string) (string, error) {
+	if idNumber == "" {
+		return "", ErrNoIDNumber
+	}
+
+	var err error
+	for i := 0; i < maxAttempts; i++ {
+		var r *Record
+		r, err = a.s.ByIDNumber(ctx, idNumber)
+		if err == nil {
+			return r.HealthID, nil
+		} else if err != ErrNotFound {
+			return "", err
+		}
+
+		var seq int64
+		seq, err = a.s.NextSeq(ctx)
+		if err != nil {
+			return "", err
+		}
+		if seq <= SeqStart || seq > seqMax {
+			return "", ErrExhausted
+		}
+
+		r = &Record{HealthID: Format(seq), IDNumber: idNumber, State: Reserved, UpdatedAt: a.now()}
+		err = a.s.Insert(ctx, r)
+		if err == nil {
+			return r.HealthID, nil
+		} else if err != ErrConflict {
+			return "", err
+		}
+		// reserved by another request in the meantime, the sequence number is skipped
+	}
+	return "", err
+}
+
+// Bind marks the health id used by the record of the id number, binding it again is a no-op.
+// ids issued before the allocator e.g. the used rows of the MSSQL pool from before its states are recorded as bound
+func (a *Allocator) Bind(ctx context.Context, healthID, idNumber string) error {
+	if idNumber == "" {
+		return ErrNoIDNumber
+	}
+	if err := Validate(healthID); err != nil {
+		return err
+	}
+
+	r, err := a.s.Get(ctx, healthID)
+	if err == ErrNotFound {
+		return a.s.Insert(ctx, &Record{HealthID: healthID, IDNumber: idNumber, State: Bound, UpdatedAt: a.now()})
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case r.State == Released || r.IDNumber != idNumber:
+		return ErrConflict
+	case r.State == Bound:
+		return nil
+	}
+	r.State = Bound
+	r.UpdatedAt = a.now()
+	return a.s.Transition(ctx, Reserved, r)
+}
+
+// Release frees the health id from its id number, e.g. after it was bound to the wrong person.
+// the returned record has the id number it was freed from in ReleasedFrom
+func (a *Allocator) Release(ctx context.Context, healthID, reason string) (*Record, error) {
+	if reason == "" {
+		return nil, ErrNoReason
+	}
+	r, err := a.Get(ctx, healthID)
+	if err != nil {
+		return nil, err
+	}
+	if r.State == Released {
+		return nil, ErrState
+	}
+
+	from := r.State
+	r.ReleasedFrom = r.IDNumber
+	r.IDNumber = ""
+	r.State = Released
+	r.Reason = reason
+	r.UpdatedAt = a.now()
+	if err := a.s.Transition(ctx, from, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reissue binds a released health id to the id number,
+// it returns ErrConflict if the id number already has one
+func (a *Allocator) Reissue(ctx context.Context, healthID, idNumber, reason string) (*Record, error) {
+	if idNumber == "" {
+		return nil, ErrNoIDNumber
+	}
+	if reason == "" {
+		return nil, ErrNoReason
+	}
+	r, err := a.Get(ctx, healthID)
+	if err != nil {
+		return nil, err
+	}
+	if r.State != Released {
+		return nil, ErrState
+	}
+
+	r.IDNumber = idNumber
+	r.State = Bound
+	r.Reason = reason
+	r.UpdatedAt = a.now()
+	if err := a.s.Transition(ctx, Released, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
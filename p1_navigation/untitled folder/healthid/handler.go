@@ -0,0 +1,100 @@
+package healthid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// Admin is what the admin api needs, *Allocator implements it.
+// the controller wraps it to remove the record of a released id
+type Admin interface {
+	Get(ctx context.Context, healthID string) (*Record, error)
+	Release(ctx context.Context, healthID, reason string) (*Record, error)
+	Reissue(ctx context.Context, healthID, idNumber, reason string) (*Record, error)
+}
+
+// NewHandler returns the admin api logging to log, paths are relative to where it's mounted
+//
+//	GET  /{health_id}
+//	POST /{health_id}/release  {"reason": "bound to the wrong iqama"}
+//	POST /{health_id}/reissue  {"id_number": "2012345675", "reason": "..."}
+//
+//	mux.Handle("/admin/health-ids/", http.StripPrefix("/admin/health-ids", healthid.NewHandler(admin, logger)))
+//
+// it's meant for operators, mount it behind the admin auth
+func NewHandler(a Admin, log *logging.Logger) http.Handler {
+	return &handler{a: a, log: log}
+}
+
+type handler struct {
+	a   Admin
+	log *logging.Logger
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	id := parts[0]
+
+	var req struct {
+		IDNumber string `json:"id_number"`
+		Reason   string `json:"reason"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeJSON(r.Context(), w, http.StatusBadRequest, map[string]string{"error": "malformed body"})
+			return
+		}
+	}
+
+	var (
+		rec *Record
+		err error
+	)
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		rec, err = h.a.Get(r.Context(), id)
+	case len(parts) == 2 && parts[1] == "release" && r.Method == http.MethodPost:
+		rec, err = h.a.Release(r.Context(), id, req.Reason)
+	case len(parts) == 2 && parts[1] == "reissue" && r.Method == http.MethodPost:
+		rec, err = h.a.Reissue(r.Context(), id, req.IDNumber, req.Reason)
+	case len(parts) <= 2:
+		h.writeJSON(r.Context(), w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.writeJSON(r.Context(), w, statusOf(err), map[string]string{"error": err.Error()})
+		return
+	}
+	h.writeJSON(r.Context(), w, http.StatusOK, rec)
+}
+
+// statusOf maps the errors of Admin, errors that aren't the package's
+// are already generic e.g. the controller's
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrMalformed), errors.Is(err, ErrChecksum),
+		errors.Is(err, ErrNoReason), errors.Is(err, ErrNoIDNumber):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrState):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *handler) writeJSON(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warn(ctx, "response not written", logging.Err(err))
+	}
+}
@@ -0,0 +1,117 @@
+// Package healthid issues the health ids of patients and practitioners e.g. ID10000084583721,
+// "ID" then a 13 digit sequence number and a luhn check digit.
+//
+// an id is reserved for an id number when the lookup misses the db, bound when the record
+// is added and can be released when it was bound to the wrong id number, a released id
+// is only given out again by Reissue
+package healthid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	prefix    = "ID"
+	seqDigits = 13
+
+	// SeqStart is the sequence number before the first issued, the first id is ID10000000000016
+	SeqStart int64 = 1000000000000
+	seqMax   int64 = 9999999999999
+)
+
+var (
+	ErrMalformed = errors.New("malformed health id")
+	ErrChecksum  = errors.New("health id check digit doesn't match")
+	ErrNotFound  = errors.New("health id not found")
+	// the id number has another active health id, or the id is bound to another id number
+	ErrConflict   = errors.New("health id conflicts with another record")
+	ErrState      = errors.New("health id can't change from its current state")
+	ErrNoReason   = errors.New("reason is missing")
+	ErrNoIDNumber = errors.New("id number is missing")
+	ErrExhausted  = errors.New("health id sequence is exhausted")
+)
+
+// State of a health id
+type State string
+
+const (
+	Reserved State = "reserved"
+	Bound    State = "bound"
+	Released State = "released"
+)
+
+// Record is a health id and the id number it's reserved or bound to.
+// released records keep the id number they had in ReleasedFrom
+type Record struct {
+	HealthID     string    `json:"health_id" db:"HealthID"`
+	IDNumber     string    `json:"id_number,omitempty" db:"IDNumber"`
+	State        State     `json:"state" db:"State"`
+	ReleasedFrom string    `json:"released_from,omitempty" db:"ReleasedFrom"`
+	Reason       string    `json:"reason,omitempty" db:"Reason"`
+	UpdatedAt    time.Time `json:"updated_at" db:"UpdatedAt"`
+}
+
+// Store keeps the records, store/memory, store/sqlite and store/mssql implement it
+type Store interface {
+	// Get returns the record of the health id or ErrNotFound
+	Get(ctx context.Context, healthID string) (*Record, error)
+	// ByIDNumber returns the reserved or bound record of the id number or ErrNotFound
+	ByIDNumber(ctx context.Context, idNumber string) (*Record, error)
+	// NextSeq returns the next sequence number, starting after SeqStart
+	NextSeq(ctx context.Context) (int64, error)
+	// Insert adds r, it returns ErrConflict if the id number already has
+	// a reserved or bound record
+	Insert(ctx context.Context, r *Record) error
+	// Transition replaces the record of r.HealthID if it's still in state from,
+	// it returns ErrState if it isn't and ErrConflict like Insert
+	Transition(ctx context.Context, from State, r *Record) error
+}
+
+// Format returns the health id of the sequence number
+func Format(seq int64) string {
+	digits := fmt.Sprintf("%0*d", seqDigits, seq)
+	return prefix + digits + string(rune('0'+checkDigit(digits)))
+}
+
+// Validate checks the format and the check digit of id
+func Validate(id string) error {
+	digits := strings.TrimPrefix(id, prefix)
+	if len(digits) != seqDigits+1 || digits == id || !isDigits(digits) {
+		return ErrMalformed
+	}
+	if checkDigit(digits[:seqDigits]) != int(digits[seqDigits]-'0') {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// checkDigit is the luhn digit to append to digits
+func checkDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
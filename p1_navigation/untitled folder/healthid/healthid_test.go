@@ -0,0 +1,213 @@
+package healthid
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		seq  int64
+		want string
+	}{
+		{SeqStart + 1, "ID10000000000016"},
+		{1000008458372, "ID10000084583721"},
+		{seqMax, "ID99999999999993"},
+	}
+	for _, tt := range tests {
+		got := Format(tt.seq)
+		if got != tt.want {
+			t.Errorf("Format(%d) = %s, want %s", tt.seq, got, tt.want)
+		}
+		if err := Validate(got); err != nil {
+			t.Errorf("Validate(%s) = %v", got, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		id   string
+		want error
+	}{
+		{"ID10000084583721", nil},
+		{"ID10000084583722", ErrChecksum},
+		{"ID10000084583712", ErrChecksum},
+		{"10000084583721", ErrMalformed},
+		{"ID1000008458372", ErrMalformed},
+		{"ID100000845837211", ErrMalformed},
+		{"ID1000008458372a", ErrMalformed},
+		{"id10000084583721", ErrMalformed},
+		{"", ErrMalformed},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.id); err != tt.want {
+			t.Errorf("Validate(%q) = %v, want %v", tt.id, err, tt.want)
+		}
+	}
+}
+
+// fakeStore is a Store in a map, like store/memory
+type fakeStore struct {
+	mu      sync.Mutex
+	seq     int64
+	records map[string]Record
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{seq: SeqStart, records: make(map[string]Record)}
+}
+
+func (s *fakeStore) Get(ctx context.Context, healthID string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[healthID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &r, nil
+}
+
+func (s *fakeStore) ByIDNumber(ctx context.Context, idNumber string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		if r.IDNumber == idNumber && r.State != Released {
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *fakeStore) NextSeq(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return s.seq, nil
+}
+
+func (s *fakeStore) Insert(ctx context.Context, r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active(r) {
+		return ErrConflict
+	}
+	s.records[r.HealthID] = *r
+	return nil
+}
+
+func (s *fakeStore) Transition(ctx context.Context, from State, r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.records[r.HealthID]
+	if !ok || cur.State != from {
+		return ErrState
+	}
+	if s.active(r) {
+		return ErrConflict
+	}
+	s.records[r.HealthID] = *r
+	return nil
+}
+
+// active tells if another record of the id number of r is reserved or bound
+func (s *fakeStore) active(r *Record) bool {
+	if r.State == Released {
+		return false
+	}
+	for _, o := range s.records {
+		if o.HealthID != r.HealthID && o.IDNumber == r.IDNumber && o.State != Released {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAllocator(t *testing.T) {
+	ctx := context.Background()
+	a := New(newFakeStore())
+
+	hid, err := a.Reserve(ctx, "1012345672")
+	if err != nil || hid != "ID10000000000016" {
+		t.Fatalf("reserve: %s %v", hid, err)
+	}
+	if again, err := a.Reserve(ctx, "1012345672"); err != nil || again != hid {
+		t.Fatalf("reserve again: %s %v", again, err)
+	}
+	if _, err := a.Reserve(ctx, ""); err != ErrNoIDNumber {
+		t.Fatalf("reserve without id number: %v", err)
+	}
+
+	if err := a.Bind(ctx, hid, "2034567897"); err != ErrConflict {
+		t.Fatalf("bind to another id number: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := a.Bind(ctx, hid, "1012345672"); err != nil {
+			t.Fatalf("bind: %v", err)
+		}
+	}
+	// issued before the allocator
+	if err := a.Bind(ctx, "ID10000084583721", "2034567897"); err != nil {
+		t.Fatalf("bind an older id: %v", err)
+	}
+	if r, err := a.Get(ctx, "ID10000084583721"); err != nil || r.State != Bound {
+		t.Fatalf("get an older id: %+v %v", r, err)
+	}
+
+	if _, err := a.Release(ctx, hid, ""); err != ErrNoReason {
+		t.Fatalf("release without reason: %v", err)
+	}
+	r, err := a.Release(ctx, hid, "bound to the wrong iqama")
+	if err != nil || r.State != Released || r.ReleasedFrom != "1012345672" || r.IDNumber != "" {
+		t.Fatalf("release: %+v %v", r, err)
+	}
+	if _, err := a.Release(ctx, hid, "again"); err != ErrState {
+		t.Fatalf("release again: %v", err)
+	}
+
+	// the id number gets a new id, the released one isn't given out again
+	next, err := a.Reserve(ctx, "1012345672")
+	if err != nil || next == hid {
+		t.Fatalf("reserve after release: %s %v", next, err)
+	}
+
+	if _, err := a.Reissue(ctx, hid, "2034567897", "naturalized"); err != ErrConflict {
+		t.Fatalf("reissue to an id number with an id: %v", err)
+	}
+	r, err = a.Reissue(ctx, hid, "1098765436", "naturalized")
+	if err != nil || r.State != Bound || r.IDNumber != "1098765436" {
+		t.Fatalf("reissue: %+v %v", r, err)
+	}
+	if _, err := a.Reissue(ctx, hid, "1098765436", "again"); err != ErrState {
+		t.Fatalf("reissue a bound id: %v", err)
+	}
+
+	if _, err := a.Get(ctx, "ID10000084583722"); err != ErrChecksum {
+		t.Fatalf("get a malformed id: %v", err)
+	}
+	if _, err := a.Get(ctx, Format(SeqStart+100)); err != ErrNotFound {
+		t.Fatalf("get an unknown id: %v", err)
+	}
+}
+
+func TestReserveConcurrently(t *testing.T) {
+	ctx := context.Background()
+	a := New(newFakeStore())
+
+	ids := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], _ = a.Reserve(ctx, "1012345672")
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id != ids[0] || id == "" {
+			t.Fatalf("reserved %v for the same id number", ids)
+		}
+	}
+}
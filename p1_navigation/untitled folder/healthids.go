@@ -0,0 +1,145 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+var ErrHealthIDsUnsupported = errors.New("store doesn't allocate health ids")
+
+// healthIDStore is implemented by the stores that allocate the health ids,
+// the MSSQL store takes them from its pool in LuhnNumbersReserve
+type healthIDStore interface {
+	HealthIDs() *healthid.Allocator
+}
+
+// patientDeleter is implemented by the stores that can remove a patient
+// whose health id was released
+type patientDeleter interface {
+	DeletePatient(ctx context.Context, id string) error
+}
+
+// patientMerger is implemented by the stores that can remove a patient merged into the one
+// with the health id, keeping its id number as an alias of that one
+type patientMerger interface {
+	MergePatient(ctx context.Context, id, healthID string) error
+}
+
+// GetHealthID returns the record of the health id
+func (c *Controller) GetHealthID(ctx context.Context, healthID string) (*healthid.Record, error) {
+	if c.healthIDs == nil {
+		return nil, ErrHealthIDsUnsupported
+	}
+
+	r, err := c.healthIDs.Get(ctx, healthID)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && !isHealthIDErr(err) {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "get health id: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+	return r, err
+}
+
+// GetPatientByHealthID returns the stored patient the health id is bound to,
+// ErrNotFound if it's reserved or released
+func (c *Controller) GetPatientByHealthID(ctx context.Context, healthID string) (*store.Patient, error) {
+	r, err := c.GetHealthID(ctx, healthID)
+	if err == healthid.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if r.State != healthid.Bound {
+		return nil, ErrNotFound
+	}
+	return c.GetPatientByID(ctx, r.IDNumber)
+}
+
+// ReleaseHealthID frees a health id bound to the wrong id number,
+// the patient stored under that id number is removed so the next lookup adds it again
+// with a new health id
+func (c *Controller) ReleaseHealthID(ctx context.Context, healthID, reason string) (*healthid.Record, error) {
+	if c.healthIDs == nil {
+		return nil, ErrHealthIDsUnsupported
+	}
+
+	r, err := c.healthIDs.Release(ctx, healthID, reason)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && !isHealthIDErr(err) {
+		c.log.Error(ctx, "release health id: update failed", logging.Err(err))
+		return nil, ErrUpdateInfo
+	} else if err != nil {
+		return nil, err
+	}
+
+	del, ok := c.store.(patientDeleter)
+	if !ok || r.ReleasedFrom == "" {
+		return r, nil
+	}
+	err = del.DeletePatient(ctx, r.ReleasedFrom)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err != store.ErrNotFound {
+		c.log.Error(ctx, "health id released but the patient wasn't removed", logging.Err(err))
+		return nil, ErrUpdateInfo
+	}
+	return r, nil
+}
+
+// ReissueHealthID binds a released health id to the id number
+func (c *Controller) ReissueHealthID(ctx context.Context, healthID, idNumber, reason string) (*healthid.Record, error) {
+	if c.healthIDs == nil {
+		return nil, ErrHealthIDsUnsupported
+	}
+
+	r, err := c.healthIDs.Reissue(ctx, healthID, idNumber, reason)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && !isHealthIDErr(err) {
+		c.log.Error(ctx, "reissue health id: update failed", logging.Err(err))
+		return nil, ErrUpdateInfo
+	}
+	return r, err
+}
+
+// HealthIDAdmin returns the controller as a healthid.Admin to mount healthid.NewHandler,
+// nil if the store doesn't allocate health ids
+func (c *Controller) HealthIDAdmin() healthid.Admin {
+	if c.healthIDs == nil {
+		return nil
+	}
+	return healthIDAdmin{c}
+}
+
+type healthIDAdmin struct {
+	c *Controller
+}
+
+func (a healthIDAdmin) Get(ctx context.Context, healthID string) (*healthid.Record, error) {
+	return a.c.GetHealthID(ctx, healthID)
+}
+
+func (a healthIDAdmin) Release(ctx context.Context, healthID, reason string) (*healthid.Record, error) {
+	return a.c.ReleaseHealthID(ctx, healthID, reason)
+}
+
+func (a healthIDAdmin) Reissue(ctx context.Context, healthID, idNumber, reason string) (*healthid.Record, error) {
+	return a.c.ReissueHealthID(ctx, healthID, idNumber, reason)
+}
+
+// isHealthIDErr tells if err is one of the healthid errors that are safe to return
+func isHealthIDErr(err error) bool {
+	switch err {
+	case healthid.ErrMalformed, healthid.ErrChecksum, healthid.ErrNotFound, healthid.ErrConflict,
+		healthid.ErrState, healthid.ErrNoReason, healthid.ErrNoIDNumber:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+// Package hijri converts dates between the Umm al-Qura calendar, used by Yakeen and
+// on national IDs, and the gregorian calendar.
+//
+// it covers 01-01-1356 to 30-12-1500 (1937-03-14 to 2077-11-16)
+package hijri
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	firstYear = 1356
+	lastYear  = 1500
+
+	secondsPerDay = 24 * 60 * 60
+
+	// years below are hijri, above are gregorian.
+	// birth dates are 1356+ hijri or 1900+ gregorian
+	calendarCutoff = 1700
+)
+
+var (
+	ErrMalformed  = errors.New("malformed date")
+	ErrInvalid    = errors.New("date doesn't exist in the calendar")
+	ErrOutOfRange = errors.New("date is out of the umm al-qura calendar range")
+)
+
+// Date is a day in the Umm al-Qura calendar
+type Date struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+// New returns the Date if it exists in the calendar
+func New(year, month, day int) (Date, error) {
+	d := Date{Year: year, Month: month, Day: day}
+	return d, d.Validate()
+}
+
+// Validate returns ErrOutOfRange if the year isn't covered
+// or ErrInvalid if the month or day don't exist e.g. 30-01-1445
+func (d Date) Validate() error {
+	if d.Year < firstYear || d.Year > lastYear {
+		return ErrOutOfRange
+	}
+	n, err := DaysInMonth(d.Year, d.Month)
+	if err != nil {
+		return err
+	}
+	if d.Day < 1 || d.Day > n {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// DaysInMonth returns 29 or 30, the length of the month in year
+func DaysInMonth(year, month int) (int, error) {
+	if year < firstYear || year > lastYear {
+		return 0, ErrOutOfRange
+	}
+	if month < 1 || month > 12 {
+		return 0, ErrInvalid
+	}
+	i := monthIndex(year, month)
+	return int(monthStarts[i+1] - monthStarts[i]), nil
+}
+
+// FromTime returns the hijri date of the day of t, in t's location
+func FromTime(t time.Time) (Date, error) {
+	day := unixDay(t)
+	if day < monthStarts[0] || day >= monthStarts[len(monthStarts)-1] {
+		return Date{}, ErrOutOfRange
+	}
+
+	// index of the month the day falls in
+	i := sort.Search(len(monthStarts), func(i int) bool {
+		return monthStarts[i] > day
+	}) - 1
+
+	return Date{
+		Year:  firstYear + i/12,
+		Month: i%12 + 1,
+		Day:   int(day-monthStarts[i]) + 1,
+	}, nil
+}
+
+// Time returns the gregorian day of d at 00:00 UTC
+func (d Date) Time() (time.Time, error) {
+	if err := d.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	day := monthStarts[monthIndex(d.Year, d.Month)] + int64(d.Day-1)
+	return time.Unix(day*secondsPerDay, 0).UTC(), nil
+}
+
+// String formats d as dd-mm-yyyy, the layout Yakeen uses
+func (d Date) String() string {
+	return fmt.Sprintf("%02d-%02d-%04d", d.Day, d.Month, d.Year)
+}
+
+// Parse reads a hijri date in one of the layouts we get from callers and upstreams
+// dd-mm-yyyy, yyyy-mm-dd, dd/mm/yyyy, yyyy/mm/dd
+func Parse(s string) (Date, error) {
+	y, m, d, err := Split(s)
+	if err != nil {
+		return Date{}, err
+	}
+	return New(y, m, d)
+}
+
+// ParseAny reads a date that can be in either calendar, the calendar is told by the year.
+// it returns the date in both calendars
+func ParseAny(s string) (Date, time.Time, error) {
+	y, m, d, err := Split(s)
+	if err != nil {
+		return Date{}, time.Time{}, err
+	}
+
+	if y < calendarCutoff {
+		h, err := New(y, m, d)
+		if err != nil {
+			return Date{}, time.Time{}, err
+		}
+		g, err := h.Time()
+		return h, g, err
+	}
+
+	g := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes e.g. 31-02 to 03-03
+	if g.Day() != d || int(g.Month()) != m {
+		return Date{}, time.Time{}, ErrInvalid
+	}
+	h, err := FromTime(g)
+	if err != nil {
+		return Date{}, time.Time{}, err
+	}
+	return h, g, nil
+}
+
+// IsHijri tells if the date s is written in the hijri calendar, it doesn't validate the date
+func IsHijri(s string) bool {
+	y, _, _, err := Split(s)
+	return err == nil && IsHijriYear(y)
+}
+
+// IsHijriYear tells if year is a hijri year rather than a gregorian one
+func IsHijriYear(year int) bool {
+	return year < calendarCutoff
+}
+
+// Split reads year, month and day whichever order they are in, it doesn't validate them.
+// a time part after T or a space is ignored e.g. 1963-07-21T00:00:00
+func Split(s string) (year, month, day int, err error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "T "); i > 0 {
+		s = s[:i]
+	}
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '-' || r == '/'
+	})
+	if len(parts) != 3 {
+		return 0, 0, 0, ErrMalformed
+	}
+
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, 0, 0, ErrMalformed
+		}
+		n[i] = v
+	}
+
+	switch {
+	case len(parts[0]) == 4:
+		return n[0], n[1], n[2], nil
+	case len(parts[2]) == 4:
+		return n[2], n[1], n[0], nil
+	}
+	return 0, 0, 0, ErrMalformed
+}
+
+func monthIndex(year, month int) int {
+	return (year-firstYear)*12 + month - 1
+}
+
+func unixDay(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay
+}
@@ -0,0 +1,122 @@
+package hijri
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTableLengths(t *testing.T) {
+	if len(monthStarts) != (lastYear-firstYear+1)*12+1 {
+		t.Fatalf("table has %d month starts", len(monthStarts))
+	}
+	for y := firstYear; y <= lastYear; y++ {
+		days := 0
+		for m := 1; m <= 12; m++ {
+			n, err := DaysInMonth(y, m)
+			if err != nil {
+				t.Fatalf("%d-%d: %v", m, y, err)
+			}
+			if n != 29 && n != 30 {
+				t.Errorf("%02d-%d has %d days", m, y, n)
+			}
+			days += n
+		}
+		if days != 354 && days != 355 {
+			t.Errorf("%d has %d days", y, days)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		hijri     string
+		gregorian string
+	}{
+		{"01-01-1356", "1937-03-14"},
+		{"01-09-1364", "1945-08-09"},
+		{"01-10-1364", "1945-09-08"},
+		{"01-01-1421", "2000-04-06"},
+		{"15-07-1405", "1985-04-06"},
+		{"01-09-1445", "2024-03-11"},
+		{"30-12-1500", "2077-11-16"},
+	}
+	for _, tt := range tests {
+		h, err := Parse(tt.hijri)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.hijri, err)
+		}
+		g, err := h.Time()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.hijri, err)
+		}
+		if got := g.Format("2006-01-02"); got != tt.gregorian {
+			t.Errorf("%s is %s, want %s", tt.hijri, got, tt.gregorian)
+		}
+		back, err := FromTime(g)
+		if err != nil || back != h {
+			t.Errorf("%s back to %s, %v", tt.gregorian, back, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	first, last := monthStarts[0], monthStarts[len(monthStarts)-1]
+	for day := first; day < last; day++ {
+		g := time.Unix(day*secondsPerDay, 0).UTC()
+		h, err := FromTime(g)
+		if err != nil {
+			t.Fatalf("%s: %v", g, err)
+		}
+		back, err := h.Time()
+		if err != nil || !back.Equal(g) {
+			t.Fatalf("%s is %s, back to %s %v", g, h, back, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{"30-01-1445", ErrInvalid},
+		{"01-13-1445", ErrInvalid},
+		{"00-01-1445", ErrInvalid},
+		{"01-01-1355", ErrOutOfRange},
+		{"01-01-1501", ErrOutOfRange},
+		{"1445-01", ErrMalformed},
+		{"01-1a-1445", ErrMalformed},
+		{"1-1-45", ErrMalformed},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.in); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestParseAny(t *testing.T) {
+	tests := []struct {
+		in        string
+		hijri     string
+		gregorian string
+	}{
+		{"01-09-1445", "01-09-1445", "2024-03-11"},
+		{"1445/09/01", "01-09-1445", "2024-03-11"},
+		{"2024-03-11", "01-09-1445", "2024-03-11"},
+		{"11/03/2024", "01-09-1445", "2024-03-11"},
+		{"1985-04-06T00:00:00", "15-07-1405", "1985-04-06"},
+	}
+	for _, tt := range tests {
+		h, g, err := ParseAny(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+		if h.String() != tt.hijri || g.Format("2006-01-02") != tt.gregorian {
+			t.Errorf("%s: got %s %s", tt.in, h, g.Format("2006-01-02"))
+		}
+	}
+	if _, _, err := ParseAny("31-02-1990"); err != ErrInvalid {
+		t.Errorf("31-02-1990: got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package hijri
+
+// monthStarts holds the first day of every Umm al-Qura month from 1356 to 1500
+// and the first day of 1501, as days since 1970-01-01.
+// one hijri year per line.
+//
+// the table is the Umm al-Qura calendar published by King Abdulaziz City for Science and Technology,
+// as shipped in ICU 77 (islamic-umalqura). the compilation in github.com/hablullah/go-hijri we had before
+// has transcription errors before 1420 e.g. a 28 days sha'ban in 1364 and 353 days in 1356 and 1401
+var monthStarts = [...]int64{
+	-11981, -11952, -11922, -11893, -11863, -11834, -11804, -11775, -11745, -11716, -11686, -11656, // 1356
+	-11626, -11597, -11568, -11538, -11509, -11479, -11450, -11421, -11391, -11362, -11332, -11302, // 1357
+	-11272, -11243, -11213, -11184, -11154, -11125, -11095, -11066, -11037, -11007, -10978, -10948, // 1358
+	-10918, -10889, -10859, -10829, -10800, -10770, -10741, -10711, -10682, -10653, -10624, -10594, // 1359
+	-10564, -10535, -10505, -10475, -10445, -10416, -10386, -10357, -10327, -10298, -10269, -10239, // 1360
+	-10210, -10180, -10151, -10121, -10091, -10062, -10032, -10002, -9973, -9944, -9914, -9885, // 1361
+	-9855, -9826, -9796, -9767, -9737, -9708, -9678, -9648, -9619, -9589, -9560, -9530, // 1362
+	-9501, -9471, -9442, -9412, -9383, -9353, -9324, -9294, -9265, -9235, -9206, -9176, // 1363
+	-9146, -9117, -9087, -9058, -9028, -8999, -8970, -8940, -8911, -8881, -8852, -8822, // 1364
+	-8792, -8762, -8732, -8703, -8674, -8644, -8615, -8586, -8556, -8527, -8497, -8468, // 1365
+	-8438, -8408, -8378, -8349, -8319, -8290, -8260, -8231, -8202, -8172, -8143, -8113, // 1366
+	-8084, -8054, -8024, -7995, -7965, -7935, -7906, -7876, -7847, -7818, -7788, -7759, // 1367
+	-7729, -7700, -7670, -7641, -7611, -7581, -7551, -7522, -7493, -7463, -7434, -7404, // 1368
+	-7375, -7345, -7316, -7286, -7257, -7227, -7197, -7168, -7138, -7109, -7079, -7049, // 1369
+	-7020, -6990, -6961, -6932, -6902, -6873, -6843, -6814, -6784, -6755, -6725, -6695, // 1370
+	-6665, -6636, -6606, -6577, -6548, -6518, -6489, -6459, -6430, -6400, -6371, -6341, // 1371
+	-6311, -6281, -6252, -6223, -6193, -6164, -6134, -6105, -6076, -6046, -6017, -5987, // 1372
+	-5957, -5927, -5898, -5868, -5839, -5809, -5780, -5750, -5721, -5692, -5662, -5633, // 1373
+	-5603, -5573, -5544, -5514, -5484, -5455, -5425, -5396, -5366, -5337, -5308, -5278, // 1374
+	-5249, -5219, -5190, -5160, -5130, -5101, -5071, -5041, -5012, -4982, -4953, -4923, // 1375
+	-4894, -4865, -4835, -4806, -4776, -4747, -4717, -4687, -4657, -4628, -4598, -4569, // 1376
+	-4539, -4510, -4481, -4451, -4422, -4393, -4363, -4333, -4303, -4274, -4244, -4214, // 1377
+	-4185, -4155, -4126, -4097, -4068, -4038, -4009, -3979, -3949, -3920, -3890, -3860, // 1378
+	-3830, -3801, -3771, -3742, -3713, -3684, -3654, -3625, -3595, -3565, -3536, -3506, // 1379
+	-3476, -3447, -3417, -3388, -3358, -3329, -3299, -3270, -3240, -3211, -3181, -3152, // 1380
+	-3122, -3093, -3063, -3034, -3004, -2974, -2945, -2915, -2886, -2856, -2827, -2798, // 1381
+	-2768, -2739, -2709, -2680, -2650, -2620, -2591, -2561, -2531, -2502, -2472, -2443, // 1382
+	-2414, -2384, -2355, -2326, -2296, -2266, -2236, -2207, -2177, -2147, -2118, -2088, // 1383
+	-2059, -2030, -2000, -1971, -1942, -1912, -1882, -1853, -1823, -1793, -1763, -1734, // 1384
+	-1704, -1675, -1646, -1616, -1587, -1558, -1528, -1498, -1469, -1439, -1409, -1379, // 1385
+	-1350, -1320, -1291, -1262, -1232, -1203, -1174, -1144, -1114, -1085, -1055, -1025, // 1386
+	-996, -966, -937, -907, -878, -848, -819, -789, -760, -730, -701, -671, // 1387
+	-642, -612, -582, -553, -523, -494, -464, -435, -405, -376, -346, -317, // 1388
+	-288, -258, -228, -199, -169, -139, -110, -80, -50, -21, 8, 38, // 1389
+	67, 96, 126, 155, 185, 215, 245, 274, 304, 333, 363, 392, // 1390
+	422, 451, 480, 510, 539, 569, 599, 628, 658, 688, 717, 747, // 1391
+	776, 806, 835, 864, 894, 923, 953, 982, 1012, 1042, 1071, 1101, // 1392
+	1131, 1160, 1190, 1219, 1248, 1278, 1307, 1337, 1366, 1396, 1425, 1455, // 1393
+	1485, 1515, 1544, 1574, 1603, 1632, 1662, 1691, 1721, 1750, 1780, 1809, // 1394
+	1839, 1869, 1898, 1928, 1958, 1987, 2017, 2046, 2075, 2105, 2134, 2163, // 1395
+	2193, 2223, 2252, 2282, 2312, 2341, 2371, 2401, 2430, 2459, 2489, 2518, // 1396
+	2547, 2577, 2606, 2636, 2666, 2695, 2725, 2755, 2785, 2814, 2843, 2872, // 1397
+	2902, 2931, 2961, 2990, 3020, 3050, 3079, 3109, 3139, 3168, 3198, 3227, // 1398
+	3256, 3286, 3315, 3345, 3374, 3404, 3433, 3463, 3493, 3522, 3552, 3581, // 1399
+	3611, 3641, 3670, 3700, 3729, 3758, 3788, 3817, 3847, 3876, 3906, 3935, // 1400
+	3965, 3995, 4025, 4054, 4084, 4113, 4142, 4172, 4201, 4230, 4260, 4289, // 1401
+	4319, 4349, 4379, 4409, 4438, 4468, 4497, 4526, 4556, 4585, 4614, 4644, // 1402
+	4673, 4703, 4733, 4763, 4792, 4822, 4852, 4881, 4910, 4940, 4969, 4998, // 1403
+	5028, 5057, 5087, 5117, 5146, 5176, 5206, 5235, 5265, 5294, 5324, 5353, // 1404
+	5382, 5412, 5441, 5471, 5500, 5530, 5560, 5590, 5619, 5649, 5678, 5707, // 1405
+	5737, 5767, 5796, 5825, 5855, 5884, 5914, 5944, 5973, 6003, 6032, 6062, // 1406
+	6092, 6121, 6151, 6180, 6209, 6239, 6268, 6298, 6327, 6357, 6386, 6416, // 1407
+	6446, 6476, 6505, 6535, 6564, 6594, 6623, 6652, 6682, 6711, 6740, 6770, // 1408
+	6800, 6830, 6860, 6889, 6919, 6948, 6978, 7007, 7036, 7066, 7095, 7124, // 1409
+	7154, 7184, 7214, 7243, 7273, 7303, 7332, 7362, 7391, 7420, 7450, 7479, // 1410
+	7508, 7538, 7568, 7597, 7627, 7657, 7686, 7716, 7746, 7775, 7804, 7834, // 1411
+	7863, 7893, 7922, 7952, 7981, 8011, 8040, 8070, 8100, 8130, 8159, 8188, // 1412
+	8218, 8247, 8277, 8306, 8335, 8365, 8394, 8424, 8454, 8484, 8513, 8543, // 1413
+	8572, 8602, 8631, 8661, 8690, 8719, 8749, 8778, 8808, 8838, 8867, 8897, // 1414
+	8927, 8956, 8986, 9015, 9045, 9074, 9103, 9133, 9162, 9192, 9221, 9251, // 1415
+	9281, 9311, 9340, 9370, 9399, 9429, 9458, 9487, 9517, 9546, 9576, 9605, // 1416
+	9635, 9665, 9694, 9724, 9754, 9783, 9812, 9842, 9871, 9901, 9930, 9960, // 1417
+	9989, 10019, 10048, 10078, 10108, 10137, 10167, 10196, 10226, 10255, 10285, 10314, // 1418
+	10344, 10373, 10403, 10432, 10462, 10491, 10521, 10550, 10580, 10610, 10640, 10669, // 1419
+	10698, 10727, 10757, 10786, 10815, 10845, 10874, 10904, 10934, 10964, 10994, 11023, // 1420
+	11053, 11082, 11111, 11141, 11170, 11199, 11228, 11258, 11288, 11318, 11348, 11377, // 1421
+	11407, 11437, 11466, 11495, 11525, 11554, 11583, 11612, 11642, 11672, 11702, 11731, // 1422
+	11761, 11791, 11820, 11850, 11879, 11909, 11938, 11967, 11997, 12026, 12056, 12085, // 1423
+	12115, 12145, 12174, 12204, 12234, 12263, 12293, 12322, 12351, 12381, 12410, 12440, // 1424
+	12469, 12499, 12528, 12558, 12588, 12617, 12647, 12676, 12706, 12736, 12765, 12795, // 1425
+	12824, 12853, 12883, 12912, 12942, 12971, 13001, 13031, 13060, 13090, 13120, 13149, // 1426
+	13179, 13208, 13237, 13267, 13296, 13326, 13355, 13385, 13415, 13444, 13474, 13504, // 1427
+	13533, 13563, 13592, 13621, 13651, 13680, 13709, 13739, 13769, 13799, 13828, 13858, // 1428
+	13888, 13917, 13947, 13976, 14005, 14035, 14064, 14093, 14123, 14153, 14182, 14212, // 1429
+	14242, 14271, 14301, 14331, 14360, 14389, 14419, 14448, 14478, 14507, 14537, 14566, // 1430
+	14596, 14625, 14655, 14685, 14714, 14744, 14773, 14803, 14832, 14862, 14891, 14920, // 1431
+	14950, 14979, 15009, 15039, 15069, 15098, 15128, 15157, 15187, 15216, 15246, 15275, // 1432
+	15304, 15334, 15363, 15393, 15423, 15452, 15482, 15512, 15541, 15571, 15600, 15630, // 1433
+	15659, 15688, 15718, 15747, 15777, 15806, 15836, 15866, 15895, 15925, 15955, 15984, // 1434
+	16013, 16043, 16072, 16102, 16131, 16161, 16190, 16220, 16249, 16279, 16309, 16338, // 1435
+	16368, 16397, 16427, 16456, 16486, 16515, 16545, 16574, 16604, 16633, 16663, 16692, // 1436
+	16722, 16752, 16781, 16811, 16841, 16870, 16899, 16929, 16958, 16988, 17017, 17046, // 1437
+	17076, 17106, 17135, 17165, 17195, 17225, 17254, 17283, 17313, 17342, 17371, 17401, // 1438
+	17430, 17460, 17489, 17519, 17549, 17579, 17608, 17638, 17667, 17697, 17726, 17755, // 1439
+	17785, 17814, 17844, 17873, 17903, 17933, 17963, 17992, 18022, 18051, 18081, 18110, // 1440
+	18139, 18169, 18198, 18228, 18257, 18287, 18317, 18346, 18376, 18406, 18435, 18465, // 1441
+	18494, 18523, 18553, 18582, 18612, 18641, 18671, 18700, 18730, 18760, 18789, 18819, // 1442
+	18848, 18878, 18907, 18937, 18966, 18996, 19025, 19055, 19084, 19114, 19143, 19173, // 1443
+	19203, 19232, 19262, 19291, 19321, 19351, 19380, 19409, 19439, 19468, 19498, 19527, // 1444
+	19557, 19586, 19616, 19646, 19676, 19705, 19735, 19764, 19793, 19823, 19852, 19881, // 1445
+	19911, 19940, 19970, 20000, 20030, 20059, 20089, 20119, 20148, 20177, 20207, 20236, // 1446
+	20265, 20295, 20324, 20354, 20384, 20414, 20443, 20473, 20502, 20532, 20561, 20591, // 1447
+	20620, 20649, 20679, 20708, 20738, 20768, 20797, 20827, 20857, 20886, 20916, 20945, // 1448
+	20975, 21004, 21033, 21063, 21092, 21122, 21151, 21181, 21211, 21240, 21270, 21300, // 1449
+	21329, 21359, 21388, 21418, 21447, 21476, 21506, 21535, 21565, 21594, 21624, 21654, // 1450
+	21683, 21713, 21743, 21773, 21802, 21831, 21861, 21890, 21919, 21949, 21979, 22008, // 1451
+	22038, 22068, 22097, 22127, 22157, 22186, 22215, 22245, 22274, 22303, 22333, 22362, // 1452
+	22392, 22422, 22451, 22481, 22511, 22540, 22570, 22599, 22629, 22658, 22687, 22717, // 1453
+	22746, 22776, 22805, 22835, 22865, 22894, 22924, 22954, 22983, 23013, 23042, 23072, // 1454
+	23101, 23130, 23160, 23189, 23219, 23249, 23278, 23308, 23337, 23367, 23397, 23426, // 1455
+	23456, 23485, 23514, 23544, 23573, 23603, 23632, 23662, 23691, 23721, 23751, 23781, // 1456
+	23810, 23840, 23869, 23898, 23928, 23957, 23986, 24016, 24045, 24075, 24105, 24135, // 1457
+	24165, 24194, 24224, 24253, 24282, 24312, 24341, 24370, 24400, 24429, 24459, 24489, // 1458
+	24519, 24548, 24578, 24608, 24637, 24666, 24696, 24725, 24754, 24784, 24813, 24843, // 1459
+	24873, 24902, 24932, 24962, 24991, 25021, 25050, 25080, 25109, 25138, 25168, 25197, // 1460
+	25227, 25256, 25286, 25316, 25345, 25375, 25404, 25434, 25463, 25493, 25523, 25552, // 1461
+	25581, 25611, 25640, 25670, 25699, 25729, 25759, 25788, 25818, 25847, 25877, 25907, // 1462
+	25936, 25965, 25995, 26024, 26054, 26083, 26113, 26142, 26172, 26202, 26232, 26261, // 1463
+	26291, 26320, 26350, 26379, 26408, 26438, 26467, 26496, 26526, 26556, 26586, 26615, // 1464
+	26645, 26675, 26704, 26734, 26763, 26792, 26822, 26851, 26880, 26910, 26940, 26969, // 1465
+	26999, 27029, 27059, 27088, 27118, 27147, 27176, 27205, 27235, 27264, 27294, 27324, // 1466
+	27353, 27383, 27413, 27442, 27472, 27502, 27531, 27560, 27590, 27619, 27649, 27678, // 1467
+	27708, 27737, 27767, 27796, 27826, 27856, 27885, 27915, 27944, 27974, 28003, 28033, // 1468
+	28062, 28091, 28121, 28150, 28180, 28210, 28239, 28269, 28299, 28328, 28358, 28387, // 1469
+	28417, 28446, 28475, 28505, 28534, 28564, 28594, 28623, 28653, 28683, 28712, 28742, // 1470
+	28771, 28801, 28830, 28859, 28889, 28918, 28948, 28977, 29007, 29037, 29066, 29096, // 1471
+	29126, 29155, 29185, 29214, 29243, 29273, 29302, 29332, 29361, 29391, 29421, 29450, // 1472
+	29480, 29509, 29539, 29568, 29598, 29628, 29657, 29686, 29716, 29745, 29775, 29804, // 1473
+	29834, 29863, 29893, 29923, 29952, 29982, 30012, 30041, 30070, 30100, 30129, 30159, // 1474
+	30188, 30217, 30247, 30277, 30306, 30336, 30366, 30396, 30425, 30454, 30484, 30513, // 1475
+	30542, 30572, 30601, 30631, 30660, 30690, 30720, 30750, 30779, 30809, 30838, 30868, // 1476
+	30897, 30926, 30956, 30985, 31014, 31044, 31074, 31104, 31134, 31163, 31193, 31222, // 1477
+	31252, 31281, 31310, 31340, 31369, 31399, 31428, 31458, 31488, 31517, 31547, 31577, // 1478
+	31606, 31636, 31665, 31694, 31724, 31753, 31783, 31812, 31842, 31871, 31901, 31931, // 1479
+	31960, 31990, 32019, 32049, 32078, 32108, 32137, 32167, 32196, 32226, 32255, 32285, // 1480
+	32314, 32344, 32373, 32403, 32433, 32462, 32492, 32521, 32551, 32580, 32610, 32639, // 1481
+	32668, 32698, 32727, 32757, 32787, 32817, 32847, 32876, 32906, 32935, 32964, 32994, // 1482
+	33023, 33052, 33082, 33111, 33141, 33171, 33201, 33230, 33260, 33290, 33319, 33348, // 1483
+	33378, 33407, 33436, 33466, 33495, 33525, 33555, 33585, 33614, 33644, 33673, 33703, // 1484
+	33732, 33762, 33791, 33820, 33850, 33879, 33909, 33939, 33968, 33998, 34028, 34057, // 1485
+	34087, 34116, 34146, 34175, 34204, 34234, 34263, 34293, 34322, 34352, 34382, 34411, // 1486
+	34441, 34471, 34500, 34530, 34559, 34589, 34618, 34647, 34677, 34706, 34736, 34765, // 1487
+	34795, 34825, 34854, 34884, 34914, 34943, 34973, 35002, 35031, 35061, 35090, 35120, // 1488
+	35149, 35179, 35208, 35238, 35268, 35298, 35327, 35357, 35386, 35415, 35445, 35474, // 1489
+	35504, 35533, 35563, 35592, 35622, 35652, 35681, 35711, 35741, 35770, 35799, 35829, // 1490
+	35858, 35888, 35917, 35946, 35976, 36006, 36035, 36065, 36095, 36124, 36154, 36183, // 1491
+	36213, 36242, 36272, 36301, 36330, 36360, 36390, 36419, 36449, 36478, 36508, 36538, // 1492
+	36567, 36597, 36626, 36656, 36685, 36715, 36744, 36773, 36803, 36832, 36862, 36892, // 1493
+	36922, 36951, 36981, 37010, 37040, 37069, 37099, 37128, 37157, 37186, 37216, 37246, // 1494
+	37276, 37305, 37335, 37365, 37394, 37424, 37453, 37482, 37512, 37541, 37570, 37600, // 1495
+	37630, 37659, 37689, 37719, 37749, 37778, 37808, 37837, 37866, 37896, 37925, 37954, // 1496
+	37984, 38014, 38043, 38073, 38103, 38132, 38162, 38191, 38221, 38250, 38280, 38309, // 1497
+	38339, 38368, 38398, 38427, 38457, 38486, 38516, 38546, 38575, 38605, 38634, 38664, // 1498
+	38693, 38723, 38752, 38782, 38811, 38840, 38870, 38900, 38929, 38959, 38988, 39018, // 1499
+	39048, 39077, 39107, 39136, 39166, 39195, 39224, 39254, 39283, 39313, 39342, 39372, // 1500
+	39402, // 1501
+}
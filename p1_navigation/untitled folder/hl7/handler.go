@@ -0,0 +1,398 @@
+package hl7
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// errInternalMsg is written to ERR-8 instead of the errors that aren't the caller's
+var errInternalMsg = errors.New("registry internal error")
+
+// acknowledgment codes (table 0008)
+const (
+	ackAccept = "AA"
+	ackError  = "AE"
+	ackReject = "AR"
+)
+
+// error codes of ERR-3 (table 0357)
+const (
+	errSegmentSequence  = "100"
+	errRequiredField    = "101"
+	errDataType         = "102"
+	errUnsupportedType  = "200"
+	errUnsupportedEvent = "201"
+	errUnknownKey       = "204"
+	errInternal         = "207"
+)
+
+// query response status of QAK-2 (table 0208)
+const (
+	queryOK       = "OK"
+	queryNotFound = "NF"
+	queryError    = "AE"
+)
+
+const (
+	timestampLayout = "20060102150405"
+	defaultVersion  = "2.5"
+	charset         = "UNICODE UTF-8"
+)
+
+// Controller is what the handler needs from *nhic.Controller
+type Controller interface {
+	GetPatient(ctx context.Context, pq *nhic.PatientQuery) (*store.Patient, error)
+	GetPatientByHealthID(ctx context.Context, healthID string) (*store.Patient, error)
+	UpdatePatient(ctx context.Context, pq *nhic.PatientQuery) (*store.Patient, error)
+	SearchPatients(ctx context.Context, q *nhic.PatientSearchQuery) (*nhic.PatientPage, error)
+}
+
+// Handler answers the messages:
+//
+//	QBP^Q22   RSP^K22 with a PID per patient, by identifier and birth date or by demographics
+//	ADT^A04   ACK, the patient is refreshed from the identity sources, or added if it isn't stored
+//	ADT^A08   same as A04
+//
+// the other messages are rejected with an ACK
+type Handler struct {
+	c Controller
+	// MSH-3 and MSH-4 of the replies
+	app      string
+	facility string
+
+	log *logging.Logger
+
+	seq uint64
+	now func() time.Time
+}
+
+// NewHandler returns a Handler looking the patients up through c and logging to log,
+// the replies are sent from the app and facility
+func NewHandler(c Controller, app, facility string, log *logging.Logger) *Handler {
+	return &Handler{c: c, app: app, facility: facility, log: log, now: time.Now}
+}
+
+// Handle returns the reply to the raw message, malformed messages are rejected
+func (h *Handler) Handle(ctx context.Context, raw []byte) *Message {
+	req, err := Parse(raw)
+	if err != nil {
+		resp := h.reply(nil, "ACK", "", "ACK")
+		h.ack(resp, nil, ackReject, errSegmentSequence, err.Error(), "")
+		return resp
+	}
+
+	ctx = audit.NewContext(ctx, access(req))
+	code, event := req.Type()
+	switch {
+	case code == "QBP" && event == "Q22":
+		return h.query(ctx, req)
+	case code == "ADT" && (event == "A04" || event == "A08"):
+		return h.adt(ctx, req, event)
+	}
+
+	resp := h.reply(req, "ACK", event, "ACK")
+	if code == "QBP" || code == "ADT" {
+		h.ack(resp, req, ackReject, errUnsupportedEvent, fmt.Sprintf("%s^%s isn't supported", code, event), "MSH^1^9^1^2")
+	} else {
+		h.ack(resp, req, ackReject, errUnsupportedType, fmt.Sprintf("%s messages aren't supported", code), "MSH^1^9^1^1")
+	}
+	return resp
+}
+
+// access is who sent req for the audit trail: the sending facility (MSH-4) or application (MSH-3),
+// and the message control id (MSH-10). v2 has no purpose of use, it's left empty
+func access(req *Message) audit.Access {
+	msh := req.Segment("MSH")
+	if msh == nil {
+		return audit.Access{}
+	}
+	caller := msh.Get(4, 1)
+	if caller == "" {
+		caller = msh.Get(3, 1)
+	}
+	return audit.Access{Caller: caller, CorrelationID: msh.Get(10, 1)}
+}
+
+// query answers a QBP^Q22. the QPD-3 parameters are @PID.3.1 with the PID.3.4 authority
+// and @PID.7, or the demographics @PID.5.1, @PID.5.2, @PID.7 and @PID.8. RCP-2 is the page size
+func (h *Handler) query(ctx context.Context, req *Message) *Message {
+	resp := h.reply(req, "RSP", "K22", "RSP_K21")
+	qpd := req.Segment("QPD")
+	if qpd == nil {
+		h.ack(resp, req, ackError, errSegmentSequence, "QPD segment is missing", "")
+		h.qak(resp, nil, queryError, 0, 0)
+		return resp
+	}
+
+	params := queryParams(req.Delimiters, qpd)
+	pnts, total, code, err := h.find(ctx, params, req.Segment("RCP"))
+	if err != nil {
+		h.ack(resp, req, ackError, code, err.Error(), "QPD^1^3")
+		h.qak(resp, qpd, queryError, 0, 0)
+		return resp
+	}
+
+	h.ack(resp, req, ackAccept, "", "", "")
+	status := queryOK
+	if total == 0 {
+		status = queryNotFound
+	}
+	h.qak(resp, qpd, status, total, len(pnts))
+	for i := range pnts {
+		PID(resp, i+1, &pnts[i])
+	}
+	return resp
+}
+
+// find returns the patients of the query params, and the ERR-3 code of the error
+func (h *Handler) find(ctx context.Context, params map[string]string, rcp *Segment) ([]store.Patient, int, string, error) {
+	param := func(keys ...string) string {
+		for _, k := range keys {
+			if v := params[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	birthDate := ""
+	if bd := param("PID.7", "PID.7.1"); bd != "" {
+		var err error
+		if birthDate, err = dateParam(bd); err != nil {
+			return nil, 0, errDataType, err
+		}
+	}
+
+	if id := param("PID.3.1", "PID.3"); id != "" {
+		namespace := param("PID.3.4.1", "PID.3.4")
+		system := param("PID.3.4.2")
+		typeCode := param("PID.3.5")
+		var pnt *store.Patient
+		pq, err := identifierQuery(id, namespace, system, typeCode, param("PID.3.10", "PID.3.10.1"))
+		if err == ErrNoIdentifier {
+			// a health id
+			pnt, err = h.c.GetPatientByHealthID(ctx, id)
+		} else if err != nil {
+			return nil, 0, errUnknownKey, err
+		} else {
+			if pq.BirthDate == "" {
+				pq.BirthDate = birthDate
+			}
+			if pq.BirthDate == "" {
+				return nil, 0, errRequiredField, ErrNoBirthDate
+			}
+			if err := pq.Validate(); err != nil {
+				return nil, 0, errDataType, err
+			}
+			pnt, err = h.c.GetPatient(ctx, pq)
+		}
+		if isNotFound(err) || (err == nil && pnt == nil) {
+			return nil, 0, "", nil
+		} else if err != nil {
+			return nil, 0, errCode(err), h.errMessage(ctx, err)
+		}
+		return []store.Patient{*pnt}, 1, "", nil
+	}
+
+	q := &nhic.PatientSearchQuery{
+		Family:    param("PID.5.1.1", "PID.5.1", "PID.5"),
+		Given:     param("PID.5.2"),
+		BirthDate: birthDate,
+	}
+	switch strings.ToUpper(param("PID.8", "PID.8.1")) {
+	case "":
+	case "M":
+		q.Gender = "male"
+	case "F":
+		q.Gender = "female"
+	default:
+		return nil, 0, errDataType, nhic.ErrBadGender
+	}
+	if rcp != nil {
+		q.Count, _ = strconv.Atoi(rcp.Get(2, 1))
+	}
+	page, err := h.c.SearchPatients(ctx, q)
+	if isNotFound(err) {
+		return nil, 0, "", nil
+	} else if err != nil {
+		return nil, 0, errCode(err), h.errMessage(ctx, err)
+	}
+	return page.Patients, page.Total, "", nil
+}
+
+// adt refreshes the patient of the PID from the identity sources, UpdatePatient only updates
+// stored patients so a patient registered elsewhere first is added by GetPatient.
+// the demographics of the message aren't stored, the identity sources are the reference
+func (h *Handler) adt(ctx context.Context, req *Message, event string) *Message {
+	resp := h.reply(req, "ACK", event, "ACK")
+	pid := req.Segment("PID")
+	if pid == nil {
+		h.ack(resp, req, ackError, errSegmentSequence, "PID segment is missing", "")
+		return resp
+	}
+
+	pq, err := QueryFromPID(pid)
+	switch err {
+	case nil:
+	case ErrNoBirthDate:
+		h.ack(resp, req, ackError, errRequiredField, err.Error(), "PID^1^7")
+		return resp
+	case ErrNoIdentifier, ErrUnknownAuthority, ErrBadNewbornID:
+		h.ack(resp, req, ackError, errUnknownKey, err.Error(), "PID^1^3")
+		return resp
+	default:
+		h.ack(resp, req, ackError, errDataType, err.Error(), "PID^1^7")
+		return resp
+	}
+	if err := pq.Validate(); err != nil {
+		h.ack(resp, req, ackError, errDataType, err.Error(), "PID^1^3")
+		return resp
+	}
+
+	_, err = h.c.UpdatePatient(ctx, pq)
+	if isNotFound(err) {
+		_, err = h.c.GetPatient(ctx, pq)
+	}
+	if isNotFound(err) {
+		h.ack(resp, req, ackError, errUnknownKey, "patient isn't known to the identity sources", "PID^1^3")
+		return resp
+	} else if err != nil {
+		h.ack(resp, req, ackError, errCode(err), h.errMessage(ctx, err).Error(), "")
+		return resp
+	}
+	h.ack(resp, req, ackAccept, "", "", "")
+	return resp
+}
+
+// reply returns a message with the MSH of the reply to req, written with the delimiters of req
+func (h *Handler) reply(req *Message, code, event, structure string) *Message {
+	m := NewMessage()
+	var reqMSH *Segment
+	if req != nil {
+		reqMSH = req.Segment("MSH")
+		if req.Delimiters.Subcomponent != 0 {
+			m.Delimiters = req.Delimiters
+		}
+	}
+	d := m.Delimiters
+
+	msh := m.Add("MSH")
+	msh.Set(3, d.Encode(h.app))
+	msh.Set(4, d.Encode(h.facility))
+	now := h.now()
+	msh.Set(7, now.Format(timestampLayout))
+	msh.Set(9, d.Join(code, event, structure))
+	msh.Set(10, fmt.Sprintf("%s%04d", now.Format(timestampLayout), atomic.AddUint64(&h.seq, 1)%10000))
+	msh.Set(11, "P")
+	msh.Set(12, defaultVersion)
+	msh.Set(18, charset)
+	if reqMSH != nil {
+		msh.Set(5, d.Encode(reqMSH.Get(3, 1)))
+		msh.Set(6, d.Encode(reqMSH.Get(4, 1)))
+		if p := reqMSH.Get(11, 1); p != "" {
+			msh.Set(11, d.Encode(p))
+		}
+		if v := reqMSH.Get(12, 1); v != "" {
+			msh.Set(12, d.Encode(v))
+		}
+	}
+	return m
+}
+
+// ack adds the MSA, and the ERR if code isn't accept. location is ERR-2 e.g. PID^1^7
+func (h *Handler) ack(resp, req *Message, code, errCode, text, location string) {
+	d := resp.Delimiters
+	msa := resp.Add("MSA")
+	msa.Set(1, code)
+	if req != nil {
+		msa.Set(2, d.Encode(req.ControlID()))
+	}
+	if code == ackAccept {
+		return
+	}
+	e := resp.Add("ERR")
+	e.Set(2, location)
+	e.Set(3, d.Join(errCode, errCodeText[errCode], "HL70357"))
+	e.Set(4, "E")
+	e.Set(8, d.Encode(text))
+}
+
+// qak adds the QAK and echoes the QPD, hits are the matches in all the pages
+func (h *Handler) qak(resp *Message, qpd *Segment, status string, hits, sent int) {
+	qak := resp.Add("QAK")
+	if qpd != nil {
+		qak.Set(1, qpd.Field(2))
+		qak.Set(3, qpd.Field(1))
+	}
+	qak.Set(2, status)
+	if status != queryError {
+		qak.Set(4, strconv.Itoa(hits))
+		qak.Set(5, strconv.Itoa(sent))
+		qak.Set(6, strconv.Itoa(hits-sent))
+	}
+	if qpd != nil {
+		echo := resp.Add("QPD")
+		for i := 1; i < len(qpd.fields); i++ {
+			echo.Set(i, qpd.fields[i])
+		}
+	}
+}
+
+var errCodeText = map[string]string{
+	errSegmentSequence:  "Segment sequence error",
+	errRequiredField:    "Required field missing",
+	errDataType:         "Data type error",
+	errUnsupportedType:  "Unsupported message type",
+	errUnsupportedEvent: "Unsupported event code",
+	errUnknownKey:       "Unknown key identifier",
+	errInternal:         "Application internal error",
+}
+
+// queryParams reads the QPD-3 repetitions @PID.5.1^value into a map by the field path without the @
+func queryParams(d Delimiters, qpd *Segment) map[string]string {
+	params := map[string]string{}
+	for _, rep := range qpd.Repetitions(3) {
+		key := strings.TrimPrefix(Component(d, rep, 1), "@")
+		if v := Component(d, rep, 2); key != "" && v != "" {
+			params[key] = v
+		}
+	}
+	return params
+}
+
+func isNotFound(err error) bool {
+	return err == nhic.ErrNotFound || err == store.ErrNotFound || err == healthid.ErrNotFound
+}
+
+// errCode is the ERR-3 code of a controller error
+func errCode(err error) string {
+	switch err {
+	case nhic.ErrSearchInput, nhic.ErrBadArgs, nhic.ErrBadBirthDate, nhic.ErrBadGender,
+		healthid.ErrMalformed, healthid.ErrChecksum:
+		return errDataType
+	}
+	return errInternal
+}
+
+// errMessage is the error written to ERR-8, unexpected errors are logged and not written
+func (h *Handler) errMessage(ctx context.Context, err error) error {
+	switch err {
+	case nhic.ErrSearchInput, nhic.ErrBadArgs, nhic.ErrBadBirthDate, nhic.ErrBadGender, nhic.ErrTimeout,
+		nhic.ErrSearchUnsupported, nhic.ErrHealthIDsUnsupported, healthid.ErrMalformed, healthid.ErrChecksum,
+		nhic.ErrPurposeOfUse, nhic.ErrConsentDenied:
+		return err
+	}
+	h.log.Error(ctx, "hl7: lookup failed", logging.Err(err))
+	return errInternalMsg
+}
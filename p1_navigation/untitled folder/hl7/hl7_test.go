@@ -0,0 +1,243 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+// fakeController has one stored patient, the queries it got are kept
+type fakeController struct {
+	pnt     store.Patient
+	updated []string
+	search  *nhic.PatientSearchQuery
+}
+
+func newFake() *fakeController {
+	bd, _ := store.ParseDate("06-04-1985")
+	return &fakeController{pnt: store.Patient{IDNumber: sp("1000000008"), IDType: sp("NationalId"), HealthID: sp("ID10000084583721"),
+		FirstNameAr: sp("محمد"), LastNameAr: sp("العتيبي"), FirstNameEn: sp("Mohammed"), LastNameEn: sp("Al^Otaibi"),
+		DateOfBirthG: &bd, Gender: sp("ذكر"), NationalityCode: sp("SAU"), PassportNumber: sp("P1234567")}}
+}
+
+func (f *fakeController) GetPatient(ctx context.Context, pq *nhic.PatientQuery) (*store.Patient, error) {
+	if pq.ID != *f.pnt.IDNumber {
+		return nil, nhic.ErrNotFound
+	}
+	pnt := f.pnt
+	return &pnt, nil
+}
+
+func (f *fakeController) GetPatientByHealthID(ctx context.Context, healthID string) (*store.Patient, error) {
+	if healthID != *f.pnt.HealthID {
+		return nil, nhic.ErrNotFound
+	}
+	pnt := f.pnt
+	return &pnt, nil
+}
+
+func (f *fakeController) UpdatePatient(ctx context.Context, pq *nhic.PatientQuery) (*store.Patient, error) {
+	f.updated = append(f.updated, pq.ID+"/"+pq.IDType+"/"+pq.BirthDate)
+	return f.GetPatient(ctx, pq)
+}
+
+func (f *fakeController) SearchPatients(ctx context.Context, q *nhic.PatientSearchQuery) (*nhic.PatientPage, error) {
+	f.search = q
+	return &nhic.PatientPage{Patients: []store.Patient{f.pnt}, Total: 1, Count: 1}, nil
+}
+
+func TestDelimiters(t *testing.T) {
+	d := DefaultDelimiters
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Al Otaibi", "Al Otaibi"},
+		{"Al^Otaibi", `Al\S\Otaibi`},
+		{"a|b~c&d\\e", `a\F\b\R\c\T\d\E\e`},
+		{"العتيبي", "العتيبي"},
+	}
+	for _, tt := range tests {
+		if got := d.Encode(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+		if got := d.Decode(d.Encode(tt.in)); got != tt.in {
+			t.Errorf("%q: decoded %q", tt.in, got)
+		}
+	}
+	if got := d.Decode(`\X0D\`); got != `\X0D\` {
+		t.Errorf("hex escape: %q", got)
+	}
+}
+
+func TestQueryFromPID(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  string
+		want string
+		err  error
+	}{
+		{"national id", "PID|1||1000000008^^^SANID||||19850406", "1000000008/national_id/06-04-1985", nil},
+		{"health id skipped", "PID|1||ID10000084583721^^^NHIC~2000000006^^^^PRC||||19900101", "2000000006/iqama/01-01-1990", nil},
+		{"first digit", "PID|1||1000000008||||19850406", "1000000008//06-04-1985", nil},
+		{"gcc id", "PID|1||784199012345671^^^^NI^^^^^ARE||||19900101", "784199012345671/gcc_id/01-01-1990", nil},
+		{"newborn", "PID|1||NB-1000000008-20261001-1^^^NHICNB", "1000000008/newborn/01-10-2026", nil},
+		{"bad newborn", "PID|1||NB-1000000008^^^NHICNB", "", ErrBadNewbornID},
+		{"unknown authority", "PID|1||1000000008^^^XYZ||||19850406", "", ErrUnknownAuthority},
+		{"no birth date", "PID|1||1000000008^^^SANID", "", ErrNoBirthDate},
+		{"year alone", "PID|1||1000000008^^^SANID||||1985", "", nhic.ErrBadBirthDate},
+		{"no identifier", "PID|1||ID10000084583721^^^NHIC||||19850406", "", ErrNoIdentifier},
+	}
+	for _, tt := range tests {
+		m, err := Parse([]byte("MSH|^~\\&|HIS|KFSH|||x||ADT^A04|C1|P|2.5\r" + tt.pid + "\r"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		pq, err := QueryFromPID(m.Segment("PID"))
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && pq.ID+"/"+pq.IDType+"/"+pq.BirthDate != tt.want {
+			t.Errorf("%s: got %+v", tt.name, pq)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	const msh = "MSH|^~\\&|HIS|KFSH|NHIC|MOH|20260101||QBP^Q22^QBP_Q21|C1|P|2.5\r"
+	tests := []struct {
+		name   string
+		qpd    string
+		ack    string
+		status string
+		err    string
+	}{
+		{"identifier", "QPD|IHE PDQ Query|Q1|@PID.3.1^1000000008~@PID.3.4.1^SANID~@PID.7^19850406\rRCP|I|10^RD", "AA", "OK", ""},
+		{"health id", "QPD|Q|Q1|@PID.3.1^ID10000084583721~@PID.3.4.1^NHIC", "AA", "OK", ""},
+		{"not found", "QPD|Q|Q1|@PID.3.1^2000000006~@PID.3.5^PRC~@PID.7^19900101", "AA", "NF", ""},
+		{"demographics", "QPD|Q|Q1|@PID.5.1.1^Otaibi~@PID.8^F\rRCP|I|5^RD", "AA", "OK", ""},
+		{"bad birth date", "QPD|Q|Q1|@PID.3.1^1000000008~@PID.7^1985", "AE", "AE", "102"},
+	}
+	for _, tt := range tests {
+		c := newFake()
+		resp := NewHandler(c, "NHIC", "MOH", nil).Handle(context.Background(), []byte(msh+tt.qpd+"\r"))
+		if code, event := resp.Type(); code != "RSP" || event != "K22" {
+			t.Errorf("%s: reply %s^%s", tt.name, code, event)
+			continue
+		}
+		msa, qak := resp.Segment("MSA"), resp.Segment("QAK")
+		if msa.Field(1) != tt.ack || msa.Field(2) != "C1" || qak.Field(1) != "Q1" || qak.Field(2) != tt.status {
+			t.Errorf("%s: got %q", tt.name, resp.Bytes())
+		}
+		if tt.err != "" && !strings.HasPrefix(resp.Segment("ERR").Field(3), tt.err) {
+			t.Errorf("%s: got %q", tt.name, resp.Bytes())
+		}
+		if tt.status == "OK" && resp.Segment("PID") == nil {
+			t.Errorf("%s: no PID in %q", tt.name, resp.Bytes())
+		}
+		if tt.name == "demographics" && (c.search.Family != "Otaibi" || c.search.Gender != "female" || c.search.Count != 5) {
+			t.Errorf("%s: got %+v", tt.name, c.search)
+		}
+	}
+}
+
+func TestPID(t *testing.T) {
+	m := NewMessage()
+	pid := PID(m, 1, &newFake().pnt)
+
+	ids, names := pid.Repetitions(3), pid.Repetitions(5)
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"health id first", Component(m.Delimiters, ids[0], 1) + "^" + Subcomponent(m.Delimiters, ids[0], 4, 1), "ID10000084583721^NHIC"},
+		{"id number", Component(m.Delimiters, ids[1], 1) + "^" + Subcomponent(m.Delimiters, ids[1], 4, 1), "1000000008^SANID"},
+		{"passport", Component(m.Delimiters, ids[2], 1), "P1234567"},
+		{"arabic name", Component(m.Delimiters, names[0], 2), "محمد"},
+		{"escaped english name", Component(m.Delimiters, names[1], 1), "Al^Otaibi"},
+		{"birth date", pid.Field(7), "19850406"},
+		{"sex", pid.Field(8), "M"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestADT(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		ack     string
+		err     string
+		updated string
+	}{
+		{"A08", "MSH|^~\\&|HIS|KFSH|||x||ADT^A08^ADT_A01|C1|P|2.5\rEVN|A08\rPID|1||1000000008^^^SANID&urn:x&URI^NI||Doe^John||19850406|M",
+			"AA", "", "1000000008/national_id/06-04-1985"},
+		{"newborn", "MSH|^~\\&|HIS|KFSH|||x||ADT^A04|C1|P|2.5\rPID|1||NB-1000000008-20261001-1^^^NHICNB||Doe||20261001|F",
+			"AA", "", "1000000008/newborn/01-10-2026"},
+		{"unknown to the sources", "MSH|^~\\&|HIS|KFSH|||x||ADT^A04|C1|P|2.5\rPID|1||1000000016^^^^NI||Doe||19800101|F",
+			"AE", "204", "1000000016//01-01-1980"},
+		{"no PID", "MSH|^~\\&|HIS|KFSH|||x||ADT^A04|C1|P|2.5", "AE", "", ""},
+		{"unsupported event", "MSH|^~\\&|HIS|KFSH|||x||ADT^A01|C1|P|2.5", "AR", "201", ""},
+		{"not a message", "garbage", "AR", "", ""},
+	}
+	for _, tt := range tests {
+		c := newFake()
+		resp := NewHandler(c, "NHIC", "MOH", nil).Handle(context.Background(), []byte(tt.raw+"\r"))
+		if got := resp.Segment("MSA").Field(1); got != tt.ack {
+			t.Errorf("%s: got %s, want %s: %q", tt.name, got, tt.ack, resp.Bytes())
+		}
+		if tt.err != "" && !strings.HasPrefix(resp.Segment("ERR").Field(3), tt.err) {
+			t.Errorf("%s: got %q", tt.name, resp.Bytes())
+		}
+		if got := strings.Join(c.updated, ","); got != tt.updated {
+			t.Errorf("%s: updated %q, want %q", tt.name, got, tt.updated)
+		}
+	}
+}
+
+func TestMLLP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(NewHandler(newFake(), "NHIC", "MOH", nil))
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	// the connection stays open for the next message
+	for i := 0; i < 2; i++ {
+		if err := WriteFrame(conn, []byte("MSH|^~\\&|HIS|KFSH|||x||QBP^Q22|C1|P|2.5\rQPD|Q|Q1|@PID.3.1^ID10000084583721~@PID.3.4.1^NHIC\r")); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		frame, err := ReadFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, err := Parse(frame); err != nil || m.Segment("PID") == nil {
+			t.Fatalf("%q: %v", frame, err)
+		}
+	}
+	srv.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,281 @@
+// Package hl7 serves the registry to the hospital systems that only speak HL7 v2:
+// QBP^Q22 patient demographic queries answered with RSP^K22, and ADT^A04/A08 that refresh
+// the patient, over MLLP.
+//
+// only the segments and fields the registry uses are read and written, see pid.go for the PID mapping
+package hl7
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNoMSH     = errors.New("message doesn't start with an MSH segment")
+	ErrBadHeader = errors.New("MSH encoding characters are malformed")
+)
+
+// Delimiters are the separators of a message, read from MSH-1 and MSH-2
+type Delimiters struct {
+	Field        byte
+	Component    byte
+	Repetition   byte
+	Escape       byte
+	Subcomponent byte
+}
+
+// DefaultDelimiters are the ones the replies are written with, |^~\&
+var DefaultDelimiters = Delimiters{Field: '|', Component: '^', Repetition: '~', Escape: '\\', Subcomponent: '&'}
+
+func (d Delimiters) encodingChars() string {
+	return string([]byte{d.Component, d.Repetition, d.Escape, d.Subcomponent})
+}
+
+// Encode escapes the delimiters in s, \F\ \S\ \T\ \R\ \E\
+func (d Delimiters) Encode(s string) string {
+	if !strings.ContainsAny(s, string([]byte{d.Field, d.Component, d.Repetition, d.Escape, d.Subcomponent})) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case d.Field:
+			b.WriteString(string(d.Escape) + "F" + string(d.Escape))
+		case d.Component:
+			b.WriteString(string(d.Escape) + "S" + string(d.Escape))
+		case d.Subcomponent:
+			b.WriteString(string(d.Escape) + "T" + string(d.Escape))
+		case d.Repetition:
+			b.WriteString(string(d.Escape) + "R" + string(d.Escape))
+		case d.Escape:
+			b.WriteString(string(d.Escape) + "E" + string(d.Escape))
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// Decode reverses Encode, the other escape sequences e.g. \X..\ are kept as they are
+func (d Delimiters) Decode(s string) string {
+	if strings.IndexByte(s, d.Escape) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != d.Escape || i+2 >= len(s) || s[i+2] != d.Escape {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'F':
+			b.WriteByte(d.Field)
+		case 'S':
+			b.WriteByte(d.Component)
+		case 'T':
+			b.WriteByte(d.Subcomponent)
+		case 'R':
+			b.WriteByte(d.Repetition)
+		case 'E':
+			b.WriteByte(d.Escape)
+		default:
+			b.WriteString(s[i : i+3])
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// Join escapes the components and joins them into a field, trailing empty components are dropped
+func (d Delimiters) Join(components ...string) string {
+	return d.join(d.Component, components)
+}
+
+// JoinSub is Join for the subcomponents of a component
+func (d Delimiters) JoinSub(subcomponents ...string) string {
+	return d.join(d.Subcomponent, subcomponents)
+}
+
+func (d Delimiters) join(sep byte, parts []string) string {
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = d.Encode(p)
+	}
+	return strings.Join(escaped, string(sep))
+}
+
+// Repeat joins already joined values into the repetitions of a field
+func (d Delimiters) Repeat(values ...string) string {
+	var reps []string
+	for _, v := range values {
+		if v != "" {
+			reps = append(reps, v)
+		}
+	}
+	return strings.Join(reps, string(d.Repetition))
+}
+
+// Segment is a segment split into its raw fields, the field n of the spec is Field(n).
+// for MSH, Field(1) is the field separator and Field(2) the encoding characters
+type Segment struct {
+	Name   string
+	fields []string
+	d      Delimiters
+}
+
+// Field returns field n as it's written, with its delimiters and escapes
+func (s *Segment) Field(n int) string {
+	if n <= 0 || n >= len(s.fields) {
+		return ""
+	}
+	return s.fields[n]
+}
+
+// Repetitions returns the raw repetitions of field n
+func (s *Segment) Repetitions(n int) []string {
+	f := s.Field(n)
+	if f == "" {
+		return nil
+	}
+	if s.Name == "MSH" && n <= 2 {
+		return []string{f}
+	}
+	return strings.Split(f, string(s.d.Repetition))
+}
+
+// Get returns component c (from 1) of the first repetition of field n, unescaped
+func (s *Segment) Get(n, c int) string {
+	reps := s.Repetitions(n)
+	if len(reps) == 0 {
+		return ""
+	}
+	return Component(s.d, reps[0], c)
+}
+
+// Set sets field n to the raw value, made with Join and Repeat
+func (s *Segment) Set(n int, value string) {
+	for len(s.fields) <= n {
+		s.fields = append(s.fields, "")
+	}
+	s.fields[n] = value
+}
+
+// Component returns component c (from 1) of a raw repetition, unescaped
+func Component(d Delimiters, rep string, c int) string {
+	parts := strings.Split(rep, string(d.Component))
+	if c <= 0 || c > len(parts) {
+		return ""
+	}
+	return d.Decode(parts[c-1])
+}
+
+// Subcomponent returns subcomponent sc (from 1) of component c of a raw repetition, unescaped
+func Subcomponent(d Delimiters, rep string, c, sc int) string {
+	parts := strings.Split(rep, string(d.Component))
+	if c <= 0 || c > len(parts) {
+		return ""
+	}
+	subs := strings.Split(parts[c-1], string(d.Subcomponent))
+	if sc <= 0 || sc > len(subs) {
+		return ""
+	}
+	return d.Decode(subs[sc-1])
+}
+
+// Message is a parsed HL7 v2 message
+type Message struct {
+	Delimiters Delimiters
+	Segments   []*Segment
+}
+
+// NewMessage returns a message with the default delimiters and no segments
+func NewMessage() *Message {
+	return &Message{Delimiters: DefaultDelimiters}
+}
+
+// Parse reads an ER7 message, segments end with \r, \n is accepted too
+func Parse(b []byte) (*Message, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) < 8 || string(b[:3]) != "MSH" {
+		return nil, ErrNoMSH
+	}
+	d := Delimiters{Field: b[3], Component: b[4], Repetition: b[5], Escape: b[6], Subcomponent: b[7]}
+	if b[7] == d.Field {
+		// no subcomponent separator, the encoding characters are 3 long
+		d.Subcomponent = 0
+	} else if len(b) > 8 && b[8] != d.Field {
+		return nil, ErrBadHeader
+	}
+
+	m := &Message{Delimiters: d}
+	lines := strings.FieldsFunc(string(b), func(r rune) bool { return r == '\r' || r == '\n' })
+	for _, line := range lines {
+		fields := strings.Split(line, string(d.Field))
+		seg := &Segment{Name: fields[0], d: d}
+		if seg.Name == "MSH" {
+			// MSH-1 is the separator itself
+			fields = append([]string{"MSH", string(d.Field)}, fields[1:]...)
+		}
+		seg.fields = fields
+		m.Segments = append(m.Segments, seg)
+	}
+	return m, nil
+}
+
+// Segment returns the first segment with the name, nil if there's none
+func (m *Message) Segment(name string) *Segment {
+	for _, s := range m.Segments {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Add appends a segment with the name and returns it
+func (m *Message) Add(name string) *Segment {
+	s := &Segment{Name: name, fields: []string{name}, d: m.Delimiters}
+	if name == "MSH" {
+		s.Set(1, string(m.Delimiters.Field))
+		s.Set(2, m.Delimiters.encodingChars())
+	}
+	m.Segments = append(m.Segments, s)
+	return s
+}
+
+// Type returns the message code and trigger event of MSH-9 e.g. QBP and Q22
+func (m *Message) Type() (code, event string) {
+	msh := m.Segment("MSH")
+	if msh == nil {
+		return "", ""
+	}
+	return msh.Get(9, 1), msh.Get(9, 2)
+}
+
+// ControlID returns MSH-10
+func (m *Message) ControlID() string {
+	if msh := m.Segment("MSH"); msh != nil {
+		return msh.Get(10, 1)
+	}
+	return ""
+}
+
+// Bytes writes the message in ER7, each segment ends with \r
+func (m *Message) Bytes() []byte {
+	var b bytes.Buffer
+	sep := string(m.Delimiters.Field)
+	for _, s := range m.Segments {
+		fields := s.fields
+		if s.Name == "MSH" && len(fields) > 1 {
+			// MSH-1 isn't written twice
+			fields = append([]string{"MSH"}, fields[2:]...)
+		}
+		b.WriteString(strings.Join(fields, sep))
+		b.WriteByte('\r')
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,190 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// MLLP frames a message as <VT> message <FS><CR>
+const (
+	startBlock     = 0x0b
+	endBlock       = 0x1c
+	carriageReturn = 0x0d
+
+	// maxFrameSize bounds a message, a query or an ADT is a few KB
+	maxFrameSize = 1 << 20
+
+	defaultIdleTimeout = 5 * time.Minute
+)
+
+var (
+	ErrFrame         = errors.New("malformed MLLP frame")
+	ErrFrameTooLarge = errors.New("MLLP frame is too large")
+	ErrServerClosed  = errors.New("hl7: server closed")
+)
+
+// ReadFrame reads the next MLLP frame and returns the message in it,
+// bytes before the start block are skipped
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == startBlock {
+			break
+		}
+	}
+
+	var msg []byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return nil, ErrFrame
+		} else if err != nil {
+			return nil, err
+		}
+		if c == endBlock {
+			next, err := r.ReadByte()
+			if err != nil || next != carriageReturn {
+				return nil, ErrFrame
+			}
+			return msg, nil
+		}
+		if len(msg) == maxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+		msg = append(msg, c)
+	}
+}
+
+// WriteFrame writes msg in an MLLP frame
+func WriteFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, msg...)
+	frame = append(frame, endBlock, carriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
+
+// Server accepts MLLP connections and answers each message with the reply of the Handler,
+// messages on a connection are handled in order. the dropped connections are logged to the log of the Handler
+type Server struct {
+	h *Handler
+
+	// IdleTimeout closes the connections that don't send a message for that long, 5m if 0
+	IdleTimeout time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	closed    bool
+}
+
+// NewServer returns a Server answering with h
+func NewServer(h *Handler) *Server {
+	return &Server{h: h, listeners: map[net.Listener]bool{}, conns: map[net.Conn]bool{}}
+}
+
+// ListenAndServe listens on the tcp addr e.g. ":2575" and serves it
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts the connections of l until Close, it always returns an error,
+// ErrServerClosed after Close
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners and closes the connections, the messages being handled are canceled
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	idle := s.IdleTimeout
+	if idle <= 0 {
+		idle = defaultIdleTimeout
+	}
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idle))
+		frame, err := ReadFrame(r)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if err != io.EOF && !closed {
+				s.h.log.Warn(ctx, "hl7: connection dropped", logging.String("remote", conn.RemoteAddr().String()), logging.Err(err))
+			}
+			return
+		}
+
+		reply := s.h.Handle(ctx, frame)
+		if err := WriteFrame(conn, reply.Bytes()); err != nil {
+			s.h.log.Warn(ctx, "hl7: reply not sent", logging.String("remote", conn.RemoteAddr().String()), logging.Err(err))
+			return
+		}
+	}
+}
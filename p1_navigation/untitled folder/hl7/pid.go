@@ -0,0 +1,290 @@
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic"
+	"gitlab.lean/leandevclan/nhic/fhir"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+var (
+	ErrNoIdentifier     = errors.New("PID-3 has no identifier the registry knows")
+	ErrBadNewbornID     = errors.New("newborn identifier is NB-<guardian id>-<yyyymmdd>-<birth order>")
+	ErrUnknownAuthority = errors.New("identifier assigning authority is unknown")
+	ErrNoBirthDate      = errors.New("PID-7 birth date is required")
+)
+
+const (
+	dateLayout = "20060102"
+
+	// assigning authorities of the ids the registry allocates
+	namespaceHealthID = "NHIC"
+	namespaceNewborn  = "NHICNB"
+	typeHealthID      = "MR"
+)
+
+// authority is how an id family is written in a CX: the assigning authority namespace
+// with the FHIR system as the universal id, and the v2 identifier type (table 0203)
+type authority struct {
+	namespace string
+	system    string
+	typeCode  string
+	idType    nhic.IDType
+}
+
+// by store.Patient.IDType
+var authorities = map[string]authority{
+	"NationalId":   {namespace: "SANID", system: fhir.SystemNationalID, typeCode: "NI", idType: nhic.IDTypeNationalID},
+	"Iqama":        {namespace: "SAIQAMA", system: fhir.SystemIqama, typeCode: "PRC", idType: nhic.IDTypeIqama},
+	"BorderNumber": {namespace: "SABORDER", system: fhir.SystemBorderNumber, idType: nhic.IDTypeBorderNumber},
+	"VisitVisa":    {namespace: "SAVISA", system: fhir.SystemVisa, typeCode: "VS", idType: nhic.IDTypeVisa},
+	"GCCID":        {namespace: "GCCID", system: fhir.SystemGCCID, typeCode: "NI", idType: nhic.IDTypeGCCID},
+}
+
+// passports aren't an IDType of the stored patients, they're written from PassportNumber
+var passport = authority{namespace: "PASSPORT", system: fhir.SystemPassport, typeCode: "PPN", idType: nhic.IDTypePassport}
+
+// is tells if the namespace or the universal id of a CX is a's
+func (a authority) is(namespace, system string) bool {
+	return (namespace != "" && strings.EqualFold(namespace, a.namespace)) || (system != "" && system == a.system)
+}
+
+// PID writes pnt as a PID segment of m, setID is PID-1.
+//
+// PID-3 has the health id, the id number by its IDType and the passport and border numbers,
+// PID-5 the arabic then the english legal name, a generated english name is a display name
+func PID(m *Message, setID int, pnt *store.Patient) *Segment {
+	d := m.Delimiters
+	pid := m.Add("PID")
+	pid.Set(1, fmt.Sprint(setID))
+	pid.Set(3, d.Repeat(identifiers(d, pnt)...))
+	pid.Set(5, d.Repeat(
+		name(d, pnt.FirstNameAr, pnt.SecondNameAr, pnt.ThirdNameAr, pnt.LastNameAr, "L", ""),
+		name(d, pnt.FirstNameEn, pnt.SecondNameEn, pnt.ThirdNameEn, pnt.LastNameEn, englishNameType(pnt), "A"),
+	))
+	pid.Set(7, birthDate(pnt))
+	pid.Set(8, sex(pnt.Gender))
+	if n := str(pnt.MobileNumber); n != "" {
+		pid.Set(13, d.Join(n, "PRN", "CP"))
+	}
+	if code := str(pnt.NationalityCode); code != "" {
+		pid.Set(26, d.Join(code, str(pnt.Nationality), "ISO3166"))
+	}
+	if pnt.IsDead != nil {
+		dead := "N"
+		if *pnt.IsDead == "1" || strings.EqualFold(*pnt.IsDead, "true") {
+			dead = "Y"
+		}
+		pid.Set(30, dead)
+	}
+	return pid
+}
+
+func identifiers(d Delimiters, pnt *store.Patient) []string {
+	var ids []string
+	if hid := str(pnt.HealthID); hid != "" {
+		ids = append(ids, cx(d, hid, authority{namespace: namespaceHealthID, system: fhir.SystemHealthID, typeCode: typeHealthID}, ""))
+	}
+
+	idNumber := str(pnt.IDNumber)
+	switch t := str(pnt.IDType); {
+	case t == "Newborn" || strings.HasPrefix(idNumber, "NB-"):
+		ids = append(ids, cx(d, idNumber, authority{namespace: namespaceNewborn}, ""))
+	case idNumber != "":
+		if t == "" {
+			// older rows don't have it, national ids and iqamas are told by the first digit
+			switch {
+			case strings.HasPrefix(idNumber, "1"):
+				t = "NationalId"
+			case strings.HasPrefix(idNumber, "2"):
+				t = "Iqama"
+			}
+		}
+		if a, ok := authorities[t]; ok {
+			ids = append(ids, cx(d, idNumber, a, str(pnt.IDCountry)))
+		}
+	}
+
+	if n := str(pnt.PassportNumber); n != "" && n != idNumber {
+		ids = append(ids, cx(d, n, passport, str(pnt.IDCountry)))
+	}
+	// visitors by visa have a border number too
+	if n := str(pnt.BorderNumber); n != "" && n != idNumber {
+		ids = append(ids, cx(d, n, authorities["BorderNumber"], ""))
+	}
+	return ids
+}
+
+// cx is id^^^namespace&system&URI^type^^^^^country
+func cx(d Delimiters, id string, a authority, country string) string {
+	hd := d.JoinSub(a.namespace, a.system, uriType(a.system))
+	parts := []string{d.Encode(id), "", "", hd, d.Encode(a.typeCode), "", "", "", "", d.Encode(country)}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, string(d.Component))
+}
+
+func uriType(system string) string {
+	if system == "" {
+		return ""
+	}
+	return "URI"
+}
+
+// name is family^given^second and third^^^^L^representation, "" if there's no part of it
+func name(d Delimiters, first, second, third, last *string, nameType, representation string) string {
+	family := strings.TrimSpace(str(last))
+	given := strings.TrimSpace(str(first))
+	further := strings.TrimSpace(strings.TrimSpace(str(second)) + " " + strings.TrimSpace(str(third)))
+	if family == "" && given == "" && further == "" {
+		return ""
+	}
+	return d.Join(family, given, further, "", "", "", nameType, representation)
+}
+
+// englishNameType is L (legal), or D (display) if the name was transliterated from the arabic one
+func englishNameType(pnt *store.Patient) string {
+	if str(pnt.NameEnSource) == store.NameSourceGenerated {
+		return "D"
+	}
+	return "L"
+}
+
+// birthDate is the gregorian birth date as YYYYMMDD
+func birthDate(pnt *store.Patient) string {
+	for _, b := range []*store.Date{pnt.DateOfBirthG, pnt.DateOfBirthH} {
+		if b == nil || b.IsZero() {
+			continue
+		}
+		if t, err := b.Time(); err == nil {
+			return t.Format(dateLayout)
+		}
+	}
+	return ""
+}
+
+// sex is M, F or U (table 0001)
+func sex(gender *string) string {
+	g := strings.TrimSpace(str(gender))
+	if g == "" {
+		return ""
+	}
+	for code, v := range map[string]string{"M": "male", "F": "female"} {
+		for _, s := range store.GenderValues(v) {
+			if strings.EqualFold(g, s) {
+				return code
+			}
+		}
+	}
+	return "U"
+}
+
+// QueryFromPID reads the query of the registry from a PID: the first identifier of PID-3 that
+// isn't the health id and the PID-7 birth date
+func QueryFromPID(pid *Segment) (*nhic.PatientQuery, error) {
+	var pq *nhic.PatientQuery
+	var err error
+	for _, rep := range pid.Repetitions(3) {
+		d := pid.d
+		pq, err = identifierQuery(Component(d, rep, 1), Subcomponent(d, rep, 4, 1), Subcomponent(d, rep, 4, 2),
+			Component(d, rep, 5), Component(d, rep, 10))
+		if err == ErrNoIdentifier {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if pq == nil {
+		return nil, ErrNoIdentifier
+	}
+	if pq.BirthDate == "" {
+		bd := pid.Get(7, 1)
+		if bd == "" {
+			return nil, ErrNoBirthDate
+		}
+		if pq.BirthDate, err = dateParam(bd); err != nil {
+			return nil, err
+		}
+	}
+	return pq, nil
+}
+
+// identifierQuery is the query of an identifier, the id type is told by the assigning
+// authority, or the identifier type, or the first digit when it has neither.
+// ErrNoIdentifier if it's a health id or empty
+func identifierQuery(id, namespace, system, typeCode, country string) (*nhic.PatientQuery, error) {
+	if id == "" || namespace == namespaceHealthID || system == fhir.SystemHealthID || typeCode == typeHealthID {
+		return nil, ErrNoIdentifier
+	}
+	if namespace == namespaceNewborn {
+		return newbornQuery(id)
+	}
+
+	pq := &nhic.PatientQuery{ID: id, Country: country}
+	if namespace != "" || system != "" {
+		a, found := passport, passport.is(namespace, system)
+		for _, known := range authorities {
+			if known.is(namespace, system) {
+				a, found = known, true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrUnknownAuthority
+		}
+		pq.IDType = string(a.idType)
+		return pq, nil
+	}
+
+	switch typeCode {
+	case "PRC":
+		pq.IDType = string(nhic.IDTypeIqama)
+	case "VS":
+		pq.IDType = string(nhic.IDTypeVisa)
+	case "PPN":
+		pq.IDType = string(nhic.IDTypePassport)
+	case "NI":
+		if country != "" && country != "SAU" {
+			pq.IDType = string(nhic.IDTypeGCCID)
+		}
+	}
+	return pq, nil
+}
+
+// newbornQuery reads the record id of a newborn, NB-<guardian id>-<yyyymmdd>-<birth order>
+func newbornQuery(id string) (*nhic.PatientQuery, error) {
+	parts := strings.Split(id, "-")
+	if len(parts) != 4 || parts[0] != "NB" {
+		return nil, ErrBadNewbornID
+	}
+	bd, err := dateParam(parts[2])
+	if err != nil {
+		return nil, ErrBadNewbornID
+	}
+	return &nhic.PatientQuery{ID: parts[1], IDType: string(nhic.IDTypeNewborn), BirthDate: bd, BirthOrder: parts[3]}, nil
+}
+
+// dateParam reads a v2 date, YYYYMMDD with an optional time, as dd-mm-yyyy in its calendar
+func dateParam(s string) (string, error) {
+	if len(s) < 8 {
+		return "", nhic.ErrBadBirthDate
+	}
+	d, err := store.ParseDate(s[6:8] + "-" + s[4:6] + "-" + s[:4])
+	if err != nil {
+		return "", nhic.ErrBadBirthDate
+	}
+	return d.String(), nil
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,451 @@
+// Package httptest serves stand-ins for the upstreams behind the Apigee gateway:
+// Yakeen, NIC, SCFHS and the OAuth token endpoint, with data from fixture files.
+//
+// point STG_GATEWAY_URL (and the scfhs url) at it to run the server or the tests without the gateway
+//
+//	fx, err := httptest.LoadFixtures("httptest/testdata/fixtures.json")
+//	srv := httptest.NewServer(fx)
+//	defer srv.Close()
+//	conf.Gateway.URL = srv.URL
+//	conf.Gateway.Lookups = httptest.GatewayLookups()
+//
+// errors can be injected per record in the fixtures or per route with SetFault
+package httptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	stdhttptest "net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/config"
+	"gitlab.lean/leandevclan/nhic/gateway"
+	"gitlab.lean/leandevclan/nhic/nic"
+	"gitlab.lean/leandevclan/nhic/scfhs"
+	"gitlab.lean/leandevclan/nhic/yakeen"
+)
+
+// routes served by the fakes, same paths the clients call on the gateway
+const (
+	RouteYakeenCitizen   = "/yakeen/GetCitizenInfo"
+	RouteYakeenExpat     = "/yakeen/GetAlienInfoByIqama"
+	RouteNicPersonInfo   = "/nic/person-info"
+	RouteNicContactsInfo = "/nic/person-contacts-info"
+	RouteScfhsProfile    = "/scfhs/practitioner"
+	RouteOauthToken      = "/oauth/client_credential/accesstoken"
+
+	// the gateway lookups have no published paths, the fakes serve them here,
+	// set conf.Gateway.Lookups to GatewayLookups() to use them
+	RouteGatewayBorderNumber = "/_fakes/gateway/border-number"
+	RouteGatewayVisa         = "/_fakes/gateway/visa"
+	RouteGatewayGCCNational  = "/_fakes/gateway/gcc-national"
+	RouteGatewayNewborn      = "/_fakes/gateway/newborn"
+)
+
+// GatewayLookups points the gateway lookups at the fakes, with the error codes of the fixture faults
+func GatewayLookups() config.GatewayLookups {
+	return config.GatewayLookups{
+		Paths: map[string]string{
+			string(gateway.LookupBorderNumber): RouteGatewayBorderNumber,
+			string(gateway.LookupVisa):         RouteGatewayVisa,
+			string(gateway.LookupGCCNational):  RouteGatewayGCCNational,
+			string(gateway.LookupNewborn):      RouteGatewayNewborn,
+		},
+		BadDOBCode: "bad_dob",
+		BadIDCode:  "bad_id",
+	}
+}
+
+// Handler is the http.Handler of the fakes
+type Handler struct {
+	mux *http.ServeMux
+
+	mu     sync.RWMutex
+	fx     *Fixtures
+	faults map[string]Fault
+	tokens int
+}
+
+// NewHandler returns a Handler serving fx
+func NewHandler(fx *Fixtures) *Handler {
+	h := &Handler{
+		mux:    http.NewServeMux(),
+		fx:     fx,
+		faults: make(map[string]Fault),
+	}
+	h.mux.HandleFunc(RouteYakeenCitizen, h.withFault(RouteYakeenCitizen, h.citizen))
+	h.mux.HandleFunc(RouteYakeenExpat, h.withFault(RouteYakeenExpat, h.expat))
+	h.mux.HandleFunc(RouteNicPersonInfo, h.withFault(RouteNicPersonInfo, h.person))
+	h.mux.HandleFunc(RouteNicContactsInfo, h.withFault(RouteNicContactsInfo, h.person))
+	h.mux.HandleFunc(RouteScfhsProfile+"/", h.withFault(RouteScfhsProfile, h.practitioner))
+	h.mux.HandleFunc(RouteOauthToken, h.withFault(RouteOauthToken, h.token))
+	h.mux.HandleFunc(RouteGatewayBorderNumber, h.withFault(RouteGatewayBorderNumber, h.visitor("border_number")))
+	h.mux.HandleFunc(RouteGatewayVisa, h.withFault(RouteGatewayVisa, h.visitor("visa")))
+	h.mux.HandleFunc(RouteGatewayGCCNational, h.withFault(RouteGatewayGCCNational, h.visitor("gcc_id")))
+	h.mux.HandleFunc(RouteGatewayNewborn, h.withFault(RouteGatewayNewborn, h.visitor("newborn")))
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// SetFault makes every request on route fail with f, the zero Fault clears it
+func (h *Handler) SetFault(route string, f Fault) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if f.isZero() {
+		delete(h.faults, route)
+		return
+	}
+	h.faults[route] = f
+}
+
+// SetFixtures replaces the data served
+func (h *Handler) SetFixtures(fx *Fixtures) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fx = fx
+}
+
+// Server is a running fake gateway, use URL as the gateway url
+type Server struct {
+	*stdhttptest.Server
+	*Handler
+}
+
+// NewServer starts a Server serving fx, the caller should call Close when done
+func NewServer(fx *Fixtures) *Server {
+	h := NewHandler(fx)
+	return &Server{
+		Server:  stdhttptest.NewServer(h),
+		Handler: h,
+	}
+}
+
+func (h *Handler) withFault(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		f, ok := h.faults[route]
+		h.mu.RUnlock()
+		if ok && h.fail(w, r, f) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// fail waits the fault delay then writes the fault, it returns false if
+// the fault is only a delay and the request should be served
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, f Fault) bool {
+	if f.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(f.Delay)):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+
+	switch {
+	case f.Status != 0:
+		writeJSON(w, f.Status, map[string]string{"error": http.StatusText(f.Status)})
+	case f.Code == FaultBadDOB:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorCode": FaultBadDOB, "errorMessage": "birth date doesn't match the id"})
+	case f.Code == FaultBadID:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorCode": FaultBadID, "errorMessage": "id not found"})
+	default:
+		return false
+	}
+	return true
+}
+
+func (h *Handler) citizen(w http.ResponseWriter, r *http.Request) {
+	q := params(r)
+
+	var c *Citizen
+	h.mu.RLock()
+	for i := range h.fx.Citizens {
+		if h.fx.Citizens[i].NationalID == q.Get("id") {
+			cp := h.fx.Citizens[i]
+			c = &cp
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if c == nil {
+		h.fail(w, r, Fault{Code: FaultBadID})
+		return
+	}
+	if h.fail(w, r, c.Fault) {
+		return
+	}
+	if c.BirthDate != q.Get("birth_date") {
+		h.fail(w, r, Fault{Code: FaultBadDOB})
+		return
+	}
+
+	var ctzn yakeen.Citizen
+	res := &ctzn.GetCitizenInfoResponse.CitizenInfoResult
+	res.NationalID = c.NationalID
+	res.BirthDate = c.BirthDate
+	res.IDIssuePlace = c.IDIssuePlace
+	res.IDIssueDate = c.IDIssueDate
+	res.IDExpiryDate = c.IDExpiryDate
+	res.FirstName = c.FirstName
+	res.FatherName = c.FatherName
+	res.GrandFatherName = c.GrandFatherName
+	res.SubtribeName = c.SubtribeName
+	res.FamilyName = c.FamilyName
+	res.EnglishFirstName = c.EnglishFirstName
+	res.EnglishSecondName = c.EnglishSecondName
+	res.EnglishThirdName = c.EnglishThirdName
+	res.EnglishLastName = c.EnglishLastName
+	res.Gender = c.Gender
+	res.PlaceOfBirth = c.PlaceOfBirth
+	writeJSON(w, http.StatusOK, ctzn)
+}
+
+func (h *Handler) expat(w http.ResponseWriter, r *http.Request) {
+	q := params(r)
+
+	var e *Expat
+	h.mu.RLock()
+	for i := range h.fx.Expats {
+		if h.fx.Expats[i].IqamaID == q.Get("id") {
+			cp := h.fx.Expats[i]
+			e = &cp
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if e == nil {
+		h.fail(w, r, Fault{Code: FaultBadID})
+		return
+	}
+	if h.fail(w, r, e.Fault) {
+		return
+	}
+	if e.BirthDate != q.Get("birth_date") {
+		h.fail(w, r, Fault{Code: FaultBadDOB})
+		return
+	}
+
+	var exp yakeen.Expat
+	res := &exp.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult
+	res.IqamaID = e.IqamaID
+	res.BirthDate = e.BirthDate
+	res.IqamaIssuePlaceDesc = e.IssuePlace
+	res.IqamaIssueDateH = e.IssueDateH
+	res.IqamaExpiryDateH = e.ExpiryDateH
+	res.NationalityDesc = e.Nationality
+	res.OccupationDesc = e.Occupation
+	res.Gender = e.Gender
+	res.FirstName = e.FirstName
+	res.SecondName = e.SecondName
+	res.ThirdName = e.ThirdName
+	res.LastName = e.LastName
+	res.EnglishFirstName = e.EnglishFirstName
+	res.EnglishSecondName = e.EnglishSecondName
+	res.EnglishThirdName = e.EnglishThirdName
+	res.EnglishLastName = e.EnglishLastName
+	writeJSON(w, http.StatusOK, exp)
+}
+
+// person serves both NIC person info and contacts info,
+// nic merges the two so each gets the whole record
+func (h *Handler) person(w http.ResponseWriter, r *http.Request) {
+	q := params(r)
+
+	var p *Person
+	h.mu.RLock()
+	for i := range h.fx.Persons {
+		if h.fx.Persons[i].ID == q.Get("id") {
+			cp := h.fx.Persons[i]
+			p = &cp
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if p == nil {
+		h.fail(w, r, Fault{Code: FaultBadID})
+		return
+	}
+	if h.fail(w, r, p.Fault) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, nic.PersonInfo{
+		ID:                p.ID,
+		BirthDateG:        p.BirthDateG,
+		Gender:            p.Gender,
+		MobileNumber:      p.MobileNumber,
+		NationalityCode:   p.NationalityCode,
+		NationalityDescAr: p.NationalityDescAr,
+		OccupationCode:    p.OccupationCode,
+		OccupationDescAr:  p.OccupationDescAr,
+		FirstNameAr:       p.FirstNameAr,
+		SecondNameAr:      p.SecondNameAr,
+		ThirdNameAr:       p.ThirdNameAr,
+		LastNameAr:        p.LastNameAr,
+		FirstNameEn:       p.FirstNameEn,
+		SecondNameEn:      p.SecondNameEn,
+		ThirdNameEn:       p.ThirdNameEn,
+		LastNameEn:        p.LastNameEn,
+	})
+}
+
+// practitioner serves /scfhs/practitioner/{id}
+func (h *Handler) practitioner(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, RouteScfhsProfile+"/")
+
+	var p *Practitioner
+	h.mu.RLock()
+	for i := range h.fx.Practitioners {
+		if h.fx.Practitioners[i].ID == id {
+			cp := h.fx.Practitioners[i]
+			p = &cp
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if p == nil {
+		h.fail(w, r, Fault{Status: http.StatusNotFound})
+		return
+	}
+	if h.fail(w, r, p.Fault) {
+		return
+	}
+
+	var pract scfhs.Practitioner
+	info := &pract.Response.Info
+	info.Profile.RegistrationNumber = p.RegistrationNumber
+	info.Profile.Ar.FirstName = p.FirstNameAr
+	info.Profile.Ar.SecondName = p.SecondNameAr
+	info.Profile.Ar.LastName = p.LastNameAr
+	info.Profile.En.FirstName = p.FirstNameEn
+	info.Profile.En.SecondName = p.SecondNameEn
+	info.Profile.En.LastName = p.LastNameEn
+	info.Profile.Gender.Code = p.GenderCode
+	info.Profile.Gender.NameAr = p.GenderAr
+	info.Profile.Gender.NameEn = p.GenderEn
+	info.Professionality.Category.Code = p.CategoryCode
+	info.Professionality.Category.NameAr = p.CategoryAr
+	info.Professionality.Category.NameEn = p.CategoryEn
+	info.Professionality.Specialty.Code = p.SpecialtyCode
+	info.Professionality.Specialty.NameAr = p.SpecialtyAr
+	info.Professionality.Specialty.NameEn = p.SpecialtyEn
+	info.Status.Code = p.StatusCode
+	info.Status.DescAr = p.StatusDescAr
+	info.Status.License.IssuedDate = p.LicenseIssuedDate
+	info.Status.License.ExpiryDate = p.LicenseExpiryDate
+	writeJSON(w, http.StatusOK, pract)
+}
+
+// visitor serves the gateway lookups of idType
+func (h *Handler) visitor(idType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := params(r)
+
+		var v *Visitor
+		h.mu.RLock()
+		for i := range h.fx.Visitors {
+			if h.fx.Visitors[i].IDType == idType && visitorMatches(&h.fx.Visitors[i], q) {
+				cp := h.fx.Visitors[i]
+				v = &cp
+				break
+			}
+		}
+		h.mu.RUnlock()
+
+		if v == nil {
+			h.fail(w, r, Fault{Code: FaultBadID})
+			return
+		}
+		if h.fail(w, r, v.Fault) {
+			return
+		}
+		if v.BirthDate != q.Get("birth_date") {
+			h.fail(w, r, Fault{Code: FaultBadDOB})
+			return
+		}
+		writeJSON(w, http.StatusOK, v.Person)
+	}
+}
+
+// visitorMatches tells if v is the one looked up by q, newborns are looked up by the guardian's id
+func visitorMatches(v *Visitor, q url.Values) bool {
+	switch v.IDType {
+	case "newborn":
+		order := v.BirthOrder
+		if order == 0 {
+			order = 1
+		}
+		return v.GuardianID == q.Get("id") && strconv.Itoa(order) == q.Get("birth_order")
+	case "gcc_id":
+		return v.ID == q.Get("id") && v.Country == q.Get("country")
+	}
+	return v.ID == q.Get("id")
+}
+
+// token issues a new access token on every call, like Apigee client credentials
+func (h *Handler) token(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.tokens++
+	n := h.tokens
+	h.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": fmt.Sprintf("fake-token-%d", n),
+		"token_type":   "BearerToken",
+		"expires_in":   "3599",
+		"issued_at":    strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+		"status":       "approved",
+	})
+}
+
+// params reads the query, and the form or json body for POST
+func params(r *http.Request) url.Values {
+	v := r.URL.Query()
+	if r.Method != http.MethodPost {
+		return v
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return v
+		}
+		for k, b := range body {
+			if s, ok := b.(string); ok {
+				v.Set(k, s)
+			}
+		}
+		return v
+	}
+
+	if err := r.ParseForm(); err == nil {
+		for k := range r.PostForm {
+			v.Set(k, r.PostForm.Get(k))
+		}
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("fakes:", err)
+	}
+}
@@ -0,0 +1,179 @@
+package httptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/gateway"
+)
+
+// Fixtures is the data served by the fakes, it's loaded from a json file
+// see testdata/fixtures.json
+type Fixtures struct {
+	Citizens      []Citizen      `json:"citizens"`
+	Expats        []Expat        `json:"expats"`
+	Persons       []Person       `json:"persons"`
+	Practitioners []Practitioner `json:"practitioners"`
+	Visitors      []Visitor      `json:"visitors"`
+}
+
+// Fault makes a route or a single record fail.
+// Code is one of the fault codes, Status an http status to reply with,
+// Delay how long to wait before replying e.g. "3s"
+type Fault struct {
+	Code   string   `json:"code,omitempty"`
+	Status int      `json:"status,omitempty"`
+	Delay  Duration `json:"delay,omitempty"`
+}
+
+// fault codes
+const (
+	// the birth date doesn't match the id
+	FaultBadDOB = "bad_dob"
+	// the id is not known by the upstream
+	FaultBadID = "bad_id"
+)
+
+func (f Fault) isZero() bool {
+	return f.Code == "" && f.Status == 0 && f.Delay == 0
+}
+
+// Duration is a time.Duration read from json as "1500ms", "2s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Citizen is served by Yakeen GetCitizenInfo, BirthDate is hijri dd-mm-yyyy
+type Citizen struct {
+	NationalID        string `json:"national_id"`
+	BirthDate         string `json:"birth_date"`
+	IDIssuePlace      string `json:"id_issue_place"`
+	IDIssueDate       string `json:"id_issue_date"`
+	IDExpiryDate      string `json:"id_expiry_date"`
+	FirstName         string `json:"first_name"`
+	FatherName        string `json:"father_name"`
+	GrandFatherName   string `json:"grand_father_name"`
+	SubtribeName      string `json:"subtribe_name"`
+	FamilyName        string `json:"family_name"`
+	EnglishFirstName  string `json:"english_first_name"`
+	EnglishSecondName string `json:"english_second_name"`
+	EnglishThirdName  string `json:"english_third_name"`
+	EnglishLastName   string `json:"english_last_name"`
+	Gender            string `json:"gender"`
+	PlaceOfBirth      string `json:"place_of_birth"`
+
+	Fault Fault `json:"fault"`
+}
+
+// Expat is served by Yakeen GetAlienInfoByIqama, BirthDate is gregorian dd-mm-yyyy
+type Expat struct {
+	IqamaID           string `json:"iqama_id"`
+	BirthDate         string `json:"birth_date"`
+	IssuePlace        string `json:"issue_place"`
+	IssueDateH        string `json:"issue_date_h"`
+	ExpiryDateH       string `json:"expiry_date_h"`
+	Nationality       string `json:"nationality"`
+	Occupation        string `json:"occupation"`
+	Gender            string `json:"gender"`
+	FirstName         string `json:"first_name"`
+	SecondName        string `json:"second_name"`
+	ThirdName         string `json:"third_name"`
+	LastName          string `json:"last_name"`
+	EnglishFirstName  string `json:"english_first_name"`
+	EnglishSecondName string `json:"english_second_name"`
+	EnglishThirdName  string `json:"english_third_name"`
+	EnglishLastName   string `json:"english_last_name"`
+
+	Fault Fault `json:"fault"`
+}
+
+// Person is served by NIC person info and contact info, BirthDateG is yyyy-mm-ddT00:00:00
+type Person struct {
+	ID                string `json:"id"`
+	BirthDateG        string `json:"birth_date_g"`
+	Gender            string `json:"gender"`
+	MobileNumber      string `json:"mobile_number"`
+	NationalityCode   string `json:"nationality_code"`
+	NationalityDescAr string `json:"nationality_desc_ar"`
+	OccupationCode    string `json:"occupation_code"`
+	OccupationDescAr  string `json:"occupation_desc_ar"`
+	FirstNameAr       string `json:"first_name_ar"`
+	SecondNameAr      string `json:"second_name_ar"`
+	ThirdNameAr       string `json:"third_name_ar"`
+	LastNameAr        string `json:"last_name_ar"`
+	FirstNameEn       string `json:"first_name_en"`
+	SecondNameEn      string `json:"second_name_en"`
+	ThirdNameEn       string `json:"third_name_en"`
+	LastNameEn        string `json:"last_name_en"`
+
+	Fault Fault `json:"fault"`
+}
+
+// Practitioner is served by SCFHS practitioner profile
+type Practitioner struct {
+	ID                 string `json:"id"`
+	RegistrationNumber string `json:"registration_number"`
+	FirstNameAr        string `json:"first_name_ar"`
+	SecondNameAr       string `json:"second_name_ar"`
+	LastNameAr         string `json:"last_name_ar"`
+	FirstNameEn        string `json:"first_name_en"`
+	SecondNameEn       string `json:"second_name_en"`
+	LastNameEn         string `json:"last_name_en"`
+	GenderCode         string `json:"gender_code"`
+	GenderAr           string `json:"gender_ar"`
+	GenderEn           string `json:"gender_en"`
+	CategoryCode       string `json:"category_code"`
+	CategoryAr         string `json:"category_ar"`
+	CategoryEn         string `json:"category_en"`
+	SpecialtyCode      string `json:"specialty_code"`
+	SpecialtyAr        string `json:"specialty_ar"`
+	SpecialtyEn        string `json:"specialty_en"`
+	StatusCode         string `json:"status_code"`
+	StatusDescAr       string `json:"status_desc_ar"`
+	LicenseIssuedDate  string `json:"license_issued_date"`
+	LicenseExpiryDate  string `json:"license_expiry_date"`
+
+	Fault Fault `json:"fault"`
+}
+
+// Visitor is served by the gateway lookups of border numbers, visit visas, gcc ids and newborns,
+// IDType is the id_type it's looked up by. newborns are looked up by GuardianID, BirthDate and BirthOrder
+type Visitor struct {
+	IDType  string `json:"id_type"`
+	Country string `json:"country,omitempty"`
+	gateway.Person
+
+	Fault Fault `json:"fault"`
+}
+
+// LoadFixtures reads the fixtures from the json file at path
+func LoadFixtures(path string) (*Fixtures, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fx := &Fixtures{}
+	if err := json.NewDecoder(f).Decode(fx); err != nil {
+		return nil, fmt.Errorf("fixtures %s: %w", path, err)
+	}
+	return fx, nil
+}
@@ -0,0 +1,489 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/gateway"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/nic"
+	"gitlab.lean/leandevclan/nhic/store"
+	"gitlab.lean/leandevclan/nhic/yakeen"
+)
+
+// names of the identity sources, used in the "identity" config
+const (
+	sourceYakeen  = "yakeen"
+	sourceNic     = "nic"
+	sourceGateway = "gateway"
+)
+
+var (
+	ErrUnknownIdentitySource = errors.New("unknown identity source")
+	// errNoIdentitySource is returned when no source of a chain is enabled and serves the kind
+	errNoIdentitySource = errors.New("no identity source is enabled")
+)
+
+// defaultChains are the lookup orders used when an endpoint has none in config.
+// the db is always looked up first by the controller, these are the upstreams after it
+var defaultChains = map[string][]string{
+	opGetPatient:         {sourceYakeen, sourceGateway},
+	opUpdatePatient:      {sourceYakeen, sourceGateway},
+	opGetFullPatientInfo: {sourceNic},
+}
+
+// Person is the normalized person record returned by an IdentitySource.
+// fields the source doesn't provide are left nil
+type Person struct {
+	IDType       *string
+	IDNumber     *string
+	IDIssuePlace *string
+	IDIssueDate  *store.Date
+	IDExpiryDate *store.Date
+
+	// in whichever calendar the source has it
+	BirthDate    *store.Date
+	PlaceOfBirth *string
+	Gender       *string
+
+	FirstNameAr  *string
+	SecondNameAr *string
+	ThirdNameAr  *string
+	LastNameAr   *string
+	SubtribeName *string
+
+	FirstNameEn  *string
+	SecondNameEn *string
+	ThirdNameEn  *string
+	LastNameEn   *string
+
+	Nationality     *string
+	NationalityCode *string
+	Occupation      *string
+	OccupationCode  *string
+	MobileNumber    *string
+
+	PassportNumber *string
+	BorderNumber   *string
+	VisaNumber     *string
+	IDCountry      *string
+	GuardianID     *string
+	BirthOrder     *string
+}
+
+// IdentitySource is an upstream that knows people by their id number
+// e.g. Yakeen, NIC
+//
+// Lookup returns ErrSearchInput when the upstream rejects the query itself (bad id, bad birth date),
+// in that case the controller doesn't fall back to the next source.
+// Serves tells which kinds the source can look up, the others skip it
+type IdentitySource interface {
+	Name() string
+	Serves(k PatientKind) bool
+	Lookup(ctx context.Context, pq *PatientQuery) (*Person, error)
+}
+
+// newChains builds the lookup order of each endpoint from config,
+// endpoints missing from conf use defaultChains
+func newChains(conf map[string][]string, sources ...IdentitySource) (map[string][]IdentitySource, error) {
+	byName := make(map[string]IdentitySource, len(sources))
+	for _, src := range sources {
+		byName[src.Name()] = src
+	}
+
+	order := make(map[string][]string, len(defaultChains))
+	for op, names := range defaultChains {
+		order[op] = names
+	}
+	for op, names := range conf {
+		order[op] = names
+	}
+
+	chains := make(map[string][]IdentitySource, len(order))
+	for op, names := range order {
+		for _, name := range names {
+			src, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%w %q in chain of %s", ErrUnknownIdentitySource, name, op)
+			}
+			chains[op] = append(chains[op], src)
+		}
+	}
+	return chains, nil
+}
+
+// lookup walks the identity sources of op in order and fills pnt from the first one that finds the person.
+// a source is skipped if it doesn't serve the kind or the "disable-<source>" feature is enabled.
+// it returns the name of the source that found it, or of the last one tried
+func (c *Controller) lookup(ctx context.Context, op string, pq *PatientQuery, pnt *store.Patient) (string, error) {
+	err := errNoIdentitySource
+	var name string
+	kind := pq.Kind()
+	for _, src := range c.chains[op] {
+		if !src.Serves(kind) || c.FeatureIsEnabled("disable-"+src.Name()) {
+			continue
+		}
+
+		name = src.Name()
+		var prsn *Person
+		prsn, err = src.Lookup(ctx, pq)
+		if err == nil {
+			personToPnt(prsn, pnt)
+			fillEnglishNames(prsn, pnt)
+			return name, nil
+		}
+		// the query is wrong or the caller is gone, the next source won't do better
+		if err == ErrSearchInput {
+			c.log.Info(ctx, "identity source rejected the query", logging.String("source", name))
+			return name, err
+		} else if ctxErr(ctx) != nil {
+			return name, err
+		}
+		c.log.Warn(ctx, "identity lookup failed, falling back", logging.String("source", name), logging.Err(err))
+	}
+	return name, err
+}
+
+// personToPnt copies the fields the source provided to pnt,
+// fields already in pnt e.g. from the db are kept if the source doesn't have them
+func personToPnt(prsn *Person, pnt *store.Patient) {
+	fields := []struct {
+		dst **string
+		src *string
+	}{
+		{&pnt.IDType, prsn.IDType},
+		{&pnt.IDNumber, prsn.IDNumber},
+		{&pnt.IDIssuePlace, prsn.IDIssuePlace},
+		{&pnt.PlaceOfBirth, prsn.PlaceOfBirth},
+		{&pnt.Gender, prsn.Gender},
+		{&pnt.FirstNameAr, prsn.FirstNameAr},
+		{&pnt.SecondNameAr, prsn.SecondNameAr},
+		{&pnt.ThirdNameAr, prsn.ThirdNameAr},
+		{&pnt.LastNameAr, prsn.LastNameAr},
+		{&pnt.SubtribeName, prsn.SubtribeName},
+		{&pnt.FirstNameEn, prsn.FirstNameEn},
+		{&pnt.SecondNameEn, prsn.SecondNameEn},
+		{&pnt.ThirdNameEn, prsn.ThirdNameEn},
+		{&pnt.LastNameEn, prsn.LastNameEn},
+		{&pnt.Nationality, prsn.Nationality},
+		{&pnt.NationalityCode, prsn.NationalityCode},
+		{&pnt.Occupation, prsn.Occupation},
+		{&pnt.OccupationCode, prsn.OccupationCode},
+		{&pnt.MobileNumber, prsn.MobileNumber},
+		{&pnt.PassportNumber, prsn.PassportNumber},
+		{&pnt.BorderNumber, prsn.BorderNumber},
+		{&pnt.VisaNumber, prsn.VisaNumber},
+		{&pnt.IDCountry, prsn.IDCountry},
+		{&pnt.GuardianID, prsn.GuardianID},
+		{&pnt.BirthOrder, prsn.BirthOrder},
+	}
+	for _, f := range fields {
+		if f.src != nil {
+			*f.dst = f.src
+		}
+	}
+	if prsn.IDIssueDate != nil {
+		pnt.IDIssueDate = prsn.IDIssueDate
+	}
+	if prsn.IDExpiryDate != nil {
+		pnt.IDExpiryDate = prsn.IDExpiryDate
+	}
+
+	// the birth date goes to the field of its calendar,
+	// the other one is left for fillBirthDates to convert
+	if b := prsn.BirthDate; b != nil {
+		switch b.Calendar {
+		case store.Hijri:
+			pnt.DateOfBirthH, pnt.DateOfBirthG = b, nil
+		case store.Gregorian:
+			pnt.DateOfBirthG, pnt.DateOfBirthH = b, nil
+		}
+	}
+
+	// add the patient's birth dates from SQL Server when the source doesn't return them
+	if pnt.DateOfBirthG == nil {
+		pnt.DateOfBirthG = pnt.DateG
+	}
+	if pnt.DateOfBirthH == nil {
+		pnt.DateOfBirthH = pnt.DateH
+	}
+}
+
+// yakeenSource looks people up in Yakeen, it needs the birth date
+// hijri for citizens, gregorian for expats
+type yakeenSource struct {
+	yakeen *yakeen.Yakeen
+	log    *logging.Logger
+}
+
+func (y *yakeenSource) Name() string {
+	return sourceYakeen
+}
+
+func (y *yakeenSource) Serves(k PatientKind) bool {
+	return k == KindCitizen || k == KindExpat
+}
+
+func (y *yakeenSource) Lookup(ctx context.Context, pq *PatientQuery) (*Person, error) {
+	switch pq.Kind() {
+	case KindCitizen:
+		ctzn, err := y.yakeen.GetCitizen(ctx, pq.ID, pq.BirthDate)
+		if err == yakeen.ErrBadDOB || err == yakeen.ErrBadID {
+			return nil, ErrSearchInput
+		} else if err != nil {
+			return nil, err
+		}
+		return ctznToPerson(ctx, y.log, ctzn)
+	case KindExpat:
+		exp, err := y.yakeen.GetExpat(ctx, pq.ID, pq.BirthDate)
+		if err == yakeen.ErrBadDOB || err == yakeen.ErrBadID {
+			return nil, ErrSearchInput
+		} else if err != nil {
+			return nil, err
+		}
+		return expatToPerson(ctx, y.log, exp)
+	}
+	return nil, ErrUnknownPatientType
+}
+
+// upstreamDate is a date field returned by an upstream and the Person field it's parsed into,
+// a malformed required date fails the lookup
+type upstreamDate struct {
+	name     string
+	value    string
+	dst      **store.Date
+	required bool
+}
+
+// parseDates parses the dates returned by the source src, empty ones are left nil.
+// only the birth date is required, the other malformed dates are logged and dropped
+func parseDates(ctx context.Context, log *logging.Logger, src string, dates ...upstreamDate) error {
+	for _, d := range dates {
+		v, err := store.ParseDatePtr(&d.value)
+		if err != nil && d.required {
+			return fmt.Errorf("%s %s: %w", src, d.name, err)
+		} else if err != nil {
+			log.Warn(ctx, "dropped malformed upstream date", logging.String("source", src),
+				logging.String("field", d.name), logging.Err(err))
+		}
+		*d.dst = v
+	}
+	return nil
+}
+
+func ctznToPerson(ctx context.Context, log *logging.Logger, ctzn *yakeen.Citizen) (*Person, error) {
+	info := &ctzn.GetCitizenInfoResponse.CitizenInfoResult
+	prsn := &Person{
+		IDType:       kindIDType(KindCitizen),
+		IDNumber:     &info.NationalID,
+		IDIssuePlace: &info.IDIssuePlace,
+
+		FirstNameEn:  &info.EnglishFirstName,
+		SecondNameEn: &info.EnglishSecondName,
+		ThirdNameEn:  &info.EnglishThirdName,
+		LastNameEn:   &info.EnglishLastName,
+
+		FirstNameAr:  &info.FirstName,
+		SecondNameAr: &info.FatherName,
+		ThirdNameAr:  &info.GrandFatherName,
+		SubtribeName: &info.SubtribeName,
+		LastNameAr:   &info.FamilyName,
+
+		Gender:       &info.Gender,
+		PlaceOfBirth: &info.PlaceOfBirth,
+	}
+	err := parseDates(ctx, log, sourceYakeen,
+		upstreamDate{"id_issue_date", info.IDIssueDate, &prsn.IDIssueDate, false},
+		upstreamDate{"id_expiry_date", info.IDExpiryDate, &prsn.IDExpiryDate, false},
+		upstreamDate{"birth_date", info.BirthDate, &prsn.BirthDate, true},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return prsn, nil
+}
+
+func expatToPerson(ctx context.Context, log *logging.Logger, expt *yakeen.Expat) (*Person, error) {
+	info := &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult
+	prsn := &Person{
+		IDType:       kindIDType(KindExpat),
+		IDNumber:     &info.IqamaID,
+		IDIssuePlace: &info.IqamaIssuePlaceDesc,
+
+		Nationality: &info.NationalityDesc,
+		Occupation:  &info.OccupationDesc,
+		Gender:      &info.Gender,
+
+		FirstNameEn:  &info.EnglishFirstName,
+		SecondNameEn: &info.EnglishSecondName,
+		ThirdNameEn:  &info.EnglishThirdName,
+		LastNameEn:   &info.EnglishLastName,
+
+		FirstNameAr:  &info.FirstName,
+		SecondNameAr: &info.SecondName,
+		ThirdNameAr:  &info.ThirdName,
+		LastNameAr:   &info.LastName,
+	}
+	err := parseDates(ctx, log, sourceYakeen,
+		upstreamDate{"iqama_issue_date", info.IqamaIssueDateH, &prsn.IDIssueDate, false},
+		upstreamDate{"iqama_expiry_date", info.IqamaExpiryDateH, &prsn.IDExpiryDate, false},
+		upstreamDate{"birth_date", info.BirthDate, &prsn.BirthDate, true},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return prsn, nil
+}
+
+// nicSource looks people up in NIC, only the id is needed
+type nicSource struct {
+	nic *nic.Nic
+	log *logging.Logger
+}
+
+func (n *nicSource) Name() string {
+	return sourceNic
+}
+
+func (n *nicSource) Serves(k PatientKind) bool {
+	return k == KindCitizen || k == KindExpat
+}
+
+func (n *nicSource) Lookup(ctx context.Context, pq *PatientQuery) (*Person, error) {
+	p, err := n.nic.GetPatient(ctx, pq.ID)
+	if err == nic.ErrValidation {
+		return nil, ErrSearchInput
+	} else if err != nil {
+		return nil, err
+	}
+
+	prsn := &Person{
+		IDNumber:     &p.ID,
+		Gender:       &p.Gender,
+		MobileNumber: &p.MobileNumber,
+
+		NationalityCode: &p.NationalityCode,
+		Nationality:     &p.NationalityDescAr,
+
+		OccupationCode: &p.OccupationCode,
+		Occupation:     &p.OccupationDescAr,
+
+		FirstNameEn:  &p.FirstNameEn,
+		SecondNameEn: &p.SecondNameEn,
+		ThirdNameEn:  &p.ThirdNameEn,
+		LastNameEn:   &p.LastNameEn,
+
+		FirstNameAr:  &p.FirstNameAr,
+		SecondNameAr: &p.SecondNameAr,
+		ThirdNameAr:  &p.ThirdNameAr,
+		LastNameAr:   &p.LastNameAr,
+	}
+
+	// nic returns the birth date as 1963-07-21T00:00:00
+	if err := parseDates(ctx, n.log, sourceNic, upstreamDate{"birth_date_g", p.BirthDateG, &prsn.BirthDate, true}); err != nil {
+		return nil, err
+	}
+
+	prsn.IDType = kindIDType(pq.Kind())
+	return prsn, nil
+}
+
+// gatewaySource looks up the kinds yakeen and nic don't know:
+// border numbers, visit visas, gcc nationals and newborns.
+// a kind is only served once its lookup has a path in config
+type gatewaySource struct {
+	gateway *gateway.Gateway
+	log     *logging.Logger
+}
+
+// gatewayLookups is the gateway lookup of each kind
+var gatewayLookups = map[PatientKind]gateway.Lookup{
+	KindBorder:  gateway.LookupBorderNumber,
+	KindVisitor: gateway.LookupVisa,
+	KindGCC:     gateway.LookupGCCNational,
+	KindNewborn: gateway.LookupNewborn,
+}
+
+func (g *gatewaySource) Name() string {
+	return sourceGateway
+}
+
+func (g *gatewaySource) Serves(k PatientKind) bool {
+	l, ok := gatewayLookups[k]
+	return ok && g.gateway.Serves(l)
+}
+
+func (g *gatewaySource) Lookup(ctx context.Context, pq *PatientQuery) (*Person, error) {
+	var p *gateway.Person
+	var err error
+	switch pq.Kind() {
+	case KindBorder:
+		p, err = g.gateway.GetBorderNumber(ctx, pq.ID, pq.BirthDate)
+	case KindVisitor:
+		p, err = g.gateway.GetVisitor(ctx, pq.ID, pq.BirthDate)
+	case KindGCC:
+		p, err = g.gateway.GetGCCNational(ctx, strings.ToUpper(pq.Country), pq.ID, pq.BirthDate)
+	case KindNewborn:
+		order, oerr := pq.birthOrder()
+		if oerr != nil {
+			return nil, ErrSearchInput
+		}
+		p, err = g.gateway.GetNewborn(ctx, pq.ID, pq.BirthDate, order)
+	default:
+		return nil, ErrUnknownPatientType
+	}
+	if err == gateway.ErrBadDOB || err == gateway.ErrBadID {
+		return nil, ErrSearchInput
+	} else if err != nil {
+		return nil, err
+	}
+
+	id := pq.recordID()
+	prsn := &Person{
+		IDType:          kindIDType(pq.Kind()),
+		IDNumber:        &id,
+		Gender:          &p.Gender,
+		Nationality:     &p.Nationality,
+		NationalityCode: &p.NationalityCode,
+
+		FirstNameAr:  &p.FirstNameAr,
+		SecondNameAr: &p.SecondNameAr,
+		ThirdNameAr:  &p.ThirdNameAr,
+		LastNameAr:   &p.LastNameAr,
+
+		FirstNameEn:  &p.FirstNameEn,
+		SecondNameEn: &p.SecondNameEn,
+		ThirdNameEn:  &p.ThirdNameEn,
+		LastNameEn:   &p.LastNameEn,
+
+		PassportNumber: nonEmpty(p.PassportNumber),
+		BorderNumber:   nonEmpty(p.BorderNumber),
+		VisaNumber:     nonEmpty(p.VisaNumber),
+	}
+	switch pq.Kind() {
+	case KindGCC:
+		country := strings.ToUpper(pq.Country)
+		prsn.IDCountry = &country
+	case KindNewborn:
+		prsn.GuardianID = &pq.ID
+		order, _ := pq.birthOrder()
+		o := strconv.Itoa(order)
+		prsn.BirthOrder = &o
+	}
+
+	if err := parseDates(ctx, g.log, sourceGateway, upstreamDate{"birth_date", p.BirthDate, &prsn.BirthDate, true}); err != nil {
+		return nil, err
+	}
+	return prsn, nil
+}
+
+// nonEmpty returns nil for empty strings, for the optional upstream fields
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
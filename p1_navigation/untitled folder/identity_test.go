@@ -0,0 +1,48 @@
+package nhic
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/yakeen"
+)
+
+func TestCitizenDates(t *testing.T) {
+	tests := []struct {
+		birth, issue string
+		err          bool
+		issued       string
+	}{
+		{"15-07-1405", "01-01-1440", false, "01-01-1440"},
+		{"12-03-1340", "01-01-1440", false, "01-01-1440"},
+		{"15-07-1405", "31-13-1440", false, ""},
+		{"31-13-1405", "01-01-1440", true, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		ctzn := &yakeen.Citizen{}
+		info := &ctzn.GetCitizenInfoResponse.CitizenInfoResult
+		info.NationalID, info.BirthDate, info.IDIssueDate = "1012345672", tt.birth, tt.issue
+
+		prsn, err := ctznToPerson(context.Background(), logging.New(&buf, logging.Info), ctzn)
+		if (err != nil) != tt.err {
+			t.Fatalf("%s %s: %v", tt.birth, tt.issue, err)
+		}
+		if err != nil {
+			continue
+		}
+		issued := ""
+		if prsn.IDIssueDate != nil {
+			issued = prsn.IDIssueDate.String()
+		}
+		if prsn.BirthDate.String() != tt.birth || issued != tt.issued {
+			t.Errorf("%s %s: got %v %s", tt.birth, tt.issue, prsn.BirthDate, issued)
+		}
+		if dropped := strings.Contains(buf.String(), "id_issue_date"); dropped != (tt.issued == "") {
+			t.Errorf("%s %s: logged %q", tt.birth, tt.issue, buf.String())
+		}
+	}
+}
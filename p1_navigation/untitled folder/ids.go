@@ -0,0 +1,196 @@
+package nhic
+
+import (
+	"errors"
+	"strings"
+)
+
+// IDType is the family of the identifier in PatientQuery,
+// sent as id_type. national ids and iqamas are told by their first digit and don't need it
+type IDType string
+
+const (
+	IDTypeNationalID   IDType = "national_id"
+	IDTypeIqama        IDType = "iqama"
+	IDTypeBorderNumber IDType = "border_number"
+	IDTypeGCCID        IDType = "gcc_id"
+	IDTypeVisa         IDType = "visa"
+	IDTypePassport     IDType = "passport"
+	// the id is the guardian's national id or iqama
+	IDTypeNewborn IDType = "newborn"
+)
+
+var (
+	ErrUnknownIDType        = errors.New("id_type is unknown")
+	ErrNationalIDChecksum   = errors.New("national_id check digit doesn't match")
+	ErrIqamaIDChecksum      = errors.New("iqama_id check digit doesn't match")
+	ErrBadBorderNumber      = errors.New("malformed border_number")
+	ErrBadGCCID             = errors.New("malformed gcc_id")
+	ErrGCCIDChecksum        = errors.New("gcc_id check digit doesn't match")
+	ErrUnknownGCCCountry    = errors.New("country is not a gcc member")
+	ErrBadVisaNumber        = errors.New("malformed visa_number")
+	ErrBadPassportNumber    = errors.New("malformed passport_number")
+	ErrMissingPassportState = errors.New("passport needs the issuing country")
+)
+
+const (
+	borderPrefixes = "34"
+	// visit visas are issued by MOFA with 10 digits
+	visaLength = 10
+	// ICAO 9303 document numbers are up to 9 characters
+	passportMinLength = 6
+	passportMaxLength = 9
+)
+
+// gccID is how the ids of a gcc member are written.
+// the check digit is verified only for the members that publish how it's computed
+type gccID struct {
+	minLen   int
+	maxLen   int
+	prefix   string
+	checksum func(id string) bool
+}
+
+// gcc members by ISO 3166 alpha-3 code, saudis use their national id
+var gccIDs = map[string]gccID{
+	// emirates id 784-yyyy-nnnnnnn-c
+	"ARE": {minLen: 15, maxLen: 15, prefix: "784", checksum: luhn},
+	// civil id cyymmddnnnnc
+	"KWT": {minLen: 12, maxLen: 12, checksum: kuwaitChecksum},
+	// cpr yymmnnnnc
+	"BHR": {minLen: 9, maxLen: 9},
+	// qid cyynnnnnnnn
+	"QAT": {minLen: 11, maxLen: 11},
+	"OMN": {minLen: 5, maxLen: 9},
+}
+
+// idType returns the family of the id, id_type if sent or the one told by the first digit
+func (pq *PatientQuery) idType() (IDType, error) {
+	if pq.IDType != "" {
+		switch t := IDType(pq.IDType); t {
+		case IDTypeNationalID, IDTypeIqama, IDTypeBorderNumber, IDTypeGCCID, IDTypeVisa, IDTypePassport, IDTypeNewborn:
+			return t, nil
+		}
+		return "", ErrUnknownIDType
+	}
+
+	switch {
+	case strings.HasPrefix(pq.ID, citizenPrefix):
+		return IDTypeNationalID, nil
+	case strings.HasPrefix(pq.ID, expatPrefix):
+		return IDTypeIqama, nil
+	case pq.ID != "" && strings.ContainsAny(pq.ID[:1], borderPrefixes):
+		return IDTypeBorderNumber, nil
+	}
+	return "", ErrUnknownPatientType
+}
+
+// validateID checks the id against the rules of its family
+func validateID(t IDType, id, country string) error {
+	switch t {
+	case IDTypeNationalID:
+		return validateSaudiID(id, citizenPrefix, ErrBadNationalID, ErrNationalIDChecksum)
+	case IDTypeIqama:
+		return validateSaudiID(id, expatPrefix, ErrBadIqamaID, ErrIqamaIDChecksum)
+	case IDTypeBorderNumber:
+		// border numbers have no check digit
+		if len(id) != 10 || !isDigits(id) || !strings.ContainsAny(id[:1], borderPrefixes) {
+			return ErrBadBorderNumber
+		}
+	case IDTypeGCCID:
+		rule, ok := gccIDs[strings.ToUpper(country)]
+		if !ok {
+			return ErrUnknownGCCCountry
+		}
+		if len(id) < rule.minLen || len(id) > rule.maxLen || !isDigits(id) || !strings.HasPrefix(id, rule.prefix) {
+			return ErrBadGCCID
+		}
+		if rule.checksum != nil && !rule.checksum(id) {
+			return ErrGCCIDChecksum
+		}
+	case IDTypeVisa:
+		if len(id) != visaLength || !isDigits(id) {
+			return ErrBadVisaNumber
+		}
+	case IDTypePassport:
+		if len(country) != 3 {
+			return ErrMissingPassportState
+		}
+		if len(id) < passportMinLength || len(id) > passportMaxLength || !isPassportNumber(id) {
+			return ErrBadPassportNumber
+		}
+	case IDTypeNewborn:
+		if strings.HasPrefix(id, expatPrefix) {
+			return validateSaudiID(id, expatPrefix, ErrBadIqamaID, ErrIqamaIDChecksum)
+		}
+		return validateSaudiID(id, citizenPrefix, ErrBadNationalID, ErrNationalIDChecksum)
+	default:
+		return ErrUnknownIDType
+	}
+	return nil
+}
+
+// validateSaudiID checks national ids and iqamas, 10 digits starting with prefix
+// and a luhn check digit
+func validateSaudiID(id, prefix string, errBad, errChecksum error) error {
+	if len(id) != 10 || !isDigits(id) || !strings.HasPrefix(id, prefix) {
+		return errBad
+	}
+	if !luhn(id) {
+		return errChecksum
+	}
+	return nil
+}
+
+// luhn checks the last digit of id, id must be digits only
+func luhn(id string) bool {
+	sum := 0
+	double := false
+	for i := len(id) - 1; i >= 0; i-- {
+		d := int(id[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// kuwaitChecksum checks the last digit of a kuwaiti civil id, weighted mod 11
+func kuwaitChecksum(id string) bool {
+	weights := [...]int{2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(id[i]-'0') * w
+	}
+	check := 11 - sum%11
+	return check < 10 && check == int(id[11]-'0')
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isPassportNumber tells if s is upper case letters and digits with at least one digit
+func isPassportNumber(s string) bool {
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r >= 'A' && r <= 'Z':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
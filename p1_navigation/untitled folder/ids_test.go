@@ -0,0 +1,110 @@
+package nhic
+
+import "testing"
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"1012345672", true},
+		{"1012345673", false},
+		{"2034567897", true},
+		{"2034567898", false},
+		{"784198012345678", true},
+		{"784198012345671", false},
+		{"0000000000", true},
+	}
+	for _, tt := range tests {
+		if got := luhn(tt.id); got != tt.want {
+			t.Errorf("luhn(%s) = %v", tt.id, got)
+		}
+	}
+}
+
+func TestKuwaitChecksum(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"287010112349", true},
+		{"287010112345", false},
+		{"299051501234", true},
+		{"299051501230", false},
+	}
+	for _, tt := range tests {
+		if got := kuwaitChecksum(tt.id); got != tt.want {
+			t.Errorf("kuwaitChecksum(%s) = %v", tt.id, got)
+		}
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	tests := []struct {
+		t       IDType
+		id      string
+		country string
+		want    error
+	}{
+		{IDTypeNationalID, "1012345672", "", nil},
+		{IDTypeNationalID, "1012345673", "", ErrNationalIDChecksum},
+		{IDTypeNationalID, "101234567", "", ErrBadNationalID},
+		{IDTypeNationalID, "2034567897", "", ErrBadNationalID},
+		{IDTypeNationalID, "10123456a2", "", ErrBadNationalID},
+		{IDTypeIqama, "2034567897", "", nil},
+		{IDTypeIqama, "2034567898", "", ErrIqamaIDChecksum},
+		{IDTypeIqama, "1012345672", "", ErrBadIqamaID},
+		{IDTypeBorderNumber, "3012345678", "", nil},
+		{IDTypeBorderNumber, "4012345678", "", nil},
+		{IDTypeBorderNumber, "5012345678", "", ErrBadBorderNumber},
+		{IDTypeBorderNumber, "301234567", "", ErrBadBorderNumber},
+		{IDTypeGCCID, "784198012345678", "ARE", nil},
+		{IDTypeGCCID, "784198012345678", "are", nil},
+		{IDTypeGCCID, "784198012345671", "ARE", ErrGCCIDChecksum},
+		{IDTypeGCCID, "78419801234567", "ARE", ErrBadGCCID},
+		{IDTypeGCCID, "123198012345678", "ARE", ErrBadGCCID},
+		{IDTypeGCCID, "287010112349", "KWT", nil},
+		{IDTypeGCCID, "287010112345", "KWT", ErrGCCIDChecksum},
+		{IDTypeGCCID, "870112345", "BHR", nil},
+		{IDTypeGCCID, "28701011234", "QAT", nil},
+		{IDTypeGCCID, "1234", "OMN", ErrBadGCCID},
+		{IDTypeGCCID, "784198012345678", "FRA", ErrUnknownGCCCountry},
+		{IDTypeVisa, "6000000000", "", nil},
+		{IDTypeVisa, "600000000", "", ErrBadVisaNumber},
+		{IDTypePassport, "A1234567", "EGY", nil},
+		{IDTypePassport, "A1234567", "", ErrMissingPassportState},
+		{IDTypePassport, "a1234567", "EGY", ErrBadPassportNumber},
+		{IDTypePassport, "ABCDEFG", "EGY", ErrBadPassportNumber},
+		{IDTypePassport, "A123", "EGY", ErrBadPassportNumber},
+		{IDTypeNewborn, "1012345672", "", nil},
+		{IDTypeNewborn, "2034567898", "", ErrIqamaIDChecksum},
+		{"foo", "1", "", ErrUnknownIDType},
+	}
+	for _, tt := range tests {
+		if err := validateID(tt.t, tt.id, tt.country); err != tt.want {
+			t.Errorf("%s %s %s: got %v, want %v", tt.t, tt.id, tt.country, err, tt.want)
+		}
+	}
+}
+
+func TestIDType(t *testing.T) {
+	tests := []struct {
+		pq   PatientQuery
+		want IDType
+		err  error
+	}{
+		{PatientQuery{ID: "1012345672"}, IDTypeNationalID, nil},
+		{PatientQuery{ID: "2034567897"}, IDTypeIqama, nil},
+		{PatientQuery{ID: "3012345678"}, IDTypeBorderNumber, nil},
+		{PatientQuery{ID: "784198012345678", IDType: "gcc_id"}, IDTypeGCCID, nil},
+		{PatientQuery{ID: "1", IDType: "foo"}, "", ErrUnknownIDType},
+		{PatientQuery{ID: "abc"}, "", ErrUnknownPatientType},
+		{PatientQuery{}, "", ErrUnknownPatientType},
+	}
+	for _, tt := range tests {
+		got, err := tt.pq.idType()
+		if got != tt.want || err != tt.err {
+			t.Errorf("%+v: got %s %v", tt.pq, got, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package nhic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+const (
+	// newborns get a national id or are added to the guardian's iqama within months,
+	// older children without an id aren't looked up as newborns
+	newbornMaxAge = 365 * 24 * time.Hour
+	maxBirthOrder = 9
+)
+
+var (
+	ErrNotNewborn    = errors.New("birth_date is too old for a newborn")
+	ErrBadBirthOrder = errors.New("malformed birth_order")
+)
+
+// kindSpec is what differs between the patient kinds
+type kindSpec struct {
+	// written to store.Patient and the Compat responses
+	idType string
+	// calendar of the birth date the upstreams expect
+	calendar store.Calendar
+}
+
+var kindSpecs = map[PatientKind]kindSpec{
+	KindCitizen: {idType: "NationalId", calendar: store.Hijri},
+	KindExpat:   {idType: "Iqama", calendar: store.Gregorian},
+	KindBorder:  {idType: "BorderNumber", calendar: store.Gregorian},
+	KindVisitor: {idType: "VisitVisa", calendar: store.Gregorian},
+	KindGCC:     {idType: "GCCID", calendar: store.Gregorian},
+	KindNewborn: {idType: "Newborn", calendar: store.Gregorian},
+}
+
+// kindIDType is the IDType of the kind, nil for KindUnknown
+func kindIDType(k PatientKind) *string {
+	spec, ok := kindSpecs[k]
+	if !ok {
+		return nil
+	}
+	ty := spec.idType
+	return &ty
+}
+
+// birthOrder is the order of the newborn among twins, 1 if not sent
+func (pq *PatientQuery) birthOrder() (int, error) {
+	if pq.BirthOrder == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(pq.BirthOrder)
+	if err != nil || n < 1 || n > maxBirthOrder {
+		return 0, ErrBadBirthOrder
+	}
+	return n, nil
+}
+
+// validateNewborn checks the birth date is recent enough and the birth order
+func (pq *PatientQuery) validateNewborn(birthDate store.Date) error {
+	t, err := birthDate.Time()
+	if err != nil {
+		return ErrBadBirthDate
+	}
+	age := time.Since(t)
+	if age < 0 {
+		return ErrBadBirthDate
+	}
+	if age > newbornMaxAge {
+		return ErrNotNewborn
+	}
+	_, err = pq.birthOrder()
+	return err
+}
+
+// recordID is the id the patient is stored under. newborns don't have one,
+// theirs is made of the guardian's id, the birth date and order e.g. NB-1012345672-20240101-1
+func (pq *PatientQuery) recordID() string {
+	if pq.Kind() != KindNewborn {
+		return pq.ID
+	}
+	d, err := store.ParseDate(pq.BirthDate)
+	if err == nil {
+		d, err = d.Gregorian()
+	}
+	order, oerr := pq.birthOrder()
+	if err != nil || oerr != nil {
+		// Validate wasn't called, don't store it under the guardian's id
+		return ""
+	}
+	return fmt.Sprintf("NB-%s-%04d%02d%02d-%d", pq.ID, d.Year, d.Month, d.Day, order)
+}
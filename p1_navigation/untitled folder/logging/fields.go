@@ -0,0 +1,231 @@
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// kind of the personal data of a field, it's what's written instead of the value
+type kind string
+
+const (
+	plain     kind = ""
+	id        kind = "[id]"
+	name      kind = "[name]"
+	birthDate kind = "[birth_date]"
+	phone     kind = "[phone]"
+)
+
+// Field is a key and value of a log line
+type Field struct {
+	Key   string
+	Value interface{}
+	kind  kind
+}
+
+func (f Field) value() interface{} {
+	if f.kind != plain {
+		if isZero(f.Value) {
+			return f.Value
+		}
+		return string(f.kind)
+	}
+	switch v := f.Value.(type) {
+	case string:
+		return Scrub(v)
+	case error:
+		return Scrub(v.Error())
+	case fmt.Stringer:
+		return Scrub(v.String())
+	}
+	return redact(reflect.ValueOf(f.Value))
+}
+
+// String is a field scrubbed like the messages
+func String(key, v string) Field {
+	return Field{Key: key, Value: v}
+}
+
+func Int(key string, v int) Field {
+	return Field{Key: key, Value: v}
+}
+
+func Duration(key string, d time.Duration) Field {
+	return Field{Key: key, Value: d.String()}
+}
+
+// Err is the error field, its message is scrubbed
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Any is v as json, the personal fields of the structs in it are redacted by name
+func Any(key string, v interface{}) Field {
+	return Field{Key: key, Value: v}
+}
+
+// ID is a national id, iqama or any id number of a person, it's redacted
+func ID(key, v string) Field {
+	return Field{Key: key, Value: v, kind: id}
+}
+
+// Name is a name of a person, it's redacted
+func Name(key, v string) Field {
+	return Field{Key: key, Value: v, kind: name}
+}
+
+// BirthDate is redacted
+func BirthDate(key, v string) Field {
+	return Field{Key: key, Value: v, kind: birthDate}
+}
+
+// Phone is a phone number or an email, it's redacted
+func Phone(key, v string) Field {
+	return Field{Key: key, Value: v, kind: phone}
+}
+
+// kinds of the struct fields by name, lower cased without the underscores so the go names
+// and the json names of store.Patient, store.Practitioner and nhic.PatientQuery are both found
+var kinds = map[string]kind{
+	"id": id, "idnumber": id, "guardianid": id, "passportnumber": id, "bordernumber": id, "visanumber": id,
+	"hifizanumber": id, "sponsornumber": id, "healthid": id, "reservedhealthid": id, "practitionerid": id,
+	"nationalid": id, "iqamaid": id, "idnumberindex": id,
+
+	"firstnamear": name, "secondnamear": name, "thirdnamear": name, "lastnamear": name, "subtribename": name,
+	"firstnameen": name, "secondnameen": name, "thirdnameen": name, "lastnameen": name,
+	"fullnamear": name, "fullnameen": name, "given": name, "family": name, "name": name,
+
+	"birthdate": birthDate, "dateofbirthg": birthDate, "dateofbirthh": birthDate, "birthdateg": birthDate,
+	"birthdateh": birthDate, "birthdateoriginal": birthDate, "birthdategregorian": birthDate,
+	"birthdatehirji": birthDate, "dateg": birthDate, "dateh": birthDate, "age": birthDate,
+
+	"mobilenumber": phone, "phonenumber": phone, "phone": phone, "emailaddress": phone, "email": phone,
+}
+
+func kindOf(f reflect.StructField) kind {
+	if k, ok := kinds[normalize(f.Name)]; ok {
+		return k
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	return kinds[normalize(tag)]
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.Replace(s, "_", "", -1))
+}
+
+// redact returns v with the personal fields of its structs and the personal keys of its maps
+// replaced by their kind, the structs become maps by json name
+func redact(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return redact(v.Elem())
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redact(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		// the keys are scrubbed too, a map can be keyed by the id numbers
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := Scrub(fmt.Sprint(iter.Key().Interface()))
+			if k := kinds[normalize(key)]; k != plain {
+				if !isZero(iter.Value().Interface()) {
+					out[key] = string(k)
+				}
+				continue
+			}
+			out[key] = redact(iter.Value())
+		}
+		return out
+	case reflect.String:
+		return Scrub(v.String())
+	case reflect.Struct:
+		t := v.Type()
+		if leaves[t] {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			tag := strings.Split(f.Tag.Get("json"), ",")
+			key := tag[0]
+			if key == "" {
+				key = f.Name
+			}
+			fv := v.Field(i)
+			if len(tag) > 1 && tag[1] == "omitempty" && isZero(fv.Interface()) {
+				continue
+			}
+			if k := kindOf(f); k != plain {
+				if !isZero(fv.Interface()) {
+					out[key] = string(k)
+				}
+				continue
+			}
+			out[key] = redact(fv)
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// leaves are the structs written as they are, the other types writing themselves e.g. projection.Object
+// are redacted by their fields like any struct since their json could have anything
+var leaves = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}):  true,
+	reflect.TypeOf(store.Date{}): true,
+}
+
+func isZero(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	if rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		return rv.IsNil() || isZero(rv.Elem().Interface())
+	}
+	return rv.IsZero()
+}
+
+// the personal data that can be told apart in free text, the phones before the ids they look like
+var scrubbers = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`(\+?966|\b0)5\d{8}\b`), string(phone)},
+	// health ids
+	{regexp.MustCompile(`\bID\d{14}\b`), string(id)},
+	// national ids, iqamas, border numbers and visas
+	{regexp.MustCompile(`\b[1-4]\d{9}\b`), string(id)},
+	// gcc ids, emirates ids with or without their dashes then the civil ids of kuwait, qatar, bahrain and oman
+	{regexp.MustCompile(`\b784-?\d{4}-?\d{7}-?\d\b`), string(id)},
+	{regexp.MustCompile(`\b(\d{9}|\d{11,12})\b`), string(id)},
+	{regexp.MustCompile(`\b(\d{4}[-/]\d{1,2}[-/]\d{1,2}|\d{1,2}[-/]\d{1,2}[-/]\d{4})\b`), "[date]"},
+}
+
+// Scrub replaces the national ids, iqamas, border numbers, gcc ids, health ids,
+// saudi phone numbers and dates in s
+func Scrub(s string) string {
+	for _, sc := range scrubbers {
+		s = sc.re.ReplaceAllString(s, sc.with)
+	}
+	return s
+}
@@ -0,0 +1,199 @@
+// Package logging writes leveled json log lines that don't leak the patients.
+//
+// each line has the time, the level, the message, the fields of the context (see NewContext, e.g. the
+// correlation id and the caller of the request set by audit.NewContext) then the fields. the personal
+// data is redacted by the type of the field: ID, Name, BirthDate and Phone fields are written as their
+// kind, the structs given to Any have their id, name, birth date and contact fields redacted by name,
+// and the messages, errors and String fields have the ids, health ids, phone numbers and dates in them
+// replaced. names in free text can't be told apart, pass them as Name fields
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a log line, the lines below the level of the Logger aren't written
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = map[Level]string{Debug: "debug", Info: "info", Warn: "warn", Error: "error"}
+
+var ErrUnknownLevel = errors.New("log level is debug, info, warn or error")
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel reads the level of config, "" is Info
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Info, nil
+	}
+	for l, name := range levelNames {
+		if name == s {
+			return l, nil
+		}
+	}
+	return Info, ErrUnknownLevel
+}
+
+// std is used by a nil *Logger
+var std = New(os.Stderr, Info)
+
+// Logger writes the json lines, it's safe for concurrent use. a nil *Logger writes to stderr at Info
+type Logger struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  Level
+	fields []Field
+	now    func() time.Time
+}
+
+// New returns a Logger writing the lines of level and above to w
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{mu: &sync.Mutex{}, w: w, level: level, now: time.Now}
+}
+
+// With returns a Logger adding fields to each line e.g. the name of a client
+func (l *Logger) With(fields ...Field) *Logger {
+	if l == nil {
+		l = std
+	}
+	cp := *l
+	cp.fields = append(append([]Field{}, l.fields...), fields...)
+	return &cp
+}
+
+// Enabled tells if the lines of level are written
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil {
+		l = std
+	}
+	return level >= l.level
+}
+
+func (l *Logger) Debug(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, Debug, msg, fields)
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, Info, msg, fields)
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, Warn, msg, fields)
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, Error, msg, fields)
+}
+
+func (l *Logger) log(ctx context.Context, level Level, msg string, fields []Field) {
+	if l == nil {
+		l = std
+	}
+	if level < l.level {
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	write(&b, "time", l.now().UTC().Format(time.RFC3339Nano))
+	b.WriteByte(',')
+	write(&b, "level", level.String())
+	b.WriteByte(',')
+	write(&b, "msg", Scrub(msg))
+	for _, f := range fromContext(ctx) {
+		if !isZero(f.Value) {
+			b.WriteByte(',')
+			write(&b, f.Key, f.value())
+		}
+	}
+	for _, fs := range [][]Field{l.fields, fields} {
+		for _, f := range fs {
+			b.WriteByte(',')
+			write(&b, f.Key, f.value())
+		}
+	}
+	b.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b.Bytes())
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx whose lines have fields, they replace the fields of ctx with the same key.
+// the empty ones aren't written
+func NewContext(ctx context.Context, fields ...Field) context.Context {
+	list := []Field{}
+	for _, f := range fromContext(ctx) {
+		if !hasKey(fields, f.Key) {
+			list = append(list, f)
+		}
+	}
+	return context.WithValue(ctx, contextKey{}, append(list, fields...))
+}
+
+func fromContext(ctx context.Context) []Field {
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	return fields
+}
+
+func hasKey(fields []Field, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes "key":v, the urls in the values are kept readable
+func write(b *bytes.Buffer, key string, v interface{}) {
+	var raw bytes.Buffer
+	enc := json.NewEncoder(&raw)
+	enc.SetEscapeHTML(false)
+	enc.Encode(key)
+	raw.Truncate(raw.Len() - 1)
+	raw.WriteByte(':')
+	if err := enc.Encode(v); err != nil {
+		enc.Encode("!" + err.Error())
+	}
+	b.Write(bytes.TrimRight(raw.Bytes(), "\n"))
+}
+
+// Writer returns an io.Writer logging each write as a line of level, it's for the standard log
+// of the packages that don't take a Logger
+//
+//	log.SetFlags(0)
+//	log.SetOutput(logger.Writer(logging.Error))
+func (l *Logger) Writer(level Level) io.Writer {
+	return &writer{l: l, level: level}
+}
+
+type writer struct {
+	l     *Logger
+	level Level
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.l.log(context.Background(), w.level, strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
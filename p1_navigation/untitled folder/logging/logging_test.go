@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"national id", "no patient 1000000008", "no patient [id]"},
+		{"iqama", "iqama 2000000006 expired", "iqama [id] expired"},
+		{"border number", "border_number=3012345678&x", "border_number=[id]&x"},
+		{"border number 4", "4012345678", "[id]"},
+		{"health id", "health id ID00000000000017 released", "health id [id] released"},
+		{"emirates id", "784-1990-1234567-1 and 784199012345671", "[id] and [id]"},
+		{"kuwait civil id", "id=289010112345", "id=[id]"},
+		{"qatar id", "id=28963412345", "id=[id]"},
+		{"bahrain cpr", "cpr 890112345", "cpr [id]"},
+		{"mobile", "call +966501234567 or 0501234567", "call [phone] or [phone]"},
+		{"dates", "born 15-07-1405 i.e. 1985/03/06", "born [date] i.e. [date]"},
+		{"url", "Get https://gw/x?id=1000000008&birth_date=1405-07-15", "Get https://gw/x?id=[id]&birth_date=[date]"},
+		{"kept", "status 500 after 1.5s, seq 42 of 12345678", "status 500 after 1.5s, seq 42 of 12345678"},
+		{"words", "IDENTITY lookup", "IDENTITY lookup"},
+	}
+	for _, tt := range tests {
+		if got := Scrub(tt.in); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// opaque writes its id itself, it's redacted like any struct
+type opaque struct {
+	IDNumber string
+	Status   string
+}
+
+func (o opaque) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.IDNumber)
+}
+
+func sp(s string) *string {
+	return &s
+}
+
+func TestRedact(t *testing.T) {
+	dob, _ := store.ParseDate("1405-07-15")
+	expiry, _ := store.ParseDate("2030-01-31")
+
+	tests := []struct {
+		name  string
+		field Field
+		want  interface{}
+	}{
+		{"patient", Any("patient", &store.Patient{IDNumber: sp("1000000008"), FirstNameAr: sp("محمد"),
+			MobileNumber: sp("0501234567"), DateOfBirthH: &dob, Gender: sp("M")}),
+			map[string]interface{}{"id_number": "[id]", "first_name_ar": "[name]", "mobile_number": "[phone]",
+				"date_of_birth_h": "[birth_date]", "gender": "M"}},
+		{"date in another field", Any("license", struct {
+			Expiry store.Date `json:"expiry"`
+		}{expiry}), map[string]interface{}{"expiry": "31-01-2030"}},
+		{"date", Any("date", dob), "[date]"},
+		{"other marshaler", Any("v", opaque{IDNumber: "1000000008", Status: "active"}),
+			map[string]interface{}{"IDNumber": "[id]", "Status": "active"}},
+		{"slice", Any("ids", []opaque{{IDNumber: "1000000008"}}), []interface{}{map[string]interface{}{"IDNumber": "[id]", "Status": ""}}},
+		{"string in a struct", Any("q", struct{ Note string }{"about 2000000006"}), map[string]interface{}{"Note": "about [id]"}},
+		{"map", Any("params", map[string]interface{}{"national_id": "1000000008", "IDNumber": "2000000006",
+			"first_name_ar": "محمد", "birth_date": "15-07-1405", "status": "active", "note": "id 1000000008", "gender": ""}),
+			map[string]interface{}{"national_id": "[id]", "IDNumber": "[id]", "first_name_ar": "[name]",
+				"birth_date": "[birth_date]", "status": "active", "note": "id [id]", "gender": ""}},
+		{"map of structs by id", Any("byID", map[string]opaque{"1000000008": {IDNumber: "1000000008", Status: "active"}}),
+			map[string]interface{}{"[id]": map[string]interface{}{"IDNumber": "[id]", "Status": "active"}}},
+		{"nil", Any("v", (*store.Patient)(nil)), nil},
+		{"error", Err(errors.New("lookup of 1000000008 failed")), "lookup of [id] failed"},
+		{"id", ID("id", "1000000008"), "[id]"},
+		{"empty id", ID("id", ""), ""},
+		{"name", Name("name", "محمد"), "[name]"},
+		{"birth date", BirthDate("dob", "15-07-1405"), "[birth_date]"},
+		{"phone", Phone("phone", "0501234567"), "[phone]"},
+		{"int", Int("n", 3), float64(3)},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		New(&buf, Info).Info(context.Background(), "m", tt.field)
+		var line map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("%s: %v %s", tt.name, err, buf.String())
+		}
+		got := line[tt.field.Key]
+		if m, ok := got.(map[string]interface{}); ok {
+			// the empty fields of the patient aren't in the test cases
+			for k, v := range m {
+				if v == nil {
+					delete(m, k)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := NewContext(context.Background(), String("correlation_id", "req-1"), String("caller", "his-1"))
+	ctx = NewContext(ctx, String("caller", ""), String("site", "riyadh"))
+
+	var buf bytes.Buffer
+	New(&buf, Info).With(String("client", "gateway")).Info(ctx, "m", String("path", "/x"))
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"correlation_id": "req-1", "site": "riyadh", "client": "gateway", "path": "/x"}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s: got %v, want %v", k, line[k], v)
+		}
+	}
+	if _, ok := line["caller"]; ok {
+		t.Errorf("empty caller written: %v", line["caller"])
+	}
+}
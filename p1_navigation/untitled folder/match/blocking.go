@@ -0,0 +1,131 @@
+package match
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.lean/leandevclan/nhic/names"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// maxBlock is the most patients of a block whose pairs are all scored. a bigger one e.g. the 01-01
+// birth dates of expats whose day isn't known is split by birth date, gender and family name,
+// and a part still bigger is scored in windows of its patients sorted by name
+const maxBlock = 500
+
+// Keys is what the scan keeps of a patient to block it, a store too big to be listed
+// reads the patients of each block again by their id numbers
+type Keys struct {
+	IDNumber string
+	// Blocking are the blocks the patient is in: the birth date, an identifier, the mobile number,
+	// or the start of the family name and the birth year
+	Blocking []string
+	// Sub are the parts of a block too big the patient is in: the birth date, gender and family name
+	Sub []string
+	// Sort orders the patients of a part still too big
+	Sort string
+}
+
+// KeysOf returns the blocking keys of the patient
+func KeysOf(pnt *store.Patient) Keys {
+	k := Keys{IDNumber: str(pnt.IDNumber)}
+	dob, year := "", ""
+	if g := gregorian(pnt); g != nil {
+		dob, year = g.String(), fmt.Sprint(g.Year)
+		k.Blocking = append(k.Blocking, "dob:"+dob)
+	}
+	for _, id := range identifiersOf(pnt) {
+		k.Blocking = append(k.Blocking, "id:"+id)
+	}
+	if m := digits(str(pnt.MobileNumber)); len(m) >= 9 {
+		k.Blocking = append(k.Blocking, "mobile:"+m[len(m)-9:])
+	}
+
+	sub := dob + ":" + genderOf(pnt.Gender)
+	for _, n := range []struct {
+		lang        string
+		first, last *string
+	}{{"ar", pnt.FirstNameAr, pnt.LastNameAr}, {"en", pnt.FirstNameEn, pnt.LastNameEn}} {
+		last := names.Key(names.Normalize(str(n.last)))
+		if last == "" {
+			continue
+		}
+		if r := []rune(last); year != "" && len(r) >= 2 {
+			k.Blocking = append(k.Blocking, n.lang+":"+string(r[:2])+":"+year)
+		}
+		k.Sub = append(k.Sub, sub+":"+n.lang+":"+last)
+		if k.Sort == "" {
+			k.Sort = last + ":" + names.Key(names.Normalize(str(n.first)))
+		}
+	}
+	if len(k.Sub) == 0 {
+		k.Sub = []string{sub}
+	}
+	return k
+}
+
+// Blocks returns the groups of patients, by their index in keys, whose pairs are worth scoring.
+// no group has more than maxBlock patients, the blocks bigger than that are split and none is skipped
+func Blocks(keys []Keys) [][]int {
+	blocks := map[string][]int{}
+	for i := range keys {
+		for _, k := range keys[i].Blocking {
+			blocks[k] = append(blocks[k], i)
+		}
+	}
+
+	var groups [][]int
+	for _, k := range sortedKeys(blocks) {
+		block := blocks[k]
+		if len(block) <= maxBlock {
+			groups = appendGroup(groups, block)
+			continue
+		}
+		parts := map[string][]int{}
+		for _, i := range block {
+			for _, sub := range keys[i].Sub {
+				parts[sub] = append(parts[sub], i)
+			}
+		}
+		for _, sub := range sortedKeys(parts) {
+			groups = append(groups, windows(keys, parts[sub])...)
+		}
+	}
+	return groups
+}
+
+// windows returns the part if it's small enough, or else windows of maxBlock of its patients
+// sorted by name, overlapping by half so each is compared with the maxBlock/2 next to it
+func windows(keys []Keys, part []int) [][]int {
+	if len(part) <= maxBlock {
+		return appendGroup(nil, part)
+	}
+	sorted := append([]int(nil), part...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return keys[sorted[a]].Sort < keys[sorted[b]].Sort
+	})
+	var groups [][]int
+	for start := 0; ; start += maxBlock / 2 {
+		if start+maxBlock >= len(sorted) {
+			return append(groups, sorted[start:])
+		}
+		groups = append(groups, sorted[start:start+maxBlock])
+	}
+}
+
+// appendGroup appends the group if it has a pair
+func appendGroup(groups [][]int, group []int) [][]int {
+	if len(group) < 2 {
+		return groups
+	}
+	return append(groups, group)
+}
+
+func sortedKeys(m map[string][]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
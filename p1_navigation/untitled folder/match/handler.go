@@ -0,0 +1,114 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// ScanResult is what a scan found
+type ScanResult struct {
+	Patients int `json:"patients"`
+	// Pairs is the number of pairs scored
+	Pairs int `json:"pairs"`
+	// Queued is the number of candidates added or updated, reviewed ones aren't queued again
+	Queued int `json:"queued"`
+}
+
+// Admin is what the review api needs, the controller implements it
+type Admin interface {
+	Scan(ctx context.Context) (*ScanResult, error)
+	List(ctx context.Context, status Status) ([]Candidate, error)
+	Get(ctx context.Context, id string) (*Candidate, error)
+	Resolve(ctx context.Context, id string, r *Resolution) (*Candidate, error)
+}
+
+// NewHandler returns the review api logging to log, paths are relative to where it's mounted
+//
+//	POST /scan                     scores the stored patients and queues the likely duplicates
+//	GET  /candidates?status=pending
+//	GET  /candidates/{id}
+//	POST /candidates/{id}/link     {"survivor": "1012345672", "reason": "naturalized, was 2012345675"}
+//	POST /candidates/{id}/merge    {"survivor": "1012345672", "reason": "typo in the family name"}
+//	POST /candidates/{id}/dismiss  {"reason": "twins"}
+//
+//	mux.Handle("/admin/duplicates/", http.StripPrefix("/admin/duplicates", match.NewHandler(admin, logger)))
+//
+// it's meant for operators, mount it behind the admin auth
+func NewHandler(a Admin, log *logging.Logger) http.Handler {
+	return &handler{a: a, log: log}
+}
+
+type handler struct {
+	a   Admin
+	log *logging.Logger
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	var (
+		v   interface{}
+		err error
+	)
+	switch {
+	case len(parts) == 1 && parts[0] == "scan" && r.Method == http.MethodPost:
+		v, err = h.a.Scan(r.Context())
+	case len(parts) == 1 && parts[0] == "candidates" && r.Method == http.MethodGet:
+		var list []Candidate
+		list, err = h.a.List(r.Context(), Status(r.URL.Query().Get("status")))
+		if list == nil {
+			list = []Candidate{}
+		}
+		v = list
+	case len(parts) == 2 && parts[0] == "candidates" && r.Method == http.MethodGet:
+		v, err = h.a.Get(r.Context(), parts[1])
+	case len(parts) == 3 && parts[0] == "candidates" && r.Method == http.MethodPost:
+		var res Resolution
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			h.writeJSON(r.Context(), w, http.StatusBadRequest, map[string]string{"error": "malformed body"})
+			return
+		}
+		res.Action = parts[2]
+		v, err = h.a.Resolve(r.Context(), parts[1], &res)
+	case parts[0] == "scan" || parts[0] == "candidates":
+		h.writeJSON(r.Context(), w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.writeJSON(r.Context(), w, statusOf(err), map[string]string{"error": err.Error()})
+		return
+	}
+	h.writeJSON(r.Context(), w, http.StatusOK, v)
+}
+
+// statusOf maps the errors of Admin, errors that aren't the package's
+// are already generic e.g. the controller's
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrSurvivor), errors.Is(err, ErrNoReason):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrAction):
+		return http.StatusNotFound
+	case errors.Is(err, ErrState), errors.Is(err, ErrNoHealthID):
+		return http.StatusConflict
+	case errors.Is(err, ErrGone):
+		return http.StatusGone
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *handler) writeJSON(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warn(ctx, "response not written", logging.Err(err))
+	}
+}
@@ -0,0 +1,319 @@
+// Package match finds the patients stored twice, e.g. under an iqama and later under the
+// national id after naturalization, or under two records with a typo in the arabic name.
+//
+// pairs of patients are scored Fellegi-Sunter style: each field that agrees adds log2(m/u)
+// and each field that disagrees adds log2((1-m)/(1-u)), m is how often the field agrees for
+// the same person and u for two people picked at random. the pairs scoring at least Review
+// go to a review queue where an operator links, merges or dismisses them
+package match
+
+import (
+	"math"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/names"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// outcome of comparing a field of two patients
+const (
+	Agree    = "agree"
+	Partial  = "partial"
+	Disagree = "disagree"
+	// Missing is a field one of the patients doesn't have, it weighs 0
+	Missing = "missing"
+)
+
+// classes of a scored pair
+const (
+	// Likely pairs are most likely the same person, they still go through review
+	Likely = "likely"
+	// Possible pairs need a closer look
+	Possible = "possible"
+	// Unlikely pairs aren't queued
+	Unlikely = "unlikely"
+)
+
+// Field is a field compared between two patients
+type Field struct {
+	Name string
+	// M is the probability the field agrees for the same person, U for two different people
+	M, U float64
+	// Partial is the similarity from which the field counts as partly agreeing,
+	// similarities between Partial and 1 are weighed between the disagreement and the agreement.
+	// 0 for fields that only agree or disagree
+	Partial float64
+	// AgreeOnly fields don't weigh when they disagree, e.g. the identifiers of duplicates differ
+	AgreeOnly bool
+	// Compare returns the similarity of a and b from 0 to 1, ok is false if one of them
+	// doesn't have the field
+	Compare func(a, b *store.Patient) (sim float64, ok bool)
+}
+
+// AgreeWeight is the weight of the field agreeing
+func (f *Field) AgreeWeight() float64 {
+	return math.Log2(f.M / f.U)
+}
+
+// DisagreeWeight is the weight of the field disagreeing
+func (f *Field) DisagreeWeight() float64 {
+	if f.AgreeOnly {
+		return 0
+	}
+	return math.Log2((1 - f.M) / (1 - f.U))
+}
+
+// FieldScore is how a field weighed in a Score
+type FieldScore struct {
+	Field      string  `json:"field"`
+	Outcome    string  `json:"outcome"`
+	Similarity float64 `json:"similarity"`
+	Weight     float64 `json:"weight"`
+}
+
+// Score is the match weight of a pair of patients
+type Score struct {
+	Total  float64      `json:"total"`
+	Class  string       `json:"class"`
+	Fields []FieldScore `json:"fields"`
+}
+
+// Matcher scores pairs of patients
+type Matcher struct {
+	Fields []Field
+	// Likely and Review are the thresholds of the classes, Likely > Review
+	Likely float64
+	Review float64
+}
+
+// New returns a Matcher with the default fields and thresholds,
+// the weights were set from a sample of the duplicates found by hand
+func New() *Matcher {
+	return &Matcher{Fields: DefaultFields(), Likely: 15, Review: 8}
+}
+
+// DefaultFields are the names in both languages, the birth date in either calendar,
+// the gender, the identifiers, the nationality and the mobile number
+func DefaultFields() []Field {
+	return []Field{
+		{Name: "name_ar", M: 0.95, U: 0.01, Partial: 0.8, Compare: nameAr},
+		{Name: "name_en", M: 0.9, U: 0.01, Partial: 0.8, Compare: nameEn},
+		{Name: "birth_date", M: 0.97, U: 0.001, Partial: 0.5, Compare: birthDate},
+		{Name: "gender", M: 0.98, U: 0.5, Compare: gender},
+		// the same passport or border number on two records is close to certain,
+		// different ones are expected since that's how duplicates happen
+		{Name: "identifiers", M: 0.3, U: 0.000001, AgreeOnly: true, Compare: identifiers},
+		// naturalized citizens had another nationality on the iqama record
+		{Name: "nationality", M: 0.85, U: 0.25, Compare: nationality},
+		{Name: "mobile", M: 0.6, U: 0.0001, AgreeOnly: true, Compare: mobile},
+	}
+}
+
+// Score scores the pair a, b
+func (m *Matcher) Score(a, b *store.Patient) *Score {
+	s := &Score{Fields: make([]FieldScore, 0, len(m.Fields))}
+	for i := range m.Fields {
+		f := &m.Fields[i]
+		fs := FieldScore{Field: f.Name, Outcome: Missing}
+		sim, ok := f.Compare(a, b)
+		if ok {
+			fs.Similarity = round(sim)
+			agree, disagree := f.AgreeWeight(), f.DisagreeWeight()
+			switch {
+			case sim >= 1:
+				fs.Outcome, fs.Weight = Agree, agree
+			case f.Partial > 0 && sim >= f.Partial:
+				fs.Outcome = Partial
+				fs.Weight = disagree + (agree-disagree)*(sim-f.Partial)/(1-f.Partial)
+			default:
+				fs.Outcome, fs.Weight = Disagree, disagree
+			}
+		}
+		fs.Weight = round(fs.Weight)
+		s.Total += fs.Weight
+		s.Fields = append(s.Fields, fs)
+	}
+	s.Total = round(s.Total)
+	s.Class = m.class(s.Total)
+	return s
+}
+
+func (m *Matcher) class(total float64) string {
+	switch {
+	case total >= m.Likely:
+		return Likely
+	case total >= m.Review:
+		return Possible
+	}
+	return Unlikely
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+func nameAr(a, b *store.Patient) (float64, bool) {
+	return nameSimilarity(
+		[]*string{a.FirstNameAr, a.SecondNameAr, a.ThirdNameAr, a.LastNameAr},
+		[]*string{b.FirstNameAr, b.SecondNameAr, b.ThirdNameAr, b.LastNameAr})
+}
+
+func nameEn(a, b *store.Patient) (float64, bool) {
+	return nameSimilarity(
+		[]*string{a.FirstNameEn, a.SecondNameEn, a.ThirdNameEn, a.LastNameEn},
+		[]*string{b.FirstNameEn, b.SecondNameEn, b.ThirdNameEn, b.LastNameEn})
+}
+
+// nameSimilarity compares the normalized first, second, third and last names both have,
+// the first and last names weigh twice the others
+func nameSimilarity(a, b []*string) (float64, bool) {
+	weights := []float64{2, 1, 1, 2}
+	var sum, total float64
+	for i := range a {
+		x, y := names.Normalize(str(a[i])), names.Normalize(str(b[i]))
+		if x == "" || y == "" {
+			continue
+		}
+		sum += weights[i] * names.Similarity(x, y)
+		total += weights[i]
+	}
+	// without the first or the last name on both there's too little to tell
+	if total < 4 {
+		return 0, false
+	}
+	return sum / total, true
+}
+
+// birthDate agrees on the same day in either calendar, it partly agrees
+// on the day and month swapped or a single part of the date off
+func birthDate(a, b *store.Patient) (float64, bool) {
+	x, y := gregorian(a), gregorian(b)
+	if x == nil || y == nil {
+		return 0, false
+	}
+	switch {
+	case *x == *y:
+		return 1, true
+	case x.Year == y.Year && x.Month == y.Day && x.Day == y.Month:
+		return 0.75, true
+	}
+	same := 0
+	if x.Year == y.Year {
+		same++
+	}
+	if x.Month == y.Month {
+		same++
+	}
+	if x.Day == y.Day {
+		same++
+	}
+	if same == 2 {
+		return 0.5, true
+	}
+	return 0, true
+}
+
+// gregorian returns the gregorian birth date of pnt, nil if it doesn't have one
+func gregorian(pnt *store.Patient) *store.Date {
+	for _, d := range []*store.Date{pnt.DateOfBirthG, pnt.DateOfBirthH} {
+		if d == nil || d.IsZero() {
+			continue
+		}
+		if g, err := d.Gregorian(); err == nil {
+			return &g
+		}
+	}
+	return nil
+}
+
+func gender(a, b *store.Patient) (float64, bool) {
+	x, y := genderOf(a.Gender), genderOf(b.Gender)
+	if x == "" || y == "" {
+		return 0, false
+	}
+	if x == y {
+		return 1, true
+	}
+	return 0, true
+}
+
+// genderOf returns male or female, "" if it's unknown
+func genderOf(g *string) string {
+	v := strings.TrimSpace(str(g))
+	for _, gender := range []string{"male", "female"} {
+		for _, s := range store.GenderValues(gender) {
+			if strings.EqualFold(v, s) {
+				return gender
+			}
+		}
+	}
+	return ""
+}
+
+// identifiers agrees if an id number, passport, border or visa number of a is one of b's
+func identifiers(a, b *store.Patient) (float64, bool) {
+	ids := map[string]bool{}
+	for _, id := range identifiersOf(a) {
+		ids[id] = true
+	}
+	for _, id := range identifiersOf(b) {
+		if ids[id] {
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+func identifiersOf(pnt *store.Patient) []string {
+	var ids []string
+	for _, v := range []*string{pnt.IDNumber, pnt.PassportNumber, pnt.BorderNumber, pnt.VisaNumber} {
+		if id := strings.ToUpper(strings.TrimSpace(str(v))); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func nationality(a, b *store.Patient) (float64, bool) {
+	return equalFold(a.NationalityCode, b.NationalityCode)
+}
+
+func mobile(a, b *store.Patient) (float64, bool) {
+	x, y := digits(str(a.MobileNumber)), digits(str(b.MobileNumber))
+	if len(x) < 9 || len(y) < 9 {
+		return 0, false
+	}
+	// 05xxxxxxxx and 9665xxxxxxxx are the same number
+	if x[len(x)-9:] == y[len(y)-9:] {
+		return 1, true
+	}
+	return 0, true
+}
+
+func equalFold(a, b *string) (float64, bool) {
+	x, y := strings.TrimSpace(str(a)), strings.TrimSpace(str(b))
+	if x == "" || y == "" {
+		return 0, false
+	}
+	if strings.EqualFold(x, y) {
+		return 1, true
+	}
+	return 0, true
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
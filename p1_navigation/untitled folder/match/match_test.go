@@ -0,0 +1,154 @@
+package match
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func date(s string) *store.Date {
+	d, err := store.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return &d
+}
+
+func TestScore(t *testing.T) {
+	citizen := &store.Patient{IDNumber: sp("1000000008"), FirstNameAr: sp("محمد"), LastNameAr: sp("الحسن"),
+		FirstNameEn: sp("Mohamed"), LastNameEn: sp("Al Hassan"), Gender: sp("ذكر"), DateOfBirthH: date("15-07-1405"), NationalityCode: sp("SAU")}
+
+	tests := []struct {
+		name  string
+		a, b  *store.Patient
+		class string
+	}{
+		{"naturalized, hijri and gregorian birth date", citizen, &store.Patient{IDNumber: sp("2000000006"), FirstNameAr: sp("محمد"), LastNameAr: sp("الحسن"),
+			FirstNameEn: sp("Mohammed"), LastNameEn: sp("Alhassan"), Gender: sp("M"), DateOfBirthG: date("06-04-1985"), NationalityCode: sp("SDN")}, Likely},
+		{"typo in the family name", &store.Patient{FirstNameEn: sp("Ali"), LastNameEn: sp("Smith"), Gender: sp("M"), DateOfBirthG: date("01-01-1990")},
+			&store.Patient{FirstNameEn: sp("Ali"), LastNameEn: sp("Smyth"), Gender: sp("M"), DateOfBirthG: date("01-01-1990")}, Likely},
+		{"no birth date", &store.Patient{FirstNameEn: sp("Ali"), LastNameEn: sp("Smith"), Gender: sp("M"), NationalityCode: sp("GBR")},
+			&store.Patient{FirstNameEn: sp("Ali"), LastNameEn: sp("Smith"), Gender: sp("male"), NationalityCode: sp("gbr")}, Possible},
+		{"same birth date", citizen, &store.Patient{FirstNameAr: sp("سارة"), LastNameAr: sp("القحطاني"), FirstNameEn: sp("Sara"), LastNameEn: sp("Qahtani"),
+			Gender: sp("F"), DateOfBirthG: date("06-04-1985")}, Unlikely},
+		{"nothing in common", citizen, &store.Patient{}, Unlikely},
+	}
+	m := New()
+	for _, tt := range tests {
+		s := m.Score(tt.a, tt.b)
+		if s.Class != tt.class {
+			t.Errorf("%s: got %s %v, want %s", tt.name, s.Class, s.Total, tt.class)
+		}
+		if len(s.Fields) != len(m.Fields) {
+			t.Errorf("%s: %d fields", tt.name, len(s.Fields))
+		}
+		if r := m.Score(tt.b, tt.a); r.Total != s.Total {
+			t.Errorf("%s: %v the other way, %v", tt.name, r.Total, s.Total)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := NewCandidate("2000000006", "1000000008", &Score{Class: Likely}, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	reviewed := *c
+	reviewed.Status = Linked
+
+	tests := []struct {
+		name string
+		c    *Candidate
+		r    Resolution
+		err  error
+	}{
+		{"link", c, Resolution{Action: ActionLink, Survivor: "1000000008", Reason: "naturalized"}, nil},
+		{"dismiss", c, Resolution{Action: ActionDismiss, Reason: "twins"}, nil},
+		{"no reason", c, Resolution{Action: ActionMerge, Survivor: "1000000008"}, ErrNoReason},
+		{"other survivor", c, Resolution{Action: ActionMerge, Survivor: "1000000016", Reason: "typo"}, ErrSurvivor},
+		{"unknown action", c, Resolution{Action: "delete", Reason: "typo"}, ErrAction},
+		{"reviewed", &reviewed, Resolution{Action: ActionDismiss, Reason: "twins"}, ErrState},
+	}
+	for _, tt := range tests {
+		if err := tt.r.Validate(tt.c); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if c.IDNumberA != "1000000008" || c.Other("1000000008") != "2000000006" || c.ID != CandidateID("2000000006", "1000000008") {
+		t.Errorf("candidate %+v", c)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	// the 01-01 birth date of the expats whose day isn't known
+	var keys []Keys
+	add := func(first, last, gender, dob string) int {
+		keys = append(keys, KeysOf(&store.Patient{IDNumber: sp(fmt.Sprint(2000000000 + len(keys))), FirstNameEn: sp(first), LastNameEn: sp(last),
+			Gender: sp(gender), DateOfBirthG: date(dob)}))
+		return len(keys) - 1
+	}
+	for i := 0; i < maxBlock; i++ {
+		add("Ahmed", "Family", "M", "01-01-1980")
+	}
+	smith, smyth := add("John", "Smith", "M", "01-01-1980"), add("John", "Smyth", "M", "01-01-1980")
+	// only the birth date block has them
+	ali, aly, alia := add("Ali", "", "M", "01-01-1980"), add("Aly", "", "M", "01-01-1980"), add("Alia", "", "F", "01-01-1980")
+	// a part still too big, sorted by first name
+	firstKhan := add("Aamir", "Khan", "M", "01-01-1980")
+	for i := 0; i < 2*maxBlock; i++ {
+		add("Imran", "Khan", "M", "01-01-1980")
+	}
+	lastKhan := add("Zaid", "Khan", "M", "01-01-1980")
+	other := add("John", "Smith", "M", "02-02-1981")
+
+	groups := Blocks(keys)
+	together := func(a, b int) bool {
+		for _, g := range groups {
+			in := 0
+			for _, i := range g {
+				if i == a || i == b {
+					in++
+				}
+			}
+			if in == 2 {
+				return true
+			}
+		}
+		return false
+	}
+	tests := []struct {
+		name string
+		a, b int
+		want bool
+	}{
+		{"same family name", smith, smyth, true},
+		{"no family name, same gender", ali, aly, true},
+		{"no family name, other gender", ali, alia, false},
+		{"other family name", smith, 0, false},
+		{"window of a part too big", lastKhan, lastKhan - 1, true},
+		{"outside the window", firstKhan, lastKhan, false},
+		{"other birth date", smith, other, false},
+	}
+	for _, tt := range tests {
+		if got := together(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	grouped := map[int]bool{}
+	for _, g := range groups {
+		if len(g) < 2 || len(g) > maxBlock {
+			t.Errorf("group of %d", len(g))
+		}
+		for _, i := range g {
+			grouped[i] = true
+		}
+	}
+	// none of the 01-01 block is left out, but the one alone in her part
+	if len(grouped) != len(keys)-2 || grouped[other] || grouped[alia] {
+		t.Errorf("grouped %d of %d", len(grouped), len(keys))
+	}
+}
@@ -0,0 +1,167 @@
+package match
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("duplicate candidate not found")
+	// the candidate was already reviewed
+	ErrState    = errors.New("duplicate candidate was already reviewed")
+	ErrSurvivor = errors.New("survivor is one of the id numbers of the candidate")
+	ErrNoReason = errors.New("reason is missing")
+	ErrAction   = errors.New("action is link, merge or dismiss")
+	// a patient of the candidate was removed since it was queued e.g. merged into another one
+	ErrGone       = errors.New("patient of the candidate is no longer stored")
+	ErrNoHealthID = errors.New("survivor has no health id")
+)
+
+// Status of a candidate in the review queue
+type Status string
+
+const (
+	Pending Status = "pending"
+	// Linked records are the same person and share the health id of the survivor,
+	// both stay reachable by their id number
+	Linked Status = "linked"
+	// Merged records were folded into the survivor, the other one is removed
+	// and its id number returns the survivor
+	Merged Status = "merged"
+	// Dismissed pairs are different people, later scans don't queue them again
+	Dismissed Status = "dismissed"
+)
+
+// actions of Resolution
+const (
+	ActionLink    = "link"
+	ActionMerge   = "merge"
+	ActionDismiss = "dismiss"
+)
+
+// Candidate is a pair of stored patients that may be the same person, by id number
+type Candidate struct {
+	ID        string  `json:"id" db:"ID"`
+	IDNumberA string  `json:"id_number_a" db:"IDNumberA"`
+	IDNumberB string  `json:"id_number_b" db:"IDNumberB"`
+	Score     float64 `json:"score" db:"Score"`
+	Class     string  `json:"class" db:"Class"`
+	// Fields is how each field weighed in the score
+	Fields FieldScores `json:"fields" db:"Fields"`
+	Status Status      `json:"status" db:"Status"`
+	// Survivor is the id number whose health id was kept, linked and merged only
+	Survivor  string    `json:"survivor,omitempty" db:"Survivor"`
+	Reason    string    `json:"reason,omitempty" db:"Reason"`
+	CreatedAt time.Time `json:"created_at" db:"CreatedAt"`
+	UpdatedAt time.Time `json:"updated_at" db:"UpdatedAt"`
+}
+
+// NewCandidate returns the pending candidate of the pair scored s,
+// the id is the same whichever order the id numbers are given in
+func NewCandidate(idNumberA, idNumberB string, s *Score, now time.Time) *Candidate {
+	if idNumberB < idNumberA {
+		idNumberA, idNumberB = idNumberB, idNumberA
+	}
+	return &Candidate{
+		ID:        CandidateID(idNumberA, idNumberB),
+		IDNumberA: idNumberA,
+		IDNumberB: idNumberB,
+		Score:     s.Total,
+		Class:     s.Class,
+		Fields:    s.Fields,
+		Status:    Pending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// CandidateID is the id of the pair of id numbers, the id numbers aren't
+// written in the urls of the admin api
+func CandidateID(idNumberA, idNumberB string) string {
+	if idNumberB < idNumberA {
+		idNumberA, idNumberB = idNumberB, idNumberA
+	}
+	sum := sha256.Sum256([]byte(idNumberA + "|" + idNumberB))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Other returns the id number of the pair that isn't idNumber
+func (c *Candidate) Other(idNumber string) string {
+	if idNumber == c.IDNumberA {
+		return c.IDNumberB
+	}
+	return c.IDNumberA
+}
+
+// Resolution is the decision of the reviewer on a candidate
+type Resolution struct {
+	// Action is link, merge or dismiss
+	Action string `json:"action"`
+	// Survivor is the id number whose health id is kept, link and merge only
+	Survivor string `json:"survivor,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// Validate checks r against the candidate c
+func (r *Resolution) Validate(c *Candidate) error {
+	if r.Reason == "" {
+		return ErrNoReason
+	}
+	switch r.Action {
+	case ActionLink, ActionMerge:
+		if r.Survivor != c.IDNumberA && r.Survivor != c.IDNumberB {
+			return ErrSurvivor
+		}
+	case ActionDismiss:
+	default:
+		return ErrAction
+	}
+	if c.Status != Pending {
+		return ErrState
+	}
+	return nil
+}
+
+// FieldScores are written to the db as json
+type FieldScores []FieldScore
+
+func (f FieldScores) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (f *FieldScores) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	}
+	return fmt.Errorf("match: can't scan %T into FieldScores", src)
+}
+
+// Store keeps the review queue, store/memory and store/sqlite implement it
+type Store interface {
+	// Get returns the candidate or ErrNotFound
+	Get(ctx context.Context, id string) (*Candidate, error)
+	// List returns the candidates with the status, all of them if it's empty,
+	// highest score first
+	List(ctx context.Context, status Status) ([]Candidate, error)
+	// Put adds c, or updates the score of a pending candidate with the same id.
+	// it returns false if the candidate was already reviewed
+	Put(ctx context.Context, c *Candidate) (bool, error)
+	// Resolve replaces the candidate if it's still pending, ErrState if it isn't
+	Resolve(ctx context.Context, c *Candidate) error
+}
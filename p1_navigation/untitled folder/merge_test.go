@@ -0,0 +1,61 @@
+package nhic
+
+import (
+	"context"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+	"gitlab.lean/leandevclan/nhic/store/memory"
+	"gitlab.lean/leandevclan/nhic/store/sqlite"
+)
+
+func TestMergeAlias(t *testing.T) {
+	ctx := context.Background()
+	sq, err := sqlite.New(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+
+	for name, s := range map[string]Store{"memory": memory.New(), "sqlite": sq} {
+		for _, id := range []string{"1000000024", "1000000032", "1000000040"} {
+			if err := s.AddPatient(ctx, &store.Patient{IDNumber: sp(id), FirstNameEn: sp("Ali"), LastNameEn: sp("Smith")}); err != nil {
+				t.Fatal(name, err)
+			}
+		}
+		c := &Controller{store: s, healthIDs: s.(healthIDStore).HealthIDs()}
+		// 1000000032 into 1000000024, then 1000000024 into 1000000040
+		if err := c.linkPatients(ctx, "1000000024", "1000000032", "typo", true); err != nil {
+			t.Fatal(name, err)
+		}
+		if err := c.linkPatients(ctx, "1000000040", "1000000024", "typo", true); err != nil {
+			t.Fatal(name, err)
+		}
+		survivor, _ := s.GetPatientByID(ctx, "1000000040")
+
+		tests := []struct {
+			name string
+			id   string
+			want string
+			err  error
+		}{
+			{"survivor", "1000000040", "1000000040", nil},
+			{"merged", "1000000024", "1000000040", nil},
+			{"merged into a merged one", "1000000032", "1000000040", nil},
+			{"never added", "1000000057", "", store.ErrNotFound},
+		}
+		for _, tt := range tests {
+			pnt, err := s.GetPatient(ctx, tt.id, "")
+			if err != tt.err {
+				t.Errorf("%s %s: got %v, want %v", name, tt.name, err, tt.err)
+			} else if err == nil && (str(pnt.IDNumber) != tt.want || str(pnt.HealthID) != str(survivor.HealthID)) {
+				t.Errorf("%s %s: got %s %s", name, tt.name, str(pnt.IDNumber), str(pnt.HealthID))
+			} else if err != nil && pnt.ReservedHealthID == nil {
+				t.Errorf("%s %s: no health id reserved", name, tt.name)
+			}
+		}
+		if _, err := s.GetPatientByID(ctx, "1000000024"); err != store.ErrNotFound {
+			t.Errorf("%s: merged patient by id: %v", name, err)
+		}
+	}
+}
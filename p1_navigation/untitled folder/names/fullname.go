@@ -0,0 +1,121 @@
+package names
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Format is how a full name is written
+type Format string
+
+// formats of a full name, e.g. for محمد عبدالله سعد القحطاني
+const (
+	// Short is the first and the family name: Mohammed Alqahtani.
+	// without a family name it's the first name bin the father's
+	Short Format = "short"
+	// Formal is the first name bin or bint the father's then the family name: Mohammed bin Abdullah Alqahtani
+	Formal Format = "formal"
+	// Legal is every part as on the id card, without connectors: Mohammed Abdullah Saad Alqahtani,
+	// the subtribe after the family name if it's another name
+	Legal Format = "legal"
+)
+
+var ErrFormat = errors.New("name format is short, formal or legal")
+
+// ParseFormat returns the format named s, Formal if it's empty
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return Formal, nil
+	case Short, Formal, Legal:
+		return f, nil
+	}
+	return "", ErrFormat
+}
+
+// connectors between a name and the father's, the sources sometimes write them in the parts
+var connectors = map[string]bool{"بن": true, "بنت": true, "ابن": true, "bin": true, "bint": true, "ibn": true, "ben": true}
+
+// Parts are the parts of a name in one language, as the entities store them
+type Parts struct {
+	First    string
+	Second   string // the father's name
+	Third    string // the grandfather's name
+	Family   string
+	Subtribe string
+	// Female is written bint instead of bin
+	Female bool
+}
+
+// Full returns the full name in the format, "" if there's no part.
+// the connectors are in the language of the parts, arabic or english
+func (p Parts) Full(f Format) string {
+	first, second, third := clean(p.First), lineage(p.Second), lineage(p.Third)
+	family, subtribe := clean(p.Family), clean(p.Subtribe)
+	// the family name is last whichever field it's in
+	if family == "" {
+		family, subtribe = subtribe, ""
+	}
+	if subtribe != "" && Normalize(subtribe) == Normalize(family) {
+		subtribe = ""
+	}
+
+	bin := p.connector(first + second + family)
+	switch f {
+	case Short:
+		if family == "" {
+			return join(first, bin, second)
+		}
+		return join(first, family)
+	case Legal:
+		return join(first, second, third, family, subtribe)
+	}
+	return join(first, bin, second, family)
+}
+
+// connector is bin or bint in the script of s
+func (p Parts) connector(s string) string {
+	latin := true
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			latin = isLatin(r)
+			break
+		}
+	}
+	switch {
+	case latin && p.Female:
+		return "bint"
+	case latin:
+		return "bin"
+	case p.Female:
+		return "بنت"
+	}
+	return "بن"
+}
+
+// clean trims s and collapses its spaces
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// lineage is the father's or grandfather's name without the connector the source wrote before it
+func lineage(s string) string {
+	words := strings.Fields(s)
+	for len(words) > 1 && connectors[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// join joins the parts with a space, a connector is dropped if the part after it is empty
+func join(parts ...string) string {
+	var words []string
+	for i, p := range parts {
+		if p == "" || (connectors[p] && (i+1 == len(parts) || parts[i+1] == "" || len(words) == 0)) {
+			continue
+		}
+		words = append(words, p)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,53 @@
+package names
+
+import "testing"
+
+func TestFull(t *testing.T) {
+	ar := Parts{First: "محمد", Second: "عبدالله", Third: "سعد", Family: "القحطاني"}
+	en := Parts{First: "Mohammed", Second: " bin  Abdullah", Third: "Saad", Family: "Alqahtani"}
+	fem := Parts{First: "Fatimah", Second: "Abdullah", Subtribe: "Alotaibi", Female: true}
+	noFamily := Parts{First: "نورة", Second: "سعد", Female: true}
+	tribe := Parts{First: "خالد", Third: "فهد", Family: "العتيبي", Subtribe: "الروقي"}
+
+	tests := []struct {
+		name   string
+		p      Parts
+		format Format
+		want   string
+	}{
+		{"short", ar, Short, "محمد القحطاني"},
+		{"formal", ar, Formal, "محمد بن عبدالله القحطاني"},
+		{"legal", ar, Legal, "محمد عبدالله سعد القحطاني"},
+		{"connector given", en, Formal, "Mohammed bin Abdullah Alqahtani"},
+		{"connector dropped", en, Legal, "Mohammed Abdullah Saad Alqahtani"},
+		{"female, subtribe as the family", fem, Formal, "Fatimah bint Abdullah Alotaibi"},
+		{"female legal", fem, Legal, "Fatimah Abdullah Alotaibi"},
+		{"short without a family name", noFamily, Short, "نورة بنت سعد"},
+		{"formal without a father", tribe, Formal, "خالد العتيبي"},
+		{"legal with the subtribe", tribe, Legal, "خالد فهد العتيبي الروقي"},
+		{"empty", Parts{}, Legal, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Full(tt.format); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Format
+		err  error
+	}{
+		{"", Formal, nil},
+		{" Legal ", Legal, nil},
+		{"short", Short, nil},
+		{"x", "", ErrFormat},
+	}
+	for _, tt := range tests {
+		if got, err := ParseFormat(tt.in); got != tt.want || err != tt.err {
+			t.Errorf("%q: got %q %v, want %q %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
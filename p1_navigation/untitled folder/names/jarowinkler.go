@@ -0,0 +1,70 @@
+package names
+
+// JaroWinkler is the Jaro-Winkler similarity of a and b from 0 to 1, by rune
+func JaroWinkler(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	x, y := []rune(a), []rune(b)
+	if len(x) == 0 || len(y) == 0 {
+		return 0
+	}
+
+	window := max(len(x), len(y))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	mx := make([]bool, len(x))
+	my := make([]bool, len(y))
+	matches := 0
+	for i := range x {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(y) {
+			hi = len(y)
+		}
+		for j := lo; j < hi; j++ {
+			if !my[j] && x[i] == y[j] {
+				mx[i], my[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range x {
+		if !mx[i] {
+			continue
+		}
+		for !my[j] {
+			j++
+		}
+		if x[i] != y[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(x)) + m/float64(len(y)) + (m-float64(transpositions)/2)/m) / 3
+
+	// common prefix of up to 4 runes
+	prefix := 0
+	for prefix < 4 && prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,176 @@
+// Package names compares the arabic and english names of patients and practitioners
+// the way they're written by different sources.
+//
+// arabic is folded to one spelling: no diacritics nor tatweel, one alef for the hamza forms,
+// ى as ي, ة as ه and "عبد ال..." written as one word. english is lowercased and the al and abd
+// prefixes are joined to the name, Key then reduces it to its consonants so the
+// transliterations e.g. Mohammed, Muhammad and Mohamad have the same key.
+//
+// Parts.Full writes the full name of the name parts in the short, formal or legal format
+package names
+
+import (
+	"strings"
+	"unicode"
+)
+
+var arabicLetters = map[rune]rune{
+	'أ': 'ا',
+	'إ': 'ا',
+	'آ': 'ا',
+	'ٱ': 'ا',
+	'ؤ': 'و',
+	'ئ': 'ي',
+	'ى': 'ي',
+	'ة': 'ه',
+	// persian forms some keyboards type
+	'ی': 'ي',
+	'ک': 'ك',
+}
+
+// prefixes joined to the word after them, "عبد الله" and "عبدالله" are the same name
+var (
+	arabicPrefixes  = map[string]bool{"عبد": true, "ال": true}
+	englishPrefixes = map[string]bool{"al": true, "el": true, "abd": true, "abdul": true, "abdel": true, "abdal": true, "abdu": true}
+)
+
+// Normalize returns s folded to one spelling, the words are separated by a space
+func Normalize(s string) string {
+	return strings.Join(Words(s), " ")
+}
+
+// Words returns the normalized words of s, the prefixes are joined to the next word
+func Words(s string) []string {
+	var words []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			words = append(words, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(s) {
+		if to, ok := arabicLetters[r]; ok {
+			r = to
+		}
+		switch {
+		case unicode.Is(unicode.Mn, r), r == 'ـ':
+			// diacritics, the superscript alef and tatweel
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			// spaces, hyphens e.g. al-otaibi, apostrophes
+			flush()
+		}
+	}
+	flush()
+
+	joined := words[:0]
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		for (arabicPrefixes[w] || englishPrefixes[w]) && i+1 < len(words) {
+			i++
+			w += words[i]
+		}
+		joined = append(joined, w)
+	}
+	return joined
+}
+
+// Key reduces a normalized word to the part the spellings of a name share: the leading al is
+// dropped, and in english the vowels after the first letter and the doubled letters too
+func Key(word string) string {
+	r := []rune(word)
+	if len(r) == 0 {
+		return ""
+	}
+	if !isLatin(r[0]) {
+		if len(r) > 4 && string(r[:2]) == "ال" {
+			r = r[2:]
+		}
+		return string(r)
+	}
+
+	w := string(r)
+	for _, p := range []string{"abdul", "abdel", "abdal", "abdur", "abdu"} {
+		if strings.HasPrefix(w, p) && len(w) > len(p)+2 {
+			w = "abd" + w[len(p):]
+			break
+		}
+	}
+	if len(w) > 4 && (strings.HasPrefix(w, "al") || strings.HasPrefix(w, "el")) {
+		w = w[2:]
+	}
+	w = strings.NewReplacer("ph", "f", "q", "k", "ou", "u").Replace(w)
+	// a trailing h after a vowel isn't pronounced e.g. fatimah
+	if n := len(w); n > 2 && w[n-1] == 'h' && isVowel(w[n-2]) {
+		w = w[:n-1]
+	}
+
+	var b strings.Builder
+	var last byte
+	for i := 0; i < len(w); i++ {
+		c := w[i]
+		switch {
+		case i == 0 && isVowel(c):
+			// othman and uthman, ibrahim and ebrahim
+			c = 'a'
+		case i > 0 && (isVowel(c) || c == 'y'):
+			continue
+		}
+		if c == last {
+			continue
+		}
+		b.WriteByte(c)
+		last = c
+	}
+	return b.String()
+}
+
+// Similarity compares the words of two names from 0 to 1 by Jaro-Winkler,
+// words with the same Key are close to the same
+func Similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	sim := JaroWinkler(a, b)
+	if ka := Key(a); ka != "" && ka == Key(b) && sim < 0.97 {
+		sim = 0.97
+	}
+	return sim
+}
+
+// Score is how well the name searched matches the name parts of a record from 0 to 1,
+// the mean of the best match of each word searched whatever the order
+func Score(query string, parts ...*string) float64 {
+	qw := Words(query)
+	var nw []string
+	for _, p := range parts {
+		if p != nil {
+			nw = append(nw, Words(*p)...)
+		}
+	}
+	if len(qw) == 0 || len(nw) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, q := range qw {
+		best := 0.0
+		for _, n := range nw {
+			if s := Similarity(q, n); s > best {
+				best = s
+			}
+		}
+		sum += best
+	}
+	return sum / float64(len(qw))
+}
+
+func isLatin(r rune) bool {
+	return r < unicode.MaxASCII
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
@@ -0,0 +1,71 @@
+package names
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"عبد الله", "عبدالله"},
+		{"أحمد", "احمد"},
+		{"إبراهيم", "ابراهيم"},
+		{"فاطمة", "فاطمه"},
+		{"مصطفى", "مصطفي"},
+		{"مُحَمَّد", "محمد"},
+		{"مـحـمـد", "محمد"},
+		{"Abdul Rahman", "abdulrahman"},
+	}
+	for _, tt := range tests {
+		if a, b := Normalize(tt.a), Normalize(tt.b); a != b {
+			t.Errorf("%q and %q: %q, %q", tt.a, tt.b, a, b)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"Mohammed", "Muhammad", true},
+		{"Mohamad", "Muhammad", true},
+		{"Abdulrahman", "Abd Al Rahman", true},
+		{"Fatimah", "Fatima", true},
+		{"Othman", "Uthman", true},
+		{"القحطاني", "قحطاني", true},
+		{"Mohammed", "Ahmed", false},
+	}
+	for _, tt := range tests {
+		a, b := Words(tt.a), Words(tt.b)
+		if len(a) != 1 || len(b) != 1 {
+			t.Errorf("%q and %q: words %q, %q", tt.a, tt.b, a, b)
+			continue
+		}
+		if same := Key(a[0]) == Key(b[0]); same != tt.same {
+			t.Errorf("%q and %q: keys %q, %q", tt.a, tt.b, Key(a[0]), Key(b[0]))
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	sp := func(s string) *string { return &s }
+	tests := []struct {
+		name  string
+		query string
+		parts []*string
+		min   float64
+		max   float64
+	}{
+		{"same", "ali", []*string{sp("Ali")}, 1, 1},
+		{"other spelling", "muhammad alqahtani", []*string{sp("Mohammed"), nil, sp("Al Qahtani")}, 0.97, 1},
+		{"words in any order", "qahtani mohammed", []*string{sp("Mohammed"), sp("Al Qahtani")}, 0.97, 1},
+		{"other name", "mohammed", []*string{sp("Ahmed")}, 0, 0.85},
+		{"nothing searched", " ", []*string{sp("Ali")}, 0, 0},
+		{"no name", "ali", []*string{nil}, 0, 0},
+	}
+	for _, tt := range tests {
+		if s := Score(tt.query, tt.parts...); s < tt.min || s > tt.max {
+			t.Errorf("%s: got %v, want %v to %v", tt.name, s, tt.min, tt.max)
+		}
+	}
+}
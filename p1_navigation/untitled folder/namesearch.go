@@ -0,0 +1,243 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/names"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// minNameScore is the lowest names.Score returned, below it the names only share a few letters
+const minNameScore = 0.85
+
+var ErrNameSearchUnsupported = errors.New("store doesn't search by name")
+
+// practitionerLister is implemented by the stores small enough to be scanned whole,
+// store/memory and store/sqlite
+type practitionerLister interface {
+	ListPractitioners(ctx context.Context) (*[]store.Practitioner, error)
+}
+
+// NameSearchQuery is a search by name, ranked by how close the names are
+type NameSearchQuery struct {
+	// Name is the name or a part of it in arabic or english, the words in any order.
+	// it's normalized, see package names
+	Name string
+	// BirthDate is hijri or gregorian in any of the layouts PatientQuery takes
+	BirthDate string
+	// Gender is male or female
+	Gender string
+
+	Offset int
+	// Count is the page size, defaultPageSize if 0 and at most maxPageSize
+	Count int
+}
+
+// PatientMatch is a patient found by name and how close its name is, from 0 to 1
+type PatientMatch struct {
+	Patient store.Patient
+	Score   float64
+}
+
+// PatientMatchPage is a page of the patients matching a NameSearchQuery, closest first
+type PatientMatchPage struct {
+	Matches []PatientMatch
+	// Total is the number of matches in all the pages, at most maxPatientMatches
+	Total  int
+	Offset int
+	Count  int
+}
+
+// PractitionerMatch is a practitioner found by name and how close its name is, from 0 to 1
+type PractitionerMatch struct {
+	Practitioner store.Practitioner
+	Score        float64
+}
+
+// PractitionerMatchPage is a page of the practitioners matching a NameSearchQuery, closest first
+type PractitionerMatchPage struct {
+	Matches []PractitionerMatch
+	Total   int
+	Offset  int
+	Count   int
+}
+
+// filter returns the birth date and gender of q as a store.PatientSearch
+func (q *NameSearchQuery) filter() (*store.PatientSearch, error) {
+	if len(names.Words(q.Name)) == 0 {
+		return nil, ErrBadArgs
+	}
+	f := &store.PatientSearch{Gender: strings.ToLower(strings.TrimSpace(q.Gender))}
+	if f.Gender != "" && store.GenderValues(f.Gender) == nil {
+		return nil, ErrBadGender
+	}
+	if q.BirthDate != "" {
+		d, err := store.ParseDate(q.BirthDate)
+		if err != nil {
+			return nil, ErrBadBirthDate
+		}
+		f.BirthDate = &d
+	}
+	return f, nil
+}
+
+// SearchPatientNames returns the page of the stored patients whose arabic or english name
+// is close to q.Name, closest first then by id number. the patients the consent policy denies are left out
+func (c *Controller) SearchPatientNames(ctx context.Context, q *NameSearchQuery) (*PatientMatchPage, error) {
+	lister, ok := c.store.(patientLister)
+	if !ok {
+		return nil, ErrNameSearchUnsupported
+	}
+	f, err := q.filter()
+	if err != nil {
+		return nil, err
+	}
+	pur, err := c.purposeOf(ctx, opSearchNames, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opSearchNames)
+	defer cancel()
+
+	pnts, err := lister.ListPatients(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "search patient names: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+
+	var all []PatientMatch
+	for _, p := range *pnts {
+		if !f.Matches(&p) {
+			continue
+		}
+		score := bestScore(q.Name,
+			[]*string{p.FirstNameAr, p.SecondNameAr, p.ThirdNameAr, p.LastNameAr},
+			[]*string{p.FirstNameEn, p.SecondNameEn, p.ThirdNameEn, p.LastNameEn})
+		if score >= minNameScore {
+			all = append(all, PatientMatch{Patient: p, Score: score})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	if len(all) > maxPatientMatches {
+		all = all[:maxPatientMatches]
+	}
+	released := all[:0]
+	for _, m := range all {
+		p, err := c.release(ctx, opSearchNames, pur, &m.Patient)
+		if err == ErrConsentDenied {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		released = append(released, PatientMatch{Patient: *p, Score: m.Score})
+	}
+	all = released
+
+	page := &PatientMatchPage{Total: len(all)}
+	var end int
+	page.Offset, page.Count, end = pageWindow(q.Offset, q.Count, len(all))
+	page.Matches = append([]PatientMatch{}, all[page.Offset:end]...)
+	for i := range page.Matches {
+		PatientFullNames(&page.Matches[i].Patient, names.Formal)
+	}
+	return page, nil
+}
+
+// SearchPractitionerNames is SearchPatientNames for the stored practitioners,
+// the ones that aren't stored yet are only found by id number through GetPractitioner
+func (c *Controller) SearchPractitionerNames(ctx context.Context, q *NameSearchQuery) (*PractitionerMatchPage, error) {
+	lister, ok := c.store.(practitionerLister)
+	if !ok {
+		return nil, ErrNameSearchUnsupported
+	}
+	f, err := q.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opSearchNames)
+	defer cancel()
+
+	practs, err := lister.ListPractitioners(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		c.log.Error(ctx, "search practitioner names: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+
+	var all []PractitionerMatch
+	for _, p := range *practs {
+		if !practitionerMatches(f, &p) {
+			continue
+		}
+		score := bestScore(q.Name,
+			[]*string{p.FirstNameAr, p.SecondNameAr, p.ThirdNameAr, p.LastNameAr},
+			[]*string{p.FirstNameEn, p.SecondNameEn, p.ThirdNameEn, p.LastNameEn})
+		if score >= minNameScore {
+			all = append(all, PractitionerMatch{Practitioner: p, Score: score})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	if len(all) > maxPatientMatches {
+		all = all[:maxPatientMatches]
+	}
+
+	page := &PractitionerMatchPage{Total: len(all)}
+	var end int
+	page.Offset, page.Count, end = pageWindow(q.Offset, q.Count, len(all))
+	page.Matches = append([]PractitionerMatch{}, all[page.Offset:end]...)
+	for i := range page.Matches {
+		PractitionerFullNames(&page.Matches[i].Practitioner, names.Formal)
+	}
+	return page, nil
+}
+
+// bestScore is the score of the name against the arabic or the english name, whichever is closer
+func bestScore(name string, ar, en []*string) float64 {
+	score := names.Score(name, ar...)
+	if s := names.Score(name, en...); s > score {
+		score = s
+	}
+	return float64(int(score*1000+0.5)) / 1000
+}
+
+// practitionerMatches tells if the practitioner has the birth date and gender of f,
+// SCFHS and the older rows keep them in different fields
+func practitionerMatches(f *store.PatientSearch, p *store.Practitioner) bool {
+	if dates := f.BirthDates(); dates != nil {
+		found := false
+		for _, d := range dates {
+			for _, b := range []*store.Date{p.BirthDateG, p.BirthDateH, p.BirthDate_G, p.BirthDate_H} {
+				if b != nil && *b == d {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Gender != "" {
+		found := false
+		for _, g := range store.GenderValues(f.Gender) {
+			for _, v := range []*string{p.Gender, p.Gender_en, p.Gender_code, p.Gender_ar} {
+				if v != nil && strings.EqualFold(strings.TrimSpace(*v), g) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
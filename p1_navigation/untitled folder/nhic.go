@@ -1,19 +1,29 @@
 package nhic
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/url"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"gitlab.lean/leandevclan/nhic/audit"
 	"gitlab.lean/leandevclan/nhic/config"
+	"gitlab.lean/leandevclan/nhic/consent"
+	"gitlab.lean/leandevclan/nhic/gateway"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/match"
+	"gitlab.lean/leandevclan/nhic/names"
 	"gitlab.lean/leandevclan/nhic/nic"
 	"gitlab.lean/leandevclan/nhic/oauth"
+	"gitlab.lean/leandevclan/nhic/projection"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
 	"gitlab.lean/leandevclan/nhic/scfhs"
 	"gitlab.lean/leandevclan/nhic/store"
 	"gitlab.lean/leandevclan/nhic/yakeen"
@@ -28,6 +38,7 @@ var (
 	ErrBadNationalID      = errors.New("malformed national_id")
 	ErrBadIqamaID         = errors.New("malformed iqama_id")
 	ErrBadBirthDate       = errors.New("malformed birth_date")
+	ErrBadNameFormat      = errors.New("name_format is short, formal or legal")
 	ErrBadExpiryDate      = errors.New("malformed expiry_date")
 	ErrUnknownPatientType = errors.New("patient type is unknown")
 	ErrFetchingInfo       = errors.New("encountered error while fetch information")  // yakeen
@@ -35,18 +46,45 @@ var (
 	ErrUpdateInfo         = errors.New("encountered error while update information")
 	ErrSearchInput        = errors.New("search input error")
 	ErrNotFound           = errors.New("no info found")
+	ErrCanceled           = errors.New("request was canceled by the caller")
+	ErrTimeout            = errors.New("request deadline exceeded")
+)
+
+// names of the operations that can have a deadline in config
+const (
+	opGetPatient          = "get_patient"
+	opGetPatientByID      = "get_patient_by_id"
+	opSearchPatients      = "search_patients"
+	opFindDuplicates      = "find_duplicates"
+	opSearchNames         = "search_names"
+	opUpdatePatient       = "update_patient"
+	opGetFullPatientInfo  = "get_full_patient_info"
+	opAddPatient          = "add_patient"
+	opGetPractitioner     = "get_practitioner"
+	opGetEstablishment    = "get_establishment"
+	opGetEstablishments   = "get_establishments"
+	opUpdateEstablishment = "update_establishment"
 )
 
 // PatientKind defines the type of the patient we're handling
 // Valid values are:
 // Expat == KindExpat
 // Citizen == KindCitizen
+// Border number (visitors, pilgrims) == KindBorder
+// Visit visa == KindVisitor
+// GCC national == KindGCC
+// Newborn without an id == KindNewborn
+// what differs between them is in kinds.go
 type PatientKind int
 
 const (
 	KindUnknown PatientKind = iota + 1
 	KindExpat
 	KindCitizen
+	KindBorder
+	KindVisitor
+	KindGCC
+	KindNewborn
 )
 
 const (
@@ -57,16 +95,40 @@ const (
 type PatientQuery struct {
 	ID        string
 	BirthDate string
+	// IDType is needed for ids not told by their first digit, see ids.go
+	IDType string
+	// Country is the ISO 3166 alpha-3 code of the gcc member or passport issuer
+	Country string
+	// BirthOrder tells twins apart, newborns only
+	BirthOrder string
+	// NameFormat is the format of the full names, short, formal (default) or legal
+	NameFormat string
 }
 
 // Kind returns the patient type
 func (pq *PatientQuery) Kind() PatientKind {
+	switch IDType(pq.IDType) {
+	case IDTypeBorderNumber:
+		return KindBorder
+	case IDTypeVisa:
+		return KindVisitor
+	case IDTypeGCCID:
+		return KindGCC
+	case IDTypeNewborn:
+		return KindNewborn
+	case IDTypePassport:
+		return KindUnknown
+	}
+
 	if len(pq.ID) == 10 && strings.HasPrefix(pq.ID, citizenPrefix) {
 		return KindCitizen
 	}
 	if len(pq.ID) > 4 && strings.HasPrefix(pq.ID, expatPrefix) {
 		return KindExpat
 	}
+	if len(pq.ID) == 10 && strings.ContainsAny(pq.ID[:1], borderPrefixes) {
+		return KindBorder
+	}
 	return KindUnknown
 }
 
@@ -75,70 +137,145 @@ func (pq *PatientQuery) Parse(u *url.URL) {
 	q := u.Query()
 	pq.ID = q.Get("id")
 	pq.BirthDate = q.Get("birth_date")
+	pq.IDType = q.Get("id_type")
+	pq.Country = q.Get("country")
+	pq.BirthOrder = q.Get("birth_order")
 }
 
 // Validate checks if PatientQuery fields are valid, depending on the type
 func (pq *PatientQuery) Validate() error {
-	switch pq.Kind() {
-	case KindCitizen:
-		if len(pq.ID) != 10 && strings.HasPrefix(pq.ID, citizenPrefix) {
-			return ErrBadNationalID
-		}
-		if len(pq.BirthDate) <= 4 {
-			return ErrBadBirthDate
-		}
-	case KindExpat:
-		// @TODO(kl): find the proper number
-		if len(pq.ID) <= 3 && strings.HasPrefix(pq.ID, expatPrefix) {
-			return ErrBadIqamaID
-		}
-		if len(pq.BirthDate) <= 4 {
-			return ErrBadBirthDate
-		}
-	default:
-		return ErrUnknownPatientType
+	if err := pq.ValidateID(); err != nil {
+		return err
 	}
+	d, err := store.ParseDate(pq.BirthDate)
+	if err != nil {
+		return ErrBadBirthDate
+	}
+	if _, err := names.ParseFormat(pq.NameFormat); err != nil {
+		return ErrBadNameFormat
+	}
+	if pq.Kind() == KindNewborn {
+		return pq.validateNewborn(d)
+	}
+	return nil
+}
 
+// normalizeBirthDate converts BirthDate to the calendar the upstreams expect, callers can send either.
+// hijri for citizens, gregorian for the other kinds, as dd-mm-yyyy
+func (pq *PatientQuery) normalizeBirthDate() error {
+	d, err := store.ParseDate(pq.BirthDate)
+	if err != nil {
+		return err
+	}
+	switch kindSpecs[pq.Kind()].calendar {
+	case store.Hijri:
+		d, err = d.Hijri()
+	case store.Gregorian:
+		d, err = d.Gregorian()
+	}
+	if err != nil {
+		return err
+	}
+	pq.BirthDate = d.String()
 	return nil
 }
 
-// Validate checks if ID is valid , depending on the type
+// ValidateID checks the id against the rules of its family, including the check digit,
+// so malformed ids are rejected before calling yakeen
 func (pq *PatientQuery) ValidateID() error {
-	switch pq.Kind() {
-	case KindCitizen:
-		if len(pq.ID) != 10 && strings.HasPrefix(pq.ID, citizenPrefix) {
-			return ErrBadNationalID
-		}
-	case KindExpat:
-		// @TODO(kl): find the proper number
-		if len(pq.ID) <= 3 && strings.HasPrefix(pq.ID, expatPrefix) {
-			return ErrBadIqamaID
-		}
-	default:
-		return ErrUnknownPatientType
+	t, err := pq.idType()
+	if err != nil {
+		return err
+	}
+	if err := validateID(t, pq.ID, pq.Country); err != nil {
+		return err
 	}
 
+	// valid but we can't look it up e.g. passports
+	if pq.Kind() == KindUnknown {
+		return ErrUnknownPatientType
+	}
 	return nil
 }
 
+// Store is what the controller needs from the db.
+// *mssql.Store is used in production,
+// store/memory and store/sqlite can be used for tests and local development
+type Store interface {
+	GetPatient(ctx context.Context, id, birthDate string) (*store.Patient, error)
+	GetPatientByID(ctx context.Context, id string) (*store.Patient, error)
+	AddPatient(ctx context.Context, pnt *store.Patient) error
+	UpdatesPatient(ctx context.Context, pnt *store.Patient) error
+
+	GetPractitioner(ctx context.Context, id string) (*store.Practitioner, error)
+	AddPractitioner(ctx context.Context, pract *store.Practitioner) error
+
+	GetEstablishment(ctx context.Context, id string) (*store.Establishment, error)
+	GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error)
+	GetEstablishments(ctx context.Context) (*[]store.Establishments, error)
+	GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error)
+	UpdateGovEstablishment(ctx context.Context, est *store.Establishment) error
+
+	GetCountryIsoCode(ctx context.Context, nationality *string) (*store.ISOCode, error)
+}
+
 // Controller handles the logic of:
-// - Getting Patient and iff missing call Yakeen, then add it to our db
+// - Getting Patient and iff missing call the identity sources (Yakeen, NIC), then add it to our db
 // - Getting Establishments
 // - Getting Practitioners
 //
 // The goal from having the logic here,
 // is to keep the business logic away from implementation details like http routes
 type Controller struct {
-	store    *store.Store
-	yakeen   *yakeen.Yakeen
-	nic      *nic.Nic
+	store    Store
 	Sc       *scfhs.Scfhs
 	features []string
+
+	// identity sources of each endpoint in lookup order
+	chains map[string][]IdentitySource
+
+	// deadlines per operation, operations without one
+	// run as long as the caller's context is alive
+	deadlines map[string]time.Duration
+
+	// nil if the store doesn't allocate health ids, see healthids.go
+	healthIDs *healthid.Allocator
+
+	// scores the pairs of patients, duplicates is nil if the store
+	// doesn't keep the review queue, see duplicates.go
+	matcher    *match.Matcher
+	duplicates match.Store
+
+	// records the lookups of patients and practitioners,
+	// nil if the store doesn't keep the trail, see audit.go
+	audit *audit.Log
+
+	// what's released of a patient to each caller, nil releases everything.
+	// consents is nil if the store doesn't keep the directives, see consent.go
+	consent  *consent.Policy
+	consents consent.Store
+
+	// the fields each caller sees of the responses, see projection.go
+	projection *projection.Policy
+
+	// nil without analytics consumers, reidentifiers are the callers allowed
+	// to re-identify their pseudonyms, see pseudonyms.go
+	pseudonyms    *pseudonym.Tokenizer
+	reidentifiers map[string]bool
+
+	// json lines with the personal data redacted, nil writes to stderr
+	log *logging.Logger
 }
 
 // New returns an instance of Controller
 // configs are define in package config
-func New(s *store.Store, conf *config.Config) (*Controller, error) {
+func New(s Store, conf *config.Config) (*Controller, error) {
+	level, err := logging.ParseLevel(conf.Logging.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger := logging.New(os.Stderr, level)
+
 	// init yakeen
 	yak, err := yakeen.New(conf.Gateway.Token, conf.Gateway.URL)
 	if err != nil {
@@ -163,90 +300,234 @@ func New(s *store.Store, conf *config.Config) (*Controller, error) {
 		return nil, err
 	}
 
+	deadlines, err := parseDeadlines(conf.Deadlines)
+	if err != nil {
+		return nil, err
+	}
+
+	// init gateway, lookups of the kinds yakeen and nic don't know
+	gw, err := gateway.New(conf.Gateway.Token, conf.Gateway.URL, conf.Gateway.Lookups)
+	if err != nil {
+		return nil, err
+	}
+	gw.SetLogger(logger)
+
+	chains, err := newChains(conf.Identity, &yakeenSource{yak, logger}, &nicSource{n, logger}, &gatewaySource{gw, logger})
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := consent.NewPolicy(conf.Consent.Callers, conf.Consent.Purposes)
+	if err != nil {
+		return nil, err
+	}
+
+	views, err := projection.NewPolicy(conf.Projection)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizer, err := newTokenizer(s, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := encryptStore(s, conf); err != nil {
+		return nil, err
+	}
+
 	cont := &Controller{
-		store:    s,
-		yakeen:   yak,
-		nic:      n,
-		Sc:       sc,
-		features: conf.Features,
+		store:         s,
+		Sc:            sc,
+		features:      conf.Features,
+		chains:        chains,
+		deadlines:     deadlines,
+		matcher:       match.New(),
+		consent:       policy,
+		projection:    views,
+		pseudonyms:    tokenizer,
+		reidentifiers: make(map[string]bool),
+		log:           logger,
+	}
+	for _, caller := range conf.Pseudonym.Reidentifiers {
+		cont.reidentifiers[caller] = true
+	}
+	if hs, ok := s.(healthIDStore); ok {
+		cont.healthIDs = hs.HealthIDs()
+	}
+	if ds, ok := s.(duplicateStore); ok {
+		cont.duplicates = ds.Duplicates()
+	}
+	if cs, ok := s.(consentStore); ok {
+		cont.consents = cs.Consents()
+	} else {
+		// the policy always applies, the opt-outs of the patients can't be left out of it
+		return nil, ErrConsentUnsupported
+	}
+	if as, ok := s.(auditStore); ok {
+		if cont.audit, err = newAuditLog(as.Audit(), conf); err != nil {
+			return nil, err
+		}
+		cont.audit.SetLogger(logger)
+	} else if conf.Audit.HashKey != "" {
+		// the lookups aren't served unaudited
+		return nil, ErrAuditUnsupported
 	}
 	return cont, nil
 }
 
-// GetPatient talks to store.GetPatient if not found it then calls Yakeen
-// it stores the results in the downstream db
-// then returns
-func (c *Controller) GetPatient(pq *PatientQuery) (*store.Patient, error) {
-	id := pq.ID
-	pnt, err := c.store.GetPatient(id, pq.BirthDate)
-	if err != nil && err == store.ErrSearch {
-		log.Println(err)
+// Logger returns the logger of the controller, the handlers and the server log through it too e.g.
+//
+//	fhir.NewHandler(ctl, "https://<host>/fhir", ctl.Logger())
+//	log.SetFlags(0)
+//	log.SetOutput(ctl.Logger().Writer(logging.Error))
+func (c *Controller) Logger() *logging.Logger {
+	return c.log
+}
+
+// parseDeadlines reads the operation deadlines from config
+// values are go durations e.g. "5s", "1500ms"
+func parseDeadlines(conf map[string]string) (map[string]time.Duration, error) {
+	deadlines := make(map[string]time.Duration, len(conf))
+	for op, v := range conf {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("deadline of %s: %w", op, err)
+		}
+		deadlines[op] = d
+	}
+	return deadlines, nil
+}
+
+// withDeadline bounds ctx by the deadline configured for op
+func (c *Controller) withDeadline(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	if d := c.deadlines[op]; d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// ctxErr returns ErrCanceled or ErrTimeout if ctx is done, nil otherwise.
+// it is checked before any other error so a canceled request
+// is not reported as a failure of the upstream or the db
+func ctxErr(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return ErrCanceled
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	}
+	return nil
+}
+
+// GetPatient talks to store.GetPatient if not found it then calls the identity sources
+// configured for get_patient (Yakeen by default), it stores the results in the downstream db
+// then returns what the consent policy releases. the lookup is recorded in the audit trail
+func (c *Controller) GetPatient(ctx context.Context, pq *PatientQuery) (pnt *store.Patient, err error) {
+	id, source := pq.recordID(), audit.SourceDB
+	defer func() { c.recordAccess(ctx, opGetPatient, id, source, pnt != nil, err) }()
+
+	format, err := names.ParseFormat(pq.NameFormat)
+	if err != nil {
+		return nil, ErrBadNameFormat
+	}
+	pur, err := c.purposeOf(ctx, opGetPatient, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opGetPatient)
+	defer cancel()
+
+	pnt, err = c.store.GetPatient(ctx, id, pq.BirthDate)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
+		c.log.Warn(ctx, "get patient: bad search input", logging.Err(err))
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "get patient: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 
-	// patient found nothing to do
+	// patient found nothing to do, but the english name of the older rows
 	if pnt != nil && err != store.ErrNotFound {
-		return pnt, nil
-	}
-
-	if c.FeatureIsEnabled("disable-yakeen") {
-		return nil, store.ErrNotFound
+		fillEnglishNames(&Person{}, pnt)
+		PatientFullNames(pnt, format)
+		return c.release(ctx, opGetPatient, pur, pnt)
 	}
 
 	// prepare birthDate based on patient type
 	// hijri for citizens, gregorian for expats
-	switch pq.Kind() {
-	case KindCitizen:
-		if pnt.DateH != nil {
-			pq.BirthDate = *pnt.DateH
-		}
-		fmt.Println(pq)
-	case KindExpat:
-		if pnt.DateG != nil {
-			pq.BirthDate = *pnt.DateG
+	// the db conversion is used only if the date is out of our calendar range
+	if err := pq.normalizeBirthDate(); err != nil {
+		switch kindSpecs[pq.Kind()].calendar {
+		case store.Hijri:
+			if pnt.DateH != nil {
+				pq.BirthDate = pnt.DateH.String()
+			}
+		case store.Gregorian:
+			if pnt.DateG != nil {
+				pq.BirthDate = pnt.DateG.String()
+			}
 		}
-		fmt.Println(pq)
 	}
+	c.log.Debug(ctx, "get patient: not in the db, calling the identity sources", logging.Any("query", pq))
 
-	err = c.getPnt(pq, pnt)
-	if err != nil && (err == yakeen.ErrBadDOB || err == yakeen.ErrBadID) {
-		log.Println(err)
+	source, err = c.lookup(ctx, opGetPatient, pq, pnt)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == errNoIdentitySource {
+		return nil, store.ErrNotFound
+	} else if err != nil && err == ErrSearchInput {
 		return nil, ErrSearchInput
 	} else if err != nil {
-		log.Println(err)
+		c.log.Error(ctx, "get patient: identity lookup failed", logging.Err(err))
 		// avoid leaking sensitive info
 		return nil, ErrFetchingInfo
 	}
 
 	// compute patient age
-	pnt.Age = c.calcAge(pnt.DateG)
+	fillBirthDates(pnt)
+	pnt.Age = c.calcAge(pnt.DateOfBirthG)
 
 	// get nationality iso code
-	country, _ := c.store.GetCountryIsoCode(pnt.Nationality)
+	country, _ := c.store.GetCountryIsoCode(ctx, pnt.Nationality)
 	if country != nil {
 		pnt.NationalityCode = country.Code
 		pnt.Nationality = country.CountryNameEn
 	}
 
+	PatientFullNames(pnt, format)
+
 	// add to db
-	go c.addPatient(pnt)
+	go c.addPatient(audit.FromContext(ctx), pnt)
 
-	return pnt, nil
+	return c.release(ctx, opGetPatient, pur, pnt)
 }
 
 //GetPatientByID get patient from db
-func (c *Controller) GetPatientByID(id string) (*store.Patient, error) {
-	pnt, err := c.store.GetPatientByID(id)
-	if err != nil && err == store.ErrSearch {
-		log.Println(err)
+func (c *Controller) GetPatientByID(ctx context.Context, id string) (pnt *store.Patient, err error) {
+	defer func() { c.recordAccess(ctx, opGetPatientByID, id, audit.SourceDB, pnt != nil, err) }()
+
+	pur, err := c.purposeOf(ctx, opGetPatientByID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opGetPatientByID)
+	defer cancel()
+
+	pnt, err = c.store.GetPatientByID(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
+		c.log.Warn(ctx, "get patient by id: bad search input", logging.Err(err))
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "get patient by id: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 
@@ -255,24 +536,42 @@ func (c *Controller) GetPatientByID(id string) (*store.Patient, error) {
 		return nil, ErrNotFound
 	}
 
-	return pnt, nil
+	fillEnglishNames(&Person{}, pnt)
+	PatientFullNames(pnt, names.Formal)
+	return c.release(ctx, opGetPatientByID, pur, pnt)
 }
 
-// UpdatePatient calls Yakeen to updated info and update it in
+// UpdatePatient calls the identity sources configured for update_patient (Yakeen by default)
+// to get the updated info and update it in
 // in the downstream db
 // then returns
-func (c *Controller) UpdatePatient(pq *PatientQuery) (*store.Patient, error) {
-	id := pq.ID
-	pnt, err := c.store.GetPatientByID(id)
-	if err != nil && err == store.ErrSearch {
-		log.Println(err)
+func (c *Controller) UpdatePatient(ctx context.Context, pq *PatientQuery) (*store.Patient, error) {
+	ctx, cancel := c.withDeadline(ctx, opUpdatePatient)
+	defer cancel()
+
+	id := pq.recordID()
+	pnt, err := c.store.GetPatientByID(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
+		c.log.Warn(ctx, "update patient: bad search input", logging.Err(err))
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "update patient: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 
+	// nothing to update
+	if pnt == nil {
+		return nil, ErrNotFound
+	}
+
+	// the caller can send the birth date in either calendar
+	if err := pq.normalizeBirthDate(); err != nil {
+		return nil, ErrSearchInput
+	}
+
 	// Getting the date from the database instead of user input,,, Caused an issue with some formatting and mismatching dates
 	// prepare birthDate based on patient type
 	// hijri for citizens, gregorian for expats
@@ -293,174 +592,123 @@ func (c *Controller) UpdatePatient(pq *PatientQuery) (*store.Patient, error) {
 	// 	}
 	// }
 
-	err = c.getPnt(pq, pnt)
-	if err != nil && (err == yakeen.ErrBadDOB || err == yakeen.ErrBadID) {
-		log.Println(err)
+	_, err = c.lookup(ctx, opUpdatePatient, pq, pnt)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == errNoIdentitySource {
+		return nil, store.ErrNotFound
+	} else if err != nil && err == ErrSearchInput {
 		return nil, ErrSearchInput
 	} else if err != nil {
-		log.Println(err)
+		c.log.Error(ctx, "update patient: identity lookup failed", logging.Err(err))
 		// avoid leaking sensitive info
 		return nil, ErrFetchingInfo
 	}
 
 	// compute patient age
-	pnt.Age = c.calcAge(pnt.DateG)
+	fillBirthDates(pnt)
+	pnt.Age = c.calcAge(pnt.DateOfBirthG)
 
 	// add to db
-	err = c.store.UpdatesPatient(pnt)
-	if err != nil {
-		log.Println(err)
+	err = c.store.UpdatesPatient(ctx, pnt)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil {
+		c.log.Error(ctx, "update patient: update failed", logging.Err(err))
 		return nil, ErrUpdateInfo
 	}
 
 	return nil, nil
 }
 
-func (c *Controller) GetFullPatientInfo(pq *PatientQuery) (*store.Patient, error) {
-	pnt := &store.Patient{}
-	err := c.getFullPnt(pq, pnt)
-	if err != nil && err == nic.ErrValidation {
+// GetFullPatientInfo calls the identity sources configured for get_full_patient_info (NIC by default)
+// it includes the contact info if the consent policy releases it, the result is added to the downstream db.
+// the lookup is recorded in the audit trail
+func (c *Controller) GetFullPatientInfo(ctx context.Context, pq *PatientQuery) (pnt *store.Patient, err error) {
+	var source string
+	defer func() { c.recordAccess(ctx, opGetFullPatientInfo, pq.recordID(), source, pnt != nil, err) }()
+
+	pur, err := c.purposeOf(ctx, opGetFullPatientInfo, pq.recordID())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opGetFullPatientInfo)
+	defer cancel()
+
+	pnt = &store.Patient{}
+	source, err = c.lookup(ctx, opGetFullPatientInfo, pq, pnt)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == errNoIdentitySource {
+		return nil, store.ErrNotFound
+	} else if err != nil && err == ErrSearchInput {
 		return nil, ErrSearchInput
 	} else if err != nil {
-		log.Println(err)
+		c.log.Error(ctx, "get full patient info: identity lookup failed", logging.Err(err))
 		// avoid leaking sensitive info
 		return nil, ErrFetchingInfo
 	}
 	// compute patient age
+	fillBirthDates(pnt)
 	pnt.Age = c.calcAge(pnt.DateOfBirthG)
-	go c.addPatient(pnt)
-	return pnt, nil
+	go c.addPatient(audit.FromContext(ctx), pnt)
+	return c.release(ctx, opGetFullPatientInfo, pur, pnt)
 }
 
-func (c *Controller) calcAge(birthDate *string) *string {
-	if birthDate == nil {
-		return birthDate
+// fillBirthDates converts whichever of DateOfBirthG/DateOfBirthH is missing from the other.
+// a date in the wrong field e.g. a gregorian DateOfBirthH from older rows is converted too
+func fillBirthDates(pnt *store.Patient) {
+	known := pnt.DateOfBirthG
+	if known == nil || known.IsZero() {
+		known = pnt.DateOfBirthH
 	}
-	bdate := *birthDate
-	if len(bdate) <= 0 {
-		return birthDate
+	if known == nil || known.IsZero() {
+		return
 	}
-	t, err := time.Parse("02-01-2006", bdate)
-	if err != nil {
-		log.Println(err)
-		return nil
-	}
-
-	diff := time.Since(t).Hours() / hoursPerYear
-	age := strconv.Itoa(int(diff))
-	return &age
-}
-
-// format birthDateH to yakeen from yyyy-mm-dd to dd-mm-yyyy
-func (c *Controller) formatBirthDate(birthDate string) string {
-	d, err := time.Parse("2006-01-02", birthDate)
-	if err != nil {
-		fmt.Println(err)
-
-		if strings.Count(birthDate, "/") >= 2 {
-			res := strings.Replace(birthDate, "/", "-", 2)
-			birthDate = res
-		}
 
-		return birthDate
+	if g, err := known.Gregorian(); err == nil && !inCalendar(pnt.DateOfBirthG, store.Gregorian) {
+		pnt.DateOfBirthG = &g
 	}
-
-	return d.Format("02-01-2006")
-}
-func (c *Controller) getPnt(pq *PatientQuery, pnt *store.Patient) error {
-	// fetch patient from yakeen since it's not found
-	switch pq.Kind() {
-	case KindCitizen:
-		ctzn, err := c.yakeen.GetCitizen(pq.ID, c.formatBirthDate(pq.BirthDate))
-		if err != nil {
-			return err
-		}
-		err = c.ctznToPnt(ctzn, pnt)
-		if err != nil {
-			return err
-		}
-	case KindExpat:
-		exp, err := c.yakeen.GetExpat(pq.ID, c.formatBirthDate(pq.BirthDate))
-		if err != nil {
-			return err
-		}
-		err = c.expatToPtnt(exp, pnt)
-		if err != nil {
-			return err
-		}
+	if h, err := known.Hijri(); err == nil && !inCalendar(pnt.DateOfBirthH, store.Hijri) {
+		pnt.DateOfBirthH = &h
 	}
-	return nil
 }
 
-func (c *Controller) getFullPnt(pq *PatientQuery, pnt *store.Patient) error {
-	// fetch patient from nic since it's not found
-	p, err := c.nic.GetPatient(pq.ID)
-	if err != nil {
-		return err
-	}
-	pnt.IDNumber = &p.ID
-	pnt.Gender = &p.Gender
-	pnt.MobileNumber = &p.MobileNumber
-
-	pnt.NationalityCode = &p.NationalityCode
-	pnt.Nationality = &p.NationalityDescAr
-
-	pnt.OccupationCode = &p.OccupationCode
-	pnt.Occupation = &p.OccupationDescAr
-
-	pnt.FirstNameEn = &p.FirstNameEn
-	pnt.SecondNameEn = &p.SecondNameEn
-	pnt.ThirdNameEn = &p.ThirdNameEn
-	pnt.LastNameEn = &p.LastNameEn
-
-	pnt.FirstNameAr = &p.FirstNameAr
-	pnt.SecondNameAr = &p.SecondNameAr
-	pnt.ThirdNameAr = &p.ThirdNameAr
-	pnt.LastNameAr = &p.LastNameAr
+// inCalendar tells if d is set and written in cal
+func inCalendar(d *store.Date, cal store.Calendar) bool {
+	return d != nil && !d.IsZero() && d.Calendar == cal
+}
 
-	// format the data return from nic 1963-07-21T00:00:00 to date
-	d, err := time.Parse("2006-01-02T15:04:05", p.BirthDateG)
-	if err != nil {
-		return err
+func (c *Controller) calcAge(birthDate *store.Date) *string {
+	if birthDate == nil || birthDate.IsZero() {
+		return nil
 	}
-	date := d.Format("02-01-2006")
-	pnt.DateOfBirthG = &date
-
-	// add the patient's gregorian birth date from SQL Server
-	pnt.DateOfBirthH = pnt.DateH
-
-	switch pq.Kind() {
-	case KindCitizen:
-		ty := "NationalId"
-		pnt.IDType = &ty
-	case KindExpat:
-		ty := "Iqama"
-		pnt.IDType = &ty
+	t, err := birthDate.Time()
+	if err != nil {
+		c.log.Warn(context.Background(), "calc age: malformed birth date", logging.Err(err))
+		return nil
 	}
 
-	return nil
+	diff := time.Since(t).Hours() / hoursPerYear
+	age := strconv.Itoa(int(diff))
+	return &age
 }
 
-func (c *Controller) Convert(pq *PatientQuery, pnt *store.Patient) ([]byte, error) {
-	//convert age to string
-	age := 0
-	if pnt.Age != nil {
-		a, err := strconv.Atoi(*pnt.Age)
-		if err != nil {
-			log.Println(err)
-		}
-		age = a
-	}
+// Convert writes pnt in the Compat shape of its kind as the caller of ctx sees it, see Project
+func (c *Controller) Convert(ctx context.Context, pq *PatientQuery, pnt *store.Patient) ([]byte, error) {
+	cp := c.compatPatient(ctx, pq, pnt)
+	pnt = cp.pnt
 
 	switch pq.Kind() {
 	case KindCitizen:
 		cc := CompatCitizen{
 			HealthID:          c.SetDefaultValue(pnt.HealthID, nil),
 			IDType:            c.SetDefaultValue(pnt.IDType, nil),
-			IDExpiryDate:      c.SetDefaultValue(pnt.IDExpiryDate, nil),
-			IDNumber:          c.SetDefaultValue(&pq.ID, nil),
-			DateOfBirth:       c.SetDefaultValue(&pq.BirthDate, nil),
-			Age:               &age,
+			IDExpiryDate:      c.SetDefaultValue(dateString(pnt.IDExpiryDate), nil),
+			IDNumber:          cp.id,
+			DateOfBirth:       cp.birthDate,
+			Age:               cp.age,
 			PlaceOfBirth:      c.SetDefaultValue(pnt.PlaceOfBirth, nil),
 			EnglishFirstName:  c.SetDefaultValue(pnt.FirstNameEn, nil),
 			EnglishSecondName: c.SetDefaultValue(pnt.SecondNameEn, nil),
@@ -485,11 +733,11 @@ func (c *Controller) Convert(pq *PatientQuery, pnt *store.Patient) ([]byte, erro
 		ce := CompatExpat{
 			HealthID:     c.SetDefaultValue(pnt.HealthID, nil),
 			IDType:       c.SetDefaultValue(&ity, nil),
-			IDNumber:     c.SetDefaultValue(&pq.ID, nil),
-			DateOfBirth:  c.SetDefaultValue(&pq.BirthDate, nil),
+			IDNumber:     cp.id,
+			DateOfBirth:  cp.birthDate,
 			PlaceOfBirth: c.SetDefaultValue(pnt.PlaceOfBirth, nil),
 
-			IDExpiryDate:    c.SetDefaultValue(pnt.IDExpiryDate, nil),
+			IDExpiryDate:    c.SetDefaultValue(dateString(pnt.IDExpiryDate), nil),
 			FirstName:       c.SetDefaultValue(pnt.FirstNameAr, nil),
 			FatherName:      c.SetDefaultValue(pnt.SecondNameAr, nil),
 			GrandFatherName: c.SetDefaultValue(pnt.ThirdNameAr, nil),
@@ -504,31 +752,28 @@ func (c *Controller) Convert(pq *PatientQuery, pnt *store.Patient) ([]byte, erro
 			Nationality:     c.SetDefaultValue(pnt.Nationality, nil),
 			NationalityCode: c.SetDefaultValue(pnt.NationalityCode, nil),
 			OccupationCode:  c.SetDefaultValue(pnt.Occupation, nil),
-			Age:             &age,
+			Age:             cp.age,
 		}
 		return json.Marshal(ce)
+	case KindBorder, KindVisitor, KindGCC, KindNewborn:
+		return json.Marshal(c.compatVisitor(pq, cp))
 	}
 	return nil, ErrUnknownPatientType
 }
 
-func (c *Controller) Convertv2(pq *PatientQuery, pnt *store.Patient) ([]byte, error) {
-	//convert age to string
-	age := 0
-	if pnt.Age != nil {
-		a, err := strconv.Atoi(*pnt.Age)
-		if err != nil {
-			log.Println(err)
-		}
-		age = a
-	}
+// Convertv2 is Convert in the v2 shapes, the birth date is gregorian
+func (c *Controller) Convertv2(ctx context.Context, pq *PatientQuery, pnt *store.Patient) ([]byte, error) {
+	cp := c.compatPatient(ctx, pq, pnt)
+	pnt = cp.pnt
+
 	switch pq.Kind() {
 	case KindCitizen:
 		cc := CompatCitizenv2{
 			HealthID:          c.SetDefaultValue(pnt.HealthID, nil),
 			IDType:            c.SetDefaultValue(pnt.IDType, nil),
-			IDNumber:          c.SetDefaultValue(&pq.ID, nil),
-			DateOfBirth:       c.SetDefaultValue(pnt.DateOfBirthG, nil),
-			Age:               &age,
+			IDNumber:          cp.id,
+			DateOfBirth:       c.SetDefaultValue(dateString(pnt.DateOfBirthG), nil),
+			Age:               cp.age,
 			PlaceOfBirth:      c.SetDefaultValue(pnt.PlaceOfBirth, nil),
 			EnglishFirstName:  c.SetDefaultValue(pnt.FirstNameEn, nil),
 			EnglishSecondName: c.SetDefaultValue(pnt.SecondNameEn, nil),
@@ -552,8 +797,8 @@ func (c *Controller) Convertv2(pq *PatientQuery, pnt *store.Patient) ([]byte, er
 		ce := CompatExpatv2{
 			HealthID:     c.SetDefaultValue(pnt.HealthID, nil),
 			IDType:       c.SetDefaultValue(&ity, nil),
-			IDNumber:     c.SetDefaultValue(&pq.ID, nil),
-			DateOfBirth:  c.SetDefaultValue(pnt.DateOfBirthG, nil),
+			IDNumber:     cp.id,
+			DateOfBirth:  c.SetDefaultValue(dateString(pnt.DateOfBirthG), nil),
 			PlaceOfBirth: c.SetDefaultValue(pnt.PlaceOfBirth, nil),
 
 			FirstNameAr:  c.SetDefaultValue(pnt.FirstNameAr, nil),
@@ -573,139 +818,122 @@ func (c *Controller) Convertv2(pq *PatientQuery, pnt *store.Patient) ([]byte, er
 			MaritalStatus:     c.SetDefaultValue(pnt.MaritalStatus, &UnknownStatus),
 			MaritalStatusCode: c.SetDefaultValue(pnt.MaritalStatusCode, &UnknownStatusCode),
 			PatientStatus:     c.SetDefaultValue(pnt.PatientStatus, nil),
-			Age:               &age,
+			Age:               cp.age,
 		}
 		return json.Marshal(ce)
+	case KindBorder, KindVisitor, KindGCC, KindNewborn:
+		return json.Marshal(c.compatVisitor(pq, cp))
 	}
 	return nil, ErrUnknownPatientType
 }
 
-func (c *Controller) ctznToPnt(ctzn *yakeen.Citizen, pnt *store.Patient) error {
-	ty := "NationalId"
-	pnt.IDType = &ty
-	pnt.IDNumber = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.NationalID
-	pnt.IDIssuePlace = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.IDIssuePlace
-	pnt.IDIssueDate = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.IDIssueDate
-	pnt.IDExpiryDate = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.IDExpiryDate
-	pnt.DateOfBirthH = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.BirthDate
-
-	// add the patient's gregorian birth date from SQL Server
-	pnt.DateOfBirthG = pnt.DateG
-
-	// pnt.OccupationCode = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.
-
-	pnt.FirstNameEn = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.EnglishFirstName
-	pnt.SecondNameEn = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.EnglishSecondName
-	pnt.ThirdNameEn = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.EnglishThirdName
-	pnt.LastNameEn = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.EnglishLastName
-
-	pnt.FirstNameAr = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.FirstName
-	pnt.SecondNameAr = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.FatherName
-	pnt.ThirdNameAr = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.GrandFatherName
-	pnt.SubtribeName = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.SubtribeName
-	pnt.LastNameAr = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.FamilyName
-
-	pnt.Gender = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.Gender
-	pnt.PlaceOfBirth = &ctzn.GetCitizenInfoResponse.CitizenInfoResult.PlaceOfBirth
-
-	return nil
-}
-
-func (c *Controller) expatToPtnt(expt *yakeen.Expat, pnt *store.Patient) error {
-	ty := "Iqama"
-	pnt.IDType = &ty
+// addPatient runs in the background after the response is sent,
+// so it gets its own context instead of the request's, with the access of the request for the logs
+func (c *Controller) addPatient(a audit.Access, pnt *store.Patient) {
+	ctx, cancel := c.withDeadline(audit.NewContext(context.Background(), a), opAddPatient)
+	defer cancel()
 
-	pnt.IDNumber = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.IqamaID
-	pnt.IDIssuePlace = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.IqamaIssuePlaceDesc
-	pnt.IDIssueDate = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.IqamaIssueDateH
-	pnt.IDExpiryDate = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.IqamaExpiryDateH
-	pnt.DateOfBirthH = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.BirthDate
-
-	// add the patient's gregorian birth date from SQL Server
-	pnt.DateOfBirthG = pnt.DateG
-
-	pnt.Nationality = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.NationalityDesc
-	pnt.Occupation = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.OccupationDesc
-	pnt.Gender = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.Gender
-
-	pnt.FirstNameEn = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.EnglishFirstName
-	pnt.SecondNameEn = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.EnglishSecondName
-	pnt.ThirdNameEn = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.EnglishThirdName
-	pnt.LastNameEn = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.EnglishLastName
-
-	pnt.FirstNameAr = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.FirstName
-	pnt.SecondNameAr = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.SecondName
-	pnt.ThirdNameAr = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.ThirdName
-	pnt.LastNameAr = &expt.GetAlienInfoByIqamaResponse.AlienInfoByIqamaResult.LastName
-
-	return nil
-}
-
-func (c *Controller) addPatient(pnt *store.Patient) {
-	log.Println(c.store.AddPatient(pnt))
+	if err := c.store.AddPatient(ctx, pnt); err != nil {
+		c.log.Error(ctx, "add patient failed", logging.Err(err))
+		return
+	}
+	c.log.Debug(ctx, "patient added")
 }
 
 // GetEstablishment searches for a *store.Establishment by id and returns it
-func (c *Controller) GetEstablishment(id string) (*store.Establishment, error) {
-	est, err := c.store.GetEstablishment(id)
-	if err != nil && err == store.ErrSearch {
+func (c *Controller) GetEstablishment(ctx context.Context, id string) (*store.Establishment, error) {
+	ctx, cancel := c.withDeadline(ctx, opGetEstablishment)
+	defer cancel()
+
+	est, err := c.store.GetEstablishment(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "get establishment: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
+	c.hideEstablishment(ctx, est)
 	return est, nil
 }
 
 // GetEstablishment searches for a *store.Establishment by id and returns it
-func (c *Controller) GetEstablishmentV2(id string) (*store.EstablishmentV2, error) {
-	est, err := c.store.GetEstablishmentV2(id)
-	if err != nil && err == store.ErrSearch {
+func (c *Controller) GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error) {
+	ctx, cancel := c.withDeadline(ctx, opGetEstablishment)
+	defer cancel()
+
+	est, err := c.store.GetEstablishmentV2(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "get establishment v2: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 	return est, nil
 }
 
 // GetEstablishments get full tEstablishments list and returns it
-func (c *Controller) GetEstablishments() (*[]store.Establishments, error) {
-	est, err := c.store.GetEstablishments()
-	if err != nil && err == store.ErrSearch {
+func (c *Controller) GetEstablishments(ctx context.Context) (*[]store.Establishments, error) {
+	ctx, cancel := c.withDeadline(ctx, opGetEstablishments)
+	defer cancel()
+
+	est, err := c.store.GetEstablishments(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "get establishments: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
+	c.hideEstablishments(ctx, est)
 	return est, nil
 }
 
 // GetEstablishments get full tEstablishments list and returns it
-func (c *Controller) GetEstablishmentsV2() (*[]store.EstablishmentV2, error) {
-	est, err := c.store.GetEstablishmentsV2()
-	if err != nil && err == store.ErrSearch {
+func (c *Controller) GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error) {
+	ctx, cancel := c.withDeadline(ctx, opGetEstablishments)
+	defer cancel()
+
+	est, err := c.store.GetEstablishmentsV2(ctx)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
 		return nil, ErrSearchInput
 	} else if err != nil && err != store.ErrNotFound {
 		// avoid leaking sensitive info
-		log.Println(err)
+		c.log.Error(ctx, "get establishments v2: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 	return est, nil
 }
 
-func (c *Controller) GetPractitioner(id string) (*store.Practitioner, error) {
-	pract, err := c.store.GetPractitioner(id)
-	if err != nil && err != store.ErrNotFound {
-		log.Println(err)
+// GetPractitioner returns the practitioner from the db, or from SCFHS then adds it to the db.
+// the lookup is recorded in the audit trail
+func (c *Controller) GetPractitioner(ctx context.Context, id string) (pract *store.Practitioner, err error) {
+	source := audit.SourceDB
+	defer func() { c.recordAccess(ctx, opGetPractitioner, id, source, pract != nil, err) }()
+
+	ctx, cancel := c.withDeadline(ctx, opGetPractitioner)
+	defer cancel()
+
+	pract, err = c.store.GetPractitioner(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err != store.ErrNotFound {
+		c.log.Error(ctx, "get practitioner: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 
 	// Practitioner found nothing to do
 	if pract != nil && err != store.ErrNotFound {
+		PractitionerFullNames(pract, names.Formal)
 		return pract, nil
 	}
 	// Uncomment this to disable SCHFS
@@ -713,26 +941,35 @@ func (c *Controller) GetPractitioner(id string) (*store.Practitioner, error) {
 	// 	return nil, store.ErrNotFound
 	// }
 
-	if err := c.getPract(id, pract); err != nil {
+	source = audit.SourceSCFHS
+	if err := c.getPract(ctx, id, pract); err != nil {
+		if cerr := ctxErr(ctx); cerr != nil {
+			return nil, cerr
+		}
 		return nil, err
 	}
 
 	// Adds the record to DB from SCHFS
-	c.store.AddPractitioner(pract)
+	c.store.AddPractitioner(ctx, pract)
 
 	// Get the values from the DB after it process the data.
-	pract, err = c.store.GetPractitioner(id)
-	if err != nil && err != store.ErrNotFound {
-		log.Println(err)
+	pract, err = c.store.GetPractitioner(ctx, id)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err != store.ErrNotFound {
+		c.log.Error(ctx, "get practitioner: lookup failed", logging.Err(err))
 		return nil, ErrLookingUpInfo
 	}
 
+	if pract != nil {
+		PractitionerFullNames(pract, names.Formal)
+	}
 	return pract, nil
 }
 
 // fetch Practitioner from Scfhs since it's not found
-func (c *Controller) getPract(id string, pract *store.Practitioner) error {
-	p, err := c.Sc.GetPractitioner(id)
+func (c *Controller) getPract(ctx context.Context, id string, pract *store.Practitioner) error {
+	p, err := c.Sc.GetPractitioner(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -764,22 +1001,29 @@ func (c *Controller) getPract(id string, pract *store.Practitioner) error {
 	pract.SCFHSPractitionerStatus = &p.Response.Info.Status.Code
 	pract.SCFHSPractitionerStatusCode = &p.Response.Info.Status.DescAr
 
-	pract.SCFHSRegistrationIssueDate = &p.Response.Info.Status.License.IssuedDate
-	pract.SCFHSRegistrationExpiryDate = &p.Response.Info.Status.License.ExpiryDate
+	license := &p.Response.Info.Status.License
+	if pract.SCFHSRegistrationIssueDate, err = store.ParseDatePtr(&license.IssuedDate); err != nil {
+		return err
+	}
+	if pract.SCFHSRegistrationExpiryDate, err = store.ParseDatePtr(&license.ExpiryDate); err != nil {
+		return err
+	}
 
 	// @TODO: change this
 	pq := PatientQuery{ID: id}
-	switch pq.Kind() {
-	case KindCitizen:
-		ty := "NationalId"
-		pract.IDType = &ty
-	case KindExpat:
-		ty := "Iqama"
-		pract.IDType = &ty
-	}
+	pract.IDType = kindIDType(pq.Kind())
 	return nil
 }
 
+// dateString is d as the Compat responses write it, dd-mm-yyyy
+func dateString(d *store.Date) *string {
+	if d == nil || d.IsZero() {
+		return nil
+	}
+	s := d.String()
+	return &s
+}
+
 // SetDefaultValue take var and it is default value
 func (c *Controller) SetDefaultValue(s *string, d *string) *string {
 	if s == nil && d != nil {
@@ -791,9 +1035,15 @@ func (c *Controller) SetDefaultValue(s *string, d *string) *string {
 	return s
 }
 
-func (c *Controller) UpdateEstablishment(est *store.Establishment) error {
-	if err := c.store.UpdateGovEstablishment(est); err != nil {
-		log.Println("establishmentUpdate error:", err)
+func (c *Controller) UpdateEstablishment(ctx context.Context, est *store.Establishment) error {
+	ctx, cancel := c.withDeadline(ctx, opUpdateEstablishment)
+	defer cancel()
+
+	if err := c.store.UpdateGovEstablishment(ctx, est); err != nil {
+		if cerr := ctxErr(ctx); cerr != nil {
+			return cerr
+		}
+		c.log.Error(ctx, "update establishment failed", logging.Err(err))
 		return ErrUpdateInfo
 	}
 	return nil
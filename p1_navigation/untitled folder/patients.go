@@ -0,0 +1,113 @@
+package nhic
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/names"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// maxPatientMatches bounds a demographic search, broader searches
+// have to be narrowed down by the caller
+const maxPatientMatches = 200
+
+var (
+	ErrSearchUnsupported = errors.New("store doesn't search patients by demographics")
+	ErrBadGender         = errors.New("gender is male or female")
+)
+
+// patientSearcher is implemented by the stores that search patients by demographics,
+// store/memory and store/sqlite
+type patientSearcher interface {
+	SearchPatients(ctx context.Context, q *store.PatientSearch) (*[]store.Patient, error)
+}
+
+// PatientSearchQuery are the demographics of SearchPatients, a name or the birth date is required.
+// only the stored patients are searched, the identity sources are looked up by id
+type PatientSearchQuery struct {
+	// Family and Given match the start of a word of the arabic or english name
+	Family string
+	Given  string
+	// BirthDate is hijri or gregorian in any of the layouts PatientQuery takes
+	BirthDate string
+	// Gender is male or female
+	Gender string
+
+	Offset int
+	// Count is the page size, defaultPageSize if 0 and at most maxPageSize
+	Count int
+}
+
+// PatientPage is a page of the patients matching a PatientSearchQuery
+type PatientPage struct {
+	Patients []store.Patient
+	// Total is the number of matches in all the pages, at most maxPatientMatches
+	Total  int
+	Offset int
+	Count  int
+}
+
+// SearchPatients returns the page of the stored patients matching q ordered by id number,
+// the patients the consent policy denies are left out
+func (c *Controller) SearchPatients(ctx context.Context, q *PatientSearchQuery) (*PatientPage, error) {
+	searcher, ok := c.store.(patientSearcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+
+	sq := &store.PatientSearch{
+		Family: strings.TrimSpace(q.Family),
+		Given:  strings.TrimSpace(q.Given),
+		Gender: strings.ToLower(strings.TrimSpace(q.Gender)),
+		Limit:  maxPatientMatches,
+	}
+	if q.BirthDate != "" {
+		d, err := store.ParseDate(q.BirthDate)
+		if err != nil {
+			return nil, ErrBadBirthDate
+		}
+		sq.BirthDate = &d
+	}
+	if sq.Gender != "" && store.GenderValues(sq.Gender) == nil {
+		return nil, ErrBadGender
+	}
+	if !sq.Valid() {
+		return nil, ErrBadArgs
+	}
+	pur, err := c.purposeOf(ctx, opSearchPatients, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.withDeadline(ctx, opSearchPatients)
+	defer cancel()
+
+	pnts, err := searcher.SearchPatients(ctx, sq)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err != nil && err == store.ErrSearch {
+		return nil, ErrSearchInput
+	} else if err != nil && err != store.ErrNotFound {
+		// avoid leaking sensitive info
+		c.log.Error(ctx, "search patients: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	}
+
+	var all []store.Patient
+	if pnts != nil {
+		if all, err = c.releaseAll(ctx, opSearchPatients, pur, *pnts); err != nil {
+			return nil, err
+		}
+	}
+	page := &PatientPage{Total: len(all)}
+	var end int
+	page.Offset, page.Count, end = pageWindow(q.Offset, q.Count, len(all))
+	page.Patients = append([]store.Patient{}, all[page.Offset:end]...)
+	for i := range page.Patients {
+		PatientFullNames(&page.Patients[i], names.Formal)
+	}
+	return page, nil
+}
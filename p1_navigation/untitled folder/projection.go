@@ -0,0 +1,113 @@
+package nhic
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/projection"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// rules returns the projection rules of the entity for the caller of ctx
+func (c *Controller) rules(ctx context.Context, entity string) projection.Rules {
+	a := audit.FromContext(ctx)
+	return c.projection.Rules(a.Caller, a.Role, entity)
+}
+
+// Project returns v as the caller of ctx sees the entity (projection.Patient, ...), it's what the api writes.
+// v is a struct, a slice of them or a pointer to either
+func (c *Controller) Project(ctx context.Context, entity string, v interface{}) (interface{}, error) {
+	r := c.rules(ctx, entity)
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() == reflect.Slice {
+		return r.ProjectAll(v)
+	}
+	return r.Project(v)
+}
+
+// hideEstablishment clears the fields of est the caller of ctx doesn't see, for the callers
+// of GetEstablishment that write it as it is
+func (c *Controller) hideEstablishment(ctx context.Context, est *store.Establishment) {
+	if est != nil {
+		c.rules(ctx, projection.Establishment).Apply(est)
+	}
+}
+
+// hideEstablishments is hideEstablishment for the GetEstablishments list
+func (c *Controller) hideEstablishments(ctx context.Context, ests *[]store.Establishments) {
+	if ests == nil {
+		return
+	}
+	r := c.rules(ctx, projection.Establishments)
+	for i := range *ests {
+		r.Apply(&(*ests)[i])
+	}
+}
+
+// compat is a patient as the caller of ctx sees it for the Compat shapes of Convert and Convertv2
+type compat struct {
+	pnt *store.Patient
+	// id and birthDate are the ones of the query
+	id        *string
+	birthDate *string
+	// age is nil unless it's visible
+	age *int
+}
+
+// compatPatient returns the copy of pnt the caller of ctx sees with the id and the birth date of pq,
+// they're projected like id_number and the stricter of date_of_birth_g and date_of_birth_h.
+// pnt is the released patient, an analytics caller gets the pseudonym it has instead of the id of pq
+func (c *Controller) compatPatient(ctx context.Context, pq *PatientQuery, pnt *store.Patient) *compat {
+	r := c.rules(ctx, projection.Patient)
+	cp := *pnt
+	r.Apply(&cp)
+
+	out := &compat{
+		pnt:       &cp,
+		birthDate: projectString(stricter(r.Action("date_of_birth_g"), r.Action("date_of_birth_h")), pq.BirthDate),
+	}
+	id := &pq.ID
+	if c.pseudonyms != nil && c.pseudonyms.Analytics(audit.FromContext(ctx).Caller) {
+		id = pnt.IDNumber
+		if pq.Kind() == KindNewborn {
+			id = pnt.GuardianID
+		}
+	}
+	if id != nil {
+		out.id = projectString(r.Action("id_number"), *id)
+	}
+	if r.Action("age") == projection.Visible {
+		age := 0
+		if pnt.Age != nil {
+			a, err := strconv.Atoi(*pnt.Age)
+			if err != nil {
+				c.log.Warn(ctx, "compat patient: malformed age", logging.Err(err))
+			}
+			age = a
+		}
+		out.age = &age
+	}
+	return out
+}
+
+// projectString returns s as the action shows it, nil if it's omitted
+func projectString(a projection.Action, s string) *string {
+	switch a {
+	case projection.Omitted:
+		return nil
+	case projection.Masked:
+		s = projection.Mask(s)
+	}
+	return &s
+}
+
+func stricter(a, b projection.Action) projection.Action {
+	for _, x := range []projection.Action{projection.Omitted, projection.Masked} {
+		if a == x || b == x {
+			return x
+		}
+	}
+	return projection.Visible
+}
@@ -0,0 +1,319 @@
+// Package projection decides which fields of the patients, practitioners and establishments
+// each consumer sees in the api responses.
+//
+// a view is a consumer, a consumer with a role ("his-1/clerk"), a role of any consumer ("*/clerk")
+// or everyone ("*"). it gives each field of an entity, by its json name, an Action. "*" is the fields
+// it doesn't name. the entities a view doesn't list fall back to the broader views then to Defaults
+package projection
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// Action is what a view does with a field
+type Action string
+
+// actions of the fields
+const (
+	Visible Action = "visible"
+	// Masked fields are written with all but their last quarter replaced by *
+	Masked  Action = "masked"
+	Omitted Action = "omitted"
+)
+
+// entities of the views
+const (
+	Patient       = "patient"
+	Practitioner  = "practitioner"
+	Establishment = "establishment"
+	// Establishments is the list of GetEstablishments
+	Establishments = "establishments"
+)
+
+// wildcard is the fields or the consumers a view doesn't name
+const wildcard = "*"
+
+var (
+	ErrUnknownEntity = errors.New("entity is patient, practitioner, establishment or establishments")
+	ErrUnknownAction = errors.New("action is visible, masked or omitted")
+	ErrUnknownField  = errors.New("entity has no such field")
+)
+
+// types are the structs of the entities
+var types = map[string]reflect.Type{
+	Patient:        reflect.TypeOf(store.Patient{}),
+	Practitioner:   reflect.TypeOf(store.Practitioner{}),
+	Establishment:  reflect.TypeOf(store.Establishment{}),
+	Establishments: reflect.TypeOf(store.Establishment{}),
+}
+
+// Rules are the actions of the fields of an entity by json name, "*" is the fields it doesn't name
+type Rules map[string]Action
+
+// Action returns the action of the field, visible if r doesn't say
+func (r Rules) Action(field string) Action {
+	if a, ok := r[field]; ok {
+		return a
+	}
+	if a, ok := r[wildcard]; ok {
+		return a
+	}
+	return Visible
+}
+
+// Defaults are the rules of the entities no view lists. the list of establishments is the summary
+// the directory shows, the contacts, the people and the record keeping are only in the single one.
+// the commercial registration and the system it was synced from are in neither
+var Defaults = map[string]Rules{
+	Establishment: omit("cr_number", "cr_establishment_name", "source_system"),
+	Establishments: omit(
+		"id", "moh_id", "legacy_entity_id", "created_at", "updated_at", "deleted_at", "migrated", "deleted",
+		"cr_number", "cr_establishment_name", "source_system", "notification_email", "license_number",
+		"issue_date", "expiry_date", "map_url", "seha_health_directory",
+		"entity_type_ar", "entity_type_en", "entity_type_code", "website", "phone_number", "email",
+		"old_hls_entity_type", "old_hls_entity_id", "old_hls_speciality", "old_hls_speciality_id",
+		"new_hls_entity_type", "new_hls_entity_id", "new_hls_entity_type_code", "new_hls_speciality", "new_hls_speciality_id",
+		"hls_establishment_id", "hls_establishment_licence_id", "full_address", "address",
+		"address_building_number", "address_street_name", "address_block_number", "address_district_name",
+		"address_postal_code", "address_city", "owner_name", "system_manager_name_ar", "system_manager_id_number",
+		"system_manager_mobile_number", "system_manager_email", "technical_supervisor_name",
+		"technical_supervisor_category", "technical_supervisor_speciality", "technical_supervisor_license_expiry_date",
+		"administrative_director_name",
+	),
+}
+
+func omit(fields ...string) Rules {
+	r := make(Rules, len(fields))
+	for _, f := range fields {
+		r[f] = Omitted
+	}
+	return r
+}
+
+// Policy is the rules of each view
+type Policy struct {
+	views map[string]map[string]Rules
+}
+
+// NewPolicy reads the views from config, view -> entity -> field -> action
+func NewPolicy(conf map[string]map[string]map[string]string) (*Policy, error) {
+	p := &Policy{views: make(map[string]map[string]Rules, len(conf))}
+	for view, entities := range conf {
+		p.views[view] = make(map[string]Rules, len(entities))
+		for entity, fields := range entities {
+			typ, ok := types[entity]
+			if !ok {
+				return nil, fmt.Errorf("projection of %s: %w", view, ErrUnknownEntity)
+			}
+			known := make(map[string]bool)
+			for _, f := range fieldsOf(typ) {
+				known[f.name] = true
+			}
+			r := make(Rules, len(fields))
+			for field, action := range fields {
+				a := Action(strings.ToLower(strings.TrimSpace(action)))
+				if a != Visible && a != Masked && a != Omitted {
+					return nil, fmt.Errorf("projection of %s %s.%s: %w", view, entity, field, ErrUnknownAction)
+				}
+				if field != wildcard && !known[field] {
+					return nil, fmt.Errorf("projection of %s %s.%s: %w", view, entity, field, ErrUnknownField)
+				}
+				r[field] = a
+			}
+			p.views[view][entity] = r
+		}
+	}
+	return p, nil
+}
+
+// Rules returns the rules of the entity for the consumer with the role, from the narrowest view
+// that lists the entity. a nil policy has only the Defaults
+func (p *Policy) Rules(consumer, role, entity string) Rules {
+	if p != nil {
+		views := []string{consumer, wildcard}
+		if role != "" {
+			views = []string{consumer + "/" + role, consumer, wildcard + "/" + role, wildcard}
+		}
+		for _, v := range views {
+			if r, ok := p.views[v][entity]; ok {
+				return r
+			}
+		}
+	}
+	return Defaults[entity]
+}
+
+// field is a field of a struct as encoding/json writes it
+type field struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+// fieldsOf returns the fields encoding/json writes of the struct typ
+func fieldsOf(typ reflect.Type) []field {
+	var fields []field
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = f.Name
+		}
+		fl := field{index: i, name: name}
+		for _, o := range parts[1:] {
+			if o == "omitempty" {
+				fl.omitEmpty = true
+			}
+		}
+		fields = append(fields, fl)
+	}
+	return fields
+}
+
+// Object is a struct projected by Rules, it's written as a json object in the order of the fields
+type Object struct {
+	names  []string
+	values []json.RawMessage
+}
+
+// Get returns the json of the field, nil if it isn't written
+func (o *Object) Get(name string) json.RawMessage {
+	for i, n := range o.names {
+		if n == name {
+			return o.values[i]
+		}
+	}
+	return nil
+}
+
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, n := range o.names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(n)
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(o.values[i])
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Project returns the struct v, or what it points to, as r shows it
+func (r Rules) Project(v interface{}) (*Object, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("projection: can't project %T", v)
+	}
+	o := &Object{}
+	for _, f := range fieldsOf(rv.Type()) {
+		a := r.Action(f.name)
+		fv := rv.Field(f.index)
+		if a == Omitted || (f.omitEmpty && isEmpty(fv)) {
+			continue
+		}
+		raw, err := json.Marshal(fv.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("projection of %s: %w", f.name, err)
+		}
+		if a == Masked && string(raw) != "null" {
+			raw = mask(raw)
+		}
+		o.names = append(o.names, f.name)
+		o.values = append(o.values, raw)
+	}
+	return o, nil
+}
+
+// ProjectAll is Project for each element of the slice v, or what it points to
+func (r Rules) ProjectAll(v interface{}) ([]*Object, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("projection: can't project %T", v)
+	}
+	out := make([]*Object, rv.Len())
+	for i := range out {
+		o, err := r.Project(rv.Index(i).Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		out[i] = o
+	}
+	return out, nil
+}
+
+// Apply clears the omitted fields of the struct v points to and masks its masked strings,
+// the other masked fields are cleared. it's for the responses that copy the fields to their own shape
+func (r Rules) Apply(v interface{}) {
+	rv := reflect.ValueOf(v).Elem()
+	for _, f := range fieldsOf(rv.Type()) {
+		fv := rv.Field(f.index)
+		switch r.Action(f.name) {
+		case Omitted:
+			fv.Set(reflect.Zero(fv.Type()))
+		case Masked:
+			if fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Elem().Kind() == reflect.String {
+				s := Mask(fv.Elem().String())
+				fv.Set(reflect.ValueOf(&s))
+			} else {
+				fv.Set(reflect.Zero(fv.Type()))
+			}
+		}
+	}
+}
+
+// Mask replaces all but the last quarter of s by *, 0501234567 is ********67
+func Mask(s string) string {
+	r := []rune(s)
+	keep := len(r) / 4
+	return strings.Repeat("*", len(r)-keep) + string(r[len(r)-keep:])
+}
+
+// mask masks the json value raw, the values that aren't strings are masked as a whole
+func mask(raw json.RawMessage) json.RawMessage {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = strings.Repeat("*", 4)
+	} else {
+		s = Mask(s)
+	}
+	out, _ := json.Marshal(s)
+	return out
+}
+
+// isEmpty is the omitempty of encoding/json
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
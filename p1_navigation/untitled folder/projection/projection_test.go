@@ -0,0 +1,151 @@
+package projection
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		conf map[string]map[string]map[string]string
+		err  error
+	}{
+		{"ok", map[string]map[string]map[string]string{"*": {Patient: {"mobile_number": "Masked ", "*": "visible"}}}, nil},
+		{"unknown entity", map[string]map[string]map[string]string{"*": {"visit": {"id": "visible"}}}, ErrUnknownEntity},
+		{"unknown action", map[string]map[string]map[string]string{"*": {Patient: {"mobile_number": "hidden"}}}, ErrUnknownAction},
+		{"unknown field", map[string]map[string]map[string]string{"*": {Patient: {"mobile": "masked"}}}, ErrUnknownField},
+		{"hidden field", map[string]map[string]map[string]string{"*": {Patient: {"row_updated_at": "visible"}}}, ErrUnknownField},
+	}
+	for _, tt := range tests {
+		_, err := NewPolicy(tt.conf)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	p, err := NewPolicy(map[string]map[string]map[string]string{
+		"*":         {Patient: {"mobile_number": "masked"}},
+		"*/clerk":   {Patient: {"mobile_number": "omitted"}},
+		"his":       {Patient: {"id_number": "masked"}},
+		"his/nurse": {Patient: {"id_number": "omitted"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		p        *Policy
+		consumer string
+		role     string
+		entity   string
+		field    string
+		want     Action
+	}{
+		{"everyone", p, "lab", "", Patient, "mobile_number", Masked},
+		{"role of any consumer", p, "lab", "clerk", Patient, "mobile_number", Omitted},
+		{"consumer", p, "his", "", Patient, "id_number", Masked},
+		{"consumer over the role", p, "his", "clerk", Patient, "id_number", Masked},
+		{"consumer with the role", p, "his", "nurse", Patient, "id_number", Omitted},
+		{"the view doesn't name it", p, "his", "", Patient, "mobile_number", Visible},
+		{"no view", p, "his", "", Practitioner, "id_number", Visible},
+		{"default list", p, "his", "", Establishments, "phone_number", Omitted},
+		{"default list shows", p, "his", "", Establishments, "name_en", Visible},
+		{"default single", p, "his", "", Establishment, "cr_number", Omitted},
+		{"default single shows", p, "his", "", Establishment, "phone_number", Visible},
+		{"nil policy", nil, "his", "", Establishment, "source_system", Omitted},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Rules(tt.consumer, tt.role, tt.entity).Action(tt.field); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	pnt := &store.Patient{IDNumber: sp("1000000008"), FirstNameAr: sp("محمد"), MobileNumber: sp("0501234567")}
+	tests := []struct {
+		name  string
+		rules Rules
+		v     interface{}
+		want  string
+	}{
+		{"visible", nil, pnt, `{"id_number":"1000000008","first_name_ar":"محمد","mobile_number":"0501234567"}`},
+		{"masked", Rules{"mobile_number": Masked}, pnt, `{"id_number":"1000000008","first_name_ar":"محمد","mobile_number":"********67"}`},
+		{"omitted", Rules{"*": Omitted, "id_number": Visible}, *pnt, `{"id_number":"1000000008"}`},
+		{"masked date", Rules{"expiry_date": Masked, "*": Omitted}, &store.Establishment{ExpiryDate: &store.Date{Calendar: store.Gregorian, Year: 2030, Month: 1, Day: 31}},
+			`{"expiry_date":"********30"}`},
+		{"masked null", Rules{"id": Masked, "*": Omitted}, &store.Establishment{}, `{"id":null}`},
+		{"slice", Rules{"*": Omitted, "id_number": Masked}, []store.Patient{*pnt}, `[{"id_number":"********08"}]`},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		var err error
+		if _, ok := tt.v.([]store.Patient); ok {
+			got, err = tt.rules.ProjectAll(tt.v)
+		} else {
+			got, err = tt.rules.Project(tt.v)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		b, _ := json.Marshal(got)
+		if string(b) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, b, tt.want)
+		}
+	}
+	if _, err := Rules(nil).Project("1000000008"); err == nil {
+		t.Error("projected a string")
+	}
+}
+
+func TestApply(t *testing.T) {
+	est := store.Establishment{OrganizationID: sp("10001"), CRNumber: sp("1010101010"), PhoneNumber: sp("0111234567"),
+		NameEn: sp("Clinic"), ExpiryDate: &store.Date{Calendar: store.Gregorian, Year: 2030, Month: 1, Day: 31}}
+	Defaults[Establishment].Apply(&est)
+	Rules{"phone_number": Masked, "expiry_date": Masked}.Apply(&est)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"omitted", est.CRNumber, (*string)(nil)},
+		{"masked string", *est.PhoneNumber, "********67"},
+		{"masked date is cleared", est.ExpiryDate, (*store.Date)(nil)},
+		{"visible", *est.NameEn, "Clinic"},
+		{"key", *est.OrganizationID, "10001"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0501234567", "********67"},
+		{"محمد", "***د"},
+		{"abc", "***"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package pseudonym
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/logging"
+)
+
+// Admin is what the re-identification api needs, the controller implements it
+type Admin interface {
+	Reidentify(ctx context.Context, consumer, pseudonym, reason string) (*Mapping, error)
+}
+
+// Authenticator returns the principal the server authenticated the request as, the subject of
+// the verified token or of the client certificate, "" if it isn't authenticated.
+// it never reads a header the client sets e.g. X-Caller-ID
+type Authenticator func(r *http.Request) string
+
+// ClientCertificate is the Authenticator of the servers that verify the client certificates (mTLS),
+// the principal is the common name of the verified certificate
+func ClientCertificate(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// NewHandler returns the re-identification api logging to log, paths are relative to where it's mounted
+//
+//	POST /reidentify  {"consumer": "research-1", "pseudonym": "MFRGGZDFMZTWQ2LKNNWG", "reason": "adverse event follow up, ticket 4711"}
+//
+//	mux.Handle("/admin/pseudonyms/", http.StripPrefix("/admin/pseudonyms", pseudonym.NewHandler(admin, pseudonym.ClientCertificate, logger)))
+//
+// it's meant for the staff allowed to re-identify, a request auth doesn't authenticate is refused
+func NewHandler(a Admin, auth Authenticator, log *logging.Logger) http.Handler {
+	return &handler{a: a, auth: auth, log: log}
+}
+
+type handler struct {
+	a    Admin
+	auth Authenticator
+	log  *logging.Logger
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Trim(r.URL.Path, "/") != "reidentify" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.writeJSON(r.Context(), w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	var req struct {
+		Consumer  string `json:"consumer"`
+		Pseudonym string `json:"pseudonym"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(r.Context(), w, http.StatusBadRequest, map[string]string{"error": "malformed body"})
+		return
+	}
+	var principal string
+	if h.auth != nil {
+		principal = strings.TrimSpace(h.auth(r))
+	}
+	if principal == "" {
+		h.writeJSON(r.Context(), w, http.StatusUnauthorized, map[string]string{"error": ErrUnauthenticated.Error()})
+		return
+	}
+	m, err := h.a.Reidentify(WithPrincipal(r.Context(), principal), req.Consumer, req.Pseudonym, req.Reason)
+	if err != nil {
+		h.writeJSON(r.Context(), w, statusOf(err), map[string]string{"error": err.Error()})
+		return
+	}
+	h.writeJSON(r.Context(), w, http.StatusOK, m)
+}
+
+// statusOf maps the errors of Admin, errors that aren't the package's
+// are already generic e.g. the controller's
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrMissing), errors.Is(err, ErrNoReason):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnsupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *handler) writeJSON(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warn(ctx, "response not written", logging.Err(err))
+	}
+}
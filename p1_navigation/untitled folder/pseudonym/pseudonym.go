@@ -0,0 +1,132 @@
+// Package pseudonym replaces the national ids and the health ids of the patients by stable
+// pseudonyms for the analytics consumers.
+//
+// a pseudonym is the HMAC-SHA256 of the id with a key derived for the consumer, the same id
+// is the same pseudonym for a consumer and a different one for every other, so two partners
+// can't join their datasets. the pseudonyms issued are kept in a Store to re-identify them
+package pseudonym
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// kinds of the ids
+const (
+	// IDNumber is a national id, iqama or any id number of the patient e.g. the guardian id of a newborn
+	IDNumber = "id_number"
+	HealthID = "health_id"
+)
+
+// length of a pseudonym, 100 bits
+const length = 20
+
+var (
+	ErrNoKey       = errors.New("pseudonym key is empty")
+	ErrNotFound    = errors.New("pseudonym not issued to the consumer")
+	ErrUnsupported = errors.New("store doesn't keep the pseudonyms, they can't be re-identified")
+	// ErrUnauthenticated is a re-identification without an authenticated principal, see Authenticator
+	ErrUnauthenticated = errors.New("re-identification needs an authenticated principal")
+	// ErrForbidden is a principal that isn't allowed to re-identify
+	ErrForbidden = errors.New("caller may not re-identify pseudonyms")
+	ErrNoReason  = errors.New("re-identification needs a reason")
+	ErrMissing   = errors.New("consumer and pseudonym are required")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Mapping is a pseudonym issued to a consumer and the id it stands for
+type Mapping struct {
+	Consumer  string    `json:"consumer" db:"Consumer"`
+	Pseudonym string    `json:"pseudonym" db:"Pseudonym"`
+	Kind      string    `json:"kind" db:"Kind"`
+	Value     string    `json:"value" db:"Value"`
+	CreatedAt time.Time `json:"created_at" db:"CreatedAt"`
+}
+
+// Store keeps the pseudonyms issued, store/memory, store/sqlite and store/mssql implement it
+type Store interface {
+	// Put keeps m, a pseudonym already kept is left as is
+	Put(ctx context.Context, m *Mapping) error
+	// Get returns the mapping of the pseudonym of the consumer, ErrNotFound if it wasn't issued
+	Get(ctx context.Context, consumer, pseudonym string) (*Mapping, error)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns ctx carrying the authenticated principal asking to re-identify,
+// the handler sets it from its Authenticator
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal of ctx, "" if there's none
+func PrincipalFrom(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// Tokenizer issues the pseudonyms of the analytics consumers
+type Tokenizer struct {
+	key       []byte
+	consumers map[string]bool
+	s         Store
+}
+
+// New returns the tokenizer of the analytics consumers with the secret key,
+// s can be nil then the pseudonyms can't be re-identified
+func New(key []byte, consumers []string, s Store) (*Tokenizer, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	t := &Tokenizer{key: key, consumers: make(map[string]bool, len(consumers)), s: s}
+	for _, c := range consumers {
+		t.consumers[c] = true
+	}
+	return t, nil
+}
+
+// Analytics tells if the consumer gets pseudonyms instead of the ids
+func (t *Tokenizer) Analytics(consumer string) bool {
+	return t.consumers[consumer]
+}
+
+// Pseudonym returns the pseudonym of the id of the kind for the consumer
+func (t *Tokenizer) Pseudonym(consumer, kind, value string) string {
+	ck := hmac.New(sha256.New, t.key)
+	ck.Write([]byte(consumer))
+
+	mac := hmac.New(sha256.New, ck.Sum(nil))
+	mac.Write([]byte(kind + ":" + strings.ToUpper(strings.TrimSpace(value))))
+	return encoding.EncodeToString(mac.Sum(nil))[:length]
+}
+
+// Tokenize returns the pseudonym of the id for the consumer and keeps it to be re-identified
+func (t *Tokenizer) Tokenize(ctx context.Context, consumer, kind, value string) (string, error) {
+	p := t.Pseudonym(consumer, kind, value)
+	if t.s == nil {
+		return p, nil
+	}
+	m := &Mapping{Consumer: consumer, Pseudonym: p, Kind: kind, Value: strings.TrimSpace(value), CreatedAt: time.Now().UTC()}
+	if err := t.s.Put(ctx, m); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// Reidentify returns the id the pseudonym of the consumer stands for
+func (t *Tokenizer) Reidentify(ctx context.Context, consumer, pseudonym string) (*Mapping, error) {
+	consumer, pseudonym = strings.TrimSpace(consumer), strings.ToUpper(strings.TrimSpace(pseudonym))
+	if consumer == "" || pseudonym == "" {
+		return nil, ErrMissing
+	}
+	if t.s == nil {
+		return nil, ErrUnsupported
+	}
+	return t.s.Get(ctx, consumer, pseudonym)
+}
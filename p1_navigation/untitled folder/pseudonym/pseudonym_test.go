@@ -0,0 +1,147 @@
+package pseudonym
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeStore keeps the mappings in a map
+type fakeStore map[string]*Mapping
+
+func (s fakeStore) Put(ctx context.Context, m *Mapping) error {
+	if _, ok := s[m.Consumer+"/"+m.Pseudonym]; !ok {
+		s[m.Consumer+"/"+m.Pseudonym] = m
+	}
+	return nil
+}
+
+func (s fakeStore) Get(ctx context.Context, consumer, pseudonym string) (*Mapping, error) {
+	m, ok := s[consumer+"/"+pseudonym]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m, nil
+}
+
+func TestPseudonym(t *testing.T) {
+	if _, err := New(nil, []string{"research-1"}, nil); err != ErrNoKey {
+		t.Fatalf("no key: %v", err)
+	}
+	tok, _ := New([]byte("secret"), []string{"research-1", "research-2"}, nil)
+	p := tok.Pseudonym("research-1", IDNumber, "1000000008")
+	if len(p) != length || strings.Contains(p, "1000000008") {
+		t.Fatalf("pseudonym %s", p)
+	}
+
+	tests := []struct {
+		name     string
+		consumer string
+		kind     string
+		value    string
+		same     bool
+	}{
+		{"same id", "research-1", IDNumber, "1000000008", true},
+		{"spaces and case", "research-1", IDNumber, " 1000000008 ", true},
+		{"other consumer", "research-2", IDNumber, "1000000008", false},
+		{"other kind", "research-1", HealthID, "1000000008", false},
+		{"other id", "research-1", IDNumber, "2000000006", false},
+	}
+	for _, tt := range tests {
+		if got := tok.Pseudonym(tt.consumer, tt.kind, tt.value); (got == p) != tt.same {
+			t.Errorf("%s: got %s, first %s", tt.name, got, p)
+		}
+	}
+	if !tok.Analytics("research-1") || tok.Analytics("his-1") {
+		t.Error("analytics consumers")
+	}
+}
+
+func TestReidentify(t *testing.T) {
+	ctx := context.Background()
+	s := fakeStore{}
+	tok, _ := New([]byte("secret"), []string{"research-1"}, s)
+	p, err := tok.Tokenize(ctx, "research-1", HealthID, "ID00000000000017")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		tok       *Tokenizer
+		consumer  string
+		pseudonym string
+		want      string
+		err       error
+	}{
+		{"issued", tok, "research-1", p, "ID00000000000017", nil},
+		{"lower case", tok, " research-1", strings.ToLower(p), "ID00000000000017", nil},
+		{"other consumer", tok, "research-2", p, "", ErrNotFound},
+		{"missing", tok, "research-1", " ", "", ErrMissing},
+		{"no store", &Tokenizer{key: []byte("secret")}, "research-1", p, "", ErrUnsupported},
+	}
+	for _, tt := range tests {
+		m, err := tt.tok.Reidentify(ctx, tt.consumer, tt.pseudonym)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && (m.Value != tt.want || m.Kind != HealthID) {
+			t.Errorf("%s: got %+v", tt.name, m)
+		}
+	}
+}
+
+// admin returns the principal it was called with
+type admin struct {
+	principal string
+	err       error
+}
+
+func (a *admin) Reidentify(ctx context.Context, consumer, pseudonym, reason string) (*Mapping, error) {
+	a.principal = PrincipalFrom(ctx)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &Mapping{Consumer: consumer, Pseudonym: pseudonym, Kind: IDNumber, Value: "1000000008"}, nil
+}
+
+func TestHandler(t *testing.T) {
+	cert := func(r *http.Request) *http.Request {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "dpo-console"}}}}}
+		return r
+	}
+	header := func(r *http.Request) *http.Request {
+		r.Header.Set("X-Caller-ID", "dpo-console")
+		return r
+	}
+	body := `{"consumer":"research-1","pseudonym":"MFRGGZDFMZTWQ2LKNNWG","reason":"adverse event"}`
+
+	tests := []struct {
+		name      string
+		auth      Authenticator
+		req       func(*http.Request) *http.Request
+		err       error
+		code      int
+		principal string
+	}{
+		{"client certificate", ClientCertificate, cert, nil, http.StatusOK, "dpo-console"},
+		{"header only", ClientCertificate, header, nil, http.StatusUnauthorized, ""},
+		{"no authenticator", nil, cert, nil, http.StatusUnauthorized, ""},
+		{"token", func(*http.Request) string { return " dpo " }, header, nil, http.StatusOK, "dpo"},
+		{"forbidden", ClientCertificate, cert, ErrForbidden, http.StatusForbidden, "dpo-console"},
+		{"not found", ClientCertificate, cert, ErrNotFound, http.StatusNotFound, "dpo-console"},
+		{"no reason", ClientCertificate, cert, ErrNoReason, http.StatusBadRequest, "dpo-console"},
+	}
+	for _, tt := range tests {
+		a := &admin{err: tt.err}
+		rec := httptest.NewRecorder()
+		NewHandler(a, tt.auth, nil).ServeHTTP(rec, tt.req(httptest.NewRequest(http.MethodPost, "/reidentify", strings.NewReader(body))))
+		if rec.Code != tt.code || a.principal != tt.principal {
+			t.Errorf("%s: got %d %q, want %d %q: %s", tt.name, rec.Code, a.principal, tt.code, tt.principal, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package nhic
+
+import (
+	"context"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/config"
+	"gitlab.lean/leandevclan/nhic/logging"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// opReidentify is the audit operation of a re-identification
+const opReidentify = "reidentify"
+
+// pseudonymStore is implemented by the stores that keep the pseudonyms issued,
+// store/memory, store/sqlite and store/mssql
+type pseudonymStore interface {
+	Pseudonyms() pseudonym.Store
+}
+
+// newTokenizer returns the tokenizer of the analytics consumers of conf.Pseudonym,
+// nil if there are none. pseudonym.ErrUnsupported if there are reidentifiers and s doesn't keep them
+func newTokenizer(s Store, conf *config.Config) (*pseudonym.Tokenizer, error) {
+	if len(conf.Pseudonym.Consumers) == 0 {
+		return nil, nil
+	}
+	var vault pseudonym.Store
+	if ps, ok := s.(pseudonymStore); ok {
+		vault = ps.Pseudonyms()
+	} else if len(conf.Pseudonym.Reidentifiers) > 0 {
+		return nil, pseudonym.ErrUnsupported
+	}
+	return pseudonym.New([]byte(conf.Pseudonym.Key), conf.Pseudonym.Consumers, vault)
+}
+
+// pseudonymize returns the copy of pnt an analytics caller of ctx sees, the ids are replaced by
+// their pseudonyms and the other numbers are left out. pnt as is for the other callers
+func (c *Controller) pseudonymize(ctx context.Context, pnt *store.Patient) (*store.Patient, error) {
+	consumer := audit.FromContext(ctx).Caller
+	if c.pseudonyms == nil || !c.pseudonyms.Analytics(consumer) {
+		return pnt, nil
+	}
+
+	cp := *pnt
+	ids := []struct {
+		kind string
+		v    **string
+	}{
+		{pseudonym.IDNumber, &cp.IDNumber},
+		{pseudonym.IDNumber, &cp.GuardianID},
+		{pseudonym.HealthID, &cp.HealthID},
+		{pseudonym.HealthID, &cp.ReservedHealthID},
+	}
+	for _, id := range ids {
+		if *id.v == nil || strings.TrimSpace(**id.v) == "" {
+			continue
+		}
+		p, err := c.pseudonyms.Tokenize(ctx, consumer, id.kind, **id.v)
+		if cerr := ctxErr(ctx); err != nil && cerr != nil {
+			return nil, cerr
+		} else if err != nil {
+			// avoid leaking sensitive info
+			c.log.Error(ctx, "pseudonymize: tokenize failed", logging.Err(err))
+			return nil, ErrLookingUpInfo
+		}
+		*id.v = &p
+	}
+	cp.SearchID, cp.ClientIdentifierId, cp.TransactionID, cp.LogId = nil, nil, nil, nil
+	cp.PassportNumber, cp.BorderNumber, cp.VisaNumber, cp.HifizaNumber, cp.SponsorNumber = nil, nil, nil, nil, nil
+	return &cp, nil
+}
+
+// Reidentify returns the id the pseudonym issued to the consumer stands for. the authenticated principal
+// of ctx (pseudonym.WithPrincipal) has to be one of the reidentifiers in config and give the reason,
+// it's recorded in the audit trail. the caller of the audit.Access is a header, it isn't trusted here
+func (c *Controller) Reidentify(ctx context.Context, consumer, pseudo, reason string) (m *pseudonym.Mapping, err error) {
+	if c.pseudonyms == nil {
+		return nil, pseudonym.ErrUnsupported
+	}
+	principal := pseudonym.PrincipalFrom(ctx)
+	if principal == "" {
+		c.recordReidentify(ctx, "", audit.ResultDenied, consumer)
+		return nil, pseudonym.ErrUnauthenticated
+	}
+	if !c.reidentifiers[principal] {
+		c.recordReidentify(ctx, "", audit.ResultDenied, consumer)
+		return nil, pseudonym.ErrForbidden
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, pseudonym.ErrNoReason
+	}
+
+	m, err = c.pseudonyms.Reidentify(ctx, consumer, pseudo)
+	if cerr := ctxErr(ctx); err != nil && cerr != nil {
+		return nil, cerr
+	} else if err == pseudonym.ErrNotFound {
+		c.recordReidentify(ctx, "", audit.ResultNotFound, consumer+": "+reason)
+		return nil, err
+	} else if err != nil && err != pseudonym.ErrMissing && err != pseudonym.ErrUnsupported {
+		c.log.Error(ctx, "reidentify: lookup failed", logging.Err(err))
+		return nil, ErrLookingUpInfo
+	} else if err != nil {
+		return nil, err
+	}
+	c.recordReidentify(ctx, m.Value, audit.ResultFound, consumer+": "+reason)
+	return m, nil
+}
+
+// recordReidentify appends the re-identification of the id to the audit trail, by the principal
+func (c *Controller) recordReidentify(ctx context.Context, id, result, detail string) {
+	if c.audit == nil {
+		return
+	}
+	actx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+
+	a := audit.FromContext(ctx)
+	if p := pseudonym.PrincipalFrom(ctx); p != "" {
+		a.Caller = p
+	}
+	if _, aerr := c.audit.Record(actx, a, opReidentify, id, audit.SourcePseudonym, result, detail); aerr != nil {
+		c.log.Error(ctx, "audit event not recorded", logging.String("operation", opReidentify), logging.Err(aerr))
+	}
+}
+
+// PseudonymAdmin returns the controller as a pseudonym.Admin to mount pseudonym.NewHandler,
+// nil if there are no analytics consumers
+func (c *Controller) PseudonymAdmin() pseudonym.Admin {
+	if c.pseudonyms == nil {
+		return nil
+	}
+	return c
+}
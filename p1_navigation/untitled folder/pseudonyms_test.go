@@ -0,0 +1,102 @@
+package nhic
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+	"gitlab.lean/leandevclan/nhic/store"
+	"gitlab.lean/leandevclan/nhic/store/memory"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func TestCompatPseudonyms(t *testing.T) {
+	tok, err := pseudonym.New([]byte("secret"), []string{"research-1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{pseudonyms: tok}
+	analytics := audit.NewContext(context.Background(), audit.Access{Caller: "research-1"})
+	his := audit.NewContext(context.Background(), audit.Access{Caller: "his-1"})
+
+	tests := []struct {
+		name string
+		pq   *PatientQuery
+		pnt  *store.Patient
+	}{
+		{"citizen", &PatientQuery{ID: "1000000008"}, &store.Patient{IDNumber: sp("1000000008"), HealthID: sp("ID00000000000017")}},
+		{"expat", &PatientQuery{ID: "2000000006"}, &store.Patient{IDNumber: sp("2000000006"), HealthID: sp("ID00000000000017")}},
+		{"border", &PatientQuery{ID: "3012345678", IDType: string(IDTypeBorderNumber)},
+			&store.Patient{IDNumber: sp("3012345678"), BorderNumber: sp("3012345678"), PassportNumber: sp("A1234567")}},
+		{"gcc", &PatientQuery{ID: "784199012345671", IDType: string(IDTypeGCCID), Country: "ARE"},
+			&store.Patient{IDNumber: sp("784199012345671")}},
+		{"newborn", &PatientQuery{ID: "1000000008", IDType: string(IDTypeNewborn), BirthOrder: "1"},
+			&store.Patient{IDNumber: sp("NB-1000000008-20260101-1"), GuardianID: sp("1000000008")}},
+	}
+	for _, tt := range tests {
+		released, err := c.pseudonymize(analytics, tt.pnt)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, convert := range []func(context.Context, *PatientQuery, *store.Patient) ([]byte, error){c.Convert, c.Convertv2} {
+			b, err := convert(analytics, tt.pq, released)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			for _, raw := range []string{tt.pq.ID, "ID00000000000017", "A1234567"} {
+				if strings.Contains(string(b), raw) {
+					t.Errorf("%s: %s in %s", tt.name, raw, b)
+				}
+			}
+			if p := tok.Pseudonym("research-1", pseudonym.IDNumber, tt.pq.ID); !strings.Contains(string(b), p) {
+				t.Errorf("%s: no pseudonym %s in %s", tt.name, p, b)
+			}
+
+			// the other callers get the id of the query
+			b, _ = convert(his, tt.pq, tt.pnt)
+			if !strings.Contains(string(b), `"`+tt.pq.ID+`"`) {
+				t.Errorf("%s: no id in %s", tt.name, b)
+			}
+		}
+	}
+}
+
+func TestReidentifyPrincipal(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+	tok, err := pseudonym.New([]byte("secret"), []string{"research-1"}, s.Pseudonyms())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{store: s, pseudonyms: tok, reidentifiers: map[string]bool{"dpo": true}}
+	p, err := tok.Tokenize(ctx, "research-1", pseudonym.IDNumber, "1000000008")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the caller of the audit.Access is the X-Caller-ID header
+	header := audit.NewContext(ctx, audit.Access{Caller: "dpo"})
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"no principal", ctx, pseudonym.ErrUnauthenticated},
+		{"header only", header, pseudonym.ErrUnauthenticated},
+		{"other principal", pseudonym.WithPrincipal(header, "clerk"), pseudonym.ErrForbidden},
+		{"reidentifier", pseudonym.WithPrincipal(ctx, "dpo"), nil},
+	}
+	for _, tt := range tests {
+		m, err := c.Reidentify(tt.ctx, "research-1", p, "adverse event")
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && m.Value != "1000000008" {
+			t.Errorf("%s: got %+v", tt.name, m)
+		}
+	}
+}
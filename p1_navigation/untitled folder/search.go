@@ -0,0 +1,104 @@
+package store
+
+import "strings"
+
+// PatientSearch are the demographics patients are searched by, at least a name
+// or the birth date is set. the names match the start of a word of the arabic
+// or english name ignoring the case
+type PatientSearch struct {
+	Family string
+	// Given matches the first, second or third name
+	Given     string
+	BirthDate *Date
+	// Gender is "male" or "female", the stores write it in many ways, see genders
+	Gender string
+	// Limit is the most patients returned, 0 is no limit
+	Limit int
+}
+
+// genders are the ways yakeen, nic and the gateway write the gender
+var genders = map[string][]string{
+	"male":   {"m", "male", "1", "ذكر"},
+	"female": {"f", "female", "2", "أنثى"},
+}
+
+// GenderValues returns the ways gender is stored, gender is "male" or "female"
+func GenderValues(gender string) []string {
+	return genders[strings.ToLower(gender)]
+}
+
+// Valid tells if there's something to search by
+func (q *PatientSearch) Valid() bool {
+	if q.Gender != "" && GenderValues(q.Gender) == nil {
+		return false
+	}
+	return strings.TrimSpace(q.Family) != "" || strings.TrimSpace(q.Given) != "" ||
+		(q.BirthDate != nil && !q.BirthDate.IsZero())
+}
+
+// BirthDates are the birth date in both calendars,
+// the hijri one is missing out of the umm al-qura table
+func (q *PatientSearch) BirthDates() []Date {
+	if q.BirthDate == nil || q.BirthDate.IsZero() {
+		return nil
+	}
+	var dates []Date
+	if g, err := q.BirthDate.Gregorian(); err == nil {
+		dates = append(dates, g)
+	}
+	if h, err := q.BirthDate.Hijri(); err == nil {
+		dates = append(dates, h)
+	}
+	return dates
+}
+
+// Matches tells if pnt matches q, for the stores that don't search with sql
+func (q *PatientSearch) Matches(pnt *Patient) bool {
+	if q.Family != "" && !hasWordPrefix(q.Family, pnt.LastNameAr, pnt.LastNameEn) {
+		return false
+	}
+	if q.Given != "" && !hasWordPrefix(q.Given, pnt.FirstNameAr, pnt.SecondNameAr, pnt.ThirdNameAr,
+		pnt.FirstNameEn, pnt.SecondNameEn, pnt.ThirdNameEn) {
+		return false
+	}
+	if dates := q.BirthDates(); dates != nil {
+		found := false
+		for _, d := range dates {
+			for _, b := range []*Date{pnt.DateOfBirthG, pnt.DateOfBirthH} {
+				if b != nil && *b == d {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Gender != "" {
+		found := false
+		for _, g := range GenderValues(q.Gender) {
+			if pnt.Gender != nil && strings.EqualFold(strings.TrimSpace(*pnt.Gender), g) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWordPrefix tells if a word of one of the values starts with s, ignoring the case
+func hasWordPrefix(s string, values ...*string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		lv := strings.ToLower(*v)
+		if strings.HasPrefix(lv, s) || strings.Contains(lv, " "+s) {
+			return true
+		}
+	}
+	return false
+}
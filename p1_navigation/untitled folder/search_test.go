@@ -0,0 +1,38 @@
+package store
+
+import "testing"
+
+func TestPatientSearch(t *testing.T) {
+	sp := func(s string) *string { return &s }
+	hijri := Date{Hijri, 1405, 7, 15}
+	pnt := &Patient{FirstNameAr: sp("علي"), LastNameAr: sp("آل سعود"), FirstNameEn: sp("Ali"), SecondNameEn: sp("Mohammed"),
+		LastNameEn: sp("Al Saud"), Gender: sp(" M "), DateOfBirthH: &hijri}
+
+	tests := []struct {
+		name    string
+		q       PatientSearch
+		valid   bool
+		matches bool
+	}{
+		{"family", PatientSearch{Family: "saud"}, true, true},
+		{"start of the family name", PatientSearch{Family: "al s"}, true, true},
+		{"arabic family name", PatientSearch{Family: "سعود"}, true, true},
+		{"middle of a word", PatientSearch{Family: "aud"}, true, false},
+		{"second name", PatientSearch{Given: "moh"}, true, true},
+		{"gregorian birth date of a hijri one", PatientSearch{BirthDate: &Date{Gregorian, 1985, 4, 6}}, true, true},
+		{"other birth date", PatientSearch{BirthDate: &Date{Gregorian, 1985, 4, 7}}, true, false},
+		{"gender", PatientSearch{Given: "ali", Gender: "male"}, true, true},
+		{"other gender", PatientSearch{Given: "ali", Gender: "female"}, true, false},
+		{"gender alone", PatientSearch{Gender: "male"}, false, true},
+		{"unknown gender", PatientSearch{Given: "ali", Gender: "x"}, false, false},
+		{"blank", PatientSearch{Family: " "}, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.Valid(); got != tt.valid {
+			t.Errorf("%s: valid %v, want %v", tt.name, got, tt.valid)
+		}
+		if got := tt.q.Matches(pnt); tt.valid && got != tt.matches {
+			t.Errorf("%s: matches %v, want %v", tt.name, got, tt.matches)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+)
+
+// auditTrail implements audit.Store, it has its own lock like healthIDs.
+// events[i] has the Seq i+1
+type auditTrail struct {
+	mu          sync.Mutex
+	events      []audit.Event
+	checkpoints []audit.Checkpoint
+}
+
+func (t *auditTrail) Append(ctx context.Context, e *audit.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e.Seq != int64(len(t.events)+1) {
+		return audit.ErrConflict
+	}
+	t.events = append(t.events, *e)
+	return nil
+}
+
+func (t *auditTrail) Query(ctx context.Context, f *audit.Filter) ([]audit.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := []audit.Event{}
+	skip, limit := f.Offset, f.Limit()
+	// latest first
+	for i := len(t.events) - 1; i >= 0 && len(list) < limit; i-- {
+		if !f.Matches(&t.events[i]) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		list = append(list, t.events[i])
+	}
+	return list, nil
+}
+
+func (t *auditTrail) Last(ctx context.Context) (*audit.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.events) == 0 {
+		return nil, nil
+	}
+	e := t.events[len(t.events)-1]
+	return &e, nil
+}
+
+func (t *auditTrail) Range(ctx context.Context, after int64, n int) ([]audit.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := sort.Search(len(t.events), func(i int) bool { return t.events[i].Seq > after })
+	end := i + n
+	if end > len(t.events) {
+		end = len(t.events)
+	}
+	return append([]audit.Event{}, t.events[i:end]...), nil
+}
+
+func (t *auditTrail) AddCheckpoint(ctx context.Context, cp *audit.Checkpoint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.checkpoints = append(t.checkpoints, *cp)
+	return nil
+}
+
+func (t *auditTrail) Checkpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]audit.Checkpoint{}, t.checkpoints...), nil
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.lean/leandevclan/nhic/consent"
+)
+
+// consents implements consent.Store, it has its own lock like healthIDs
+type consents struct {
+	mu         sync.Mutex
+	directives map[string][]consent.Directive
+}
+
+func newConsents() *consents {
+	return &consents{directives: make(map[string][]consent.Directive)}
+}
+
+func (c *consents) Directives(ctx context.Context, idNumber string) ([]consent.Directive, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]consent.Directive{}, c.directives[idNumber]...), nil
+}
+
+func (c *consents) AddDirective(ctx context.Context, d *consent.Directive) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp := *d
+	cp.Categories = append(consent.CategoryList{}, d.Categories...)
+	c.directives[d.IDNumber] = append(c.directives[d.IDNumber], cp)
+	return nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"gitlab.lean/leandevclan/nhic/match"
+)
+
+// duplicates implements match.Store, it has its own lock like healthIDs
+type duplicates struct {
+	mu         sync.Mutex
+	candidates map[string]*match.Candidate
+}
+
+func newDuplicates() *duplicates {
+	return &duplicates{candidates: make(map[string]*match.Candidate)}
+}
+
+func (d *duplicates) Get(ctx context.Context, id string) (*match.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.candidates[id]
+	if !ok {
+		return nil, match.ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (d *duplicates) List(ctx context.Context, status match.Status) ([]match.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	list := []match.Candidate{}
+	for _, c := range d.candidates {
+		if status == "" || c.Status == status {
+			list = append(list, *c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (d *duplicates) Put(ctx context.Context, c *match.Candidate) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old, ok := d.candidates[c.ID]
+	if ok && old.Status != match.Pending {
+		return false, nil
+	}
+	cp := *c
+	if ok {
+		cp.CreatedAt = old.CreatedAt
+	}
+	d.candidates[c.ID] = &cp
+	return true, nil
+}
+
+func (d *duplicates) Resolve(ctx context.Context, c *match.Candidate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old, ok := d.candidates[c.ID]
+	if !ok {
+		return match.ErrNotFound
+	}
+	if old.Status != match.Pending {
+		return match.ErrState
+	}
+	cp := *c
+	d.candidates[c.ID] = &cp
+	return nil
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.lean/leandevclan/nhic/healthid"
+)
+
+// healthIDs implements healthid.Store, it has its own lock
+// so the Store can reserve while holding its own
+type healthIDs struct {
+	mu sync.Mutex
+
+	// last issued sequence number
+	seq     int64
+	records map[string]*healthid.Record
+	// reserved or bound health id of each id number
+	active map[string]string
+}
+
+func newHealthIDs() *healthIDs {
+	return &healthIDs{
+		seq:     healthid.SeqStart,
+		records: make(map[string]*healthid.Record),
+		active:  make(map[string]string),
+	}
+}
+
+func (h *healthIDs) Get(ctx context.Context, healthID string) (*healthid.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.records[healthID]
+	if !ok {
+		return nil, healthid.ErrNotFound
+	}
+	cp := *r
+	return &cp, nil
+}
+
+func (h *healthIDs) ByIDNumber(ctx context.Context, idNumber string) (*healthid.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id, ok := h.active[idNumber]
+	if !ok {
+		return nil, healthid.ErrNotFound
+	}
+	cp := *h.records[id]
+	return &cp, nil
+}
+
+func (h *healthIDs) NextSeq(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	return h.seq, nil
+}
+
+func (h *healthIDs) Insert(ctx context.Context, r *healthid.Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.records[r.HealthID]; ok {
+		return healthid.ErrConflict
+	}
+	if _, ok := h.active[r.IDNumber]; ok && r.State != healthid.Released {
+		return healthid.ErrConflict
+	}
+	h.put(r)
+	return nil
+}
+
+func (h *healthIDs) Transition(ctx context.Context, from healthid.State, r *healthid.Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old, ok := h.records[r.HealthID]
+	if !ok || old.State != from {
+		return healthid.ErrState
+	}
+	if id, ok := h.active[r.IDNumber]; ok && id != r.HealthID && r.State != healthid.Released {
+		return healthid.ErrConflict
+	}
+	if from != healthid.Released {
+		delete(h.active, old.IDNumber)
+	}
+	h.put(r)
+	return nil
+}
+
+// put stores a copy of r, callers must hold the lock
+func (h *healthIDs) put(r *healthid.Record) {
+	cp := *r
+	h.records[cp.HealthID] = &cp
+	if cp.State != healthid.Released {
+		h.active[cp.IDNumber] = cp.HealthID
+	}
+}
@@ -0,0 +1,625 @@
+// Package memory is an in-memory store that behaves like the MSSQL store,
+// it's meant for tests and local development, data is lost on exit
+package memory
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/consent"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/match"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// same layout SQL Server returns datetime columns with
+const timeLayout = "2006-01-02 15:04:05.000"
+
+// Store keeps the records in maps keyed by id number,
+// practitioners and establishments are soft deleted like in the db
+type Store struct {
+	mu sync.RWMutex
+
+	patients         map[string]*store.Patient
+	practitioners    map[string]*store.Practitioner
+	establishments   map[string]*store.Establishment
+	establishmentsV2 map[string]*store.EstablishmentV2
+	countries        map[string]*store.ISOCode
+	// merged id numbers to the health id of the survivor
+	aliases map[string]string
+
+	ids        *healthid.Allocator
+	duplicates *duplicates
+	audit      *auditTrail
+	consents   *consents
+	pseudonyms *pseudonyms
+	// last practitioner row id
+	practSeq int
+
+	now func() time.Time
+}
+
+// New returns an empty Store
+func New() *Store {
+	return &Store{
+		patients:         make(map[string]*store.Patient),
+		aliases:          make(map[string]string),
+		practitioners:    make(map[string]*store.Practitioner),
+		establishments:   make(map[string]*store.Establishment),
+		establishmentsV2: make(map[string]*store.EstablishmentV2),
+		countries:        make(map[string]*store.ISOCode),
+		ids:              healthid.New(newHealthIDs()),
+		duplicates:       newDuplicates(),
+		audit:            &auditTrail{},
+		consents:         newConsents(),
+		pseudonyms:       newPseudonyms(),
+		now:              time.Now,
+	}
+}
+
+// HealthIDs returns the allocator of the health ids
+func (s *Store) HealthIDs() *healthid.Allocator {
+	return s.ids
+}
+
+// Duplicates returns the review queue of the duplicate patients
+func (s *Store) Duplicates() match.Store {
+	return s.duplicates
+}
+
+// Audit returns the access trail, it only appends
+func (s *Store) Audit() audit.Store {
+	return s.audit
+}
+
+// Consents returns the consent directives of the patients
+func (s *Store) Consents() consent.Store {
+	return s.consents
+}
+
+// Pseudonyms returns the pseudonyms issued to the analytics consumers
+func (s *Store) Pseudonyms() pseudonym.Store {
+	return s.pseudonyms
+}
+
+// GetPatient returns the patient with the id number.
+// if not found it returns a patient with a reserved health id and store.ErrNotFound
+func (s *Store) GetPatient(ctx context.Context, id, birthDate string) (*store.Patient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pnt, ok := s.patients[id]; ok {
+		cp := *pnt
+		return &cp, nil
+	}
+	// a merged id number returns the patient it was merged into
+	if pnt := s.byHealthID(s.aliases[id]); pnt != nil {
+		cp := *pnt
+		return &cp, nil
+	}
+
+	reserved, err := s.ids.Reserve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &store.Patient{ReservedHealthID: &reserved}, store.ErrNotFound
+}
+
+// GetPatientByID returns the patient with the id number or store.ErrNotFound
+func (s *Store) GetPatientByID(ctx context.Context, id string) (*store.Patient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pnt, ok := s.patients[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	cp := *pnt
+	return &cp, nil
+}
+
+// AddPatient adds the patient, it gets the health id reserved for it by GetPatient
+// or a new one and binds it, adding an existing patient updates it
+func (s *Store) AddPatient(ctx context.Context, pnt *store.Patient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pnt.IDNumber == nil || *pnt.IDNumber == "" {
+		return store.ErrSearch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().Format(timeLayout)
+	if old, ok := s.patients[*pnt.IDNumber]; ok {
+		copyFields(old, pnt, true)
+		old.RowUpdatedAt = &now
+		return nil
+	}
+
+	cp := *pnt
+	cp.RowUpdatedAt = &now
+	if cp.HealthID == nil {
+		cp.HealthID = cp.ReservedHealthID
+	}
+	if cp.HealthID == nil {
+		reserved, err := s.ids.Reserve(ctx, *cp.IDNumber)
+		if err != nil {
+			return err
+		}
+		cp.HealthID = &reserved
+	}
+	if err := s.ids.Bind(ctx, *cp.HealthID, *cp.IDNumber); err != nil {
+		return err
+	}
+	cp.ReservedHealthID = nil
+	s.patients[*cp.IDNumber] = &cp
+	return nil
+}
+
+// DeletePatient removes the patient e.g. after its health id was released,
+// unlike practitioners patients aren't soft deleted
+func (s *Store) DeletePatient(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.patients[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.patients, id)
+	return nil
+}
+
+// MergePatient removes the patient merged into the one with the health id and keeps its id number
+// as an alias, GetPatient of the id number returns the survivor instead of adding it again
+func (s *Store) MergePatient(ctx context.Context, id, healthID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.patients[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	delete(s.patients, id)
+	s.aliases[id] = healthID
+	// the id numbers merged into the removed patient follow it
+	if old.HealthID != nil && *old.HealthID != healthID {
+		for alias, to := range s.aliases {
+			if to == *old.HealthID {
+				s.aliases[alias] = healthID
+			}
+		}
+	}
+	return nil
+}
+
+// byHealthID returns the patient with the health id having the lowest id number
+func (s *Store) byHealthID(healthID string) *store.Patient {
+	if healthID == "" {
+		return nil
+	}
+	for _, id := range sortedKeys(s.patients) {
+		if pnt := s.patients[id]; pnt.HealthID != nil && *pnt.HealthID == healthID {
+			return pnt
+		}
+	}
+	return nil
+}
+
+// SearchPatients returns the patients matching q ordered by id number
+func (s *Store) SearchPatients(ctx context.Context, q *store.PatientSearch) (*[]store.Patient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !q.Valid() {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pnts := []store.Patient{}
+	for _, id := range sortedKeys(s.patients) {
+		if q.Limit > 0 && len(pnts) == q.Limit {
+			break
+		}
+		if pnt := s.patients[id]; q.Matches(pnt) {
+			pnts = append(pnts, *pnt)
+		}
+	}
+	return &pnts, nil
+}
+
+// ListPatients returns all the patients ordered by id number
+func (s *Store) ListPatients(ctx context.Context) (*[]store.Patient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pnts := make([]store.Patient, 0, len(s.patients))
+	for _, id := range sortedKeys(s.patients) {
+		pnts = append(pnts, *s.patients[id])
+	}
+	return &pnts, nil
+}
+
+// UpdatesPatient updates the fields set in pnt
+func (s *Store) UpdatesPatient(ctx context.Context, pnt *store.Patient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pnt.IDNumber == nil || *pnt.IDNumber == "" {
+		return store.ErrSearch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.patients[*pnt.IDNumber]
+	if !ok {
+		return store.ErrNotFound
+	}
+	copyFields(old, pnt, true)
+	now := s.now().Format(timeLayout)
+	old.RowUpdatedAt = &now
+	return nil
+}
+
+// GetPractitioner returns the practitioner with the id number.
+// if not found it returns a practitioner with a reserved health id and store.ErrNotFound
+func (s *Store) GetPractitioner(ctx context.Context, id string) (*store.Practitioner, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pract, ok := s.practitioners[id]; ok && !isDeleted(pract.IsDelted) {
+		cp := *pract
+		return &cp, nil
+	}
+
+	reserved, err := s.ids.Reserve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &store.Practitioner{HealthID: &reserved}, store.ErrNotFound
+}
+
+// ListPractitioners returns the practitioners that aren't deleted ordered by id number
+func (s *Store) ListPractitioners(ctx context.Context) (*[]store.Practitioner, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	practs := []store.Practitioner{}
+	for _, id := range sortedKeys(s.practitioners) {
+		if pract := s.practitioners[id]; !isDeleted(pract.IsDelted) {
+			practs = append(practs, *pract)
+		}
+	}
+	return &practs, nil
+}
+
+// AddPractitioner adds the practitioner, adding an existing practitioner updates it,
+// adding a deleted practitioner replaces the deleted row
+func (s *Store) AddPractitioner(ctx context.Context, pract *store.Practitioner) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pract.IDNumber == nil || *pract.IDNumber == "" {
+		return store.ErrSearch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().Format(timeLayout)
+	if old, ok := s.practitioners[*pract.IDNumber]; ok && !isDeleted(old.IsDelted) {
+		copyFields(old, pract, true)
+		old.RowUpdatedAt = &now
+		return nil
+	}
+
+	cp := *pract
+	if cp.HealthID != nil {
+		if err := s.ids.Bind(ctx, *cp.HealthID, *cp.IDNumber); err != nil {
+			return err
+		}
+	}
+	s.practSeq++
+	cp.ID = s.practSeq
+	if cp.PractitionerID == nil {
+		cp.PractitionerID = cp.HealthID
+	}
+	notDeleted := "0"
+	cp.IsDelted = &notDeleted
+	cp.RowInseartedAt = &now
+	cp.RowUpdatedAt = &now
+	cp.RowDeletedAt = nil
+	s.practitioners[*cp.IDNumber] = &cp
+	return nil
+}
+
+// DeletePractitioner soft deletes the practitioner
+func (s *Store) DeletePractitioner(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pract, ok := s.practitioners[id]
+	if !ok || isDeleted(pract.IsDelted) {
+		return store.ErrNotFound
+	}
+	now := s.now().Format(timeLayout)
+	deleted := "1"
+	pract.IsDelted = &deleted
+	pract.RowDeletedAt = &now
+	pract.RowUpdatedAt = &now
+	return nil
+}
+
+// GetEstablishment returns the establishment with the organization id
+func (s *Store) GetEstablishment(ctx context.Context, id string) (*store.Establishment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	est, ok := s.establishments[id]
+	if !ok || isDeleted(est.IsDeleted) {
+		return nil, store.ErrNotFound
+	}
+	cp := *est
+	return &cp, nil
+}
+
+// GetEstablishmentV2 returns the establishment with the organization id
+func (s *Store) GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	est, ok := s.establishmentsV2[id]
+	if !ok || isDeleted(est.IsDeleted) {
+		return nil, store.ErrNotFound
+	}
+	cp := *est
+	return &cp, nil
+}
+
+// GetEstablishments returns all the establishments that aren't deleted ordered by organization id
+func (s *Store) GetEstablishments(ctx context.Context) (*[]store.Establishments, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ests := make([]store.Establishments, 0, len(s.establishments))
+	for _, id := range sortedKeys(s.establishments) {
+		est := s.establishments[id]
+		if isDeleted(est.IsDeleted) {
+			continue
+		}
+		ests = append(ests, *est)
+	}
+	return &ests, nil
+}
+
+// GetEstablishmentsV2 returns all the establishments that aren't deleted ordered by organization id
+func (s *Store) GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ests := make([]store.EstablishmentV2, 0, len(s.establishmentsV2))
+	for _, id := range sortedKeys(s.establishmentsV2) {
+		est := s.establishmentsV2[id]
+		if isDeleted(est.IsDeleted) {
+			continue
+		}
+		ests = append(ests, *est)
+	}
+	return &ests, nil
+}
+
+// UpdateGovEstablishment adds the establishment or updates the fields set in est
+func (s *Store) UpdateGovEstablishment(ctx context.Context, est *store.Establishment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := est.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().Format(timeLayout)
+	if old, ok := s.establishments[*est.OrganizationID]; ok && !isDeleted(old.IsDeleted) {
+		copyFields(old, est, true)
+		old.RowUpdatedAt = &now
+		return nil
+	}
+
+	cp := *est
+	notDeleted := "0"
+	cp.IsDeleted = &notDeleted
+	cp.RowInsertedAt = &now
+	cp.RowUpdatedAt = &now
+	cp.RowDeletedAt = nil
+	s.establishments[*cp.OrganizationID] = &cp
+	return nil
+}
+
+// AddEstablishmentV2 adds or replaces the establishment
+func (s *Store) AddEstablishmentV2(ctx context.Context, est *store.EstablishmentV2) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if est.OrganizationID == nil {
+		return store.ErrEmptyOrganizationID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *est
+	notDeleted := "0"
+	cp.IsDeleted = &notDeleted
+	s.establishmentsV2[*cp.OrganizationID] = &cp
+	return nil
+}
+
+// DeleteEstablishment soft deletes the establishment and its v2 row
+func (s *Store) DeleteEstablishment(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	est, ok := s.establishments[id]
+	if !ok || isDeleted(est.IsDeleted) {
+		return store.ErrNotFound
+	}
+	now := s.now().Format(timeLayout)
+	deleted := "1"
+	est.IsDeleted = &deleted
+	est.RowDeletedAt = &now
+	est.RowUpdatedAt = &now
+	if v2, ok := s.establishmentsV2[id]; ok {
+		v2.IsDeleted = &deleted
+	}
+	return nil
+}
+
+// GetCountryIsoCode returns the country of the nationality,
+// nationality can be the name used by Yakeen or the english name
+func (s *Store) GetCountryIsoCode(ctx context.Context, nationality *string) (*store.ISOCode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if nationality == nil {
+		return nil, store.ErrSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	iso, ok := s.countries[strings.TrimSpace(*nationality)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	cp := *iso
+	return &cp, nil
+}
+
+// AddCountry maps nationality to its iso alpha 3 code and english name
+func (s *Store) AddCountry(nationality, code, nameEn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iso := &store.ISOCode{Code: &code, CountryNameEn: &nameEn}
+	s.countries[nationality] = iso
+	s.countries[nameEn] = iso
+}
+
+// isDeleted reads IsDeleted the way it comes from the db, bit as 1/0 or true/false
+func isDeleted(v *string) bool {
+	return v != nil && (*v == "1" || strings.EqualFold(*v, "true"))
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copyFields copies the fields of src to the fields with the same name and type in dst,
+// both are pointers to structs. if skipNil, nil fields of src don't overwrite dst
+func copyFields(dst, src interface{}, skipNil bool) {
+	d := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	for i := 0; i < sv.NumField(); i++ {
+		name := sv.Type().Field(i).Name
+		f := sv.Field(i)
+		df := d.FieldByName(name)
+		if !df.IsValid() || df.Type() != f.Type() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if skipNil && f.IsNil() {
+				continue
+			}
+		case reflect.Int:
+			if skipNil && f.Int() == 0 {
+				continue
+			}
+		}
+		df.Set(f)
+	}
+}
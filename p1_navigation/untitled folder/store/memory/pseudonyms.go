@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+)
+
+// pseudonyms implements pseudonym.Store, it has its own lock like healthIDs
+type pseudonyms struct {
+	mu sync.Mutex
+	// by consumer and pseudonym
+	issued map[[2]string]pseudonym.Mapping
+}
+
+func newPseudonyms() *pseudonyms {
+	return &pseudonyms{issued: make(map[[2]string]pseudonym.Mapping)}
+}
+
+func (p *pseudonyms) Put(ctx context.Context, m *pseudonym.Mapping) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := [2]string{m.Consumer, m.Pseudonym}
+	if _, ok := p.issued[key]; !ok {
+		p.issued[key] = *m
+	}
+	return nil
+}
+
+func (p *pseudonyms) Get(ctx context.Context, consumer, pseudo string) (*pseudonym.Mapping, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.issued[[2]string{consumer, pseudo}]
+	if !ok {
+		return nil, pseudonym.ErrNotFound
+	}
+	return &m, nil
+}
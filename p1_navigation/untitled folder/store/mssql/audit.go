@@ -0,0 +1,122 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/audit"
+)
+
+const (
+	tableAuditEvents      = "Audit.Events"
+	tableAuditCheckpoints = "Audit.Checkpoints"
+)
+
+// auditTrail implements audit.Store on Audit.Events and Audit.Checkpoints,
+// the tables and the triggers rejecting the updates and deletes of their rows
+// are in migrations/004_audit.sql
+type auditTrail struct {
+	db *sqlx.DB
+}
+
+func (t *auditTrail) Append(ctx context.Context, e *audit.Event) error {
+	// only the next Seq is inserted, the range lock keeps two writers from both reading the same last Seq.
+	// if they do anyway the primary key rejects the second one
+	res, err := t.db.ExecContext(ctx, t.db.Rebind(`INSERT INTO `+tableAuditEvents+`
+		(Seq, Time, Caller, Purpose, CorrelationID, Operation, IDHash, Source, Result, Detail, PrevHash, Hash)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE ? = (SELECT COALESCE(MAX(Seq), 0) + 1 FROM `+tableAuditEvents+` WITH (UPDLOCK, HOLDLOCK))`),
+		e.Seq, e.Time, e.Caller, e.Purpose, e.CorrelationID, e.Operation, e.IDHash, e.Source, e.Result, e.Detail,
+		e.PrevHash, e.Hash, e.Seq)
+	if isDuplicateKey(err) {
+		return audit.ErrConflict
+	} else if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return audit.ErrConflict
+	}
+	return nil
+}
+
+func (t *auditTrail) Last(ctx context.Context) (*audit.Event, error) {
+	e := &audit.Event{}
+	err := t.db.GetContext(ctx, e, `SELECT TOP 1 * FROM `+tableAuditEvents+` ORDER BY Seq DESC`)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (t *auditTrail) Range(ctx context.Context, after int64, n int) ([]audit.Event, error) {
+	list := []audit.Event{}
+	err := t.db.SelectContext(ctx, &list, t.db.Rebind(`SELECT TOP (?) * FROM `+tableAuditEvents+`
+		WHERE Seq > ? ORDER BY Seq`), n, after)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *auditTrail) AddCheckpoint(ctx context.Context, cp *audit.Checkpoint) error {
+	_, err := t.db.ExecContext(ctx, t.db.Rebind(`INSERT INTO `+tableAuditCheckpoints+` (Seq, Hash, Time, Signature)
+		VALUES (?, ?, ?, ?)`), cp.Seq, cp.Hash, cp.Time, cp.Signature)
+	return err
+}
+
+func (t *auditTrail) Checkpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	list := []audit.Checkpoint{}
+	err := t.db.SelectContext(ctx, &list, `SELECT Seq, Hash, Time, Signature FROM `+tableAuditCheckpoints+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *auditTrail) Query(ctx context.Context, f *audit.Filter) ([]audit.Event, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, c := range []struct {
+		col string
+		v   string
+	}{
+		{"Caller", f.Caller}, {"Purpose", f.Purpose}, {"CorrelationID", f.CorrelationID},
+		{"Operation", f.Operation}, {"IDHash", f.IDHash}, {"Source", f.Source}, {"Result", f.Result},
+	} {
+		if c.v != "" {
+			where = append(where, c.col+" = ?")
+			args = append(args, c.v)
+		}
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "Time >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "Time < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	query := `SELECT * FROM ` + tableAuditEvents
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY Seq DESC OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
+	args = append(args, f.Offset, f.Limit())
+
+	list := []audit.Event{}
+	if err := t.db.SelectContext(ctx, &list, t.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
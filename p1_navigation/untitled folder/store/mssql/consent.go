@@ -0,0 +1,33 @@
+package mssql
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/consent"
+)
+
+const tableConsents = "Individual.ConsentDirectives"
+
+// consents implements consent.Store on ConsentDirectives,
+// the table is in migrations/005_consent.sql
+type consents struct {
+	db *sqlx.DB
+}
+
+func (c *consents) Directives(ctx context.Context, idNumber string) ([]consent.Directive, error) {
+	list := []consent.Directive{}
+	err := c.db.SelectContext(ctx, &list, c.db.Rebind(`SELECT IDNumber, Purpose, Caller, Categories, Reason, CreatedAt
+		FROM `+tableConsents+` WHERE IDNumber = ? ORDER BY id`), idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *consents) AddDirective(ctx context.Context, d *consent.Directive) error {
+	_, err := c.db.ExecContext(ctx, c.db.Rebind(`INSERT INTO `+tableConsents+`
+		(IDNumber, Purpose, Caller, Categories, Reason, CreatedAt) VALUES (?, ?, ?, ?, ?, ?)`),
+		d.IDNumber, string(d.Purpose), d.Caller, d.Categories, d.Reason, d.CreatedAt)
+	return err
+}
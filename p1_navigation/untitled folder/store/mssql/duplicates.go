@@ -0,0 +1,86 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/match"
+)
+
+const tableDuplicates = "Individual.DuplicateCandidates"
+
+// duplicates implements match.Store on DuplicateCandidates,
+// the table is in migrations/003_duplicates.sql
+type duplicates struct {
+	db *sqlx.DB
+}
+
+func (d *duplicates) Get(ctx context.Context, id string) (*match.Candidate, error) {
+	c := &match.Candidate{}
+	err := d.db.GetContext(ctx, c, d.db.Rebind(`SELECT * FROM `+tableDuplicates+` WHERE ID = ?`), id)
+	if err == sql.ErrNoRows {
+		return nil, match.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *duplicates) List(ctx context.Context, status match.Status) ([]match.Candidate, error) {
+	list := []match.Candidate{}
+	var err error
+	if status == "" {
+		err = d.db.SelectContext(ctx, &list, `SELECT * FROM `+tableDuplicates+` ORDER BY Score DESC, ID`)
+	} else {
+		err = d.db.SelectContext(ctx, &list, d.db.Rebind(`SELECT * FROM `+tableDuplicates+`
+			WHERE Status = ? ORDER BY Score DESC, ID`), string(status))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (d *duplicates) Put(ctx context.Context, c *match.Candidate) (bool, error) {
+	// a reviewed candidate is left as it is, HOLDLOCK keeps two scans from inserting the same pair
+	res, err := d.db.ExecContext(ctx, d.db.Rebind(`MERGE `+tableDuplicates+` WITH (HOLDLOCK) AS t
+		USING (SELECT ? AS ID) AS s ON t.ID = s.ID
+		WHEN MATCHED AND t.Status = ? THEN
+			UPDATE SET Score = ?, Class = ?, Fields = ?, UpdatedAt = ?
+		WHEN NOT MATCHED THEN
+			INSERT (ID, IDNumberA, IDNumberB, Score, Class, Fields, Status, Survivor, Reason, CreatedAt, UpdatedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`),
+		c.ID, string(match.Pending),
+		c.Score, c.Class, c.Fields, c.UpdatedAt,
+		c.ID, c.IDNumberA, c.IDNumberB, c.Score, c.Class, c.Fields, string(c.Status), c.Survivor, c.Reason, c.CreatedAt, c.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (d *duplicates) Resolve(ctx context.Context, c *match.Candidate) error {
+	res, err := d.db.ExecContext(ctx, d.db.Rebind(`UPDATE `+tableDuplicates+`
+		SET Status = ?, Survivor = ?, Reason = ?, UpdatedAt = ?
+		WHERE ID = ? AND Status = ?`),
+		string(c.Status), c.Survivor, c.Reason, c.UpdatedAt, c.ID, string(match.Pending))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := d.Get(ctx, c.ID); err != nil {
+			return err
+		}
+		return match.ErrState
+	}
+	return nil
+}
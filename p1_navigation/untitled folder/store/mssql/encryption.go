@@ -0,0 +1,91 @@
+package mssql
+
+import (
+	"context"
+	"sort"
+
+	"gitlab.lean/leandevclan/nhic/encryption"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+// Encrypt encrypts the columns of the patients written from now on, the rows already written
+// are read either way, Reencrypt moves them to cols. the IdNumberIndex column is in migrations/007_encryption.sql
+func (s *Store) Encrypt(cols *encryption.Columns) {
+	s.cols = cols
+}
+
+// Reencrypt writes again the patients cols says are stale: the columns in clear text that are encrypted now,
+// the ones wrapped by a key that's no longer primary and the ones no longer encrypted. it returns how many
+func (s *Store) Reencrypt(ctx context.Context) (int, error) {
+	if s.cols == nil {
+		return 0, nil
+	}
+	pnts := []store.Patient{}
+	if err := s.db.SelectContext(ctx, &pnts, `SELECT * FROM `+tablePatients); err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range pnts {
+		raw := pnts[i]
+		if raw.IDNumber == nil || !s.cols.Stale(&raw) {
+			continue
+		}
+		pnt := raw
+		if err := s.cols.Open(ctx, &pnt); err != nil {
+			return n, err
+		}
+		sealed, err := s.cols.Seal(ctx, &pnt)
+		if err != nil {
+			return n, err
+		}
+		// the row is matched by the id number as it's stored
+		if err := update(ctx, s.db, tablePatients, sealed, "IdNumber = ?", *raw.IDNumber); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// idWhere is the condition of the patient with the id number,
+// the encrypted ones are found by the blind index and the rows not encrypted yet by the id
+func (s *Store) idWhere(id string) (string, []interface{}) {
+	if s.cols == nil || s.cols.IDIndex(id) == "" {
+		return "IdNumber = ?", []interface{}{id}
+	}
+	return "(IdNumber = ? OR IdNumberIndex = ?)", []interface{}{id, s.cols.IDIndex(id)}
+}
+
+// aliasKey is the id number as PatientAliases keeps it, the blind index if the id numbers are encrypted
+func (s *Store) aliasKey(id string) string {
+	if s.cols == nil || s.cols.IDIndex(id) == "" {
+		return id
+	}
+	return s.cols.IDIndex(id)
+}
+
+// seal returns the row of pnt to write
+func (s *Store) seal(ctx context.Context, pnt *store.Patient) (*store.Patient, error) {
+	if s.cols == nil {
+		return pnt, nil
+	}
+	return s.cols.Seal(ctx, pnt)
+}
+
+// open decrypts the patients read, they're sorted again by id number if it's encrypted
+func (s *Store) open(ctx context.Context, pnts []store.Patient) error {
+	if s.cols == nil {
+		return nil
+	}
+	for i := range pnts {
+		if err := s.cols.Open(ctx, &pnts[i]); err != nil {
+			return err
+		}
+	}
+	if s.cols.Encrypts("id_number") {
+		sort.SliceStable(pnts, func(i, j int) bool {
+			return *pnts[i].IDNumber < *pnts[j].IDNumber
+		})
+	}
+	return nil
+}
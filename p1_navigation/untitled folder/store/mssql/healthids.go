@@ -0,0 +1,230 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/healthid"
+)
+
+// claimed marks a number of the pool handed out by NextSeq that isn't inserted yet
+const claimed = "claimed"
+
+// recordState is the state of a row of LuhnNumbersReserve,
+// the rows from before the State column are told by IsUsed
+const recordState = `CASE WHEN State IS NOT NULL THEN State WHEN IsUsed = 1 THEN 'bound' ELSE 'reserved' END`
+
+// healthIDs implements healthid.Store on LuhnNumbersReserve, the pool of the pre generated health ids.
+// a free number has neither UsedForIdNumber nor State, a reserved one has UsedForIdNumber,
+// a bound one IsUsed too and its row in HealthIDs_NationalIDs_reference.
+// a released one keeps IsUsed so it's only given out again by a reissue.
+// the columns it adds to the table are in migrations/002_health_ids.sql
+type healthIDs struct {
+	db *sqlx.DB
+}
+
+// recordRow is a row of LuhnNumbersReserve as a healthid.Record
+type recordRow struct {
+	HealthID     string         `db:"HealthID"`
+	IDNumber     sql.NullString `db:"IDNumber"`
+	State        string         `db:"State"`
+	ReleasedFrom sql.NullString `db:"ReleasedFrom"`
+	Reason       sql.NullString `db:"Reason"`
+	UpdatedAt    sql.NullTime   `db:"UpdatedAt"`
+}
+
+func (r *recordRow) record() *healthid.Record {
+	return &healthid.Record{
+		HealthID:     r.HealthID,
+		IDNumber:     r.IDNumber.String,
+		State:        healthid.State(r.State),
+		ReleasedFrom: r.ReleasedFrom.String,
+		Reason:       r.Reason.String,
+		UpdatedAt:    r.UpdatedAt.Time,
+	}
+}
+
+const selectRecord = `SELECT TOP 1 LuhnNumber AS HealthID, UsedForIdNumber AS IDNumber, ` + recordState + ` AS State,
+	ReleasedFrom, Reason, UpdatedAt FROM ` + tableLuhnReserve
+
+func (h *healthIDs) Get(ctx context.Context, healthID string) (*healthid.Record, error) {
+	return h.get(ctx, h.db, selectRecord+` WHERE LuhnNumber = ?
+		AND (UsedForIdNumber IS NOT NULL OR IsUsed = 1) AND COALESCE(State, '') <> '`+claimed+`'`, healthID)
+}
+
+func (h *healthIDs) ByIDNumber(ctx context.Context, idNumber string) (*healthid.Record, error) {
+	return h.get(ctx, h.db, selectRecord+` WHERE UsedForIdNumber = ? AND `+recordState+` IN (?, ?)`,
+		idNumber, healthid.Reserved, healthid.Bound)
+}
+
+type queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	Rebind(query string) string
+}
+
+func (h *healthIDs) get(ctx context.Context, db queryer, q string, args ...interface{}) (*healthid.Record, error) {
+	r := &recordRow{}
+	err := db.GetContext(ctx, r, db.Rebind(q), args...)
+	if err == sql.ErrNoRows {
+		return nil, healthid.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return r.record(), nil
+}
+
+// NextSeq claims the next free number of the pool and returns its sequence number,
+// a claimed number that isn't inserted e.g. after a conflict is skipped like the sqlite sequence
+func (h *healthIDs) NextSeq(ctx context.Context) (int64, error) {
+	var hid string
+	// READPAST skips the numbers other requests are claiming
+	err := h.db.GetContext(ctx, &hid, h.db.Rebind(`UPDATE TOP (1) `+tableLuhnReserve+` WITH (ROWLOCK, UPDLOCK, READPAST)
+		SET State = ?, UpdatedAt = ? OUTPUT inserted.LuhnNumber
+		WHERE IsUsed = 0 AND UsedForIdNumber IS NULL AND State IS NULL`), claimed, time.Now())
+	if err == sql.ErrNoRows {
+		return 0, healthid.ErrExhausted
+	} else if err != nil {
+		return 0, err
+	}
+	if err := healthid.Validate(hid); err != nil {
+		return 0, fmt.Errorf("%s has %q: %w", tableLuhnReserve, hid, err)
+	}
+	return strconv.ParseInt(strings.TrimPrefix(hid, "ID")[:13], 10, 64)
+}
+
+// Insert reserves a claimed number, or records as bound an id issued before the pool had states
+func (h *healthIDs) Insert(ctx context.Context, r *healthid.Record) error {
+	tx, err := h.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := h.checkConflict(ctx, tx, r); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, tx.Rebind(`UPDATE `+tableLuhnReserve+`
+		SET UsedForIdNumber = ?, IsUsed = ?, State = ?, ReleasedFrom = ?, Reason = ?, UpdatedAt = ?
+		WHERE LuhnNumber = ? AND IsUsed = 0 AND UsedForIdNumber IS NULL AND (State IS NULL OR State = ?)`),
+		nullable(r.IDNumber), isUsed(r.State), r.State, nullable(r.ReleasedFrom), nullable(r.Reason), r.UpdatedAt,
+		r.HealthID, claimed)
+	if err != nil {
+		return conflictErr(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists int
+		err := tx.GetContext(ctx, &exists, tx.Rebind(`SELECT COUNT(*) FROM `+tableLuhnReserve+` WHERE LuhnNumber = ?`), r.HealthID)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return healthid.ErrConflict
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(`INSERT INTO `+tableLuhnReserve+`
+			(LuhnNumber, UsedForIdNumber, IsUsed, State, ReleasedFrom, Reason, UpdatedAt) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			r.HealthID, nullable(r.IDNumber), isUsed(r.State), r.State, nullable(r.ReleasedFrom), nullable(r.Reason), r.UpdatedAt)
+		if err != nil {
+			return conflictErr(err)
+		}
+	}
+	if err := reference(ctx, tx, r); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (h *healthIDs) Transition(ctx context.Context, from healthid.State, r *healthid.Record) error {
+	tx, err := h.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := h.checkConflict(ctx, tx, r); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, tx.Rebind(`UPDATE `+tableLuhnReserve+`
+		SET UsedForIdNumber = ?, IsUsed = ?, State = ?, ReleasedFrom = ?, Reason = ?, UpdatedAt = ?
+		WHERE LuhnNumber = ? AND (UsedForIdNumber IS NOT NULL OR IsUsed = 1) AND `+recordState+` = ?`),
+		nullable(r.IDNumber), isUsed(r.State), r.State, nullable(r.ReleasedFrom), nullable(r.Reason), r.UpdatedAt,
+		r.HealthID, from)
+	if err != nil {
+		return conflictErr(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return healthid.ErrState
+	}
+	if err := reference(ctx, tx, r); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkConflict returns healthid.ErrConflict if the id number of r has another reserved or bound id,
+// the range lock holds until the end of tx so two requests can't both pass it
+func (h *healthIDs) checkConflict(ctx context.Context, tx *sqlx.Tx, r *healthid.Record) error {
+	if r.State == healthid.Released || r.IDNumber == "" {
+		return nil
+	}
+	var other string
+	err := tx.GetContext(ctx, &other, tx.Rebind(`SELECT TOP 1 LuhnNumber FROM `+tableLuhnReserve+` WITH (UPDLOCK, HOLDLOCK)
+		WHERE UsedForIdNumber = ? AND LuhnNumber <> ? AND `+recordState+` IN (?, ?)`),
+		r.IDNumber, r.HealthID, healthid.Reserved, healthid.Bound)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return healthid.ErrConflict
+}
+
+// reference keeps HealthIDs_NationalIDs_reference in step with r, it lists the bound ids only
+func reference(ctx context.Context, tx *sqlx.Tx, r *healthid.Record) error {
+	switch r.State {
+	case healthid.Bound:
+		_, err := tx.ExecContext(ctx, tx.Rebind(`INSERT INTO `+tableHealthIDRefs+` (HealthID, NationalID)
+			SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM `+tableHealthIDRefs+` WHERE HealthID = ?)`),
+			r.HealthID, r.IDNumber, r.HealthID)
+		return err
+	case healthid.Released:
+		_, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM `+tableHealthIDRefs+` WHERE HealthID = ?`), r.HealthID)
+		return err
+	}
+	return nil
+}
+
+// isUsed is IsUsed of the state, released ids stay used so the pool doesn't give them out
+func isUsed(s healthid.State) int {
+	if s == healthid.Reserved {
+		return 0
+	}
+	return 1
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// conflictErr maps unique index violations to healthid.ErrConflict
+func conflictErr(err error) error {
+	if isDuplicateKey(err) {
+		return healthid.ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+-- columns of the visitors, gcc nationals and newborns, and the source of the english names.
+-- safe to run again, existing columns are skipped
+
+IF COL_LENGTH('Individual.Individuals', 'PassportNumber') IS NULL
+    ALTER TABLE Individual.Individuals ADD PassportNumber NVARCHAR(20) NULL;
+IF COL_LENGTH('Individual.Individuals', 'BorderNumber') IS NULL
+    ALTER TABLE Individual.Individuals ADD BorderNumber NVARCHAR(10) NULL;
+IF COL_LENGTH('Individual.Individuals', 'VisaNumber') IS NULL
+    ALTER TABLE Individual.Individuals ADD VisaNumber NVARCHAR(10) NULL;
+-- ISO 3166 alpha-3 of the issuer of a gcc id
+IF COL_LENGTH('Individual.Individuals', 'IdCountry') IS NULL
+    ALTER TABLE Individual.Individuals ADD IdCountry NVARCHAR(3) NULL;
+-- newborns are stored under NB-<guardian id>-<yyyymmdd>-<birth order>
+IF COL_LENGTH('Individual.Individuals', 'GuardianId') IS NULL
+    ALTER TABLE Individual.Individuals ADD GuardianId NVARCHAR(10) NULL;
+IF COL_LENGTH('Individual.Individuals', 'BirthOrder') IS NULL
+    ALTER TABLE Individual.Individuals ADD BirthOrder NVARCHAR(2) NULL;
+-- authoritative or generated
+IF COL_LENGTH('Individual.Individuals', 'EnglishNameSource') IS NULL
+    ALTER TABLE Individual.Individuals ADD EnglishNameSource NVARCHAR(16) NULL;
+GO
@@ -0,0 +1,24 @@
+-- states of the health ids in the pool, see store/mssql/healthids.go.
+-- the rows from before keep a NULL State and are told by IsUsed
+-- safe to run again, existing columns and indexes are skipped
+
+IF COL_LENGTH('Individual.LuhnNumbersReserve', 'State') IS NULL
+    ALTER TABLE Individual.LuhnNumbersReserve ADD State NVARCHAR(10) NULL;
+IF COL_LENGTH('Individual.LuhnNumbersReserve', 'ReleasedFrom') IS NULL
+    ALTER TABLE Individual.LuhnNumbersReserve ADD ReleasedFrom NVARCHAR(50) NULL;
+IF COL_LENGTH('Individual.LuhnNumbersReserve', 'Reason') IS NULL
+    ALTER TABLE Individual.LuhnNumbersReserve ADD Reason NVARCHAR(500) NULL;
+IF COL_LENGTH('Individual.LuhnNumbersReserve', 'UpdatedAt') IS NULL
+    ALTER TABLE Individual.LuhnNumbersReserve ADD UpdatedAt DATETIME2 NULL;
+GO
+
+-- an id number has at most one reserved or bound id, released ids have no UsedForIdNumber.
+-- list the id numbers that break it before, they have to be released by hand first:
+-- SELECT UsedForIdNumber FROM Individual.LuhnNumbersReserve WHERE UsedForIdNumber IS NOT NULL GROUP BY UsedForIdNumber HAVING COUNT(*) > 1;
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'UX_LuhnNumbersReserve_UsedForIdNumber')
+    CREATE UNIQUE INDEX UX_LuhnNumbersReserve_UsedForIdNumber ON Individual.LuhnNumbersReserve (UsedForIdNumber)
+        WHERE UsedForIdNumber IS NOT NULL;
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_LuhnNumbersReserve_Free')
+    CREATE INDEX IX_LuhnNumbersReserve_Free ON Individual.LuhnNumbersReserve (LuhnNumber)
+        WHERE IsUsed = 0 AND UsedForIdNumber IS NULL AND State IS NULL;
+GO
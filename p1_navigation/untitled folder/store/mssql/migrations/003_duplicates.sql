@@ -0,0 +1,23 @@
+-- review queue of the duplicate patients, see store/mssql/duplicates.go
+-- safe to run again, an existing table is skipped
+
+IF OBJECT_ID('Individual.DuplicateCandidates', 'U') IS NULL
+    CREATE TABLE Individual.DuplicateCandidates (
+        ID NVARCHAR(16) NOT NULL PRIMARY KEY,
+        IDNumberA NVARCHAR(50) NOT NULL,
+        IDNumberB NVARCHAR(50) NOT NULL,
+        Score FLOAT NOT NULL,
+        Class NVARCHAR(10) NOT NULL,
+        -- how each field weighed in the score, as json
+        Fields NVARCHAR(MAX) NOT NULL,
+        Status NVARCHAR(10) NOT NULL,
+        Survivor NVARCHAR(50) NOT NULL,
+        Reason NVARCHAR(500) NOT NULL,
+        CreatedAt DATETIME2 NOT NULL,
+        UpdatedAt DATETIME2 NOT NULL
+    );
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_DuplicateCandidates_Status')
+    CREATE INDEX IX_DuplicateCandidates_Status ON Individual.DuplicateCandidates (Status, Score);
+GO
@@ -0,0 +1,48 @@
+-- trail of the lookups and its checkpoints, see store/mssql/audit.go.
+-- the times are UTC with microseconds, the hashes of the events cover them
+-- safe to run again, existing objects are skipped or replaced
+
+IF SCHEMA_ID('Audit') IS NULL
+    EXEC('CREATE SCHEMA Audit');
+GO
+
+IF OBJECT_ID('Audit.Events', 'U') IS NULL
+    CREATE TABLE Audit.Events (
+        Seq BIGINT NOT NULL PRIMARY KEY,
+        Time DATETIME2(6) NOT NULL,
+        Caller NVARCHAR(200) NOT NULL,
+        Purpose NVARCHAR(50) NOT NULL,
+        CorrelationID NVARCHAR(200) NOT NULL,
+        Operation NVARCHAR(50) NOT NULL,
+        IDHash VARCHAR(64) NOT NULL,
+        Source NVARCHAR(20) NOT NULL,
+        Result NVARCHAR(20) NOT NULL,
+        Detail NVARCHAR(MAX) NOT NULL,
+        PrevHash VARCHAR(64) NOT NULL,
+        Hash VARCHAR(64) NOT NULL
+    );
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_AuditEvents_IDHash')
+    CREATE INDEX IX_AuditEvents_IDHash ON Audit.Events (IDHash);
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_AuditEvents_Caller')
+    CREATE INDEX IX_AuditEvents_Caller ON Audit.Events (Caller);
+
+IF OBJECT_ID('Audit.Checkpoints', 'U') IS NULL
+    CREATE TABLE Audit.Checkpoints (
+        id BIGINT IDENTITY(1,1) NOT NULL PRIMARY KEY,
+        Seq BIGINT NOT NULL,
+        Hash VARCHAR(64) NOT NULL,
+        Time DATETIME2(6) NOT NULL,
+        Signature VARCHAR(100) NOT NULL
+    );
+GO
+
+-- the trail is append only, also DENY UPDATE, DELETE ON SCHEMA::Audit TO the login of the app
+CREATE OR ALTER TRIGGER Audit.Events_AppendOnly ON Audit.Events INSTEAD OF UPDATE, DELETE
+AS
+    THROW 50000, 'audit events are append only', 1;
+GO
+
+CREATE OR ALTER TRIGGER Audit.Checkpoints_AppendOnly ON Audit.Checkpoints INSTEAD OF UPDATE, DELETE
+AS
+    THROW 50000, 'audit checkpoints are append only', 1;
+GO
@@ -0,0 +1,20 @@
+-- consent directives of the patients, see store/mssql/consent.go
+-- safe to run again, an existing table is skipped
+
+IF OBJECT_ID('Individual.ConsentDirectives', 'U') IS NULL
+    CREATE TABLE Individual.ConsentDirectives (
+        id BIGINT IDENTITY(1,1) NOT NULL PRIMARY KEY,
+        IDNumber NVARCHAR(50) NOT NULL,
+        -- empty Purpose and Caller are any
+        Purpose NVARCHAR(20) NOT NULL,
+        Caller NVARCHAR(200) NOT NULL,
+        -- the categories withheld comma separated, empty is all of them
+        Categories NVARCHAR(200) NOT NULL,
+        Reason NVARCHAR(500) NOT NULL,
+        CreatedAt DATETIME2 NOT NULL
+    );
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_ConsentDirectives_IDNumber')
+    CREATE INDEX IX_ConsentDirectives_IDNumber ON Individual.ConsentDirectives (IDNumber);
+GO
@@ -0,0 +1,14 @@
+-- pseudonyms issued to the analytics consumers, see store/mssql/pseudonyms.go.
+-- Value is the id the pseudonym stands for, grant the table to the app's login only
+-- safe to run again, an existing table is skipped
+
+IF OBJECT_ID('Individual.Pseudonyms', 'U') IS NULL
+    CREATE TABLE Individual.Pseudonyms (
+        Consumer NVARCHAR(200) NOT NULL,
+        Pseudonym CHAR(20) NOT NULL,
+        Kind NVARCHAR(20) NOT NULL,
+        Value NVARCHAR(50) NOT NULL,
+        CreatedAt DATETIME2 NOT NULL,
+        CONSTRAINT PK_Pseudonyms PRIMARY KEY (Consumer, Pseudonym)
+    );
+GO
@@ -0,0 +1,23 @@
+-- encrypted patient columns, see store/mssql/encryption.go and the Encryption part of the README.
+-- an encrypted value is about 120 characters longer than the value, the columns that can be encrypted
+-- are widened. an index on one of them has to be dropped before and created again after.
+-- phone_number and email_address have no column, the store doesn't write them
+-- safe to run again, the existing column and index are skipped
+
+IF COL_LENGTH('Individual.Individuals', 'IdNumberIndex') IS NULL
+    ALTER TABLE Individual.Individuals ADD IdNumberIndex VARCHAR(32) NULL;
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_Individuals_IdNumberIndex')
+    CREATE INDEX IX_Individuals_IdNumberIndex ON Individual.Individuals (IdNumberIndex) WHERE IdNumberIndex IS NOT NULL;
+GO
+
+ALTER TABLE Individual.Individuals ALTER COLUMN IdNumber NVARCHAR(400) NOT NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN GuardianId NVARCHAR(400) NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN PassportNumber NVARCHAR(400) NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN BorderNumber NVARCHAR(400) NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN VisaNumber NVARCHAR(400) NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN HifizaNumber NVARCHAR(400) NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN SponsorNumber NVARCHAR(400) NULL;
+ALTER TABLE Individual.Individuals ALTER COLUMN MobileNumber NVARCHAR(400) NULL;
+GO
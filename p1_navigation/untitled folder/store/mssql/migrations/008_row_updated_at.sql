@@ -0,0 +1,6 @@
+-- the time of the last write of the patient, written by AddPatient and UpdatesPatient
+-- safe to run again, the existing column is skipped
+
+IF COL_LENGTH('Individual.Individuals', 'RowUpdatedAt') IS NULL
+    ALTER TABLE Individual.Individuals ADD RowUpdatedAt DATETIME2 NULL;
+GO
@@ -0,0 +1,15 @@
+-- the id numbers of the patients merged into another one, GetPatient returns the survivor
+-- with the health id. the id number is its blind index if they're encrypted, see 007_encryption.sql
+-- safe to run again, an existing table is skipped
+
+IF OBJECT_ID('Individual.PatientAliases', 'U') IS NULL
+    CREATE TABLE Individual.PatientAliases (
+        IdNumber NVARCHAR(50) NOT NULL PRIMARY KEY,
+        HealthId NVARCHAR(50) NOT NULL,
+        CreatedAt DATETIME2 NOT NULL
+    );
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_PatientAliases_HealthId')
+    CREATE INDEX IX_PatientAliases_HealthId ON Individual.PatientAliases (HealthId);
+GO
@@ -0,0 +1,535 @@
+// Package mssql is the store of the registry db on MSSQL Server, the one used in production.
+//
+// it keeps the patients and their health ids in the Individual tables, and the tables of the
+// duplicates, the audit trail, the consents and the pseudonyms in migrations. the practitioners,
+// establishments and countries are read and written by the existing *store.Store.
+// the entities are read by their db tags and only the tagged fields are written, the others
+// e.g. ReservedHealthID and ErrorMsg are for the responses. every call takes the context
+// of the request, a canceled request cancels its query
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/consent"
+	"gitlab.lean/leandevclan/nhic/encryption"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/match"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+	"gitlab.lean/leandevclan/nhic/store"
+
+	// registers the "sqlserver" driver
+	_ "github.com/denisenkom/go-mssqldb"
+)
+
+// tables of the registry db
+const (
+	tablePatients     = "Individual.Individuals"
+	tableLuhnReserve  = "Individual.LuhnNumbersReserve"
+	tableHealthIDRefs = "Individual.HealthIDs_NationalIDs_reference"
+	tableAliases      = "Individual.PatientAliases"
+)
+
+// timeLayout is how the row timestamps are written, like the practitioners' ones
+const timeLayout = "2006-01-02 15:04:05.000"
+
+// ErrNoEntities is returned by the practitioner and establishment methods of a Store
+// opened without the *store.Store of those tables e.g. by the cli tools
+var ErrNoEntities = errors.New("mssql: store opened without the practitioners and establishments")
+
+// Store talks to the MSSQL db
+type Store struct {
+	db *sqlx.DB
+	// the practitioners, establishments and countries, nil for the cli tools
+	entities *store.Store
+
+	ids *healthid.Allocator
+	dup *duplicates
+	aud *auditTrail
+	con *consents
+	pse *pseudonyms
+
+	// nil if the patients aren't encrypted, see encryption.go
+	cols *encryption.Columns
+
+	now func() time.Time
+}
+
+// DSN returns the url of the db of config
+func DSN(host, user, password, port, name string) string {
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(user, password),
+		Host:     net.JoinHostPort(host, port),
+		RawQuery: url.Values{"database": {name}}.Encode(),
+	}
+	return u.String()
+}
+
+// New connects to the db at dsn e.g. DSN(conf.DB.Host, ...), entities is the existing
+// store of the practitioners, establishments and countries on the same db. the cli tools
+// that only read the patients or the audit trail pass nil
+func New(dsn string, entities *store.Store) (*Store, error) {
+	db, err := sqlx.Open("sqlserver", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return newStore(db, entities), nil
+}
+
+func newStore(db *sqlx.DB, entities *store.Store) *Store {
+	// the tables have columns the entities don't
+	db = db.Unsafe()
+	return &Store{
+		db:       db,
+		entities: entities,
+		ids:      healthid.New(&healthIDs{db: db}),
+		dup:      &duplicates{db: db},
+		aud:      &auditTrail{db: db},
+		con:      &consents{db: db},
+		pse:      &pseudonyms{db: db},
+		now:      time.Now,
+	}
+}
+
+// HealthIDs returns the allocator of the health ids, kept in LuhnNumbersReserve
+func (s *Store) HealthIDs() *healthid.Allocator {
+	return s.ids
+}
+
+// Duplicates returns the review queue of the duplicate patients, kept in DuplicateCandidates
+func (s *Store) Duplicates() match.Store {
+	return s.dup
+}
+
+// Audit returns the trail of the lookups, kept in the Audit schema
+func (s *Store) Audit() audit.Store {
+	return s.aud
+}
+
+// Consents returns the consent directives of the patients, kept in ConsentDirectives
+func (s *Store) Consents() consent.Store {
+	return s.con
+}
+
+// Pseudonyms returns the pseudonyms issued to the analytics consumers, kept in Pseudonyms
+func (s *Store) Pseudonyms() pseudonym.Store {
+	return s.pse
+}
+
+// Close closes the db
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// GetPatient returns the patient with the id number.
+// if not found it returns a patient with a reserved health id and store.ErrNotFound
+func (s *Store) GetPatient(ctx context.Context, id, birthDate string) (*store.Patient, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	pnt, err := s.GetPatientByID(ctx, id)
+	if err != store.ErrNotFound {
+		return pnt, err
+	}
+	// a merged id number returns the patient it was merged into
+	pnt, err = s.getMerged(ctx, id)
+	if err != store.ErrNotFound {
+		return pnt, err
+	}
+
+	reserved, err := s.ids.Reserve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &store.Patient{ReservedHealthID: &reserved}, store.ErrNotFound
+}
+
+// GetPatientByID returns the patient with the id number or store.ErrNotFound
+func (s *Store) GetPatientByID(ctx context.Context, id string) (*store.Patient, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	pnt := &store.Patient{}
+	where, args := s.idWhere(id)
+	err := s.get(ctx, pnt, `SELECT TOP 1 * FROM `+tablePatients+` WHERE `+where, args...)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if s.cols != nil {
+		if err := s.cols.Open(ctx, pnt); err != nil {
+			return nil, err
+		}
+	}
+	return pnt, nil
+}
+
+// ScanPatients calls fn with each patient for the duplicates scan, the rows are read one at a time
+// and the table isn't held in memory. it isn't a ListPatients, the name search would read it on every request
+func (s *Store) ScanPatients(ctx context.Context, fn func(pnt *store.Patient) error) error {
+	rows, err := s.db.QueryxContext(ctx, `SELECT * FROM `+tablePatients)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		pnt := &store.Patient{}
+		if err := rows.StructScan(pnt); err != nil {
+			return err
+		}
+		if s.cols != nil {
+			if err := s.cols.Open(ctx, pnt); err != nil {
+				return err
+			}
+		}
+		if err := fn(pnt); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetPatientsByID returns the patients with the id numbers, the duplicates scan reads
+// the patients of a block with it. there are at most 500 of them, under the 2100 parameters of SQL Server
+func (s *Store) GetPatientsByID(ctx context.Context, ids []string) (*[]store.Patient, error) {
+	pnts := []store.Patient{}
+	if len(ids) == 0 {
+		return &pnts, nil
+	}
+
+	q, args, err := sqlx.In(`SELECT * FROM `+tablePatients+` WHERE IdNumber IN (?)`, ids)
+	if s.cols != nil {
+		index := make([]string, len(ids))
+		for i, id := range ids {
+			index[i] = s.cols.IDIndex(id)
+		}
+		q, args, err = sqlx.In(`SELECT * FROM `+tablePatients+` WHERE IdNumber IN (?) OR IdNumberIndex IN (?)`, ids, index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &pnts, s.db.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	if err := s.open(ctx, pnts); err != nil {
+		return nil, err
+	}
+	return &pnts, nil
+}
+
+// AddPatient adds the patient, it gets the health id reserved for it by GetPatient
+// or a new one and binds it, adding an existing patient updates it
+func (s *Store) AddPatient(ctx context.Context, pnt *store.Patient) error {
+	if pnt.IDNumber == nil || *pnt.IDNumber == "" {
+		return store.ErrSearch
+	}
+
+	_, err := s.GetPatientByID(ctx, *pnt.IDNumber)
+	if err == nil {
+		return s.UpdatesPatient(ctx, pnt)
+	} else if err != store.ErrNotFound {
+		return err
+	}
+
+	cp := *pnt
+	if cp.HealthID == nil {
+		cp.HealthID = cp.ReservedHealthID
+	}
+	if cp.HealthID == nil {
+		reserved, err := s.ids.Reserve(ctx, *cp.IDNumber)
+		if err != nil {
+			return err
+		}
+		cp.HealthID = &reserved
+	}
+	if err := s.ids.Bind(ctx, *cp.HealthID, *cp.IDNumber); err != nil {
+		return err
+	}
+	cp.ReservedHealthID = nil
+	now := s.now().Format(timeLayout)
+	cp.RowUpdatedAt = &now
+	row, err := s.seal(ctx, &cp)
+	if err != nil {
+		return err
+	}
+	return insert(ctx, s.db, tablePatients, row)
+}
+
+// DeletePatient removes the patient e.g. after its health id was released,
+// unlike practitioners patients aren't soft deleted
+func (s *Store) DeletePatient(ctx context.Context, id string) error {
+	where, args := s.idWhere(id)
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM `+tablePatients+` WHERE `+where), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// MergePatient removes the patient merged into the one with the health id and keeps its id number
+// in PatientAliases, GetPatient of the id number returns the survivor instead of adding it again
+func (s *Store) MergePatient(ctx context.Context, id, healthID string) error {
+	old, err := s.GetPatientByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := s.idWhere(id)
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM `+tablePatients+` WHERE `+where), args...); err != nil {
+		return err
+	}
+	key := s.aliasKey(id)
+	_, err = tx.ExecContext(ctx, tx.Rebind(`MERGE `+tableAliases+` WITH (HOLDLOCK) AS t
+		USING (SELECT ? AS IdNumber) AS s ON t.IdNumber = s.IdNumber
+		WHEN MATCHED THEN
+			UPDATE SET HealthId = ?
+		WHEN NOT MATCHED THEN
+			INSERT (IdNumber, HealthId, CreatedAt) VALUES (?, ?, ?);`),
+		key, healthID, key, healthID, s.now().Format(timeLayout))
+	if err != nil {
+		return err
+	}
+	// the id numbers merged into the removed patient follow it
+	if old.HealthID != nil && *old.HealthID != healthID {
+		_, err := tx.ExecContext(ctx, tx.Rebind(`UPDATE `+tableAliases+` SET HealthId = ? WHERE HealthId = ?`), healthID, *old.HealthID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getMerged returns the patient the id number was merged into or store.ErrNotFound
+func (s *Store) getMerged(ctx context.Context, id string) (*store.Patient, error) {
+	var healthID string
+	err := s.get(ctx, &healthID, `SELECT TOP 1 HealthId FROM `+tableAliases+` WHERE IdNumber IN (?, ?)`, id, s.aliasKey(id))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	pnt := &store.Patient{}
+	err = s.get(ctx, pnt, `SELECT TOP 1 * FROM `+tablePatients+` WHERE HealthId = ? ORDER BY IdNumber`, healthID)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if s.cols != nil {
+		if err := s.cols.Open(ctx, pnt); err != nil {
+			return nil, err
+		}
+	}
+	return pnt, nil
+}
+
+// UpdatesPatient updates the fields set in pnt
+func (s *Store) UpdatesPatient(ctx context.Context, pnt *store.Patient) error {
+	if pnt.IDNumber == nil || *pnt.IDNumber == "" {
+		return store.ErrSearch
+	}
+	cp := *pnt
+	now := s.now().Format(timeLayout)
+	cp.RowUpdatedAt = &now
+	row, err := s.seal(ctx, &cp)
+	if err != nil {
+		return err
+	}
+	where, args := s.idWhere(*pnt.IDNumber)
+	return update(ctx, s.db, tablePatients, row, where, args...)
+}
+
+// GetPractitioner returns the practitioner with the id number.
+// if not found it returns a practitioner with a reserved health id and store.ErrNotFound
+func (s *Store) GetPractitioner(ctx context.Context, id string) (*store.Practitioner, error) {
+	if s.entities == nil {
+		return nil, ErrNoEntities
+	}
+	return s.entities.GetPractitioner(ctx, id)
+}
+
+// AddPractitioner adds the practitioner, adding an existing practitioner updates it
+func (s *Store) AddPractitioner(ctx context.Context, pract *store.Practitioner) error {
+	if s.entities == nil {
+		return ErrNoEntities
+	}
+	return s.entities.AddPractitioner(ctx, pract)
+}
+
+// GetEstablishment returns the establishment with the organization id
+func (s *Store) GetEstablishment(ctx context.Context, id string) (*store.Establishment, error) {
+	if s.entities == nil {
+		return nil, ErrNoEntities
+	}
+	return s.entities.GetEstablishment(ctx, id)
+}
+
+// GetEstablishmentV2 returns the establishment with the organization id
+func (s *Store) GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error) {
+	if s.entities == nil {
+		return nil, ErrNoEntities
+	}
+	return s.entities.GetEstablishmentV2(ctx, id)
+}
+
+// GetEstablishments returns all the establishments that aren't deleted
+func (s *Store) GetEstablishments(ctx context.Context) (*[]store.Establishments, error) {
+	if s.entities == nil {
+		return nil, ErrNoEntities
+	}
+	return s.entities.GetEstablishments(ctx)
+}
+
+// GetEstablishmentsV2 returns all the establishments
+func (s *Store) GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error) {
+	if s.entities == nil {
+		return nil, ErrNoEntities
+	}
+	return s.entities.GetEstablishmentsV2(ctx)
+}
+
+// UpdateGovEstablishment adds the establishment or updates the fields set in est
+func (s *Store) UpdateGovEstablishment(ctx context.Context, est *store.Establishment) error {
+	if s.entities == nil {
+		return ErrNoEntities
+	}
+	return s.entities.UpdateGovEstablishment(ctx, est)
+}
+
+// GetCountryIsoCode returns the country of the nationality
+func (s *Store) GetCountryIsoCode(ctx context.Context, nationality *string) (*store.ISOCode, error) {
+	if s.entities == nil {
+		return nil, ErrNoEntities
+	}
+	return s.entities.GetCountryIsoCode(ctx, nationality)
+}
+
+// get runs q with ? placeholders and scans the row into dst
+func (s *Store) get(ctx context.Context, dst interface{}, q string, args ...interface{}) error {
+	return s.db.GetContext(ctx, dst, s.db.Rebind(q), args...)
+}
+
+// execer is the db or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Rebind(query string) string
+}
+
+// insert adds v as a new row of table, nil fields are left to the column default
+func insert(ctx context.Context, db execer, table string, v interface{}) error {
+	var cols, params []string
+	var args []interface{}
+	for _, f := range fieldsOf(v) {
+		if isNil(f.value) {
+			continue
+		}
+		cols = append(cols, "["+f.name+"]")
+		params = append(params, "?")
+		args = append(args, f.value.Interface())
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), strings.Join(params, ", "))
+	_, err := db.ExecContext(ctx, db.Rebind(q), args...)
+	return err
+}
+
+// update sets the non nil fields of v in the rows matching where,
+// it returns store.ErrNotFound if none matched
+func update(ctx context.Context, db execer, table string, v interface{}, where string, whereArgs ...interface{}) error {
+	var set []string
+	var args []interface{}
+	for _, f := range fieldsOf(v) {
+		if f.value.Kind() != reflect.Ptr && f.value.Kind() != reflect.Interface {
+			continue
+		}
+		if f.value.IsNil() {
+			continue
+		}
+		set = append(set, "["+f.name+"] = ?")
+		args = append(args, f.value.Interface())
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(set, ", "), where)
+	res, err := db.ExecContext(ctx, db.Rebind(q), append(args, whereArgs...)...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// isDuplicateKey tells if err is a primary key or unique index violation
+func isDuplicateKey(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "UNIQUE KEY"))
+}
+
+func isNil(v reflect.Value) bool {
+	return (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()
+}
+
+type field struct {
+	name  string
+	value reflect.Value
+}
+
+// computed are the tagged columns the reads compute, the tables don't have them
+var computed = map[string]bool{"age": true, "msg": true}
+
+// fieldsOf returns the columns of v with their values, the fields without a db tag aren't columns.
+// a column tagged twice gets the first field
+func fieldsOf(v interface{}) []field {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	seen := make(map[string]bool)
+	var fields []field
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Tag.Get("db")
+		if name == "" || name == "-" || computed[strings.ToLower(name)] || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		fields = append(fields, field{name: name, value: rv.Field(i)})
+	}
+	return fields
+}
@@ -0,0 +1,203 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/encryption"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+// fakeDB keeps the statements executed, every one affects rows rows
+type fakeDB struct {
+	rows    int64
+	queries []string
+	args    [][]interface{}
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+	return driverResult(f.rows), nil
+}
+
+func (f *fakeDB) Rebind(query string) string {
+	return sqlx.Rebind(sqlx.AT, query)
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestDSN(t *testing.T) {
+	dsn := DSN("db.local", "nhic", "p@ss:w/rd?", "1433", "Registry")
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := u.User.Password()
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"scheme", u.Scheme, "sqlserver"},
+		{"host", u.Host, "db.local:1433"},
+		{"user", u.User.Username(), "nhic"},
+		{"escaped password", password, "p@ss:w/rd?"},
+		{"database", u.Query().Get("database"), "Registry"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestFieldsOf(t *testing.T) {
+	columns := func(fields []field) map[string]int {
+		m := make(map[string]int)
+		for i, f := range fields {
+			m[f.name] = i
+		}
+		return m
+	}
+	practFields := fieldsOf(&store.Practitioner{HealthID: sp("ID10000000000016")})
+	pnt, pract := columns(fieldsOf(&store.Patient{})), columns(practFields)
+
+	tests := []struct {
+		name   string
+		got    bool
+		column bool
+	}{
+		{"tagged", has(pnt, "IdNumber"), true},
+		{"untagged", has(pnt, "ReservedHealthID"), false},
+		{"computed age", has(pnt, "Age"), false},
+		{"computed msg", has(pnt, "Msg"), false},
+		{"tagged twice", has(pract, "Practitioner_id"), true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.column {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.column)
+		}
+	}
+	// the column tagged twice gets the first field
+	if f := practFields[pract["Practitioner_id"]]; f.value.IsNil() {
+		t.Errorf("Practitioner_id is the second field")
+	}
+}
+
+func has(m map[string]int, column string) bool {
+	_, ok := m[column]
+	return ok
+}
+
+func TestInsert(t *testing.T) {
+	db := &fakeDB{rows: 1}
+	err := insert(context.Background(), db, tablePatients, &store.Patient{IDNumber: sp("1000000008"), FirstNameEn: sp("Ali")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nil fields are left to the column default
+	want := "INSERT INTO " + tablePatients + " ("
+	if q := db.queries[0]; !strings.HasPrefix(q, want) || strings.Count(q, "@p") != 2 || len(db.args[0]) != 2 {
+		t.Errorf("got %s %v", q, db.args[0])
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    int64
+		v       *store.Patient
+		err     error
+		queries int
+	}{
+		{"set fields", 1, &store.Patient{FirstNameEn: sp("Ali"), LastNameEn: sp("Smith")}, nil, 1},
+		{"no row", 0, &store.Patient{FirstNameEn: sp("Ali")}, store.ErrNotFound, 1},
+		{"nothing to set", 1, &store.Patient{}, nil, 0},
+	}
+	for _, tt := range tests {
+		db := &fakeDB{rows: tt.rows}
+		err := update(context.Background(), db, tablePatients, tt.v, "IdNumber = ?", "1000000008")
+		if err != tt.err || len(db.queries) != tt.queries {
+			t.Errorf("%s: got %v %q, want %v", tt.name, err, db.queries, tt.err)
+			continue
+		}
+		// the where args come after the set ones
+		if tt.queries > 0 {
+			args := db.args[0]
+			if args[len(args)-1] != "1000000008" || !strings.HasSuffix(db.queries[0], fmt.Sprintf("WHERE IdNumber = @p%d", len(args))) {
+				t.Errorf("%s: got %s %v", tt.name, db.queries[0], args)
+			}
+		}
+	}
+}
+
+func TestIDWhere(t *testing.T) {
+	k := &encryption.KeyFile{}
+	if err := k.Rotate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	cols, err := encryption.NewColumns(encryption.NewCipher(k), []byte("index"), []string{"id_number"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mobile, err := encryption.NewColumns(encryption.NewCipher(k), nil, []string{"mobile_number"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := cols.IDIndex("1000000008")
+
+	tests := []struct {
+		name  string
+		s     *Store
+		where string
+		args  int
+		alias string
+	}{
+		{"not encrypted", &Store{}, "IdNumber = ?", 1, "1000000008"},
+		{"id number not encrypted", &Store{cols: mobile}, "IdNumber = ?", 1, "1000000008"},
+		{"encrypted", &Store{cols: cols}, "(IdNumber = ? OR IdNumberIndex = ?)", 2, index},
+	}
+	for _, tt := range tests {
+		where, args := tt.s.idWhere("1000000008")
+		if where != tt.where || len(args) != tt.args {
+			t.Errorf("%s: got %s %v", tt.name, where, args)
+		}
+		if got := tt.s.aliasKey("1000000008"); got != tt.alias {
+			t.Errorf("%s: alias %q, want %q", tt.name, got, tt.alias)
+		}
+	}
+}
+
+func TestConflictErr(t *testing.T) {
+	other := errors.New("timeout")
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{errors.New("mssql: Violation of PRIMARY KEY constraint. Cannot insert duplicate key in object"), healthid.ErrConflict},
+		{errors.New("mssql: Violation of UNIQUE KEY constraint 'UQ_UsedForIdNumber'"), healthid.ErrConflict},
+		{other, other},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := conflictErr(tt.err); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
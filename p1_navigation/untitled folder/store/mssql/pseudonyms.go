@@ -0,0 +1,40 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+)
+
+const tablePseudonyms = "Individual.Pseudonyms"
+
+// pseudonyms implements pseudonym.Store on Pseudonyms,
+// the table is in migrations/006_pseudonyms.sql
+type pseudonyms struct {
+	db *sqlx.DB
+}
+
+func (p *pseudonyms) Put(ctx context.Context, m *pseudonym.Mapping) error {
+	_, err := p.db.ExecContext(ctx, p.db.Rebind(`INSERT INTO `+tablePseudonyms+` (Consumer, Pseudonym, Kind, Value, CreatedAt)
+		SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM `+tablePseudonyms+` WHERE Consumer = ? AND Pseudonym = ?)`),
+		m.Consumer, m.Pseudonym, m.Kind, m.Value, m.CreatedAt, m.Consumer, m.Pseudonym)
+	// issued at the same time by another request
+	if isDuplicateKey(err) {
+		return nil
+	}
+	return err
+}
+
+func (p *pseudonyms) Get(ctx context.Context, consumer, pseudo string) (*pseudonym.Mapping, error) {
+	m := &pseudonym.Mapping{}
+	err := p.db.GetContext(ctx, m, p.db.Rebind(`SELECT Consumer, Pseudonym, Kind, Value, CreatedAt
+		FROM `+tablePseudonyms+` WHERE Consumer = ? AND Pseudonym = ?`), consumer, pseudo)
+	if err == sql.ErrNoRows {
+		return nil, pseudonym.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
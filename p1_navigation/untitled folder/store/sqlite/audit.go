@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/audit"
+)
+
+// auditTrail implements audit.Store on the audit_events and audit_checkpoints tables,
+// triggers abort the updates and deletes of their rows
+type auditTrail struct {
+	db *conn
+}
+
+func (t *auditTrail) Append(ctx context.Context, e *audit.Event) error {
+	// only the next Seq is inserted, the check and the insert are one statement
+	res, err := t.db.NamedExecContext(ctx, `INSERT INTO audit_events
+		(Seq, Time, Caller, Purpose, CorrelationID, Operation, IDHash, Source, Result, Detail, PrevHash, Hash)
+		SELECT :Seq, :Time, :Caller, :Purpose, :CorrelationID, :Operation, :IDHash, :Source, :Result, :Detail, :PrevHash, :Hash
+		WHERE :Seq = (SELECT COALESCE(MAX(Seq), 0) + 1 FROM audit_events)`, e)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return audit.ErrConflict
+	}
+	return nil
+}
+
+func (t *auditTrail) Last(ctx context.Context) (*audit.Event, error) {
+	e := &audit.Event{}
+	err := t.db.GetContext(ctx, e, `SELECT * FROM audit_events ORDER BY Seq DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (t *auditTrail) Range(ctx context.Context, after int64, n int) ([]audit.Event, error) {
+	list := []audit.Event{}
+	if err := t.db.SelectContext(ctx, &list, `SELECT * FROM audit_events WHERE Seq > ? ORDER BY Seq LIMIT ?`, after, n); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *auditTrail) AddCheckpoint(ctx context.Context, cp *audit.Checkpoint) error {
+	_, err := t.db.NamedExecContext(ctx, `INSERT INTO audit_checkpoints (Seq, Hash, Time, Signature)
+		VALUES (:Seq, :Hash, :Time, :Signature)`, cp)
+	return err
+}
+
+func (t *auditTrail) Checkpoints(ctx context.Context) ([]audit.Checkpoint, error) {
+	list := []audit.Checkpoint{}
+	if err := t.db.SelectContext(ctx, &list, `SELECT Seq, Hash, Time, Signature FROM audit_checkpoints ORDER BY id`); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *auditTrail) Query(ctx context.Context, f *audit.Filter) ([]audit.Event, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, c := range []struct {
+		col string
+		v   string
+	}{
+		{"Caller", f.Caller}, {"Purpose", f.Purpose}, {"CorrelationID", f.CorrelationID},
+		{"Operation", f.Operation}, {"IDHash", f.IDHash}, {"Source", f.Source}, {"Result", f.Result},
+	} {
+		if c.v != "" {
+			where = append(where, c.col+" = ?")
+			args = append(args, c.v)
+		}
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "Time >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "Time < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	query := `SELECT * FROM audit_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY Seq DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit(), f.Offset)
+
+	list := []audit.Event{}
+	if err := t.db.SelectContext(ctx, &list, query, args...); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
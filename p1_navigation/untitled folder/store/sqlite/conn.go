@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// conn is the db of the store. modernc.org/sqlite interrupts the connection when the context
+// of a statement is done, even if it's done right after the statement returned, and with the one
+// connection the interrupt hits whatever runs next e.g. the audit event written after the request.
+// each statement gets a context that's only canceled while it runs
+type conn struct {
+	*sqlx.DB
+}
+
+func (c *conn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, done := running(ctx)
+	defer done()
+	return c.DB.GetContext(ctx, dest, query, args...)
+}
+
+func (c *conn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, done := running(ctx)
+	defer done()
+	return c.DB.SelectContext(ctx, dest, query, args...)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := running(ctx)
+	defer done()
+	return c.DB.ExecContext(ctx, query, args...)
+}
+
+func (c *conn) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	ctx, done := running(ctx)
+	defer done()
+	return c.DB.NamedExecContext(ctx, query, arg)
+}
+
+// running returns a context canceled when parent is done, until done is called.
+// database/sql doesn't run a statement whose context is already done, that one is passed as it is
+func running(parent context.Context) (ctx context.Context, done func()) {
+	if parent.Done() == nil || parent.Err() != nil {
+		return parent, func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu       sync.Mutex
+		finished bool
+	)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-parent.Done():
+			mu.Lock()
+			if !finished {
+				cancel()
+			}
+			mu.Unlock()
+		case <-stop:
+		}
+	}()
+	return ctx, func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		close(stop)
+	}
+}
@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"context"
+
+	"gitlab.lean/leandevclan/nhic/consent"
+)
+
+// consents implements consent.Store on the consent_directives table
+type consents struct {
+	db *conn
+}
+
+func (c *consents) Directives(ctx context.Context, idNumber string) ([]consent.Directive, error) {
+	list := []consent.Directive{}
+	err := c.db.SelectContext(ctx, &list, `SELECT IDNumber, Purpose, Caller, Categories, Reason, CreatedAt
+		FROM consent_directives WHERE IDNumber = ? ORDER BY id`, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *consents) AddDirective(ctx context.Context, d *consent.Directive) error {
+	_, err := c.db.NamedExecContext(ctx, `INSERT INTO consent_directives (IDNumber, Purpose, Caller, Categories, Reason, CreatedAt)
+		VALUES (:IDNumber, :Purpose, :Caller, :Categories, :Reason, :CreatedAt)`, d)
+	return err
+}
@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"gitlab.lean/leandevclan/nhic/match"
+)
+
+// duplicates implements match.Store on the duplicate_candidates table
+type duplicates struct {
+	db *conn
+}
+
+func (d *duplicates) Get(ctx context.Context, id string) (*match.Candidate, error) {
+	c := &match.Candidate{}
+	err := d.db.GetContext(ctx, c, `SELECT * FROM duplicate_candidates WHERE ID = ?`, id)
+	if err == sql.ErrNoRows {
+		return nil, match.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *duplicates) List(ctx context.Context, status match.Status) ([]match.Candidate, error) {
+	list := []match.Candidate{}
+	var err error
+	if status == "" {
+		err = d.db.SelectContext(ctx, &list, `SELECT * FROM duplicate_candidates ORDER BY Score DESC, ID`)
+	} else {
+		err = d.db.SelectContext(ctx, &list, `SELECT * FROM duplicate_candidates WHERE Status = ? ORDER BY Score DESC, ID`, status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (d *duplicates) Put(ctx context.Context, c *match.Candidate) (bool, error) {
+	// a reviewed candidate is left as it is
+	res, err := d.db.NamedExecContext(ctx, `INSERT INTO duplicate_candidates
+		(ID, IDNumberA, IDNumberB, Score, Class, Fields, Status, Survivor, Reason, CreatedAt, UpdatedAt)
+		VALUES (:ID, :IDNumberA, :IDNumberB, :Score, :Class, :Fields, :Status, :Survivor, :Reason, :CreatedAt, :UpdatedAt)
+		ON CONFLICT (ID) DO UPDATE SET Score = excluded.Score, Class = excluded.Class, Fields = excluded.Fields,
+			UpdatedAt = excluded.UpdatedAt
+		WHERE Status = 'pending'`, c)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (d *duplicates) Resolve(ctx context.Context, c *match.Candidate) error {
+	res, err := d.db.NamedExecContext(ctx, `UPDATE duplicate_candidates
+		SET Status = :Status, Survivor = :Survivor, Reason = :Reason, UpdatedAt = :UpdatedAt
+		WHERE ID = :ID AND Status = 'pending'`, c)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := d.Get(ctx, c.ID); err != nil {
+			return err
+		}
+		return match.ErrState
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/healthid"
+)
+
+// healthIDs implements healthid.Store on the health_id_records table,
+// an id number has one reserved or bound record, enforced by a partial unique index
+type healthIDs struct {
+	db *conn
+}
+
+func (h *healthIDs) Get(ctx context.Context, healthID string) (*healthid.Record, error) {
+	r := &healthid.Record{}
+	err := h.db.GetContext(ctx, r, `SELECT * FROM health_id_records WHERE HealthID = ?`, healthID)
+	if err == sql.ErrNoRows {
+		return nil, healthid.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (h *healthIDs) ByIDNumber(ctx context.Context, idNumber string) (*healthid.Record, error) {
+	r := &healthid.Record{}
+	err := h.db.GetContext(ctx, r, `SELECT * FROM health_id_records WHERE IDNumber = ? AND State IN (?, ?)`,
+		idNumber, healthid.Reserved, healthid.Bound)
+	if err == sql.ErrNoRows {
+		return nil, healthid.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (h *healthIDs) NextSeq(ctx context.Context) (int64, error) {
+	res, err := h.db.ExecContext(ctx, `INSERT INTO health_id_seq DEFAULT VALUES`)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (h *healthIDs) Insert(ctx context.Context, r *healthid.Record) error {
+	_, err := h.db.NamedExecContext(ctx, `INSERT INTO health_id_records (HealthID, IDNumber, State, ReleasedFrom, Reason, UpdatedAt)
+		VALUES (:HealthID, :IDNumber, :State, :ReleasedFrom, :Reason, :UpdatedAt)`, r)
+	return conflictErr(err)
+}
+
+func (h *healthIDs) Transition(ctx context.Context, from healthid.State, r *healthid.Record) error {
+	res, err := h.db.ExecContext(ctx, `UPDATE health_id_records
+		SET IDNumber = ?, State = ?, ReleasedFrom = ?, Reason = ?, UpdatedAt = ?
+		WHERE HealthID = ? AND State = ?`,
+		r.IDNumber, r.State, r.ReleasedFrom, r.Reason, r.UpdatedAt, r.HealthID, from)
+	if err != nil {
+		return conflictErr(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return healthid.ErrState
+	}
+	return nil
+}
+
+// conflictErr maps unique constraint violations to healthid.ErrConflict
+func conflictErr(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return healthid.ErrConflict
+	}
+	return err
+}
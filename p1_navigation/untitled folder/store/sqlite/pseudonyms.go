@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+)
+
+// pseudonyms implements pseudonym.Store on the pseudonyms table
+type pseudonyms struct {
+	db *conn
+}
+
+func (p *pseudonyms) Put(ctx context.Context, m *pseudonym.Mapping) error {
+	_, err := p.db.NamedExecContext(ctx, `INSERT OR IGNORE INTO pseudonyms (Consumer, Pseudonym, Kind, Value, CreatedAt)
+		VALUES (:Consumer, :Pseudonym, :Kind, :Value, :CreatedAt)`, m)
+	return err
+}
+
+func (p *pseudonyms) Get(ctx context.Context, consumer, pseudo string) (*pseudonym.Mapping, error) {
+	m := &pseudonym.Mapping{}
+	err := p.db.GetContext(ctx, m, `SELECT Consumer, Pseudonym, Kind, Value, CreatedAt
+		FROM pseudonyms WHERE Consumer = ? AND Pseudonym = ?`, consumer, pseudo)
+	if err == sql.ErrNoRows {
+		return nil, pseudonym.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,828 @@
+// Package sqlite is a store backed by a SQLite file that behaves like the MSSQL store,
+// it's meant for tests and local development.
+//
+// the tables are created from the db tags of the store entities,
+// untagged fields use the lowercased field name like sqlx does
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gitlab.lean/leandevclan/nhic/audit"
+	"gitlab.lean/leandevclan/nhic/consent"
+	"gitlab.lean/leandevclan/nhic/encryption"
+	"gitlab.lean/leandevclan/nhic/healthid"
+	"gitlab.lean/leandevclan/nhic/match"
+	"gitlab.lean/leandevclan/nhic/pseudonym"
+	"gitlab.lean/leandevclan/nhic/store"
+
+	// registers the "sqlite" driver, pure go no cgo needed
+	_ "modernc.org/sqlite"
+)
+
+// same layout SQL Server returns datetime columns with
+const timeLayout = "2006-01-02 15:04:05.000"
+
+const (
+	tablePatients         = "patients"
+	tablePractitioners    = "practitioners"
+	tableEstablishments   = "establishments"
+	tableEstablishmentsV2 = "establishments_v2"
+)
+
+// escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// rows that aren't soft deleted
+const notDeleted = "COALESCE(IsDeleted, '0') NOT IN ('1', 'true')"
+
+// Store talks to the SQLite db
+type Store struct {
+	db  *conn
+	now func() time.Time
+	ids *healthid.Allocator
+	dup *duplicates
+	aud *auditTrail
+	con *consents
+	pse *pseudonyms
+
+	// nil if the patients aren't encrypted, see encryption.go
+	cols *encryption.Columns
+
+	// columns of each table in struct order
+	columns map[string][]column
+}
+
+type column struct {
+	name string
+	typ  string
+}
+
+// New opens the SQLite db at dsn e.g. "file:nhic.db" or ":memory:"
+// and creates the tables if they don't exist
+func New(dsn string) (*Store, error) {
+	sdb, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows one writer, and each :memory: connection is a different db
+	sdb.SetMaxOpenConns(1)
+	db := &conn{sdb}
+
+	s := &Store{
+		db:  db,
+		now: time.Now,
+		columns: map[string][]column{
+			tablePatients:         columnsOf(store.Patient{}),
+			tablePractitioners:    columnsOf(store.Practitioner{}),
+			tableEstablishments:   columnsOf(store.Establishment{}),
+			tableEstablishmentsV2: columnsOf(store.EstablishmentV2{}),
+		},
+	}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.ids = healthid.New(&healthIDs{db: db})
+	s.dup = &duplicates{db: db}
+	s.aud = &auditTrail{db: db}
+	s.con = &consents{db: db}
+	s.pse = &pseudonyms{db: db}
+	return s, nil
+}
+
+// HealthIDs returns the allocator of the health ids
+func (s *Store) HealthIDs() *healthid.Allocator {
+	return s.ids
+}
+
+// Duplicates returns the review queue of the duplicate patients
+func (s *Store) Duplicates() match.Store {
+	return s.dup
+}
+
+// Audit returns the access trail, it only appends
+func (s *Store) Audit() audit.Store {
+	return s.aud
+}
+
+// Consents returns the consent directives of the patients
+func (s *Store) Consents() consent.Store {
+	return s.con
+}
+
+// Pseudonyms returns the pseudonyms issued to the analytics consumers
+func (s *Store) Pseudonyms() pseudonym.Store {
+	return s.pse
+}
+
+// Close closes the db
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	keys := map[string]string{
+		tablePatients:         "IdNumber",
+		tablePractitioners:    "IDNumber",
+		tableEstablishments:   "OrganizationId",
+		tableEstablishmentsV2: "OrganizationId",
+	}
+	for table, cols := range s.columns {
+		defs := make([]string, 0, len(cols))
+		for _, c := range cols {
+			def := fmt.Sprintf("%q %s", c.name, c.typ)
+			if table == tablePractitioners && c.name == "id" {
+				def = `"id" INTEGER PRIMARY KEY AUTOINCREMENT`
+			}
+			defs = append(defs, def)
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(defs, ", "))); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
+		}
+		if err := s.addColumns(table, cols); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_key ON %s (%q)", table, table, keys[table])); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
+		}
+	}
+
+	stmts := []string{
+		`CREATE INDEX IF NOT EXISTS patients_id_index ON patients (IdNumberIndex)`,
+		`CREATE TABLE IF NOT EXISTS countries (
+			Nationality TEXT PRIMARY KEY,
+			ISOAlpha3Code TEXT,
+			CountryNameEn TEXT
+		)`,
+		// health_ids of older dbs had the sequence without check digits, it's left unused
+		`CREATE TABLE IF NOT EXISTS health_id_seq (
+			n INTEGER PRIMARY KEY AUTOINCREMENT
+		)`,
+		fmt.Sprintf(`INSERT INTO sqlite_sequence (name, seq)
+			SELECT 'health_id_seq', %d WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'health_id_seq')`, healthid.SeqStart),
+		`CREATE TABLE IF NOT EXISTS health_id_records (
+			HealthID TEXT PRIMARY KEY,
+			IDNumber TEXT NOT NULL,
+			State TEXT NOT NULL,
+			ReleasedFrom TEXT NOT NULL,
+			Reason TEXT NOT NULL,
+			UpdatedAt DATETIME NOT NULL
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS health_id_records_active ON health_id_records (IDNumber)
+			WHERE State IN ('reserved', 'bound')`,
+		`CREATE TABLE IF NOT EXISTS duplicate_candidates (
+			ID TEXT PRIMARY KEY,
+			IDNumberA TEXT NOT NULL,
+			IDNumberB TEXT NOT NULL,
+			Score REAL NOT NULL,
+			Class TEXT NOT NULL,
+			Fields TEXT NOT NULL,
+			Status TEXT NOT NULL,
+			Survivor TEXT NOT NULL,
+			Reason TEXT NOT NULL,
+			CreatedAt DATETIME NOT NULL,
+			UpdatedAt DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS duplicate_candidates_status ON duplicate_candidates (Status, Score)`,
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			Seq INTEGER PRIMARY KEY,
+			Time DATETIME NOT NULL,
+			Caller TEXT NOT NULL,
+			Purpose TEXT NOT NULL,
+			CorrelationID TEXT NOT NULL,
+			Operation TEXT NOT NULL,
+			IDHash TEXT NOT NULL,
+			Source TEXT NOT NULL,
+			Result TEXT NOT NULL,
+			Detail TEXT NOT NULL,
+			PrevHash TEXT NOT NULL,
+			Hash TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_id ON audit_events (IDHash)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_caller ON audit_events (Caller)`,
+		// the trail is append only
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+			BEGIN SELECT RAISE(ABORT, 'audit events are append only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+			BEGIN SELECT RAISE(ABORT, 'audit events are append only'); END`,
+		`CREATE TABLE IF NOT EXISTS audit_checkpoints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			Seq INTEGER NOT NULL,
+			Hash TEXT NOT NULL,
+			Time DATETIME NOT NULL,
+			Signature TEXT NOT NULL
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS audit_checkpoints_no_update BEFORE UPDATE ON audit_checkpoints
+			BEGIN SELECT RAISE(ABORT, 'audit checkpoints are append only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_checkpoints_no_delete BEFORE DELETE ON audit_checkpoints
+			BEGIN SELECT RAISE(ABORT, 'audit checkpoints are append only'); END`,
+		`CREATE TABLE IF NOT EXISTS consent_directives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			IDNumber TEXT NOT NULL,
+			Purpose TEXT NOT NULL,
+			Caller TEXT NOT NULL,
+			Categories TEXT NOT NULL,
+			Reason TEXT NOT NULL,
+			CreatedAt DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS consent_directives_id ON consent_directives (IDNumber)`,
+		`CREATE TABLE IF NOT EXISTS pseudonyms (
+			Consumer TEXT NOT NULL,
+			Pseudonym TEXT NOT NULL,
+			Kind TEXT NOT NULL,
+			Value TEXT NOT NULL,
+			CreatedAt DATETIME NOT NULL,
+			PRIMARY KEY (Consumer, Pseudonym)
+		)`,
+		`CREATE TABLE IF NOT EXISTS patient_aliases (
+			IdNumber TEXT PRIMARY KEY,
+			HealthId TEXT NOT NULL,
+			CreatedAt DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS patient_aliases_health_id ON patient_aliases (HealthId)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// addColumns adds the columns of the entities the table of an older db doesn't have
+func (s *Store) addColumns(table string, cols []column) error {
+	var existing []struct {
+		Name string `db:"name"`
+	}
+	if err := s.db.Select(&existing, fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table)); err != nil {
+		return err
+	}
+	has := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		has[strings.ToLower(e.Name)] = true
+	}
+	for _, c := range cols {
+		if has[strings.ToLower(c.name)] {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %q %s", table, c.name, c.typ)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPatient returns the patient with the id number.
+// if not found it returns a patient with a reserved health id and store.ErrNotFound
+func (s *Store) GetPatient(ctx context.Context, id, birthDate string) (*store.Patient, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	pnt, err := s.GetPatientByID(ctx, id)
+	if err != store.ErrNotFound {
+		return pnt, err
+	}
+	// a merged id number returns the patient it was merged into
+	pnt, err = s.getMerged(ctx, id)
+	if err != store.ErrNotFound {
+		return pnt, err
+	}
+
+	reserved, err := s.ids.Reserve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &store.Patient{ReservedHealthID: &reserved}, store.ErrNotFound
+}
+
+// GetPatientByID returns the patient with the id number or store.ErrNotFound
+func (s *Store) GetPatientByID(ctx context.Context, id string) (*store.Patient, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	where, args := s.idWhere(id)
+	pnt := &store.Patient{}
+	err := s.db.GetContext(ctx, pnt, `SELECT * FROM patients WHERE `+where, args...)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if s.cols != nil {
+		if err := s.cols.Open(ctx, pnt); err != nil {
+			return nil, err
+		}
+	}
+	return pnt, nil
+}
+
+// AddPatient adds the patient, it gets the health id reserved for it by GetPatient
+// or a new one and binds it, adding an existing patient updates it
+func (s *Store) AddPatient(ctx context.Context, pnt *store.Patient) error {
+	if pnt.IDNumber == nil || *pnt.IDNumber == "" {
+		return store.ErrSearch
+	}
+
+	_, err := s.GetPatientByID(ctx, *pnt.IDNumber)
+	if err == nil {
+		return s.UpdatesPatient(ctx, pnt)
+	} else if err != store.ErrNotFound {
+		return err
+	}
+
+	cp := *pnt
+	if cp.HealthID == nil {
+		cp.HealthID = cp.ReservedHealthID
+	}
+	if cp.HealthID == nil {
+		reserved, err := s.ids.Reserve(ctx, *cp.IDNumber)
+		if err != nil {
+			return err
+		}
+		cp.HealthID = &reserved
+	}
+	if err := s.ids.Bind(ctx, *cp.HealthID, *cp.IDNumber); err != nil {
+		return err
+	}
+	cp.ReservedHealthID = nil
+	now := s.now().Format(timeLayout)
+	cp.RowUpdatedAt = &now
+	row, err := s.seal(ctx, &cp)
+	if err != nil {
+		return err
+	}
+	return s.insert(ctx, tablePatients, row)
+}
+
+// DeletePatient removes the patient e.g. after its health id was released,
+// unlike practitioners patients aren't soft deleted
+func (s *Store) DeletePatient(ctx context.Context, id string) error {
+	where, args := s.idWhere(id)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM patients WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// MergePatient removes the patient merged into the one with the health id and keeps its id number
+// as an alias, GetPatient of the id number returns the survivor instead of adding it again
+func (s *Store) MergePatient(ctx context.Context, id, healthID string) error {
+	old, err := s.GetPatientByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	ctx, done := running(ctx)
+	defer done()
+	tx, err := s.db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := s.idWhere(id)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM patients WHERE `+where, args...); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO patient_aliases (IdNumber, HealthId, CreatedAt) VALUES (?, ?, ?)
+		ON CONFLICT (IdNumber) DO UPDATE SET HealthId = excluded.HealthId`, s.aliasKey(id), healthID, s.now().Format(timeLayout))
+	if err != nil {
+		return err
+	}
+	// the id numbers merged into the removed patient follow it
+	if old.HealthID != nil && *old.HealthID != healthID {
+		if _, err := tx.ExecContext(ctx, `UPDATE patient_aliases SET HealthId = ? WHERE HealthId = ?`, healthID, *old.HealthID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getMerged returns the patient the id number was merged into or store.ErrNotFound
+func (s *Store) getMerged(ctx context.Context, id string) (*store.Patient, error) {
+	var healthID string
+	err := s.db.GetContext(ctx, &healthID, `SELECT HealthId FROM patient_aliases WHERE IdNumber IN (?, ?)`, id, s.aliasKey(id))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	pnt := &store.Patient{}
+	err = s.db.GetContext(ctx, pnt, `SELECT * FROM patients WHERE HealthId = ? ORDER BY IdNumber LIMIT 1`, healthID)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if s.cols != nil {
+		if err := s.cols.Open(ctx, pnt); err != nil {
+			return nil, err
+		}
+	}
+	return pnt, nil
+}
+
+// SearchPatients returns the patients matching q ordered by id number
+func (s *Store) SearchPatients(ctx context.Context, q *store.PatientSearch) (*[]store.Patient, error) {
+	if !q.Valid() {
+		return nil, store.ErrSearch
+	}
+
+	var where []string
+	var args []interface{}
+	// a word of the name starts with it, LIKE ignores the case of ascii letters
+	words := func(value string, columns ...string) {
+		var or []string
+		for _, c := range columns {
+			or = append(or, c+" LIKE ? ESCAPE '\\'", c+" LIKE ? ESCAPE '\\'")
+			v := likeEscaper.Replace(strings.TrimSpace(value))
+			args = append(args, v+"%", "% "+v+"%")
+		}
+		where = append(where, "("+strings.Join(or, " OR ")+")")
+	}
+	if q.Family != "" {
+		words(q.Family, "FamilyName", "EnglishLastName")
+	}
+	if q.Given != "" {
+		words(q.Given, "FirstName", "FatherName", "GrandFatherName", "EnglishFirstName", "EnglishSecondName", "EnglishThirdName")
+	}
+	if dates := q.BirthDates(); dates != nil {
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(dates)), ", ")
+		where = append(where, fmt.Sprintf("(DateOfBirthG IN (%s) OR DateOfBirthH IN (%s))", in, in))
+		for i := 0; i < 2; i++ {
+			for _, d := range dates {
+				args = append(args, d)
+			}
+		}
+	}
+	if q.Gender != "" {
+		values := store.GenderValues(q.Gender)
+		where = append(where, fmt.Sprintf("LOWER(TRIM(Gender)) IN (%s)", strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")))
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+
+	query := `SELECT * FROM patients WHERE ` + strings.Join(where, " AND ") + ` ORDER BY IdNumber`
+	// encrypted id numbers are sorted after they're decrypted, the limit too
+	sorted := s.cols == nil || !s.cols.Encrypts("id_number")
+	if q.Limit > 0 && sorted {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	pnts := []store.Patient{}
+	if err := s.db.SelectContext(ctx, &pnts, query, args...); err != nil {
+		return nil, err
+	}
+	if err := s.open(ctx, pnts); err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(pnts) > q.Limit {
+		pnts = pnts[:q.Limit]
+	}
+	return &pnts, nil
+}
+
+// ListPatients returns all the patients ordered by id number
+func (s *Store) ListPatients(ctx context.Context) (*[]store.Patient, error) {
+	pnts := []store.Patient{}
+	if err := s.db.SelectContext(ctx, &pnts, `SELECT * FROM patients ORDER BY IdNumber`); err != nil {
+		return nil, err
+	}
+	if err := s.open(ctx, pnts); err != nil {
+		return nil, err
+	}
+	return &pnts, nil
+}
+
+// UpdatesPatient updates the fields set in pnt
+func (s *Store) UpdatesPatient(ctx context.Context, pnt *store.Patient) error {
+	if pnt.IDNumber == nil || *pnt.IDNumber == "" {
+		return store.ErrSearch
+	}
+	cp := *pnt
+	now := s.now().Format(timeLayout)
+	cp.RowUpdatedAt = &now
+	row, err := s.seal(ctx, &cp)
+	if err != nil {
+		return err
+	}
+	where, args := s.idWhere(*pnt.IDNumber)
+	return s.update(ctx, tablePatients, row, where, args...)
+}
+
+// GetPractitioner returns the practitioner with the id number.
+// if not found it returns a practitioner with a reserved health id and store.ErrNotFound
+func (s *Store) GetPractitioner(ctx context.Context, id string) (*store.Practitioner, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	pract := &store.Practitioner{}
+	err := s.db.GetContext(ctx, pract, `SELECT * FROM practitioners WHERE IDNumber = ? AND `+notDeleted, id)
+	if err == nil {
+		return pract, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	reserved, err := s.ids.Reserve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &store.Practitioner{HealthID: &reserved}, store.ErrNotFound
+}
+
+// ListPractitioners returns the practitioners that aren't deleted ordered by id number
+func (s *Store) ListPractitioners(ctx context.Context) (*[]store.Practitioner, error) {
+	practs := []store.Practitioner{}
+	if err := s.db.SelectContext(ctx, &practs, `SELECT * FROM practitioners WHERE `+notDeleted+` ORDER BY IDNumber`); err != nil {
+		return nil, err
+	}
+	return &practs, nil
+}
+
+// AddPractitioner adds the practitioner, adding an existing practitioner updates it,
+// a deleted practitioner is kept as is and a new row is added
+func (s *Store) AddPractitioner(ctx context.Context, pract *store.Practitioner) error {
+	if pract.IDNumber == nil || *pract.IDNumber == "" {
+		return store.ErrSearch
+	}
+
+	now := s.now().Format(timeLayout)
+	cp := *pract
+	cp.RowUpdatedAt = &now
+	err := s.update(ctx, tablePractitioners, &cp, "IDNumber = ? AND "+notDeleted, *pract.IDNumber)
+	if err != store.ErrNotFound {
+		return err
+	}
+
+	if cp.HealthID != nil {
+		if err := s.ids.Bind(ctx, *cp.HealthID, *cp.IDNumber); err != nil {
+			return err
+		}
+	}
+	if cp.PractitionerID == nil {
+		cp.PractitionerID = cp.HealthID
+	}
+	deleted := "0"
+	cp.IsDelted = &deleted
+	cp.RowInseartedAt = &now
+	cp.RowDeletedAt = nil
+	return s.insert(ctx, tablePractitioners, &cp)
+}
+
+// DeletePractitioner soft deletes the practitioner
+func (s *Store) DeletePractitioner(ctx context.Context, id string) error {
+	return s.softDelete(ctx, tablePractitioners, "IDNumber", id)
+}
+
+// GetEstablishment returns the establishment with the organization id
+func (s *Store) GetEstablishment(ctx context.Context, id string) (*store.Establishment, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	est := &store.Establishment{}
+	err := s.db.GetContext(ctx, est, `SELECT * FROM establishments WHERE OrganizationId = ? AND `+notDeleted, id)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return est, nil
+}
+
+// GetEstablishmentV2 returns the establishment with the organization id
+func (s *Store) GetEstablishmentV2(ctx context.Context, id string) (*store.EstablishmentV2, error) {
+	if id == "" {
+		return nil, store.ErrSearch
+	}
+
+	est := &store.EstablishmentV2{}
+	err := s.db.GetContext(ctx, est, `SELECT * FROM establishments_v2 WHERE OrganizationId = ? AND `+notDeleted, id)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return est, nil
+}
+
+// GetEstablishments returns all the establishments that aren't deleted ordered by organization id
+func (s *Store) GetEstablishments(ctx context.Context) (*[]store.Establishments, error) {
+	ests := []store.Establishments{}
+	if err := s.db.SelectContext(ctx, &ests, `SELECT * FROM establishments WHERE `+notDeleted+` ORDER BY OrganizationId`); err != nil {
+		return nil, err
+	}
+	return &ests, nil
+}
+
+// GetEstablishmentsV2 returns all the establishments that aren't deleted ordered by organization id
+func (s *Store) GetEstablishmentsV2(ctx context.Context) (*[]store.EstablishmentV2, error) {
+	ests := []store.EstablishmentV2{}
+	if err := s.db.SelectContext(ctx, &ests, `SELECT * FROM establishments_v2 WHERE `+notDeleted+` ORDER BY OrganizationId`); err != nil {
+		return nil, err
+	}
+	return &ests, nil
+}
+
+// UpdateGovEstablishment adds the establishment or updates the fields set in est
+func (s *Store) UpdateGovEstablishment(ctx context.Context, est *store.Establishment) error {
+	if err := est.Validate(); err != nil {
+		return err
+	}
+
+	now := s.now().Format(timeLayout)
+	cp := *est
+	cp.RowUpdatedAt = &now
+	err := s.update(ctx, tableEstablishments, &cp, "OrganizationId = ? AND "+notDeleted, *est.OrganizationID)
+	if err != store.ErrNotFound {
+		return err
+	}
+
+	deleted := "0"
+	cp.IsDeleted = &deleted
+	cp.RowInsertedAt = &now
+	cp.RowDeletedAt = nil
+	return s.insert(ctx, tableEstablishments, &cp)
+}
+
+// AddEstablishmentV2 adds the establishment
+func (s *Store) AddEstablishmentV2(ctx context.Context, est *store.EstablishmentV2) error {
+	if est.OrganizationID == nil {
+		return store.ErrEmptyOrganizationID
+	}
+	return s.insert(ctx, tableEstablishmentsV2, est)
+}
+
+// DeleteEstablishment soft deletes the establishment and its v2 row
+func (s *Store) DeleteEstablishment(ctx context.Context, id string) error {
+	if err := s.softDelete(ctx, tableEstablishments, "OrganizationId", id); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE establishments_v2 SET IsDeleted = '1' WHERE OrganizationId = ?`, id)
+	return err
+}
+
+// GetCountryIsoCode returns the country of the nationality,
+// nationality can be the name used by Yakeen or the english name
+func (s *Store) GetCountryIsoCode(ctx context.Context, nationality *string) (*store.ISOCode, error) {
+	if nationality == nil {
+		return nil, store.ErrSearch
+	}
+
+	iso := &store.ISOCode{}
+	n := strings.TrimSpace(*nationality)
+	err := s.db.GetContext(ctx, iso, `SELECT ISOAlpha3Code, CountryNameEn FROM countries
+		WHERE Nationality = ? OR CountryNameEn = ? LIMIT 1`, n, n)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return iso, nil
+}
+
+// AddCountry maps nationality to its iso alpha 3 code and english name
+func (s *Store) AddCountry(ctx context.Context, nationality, code, nameEn string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO countries (Nationality, ISOAlpha3Code, CountryNameEn)
+		VALUES (?, ?, ?)`, nationality, code, nameEn)
+	return err
+}
+
+// insert adds v as a new row of table
+func (s *Store) insert(ctx context.Context, table string, v interface{}) error {
+	var cols, params []string
+	var args []interface{}
+	for _, f := range fieldsOf(v) {
+		if table == tablePractitioners && f.name == "id" {
+			continue
+		}
+		cols = append(cols, fmt.Sprintf("%q", f.name))
+		params = append(params, "?")
+		args = append(args, f.value.Interface())
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), strings.Join(params, ", "))
+	_, err := s.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// update sets the non nil fields of v in the rows matching where,
+// it returns store.ErrNotFound if none matched
+func (s *Store) update(ctx context.Context, table string, v interface{}, where string, whereArgs ...interface{}) error {
+	var set []string
+	var args []interface{}
+	for _, f := range fieldsOf(v) {
+		if f.value.Kind() != reflect.Ptr && f.value.Kind() != reflect.Interface {
+			continue
+		}
+		if f.value.IsNil() {
+			continue
+		}
+		set = append(set, fmt.Sprintf("%q = ?", f.name))
+		args = append(args, f.value.Interface())
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(set, ", "), where)
+	res, err := s.db.ExecContext(ctx, q, append(args, whereArgs...)...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// softDelete marks the row deleted like the MSSQL store does instead of removing it
+func (s *Store) softDelete(ctx context.Context, table, key, id string) error {
+	now := s.now().Format(timeLayout)
+	q := fmt.Sprintf(`UPDATE %s SET IsDeleted = '1', RowDeletedAt = ?, RowUpdatedAt = ? WHERE %q = ? AND %s`, table, key, notDeleted)
+	res, err := s.db.ExecContext(ctx, q, now, now, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+type field struct {
+	name  string
+	value reflect.Value
+}
+
+// fieldsOf returns the columns of v with their values,
+// a column tagged twice gets the first field e.g. Practitioner_id
+func fieldsOf(v interface{}) []field {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	seen := make(map[string]bool)
+	var fields []field
+	for i := 0; i < rt.NumField(); i++ {
+		name := columnName(rt.Field(i))
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		fields = append(fields, field{name: name, value: rv.Field(i)})
+	}
+	return fields
+}
+
+func columnsOf(v interface{}) []column {
+	var cols []column
+	for _, f := range fieldsOf(v) {
+		typ := "TEXT"
+		switch f.value.Kind() {
+		case reflect.Int:
+			typ = "INTEGER"
+		case reflect.Interface:
+			typ = ""
+		}
+		cols = append(cols, column{name: f.name, typ: typ})
+	}
+	return cols
+}
+
+// columnName is the db tag or the lowercased name like the sqlx mapper
+func columnName(f reflect.StructField) string {
+	tag := f.Tag.Get("db")
+	if tag == "-" {
+		return ""
+	}
+	if tag != "" {
+		return tag
+	}
+	return strings.ToLower(f.Name)
+}
@@ -0,0 +1,241 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"gitlab.lean/leandevclan/nhic/store"
+)
+
+func sp(s string) *string {
+	return &s
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func newStore(t *testing.T) *Store {
+	s, err := New(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestPatients(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	pnt, err := s.GetPatient(ctx, "1000000008", "")
+	if err != store.ErrNotFound || pnt.ReservedHealthID == nil {
+		t.Fatalf("got %+v %v", pnt, err)
+	}
+	reserved := *pnt.ReservedHealthID
+	if err := s.AddPatient(ctx, &store.Patient{IDNumber: sp("1000000008"), ReservedHealthID: &reserved,
+		FirstNameEn: sp("Ali"), MobileNumber: sp("0500000000")}); err != nil {
+		t.Fatal(err)
+	}
+	// adding it again updates the fields set
+	if err := s.AddPatient(ctx, &store.Patient{IDNumber: sp("1000000008"), LastNameEn: sp("Smith")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdatesPatient(ctx, &store.Patient{IDNumber: sp("1000000008"), MobileNumber: sp("0500000001")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddPatient(ctx, &store.Patient{IDNumber: sp("1000000016"), FirstNameEn: sp("Sara")}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetPatientByID(ctx, "1000000008")
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"reserved health id bound", str(got.HealthID), reserved},
+		{"not reserved anymore", str(got.ReservedHealthID), ""},
+		{"kept by the update", str(got.FirstNameEn), "Ali"},
+		{"added by adding again", str(got.LastNameEn), "Smith"},
+		{"updated", str(got.MobileNumber), "0500000001"},
+		{"update time", str(got.RowUpdatedAt)[:2], "20"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if pnts, _ := s.ListPatients(ctx); len(*pnts) != 2 || str((*pnts)[0].IDNumber) != "1000000008" {
+		t.Errorf("list %+v", pnts)
+	}
+	if pnts, _ := s.SearchPatients(ctx, &store.PatientSearch{Given: "sar"}); len(*pnts) != 1 || str((*pnts)[0].IDNumber) != "1000000016" {
+		t.Errorf("search %+v", pnts)
+	}
+	// LIKE wildcards are searched as is
+	if pnts, _ := s.SearchPatients(ctx, &store.PatientSearch{Given: "%"}); len(*pnts) != 0 {
+		t.Errorf("wildcard search %+v", pnts)
+	}
+
+	errs := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"update not stored", s.UpdatesPatient(ctx, &store.Patient{IDNumber: sp("1000000024")}), store.ErrNotFound},
+		{"add without an id number", s.AddPatient(ctx, &store.Patient{}), store.ErrSearch},
+		{"search without a criteria", searchErr(s, &store.PatientSearch{}), store.ErrSearch},
+		{"delete", s.DeletePatient(ctx, "1000000016"), nil},
+		{"delete again", s.DeletePatient(ctx, "1000000016"), store.ErrNotFound},
+	}
+	for _, tt := range errs {
+		if tt.err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+func searchErr(s *Store, q *store.PatientSearch) error {
+	_, err := s.SearchPatients(context.Background(), q)
+	return err
+}
+
+func TestPractitioners(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	if err := s.AddPractitioner(ctx, &store.Practitioner{IDNumber: sp("1000000008"), HealthID: sp("ID10000000000016"), FirstNameEn: sp("Sara")}); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.GetPractitioner(ctx, "1000000008")
+	if err := s.DeletePractitioner(ctx, "1000000008"); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := s.GetPractitioner(ctx, "1000000008")
+	if err != store.ErrNotFound || deleted.HealthID == nil {
+		t.Fatalf("deleted: %+v %v", deleted, err)
+	}
+	// adding a deleted practitioner keeps the deleted row and adds another
+	if err := s.AddPractitioner(ctx, &store.Practitioner{IDNumber: sp("1000000008"), FirstNameEn: sp("Sarah")}); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := s.GetPractitioner(ctx, "1000000008")
+	practs, _ := s.ListPractitioners(ctx)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		// Practitioner_id is read into HealthID, the first field tagged with it
+		{"practitioner id is the health id", str(first.HealthID), "ID10000000000016"},
+		{"new row", again.ID, first.ID + 1},
+		{"new row fields", str(again.FirstNameEn), "Sarah"},
+		{"not deleted", str(again.IsDelted), "0"},
+		{"listed", len(*practs), 1},
+		{"delete twice", s.DeletePractitioner(ctx, "1000000016"), store.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEstablishments(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	if err := s.UpdateGovEstablishment(ctx, &store.Establishment{OrganizationID: sp("10001"), Code: sp("H-1"), NameEn: sp("Noor Hospital")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateGovEstablishment(ctx, &store.Establishment{OrganizationID: sp("10001"), Code: sp("H-1"), CityEn: sp("Riyadh")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddEstablishmentV2(ctx, &store.EstablishmentV2{OrganizationID: sp("10001"), The700Number: sp("920000000")}); err != nil {
+		t.Fatal(err)
+	}
+	est, _ := s.GetEstablishment(ctx, "10001")
+	if str(est.NameEn) != "Noor Hospital" || str(est.CityEn) != "Riyadh" {
+		t.Errorf("updated %+v", est)
+	}
+	if err := s.DeleteEstablishment(ctx, "10001"); err != nil {
+		t.Fatal(err)
+	}
+	ests, _ := s.GetEstablishments(ctx)
+	v2s, _ := s.GetEstablishmentsV2(ctx)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"deleted", getErr(s.GetEstablishment(ctx, "10001")), store.ErrNotFound},
+		{"v2 deleted with it", getErr(s.GetEstablishmentV2(ctx, "10001")), store.ErrNotFound},
+		{"not listed", len(*ests), 0},
+		{"v2 not listed", len(*v2s), 0},
+		{"delete twice", s.DeleteEstablishment(ctx, "10001"), store.ErrNotFound},
+		{"v2 without an organization", s.AddEstablishmentV2(ctx, &store.EstablishmentV2{}), store.ErrEmptyOrganizationID},
+		{"no code", s.UpdateGovEstablishment(ctx, &store.Establishment{OrganizationID: sp("10002")}), store.ErrEmptyCode},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func getErr(_ interface{}, err error) error {
+	return err
+}
+
+func TestCountries(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+	if err := s.AddCountry(ctx, "سعودي", "SAU", "Saudi Arabia"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		nationality string
+		want        string
+		err         error
+	}{
+		{"سعودي", "SAU", nil},
+		{" Saudi Arabia ", "SAU", nil},
+		{"مصري", "", store.ErrNotFound},
+	}
+	for _, tt := range tests {
+		iso, err := s.GetCountryIsoCode(ctx, sp(tt.nationality))
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.nationality, err, tt.err)
+		} else if err == nil && str(iso.Code) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.nationality, str(iso.Code), tt.want)
+		}
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := newStore(t)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"get", getErr(s.GetPatient(ctx, "1000000008", ""))},
+		{"add", s.AddPatient(ctx, &store.Patient{IDNumber: sp("1000000008")})},
+		{"practitioner", getErr(s.GetPractitioner(ctx, "1000000008"))},
+		{"establishment", getErr(s.GetEstablishment(ctx, "10001"))},
+	}
+	for _, tt := range tests {
+		if tt.err != context.Canceled {
+			t.Errorf("%s: got %v", tt.name, tt.err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package translit writes arabic names in english the way the civil affairs does on the id cards
+// and passports, for the patients Yakeen returns without an english name.
+//
+// the common names are looked up in a table. the others are transliterated letter by letter,
+// arabic doesn't write the short vowels so they're guessed: a between the first two consonants,
+// i after a long a (the faa'il pattern e.g. khalid) and a before a third consonant in a row.
+// the prefixes are written joined: Abdul..., Al...
+package translit
+
+import (
+	"strings"
+
+	"gitlab.lean/leandevclan/nhic/names"
+)
+
+// common names by their names.Normalize form
+var common = map[string]string{
+	"محمد": "Mohammed", "احمد": "Ahmed", "محمود": "Mahmoud", "علي": "Ali", "عمر": "Omar",
+	"عثمان": "Othman", "خالد": "Khalid", "فهد": "Fahad", "سعود": "Saud", "سعد": "Saad",
+	"سعيد": "Saeed", "سلطان": "Sultan", "فيصل": "Faisal", "تركي": "Turki", "ناصر": "Nasser",
+	"صالح": "Saleh", "ابراهيم": "Ibrahim", "يوسف": "Yousef", "حسن": "Hassan", "حسين": "Hussein",
+	"عبدالله": "Abdullah", "سلمان": "Salman", "سليمان": "Sulaiman", "منصور": "Mansour", "ماجد": "Majed",
+	"بندر": "Bandar", "نايف": "Naif", "مشعل": "Mishal", "متعب": "Mutaib", "طلال": "Talal",
+	"وليد": "Waleed", "ياسر": "Yasser", "عادل": "Adel", "حمد": "Hamad", "حمود": "Hamoud",
+	"مساعد": "Musaed", "راشد": "Rashed", "زياد": "Ziyad", "مازن": "Mazen", "هاني": "Hani",
+	"ريان": "Rayan", "عمار": "Ammar", "بدر": "Badr", "نواف": "Nawaf", "ثامر": "Thamer",
+	"عيسي": "Eisa", "موسي": "Mousa", "مصطفي": "Mustafa", "اسماعيل": "Ismail", "يحيي": "Yahya",
+	"زيد": "Zaid", "طارق": "Tariq", "حامد": "Hamed", "جابر": "Jaber", "مشاري": "Meshari",
+	"فاطمه": "Fatimah", "نوره": "Noura", "ساره": "Sarah", "عايشه": "Aisha", "مريم": "Maryam",
+	"هند": "Hind", "منيره": "Munirah", "لطيفه": "Latifah", "حصه": "Hessa", "ريم": "Reem",
+	"نوف": "Nouf", "اسماء": "Asma", "خديجه": "Khadijah", "امل": "Amal", "هيا": "Haya",
+	"العنود": "Alanoud", "شهد": "Shahad", "ليلي": "Laila", "جواهر": "Jawaher", "دانه": "Dana",
+	"رهف": "Rahaf", "غاده": "Ghada", "مها": "Maha", "مني": "Mona", "نجلاء": "Najla",
+	"وفاء": "Wafa", "زينب": "Zainab", "رقيه": "Ruqayyah", "حنان": "Hanan",
+	"ابو": "Abu", "بن": "Bin", "بنت": "Bint",
+	// the second half of the abd names, after the al
+	"رحمن": "Rahman", "عزيز": "Aziz", "مجيد": "Majeed", "كريم": "Kareem", "رحيم": "Raheem",
+	"اله": "Elah", "لطيف": "Latif", "محسن": "Mohsen", "هادي": "Hadi", "ملك": "Malik",
+	// family names, after the al
+	"قحطاني": "Qahtani", "عتيبي": "Otaibi", "غامدي": "Ghamdi", "زهراني": "Zahrani", "شهري": "Shehri",
+	"دوسري": "Dossary", "مطيري": "Mutairi", "حربي": "Harbi", "عنزي": "Anazi", "شمري": "Shammari",
+	"سبيعي": "Subaie", "عسيري": "Asiri", "يامي": "Yami", "رشيدي": "Rashidi", "بلوي": "Balawi",
+	"عمري": "Amri", "مالكي": "Malki", "جهني": "Juhani", "حازمي": "Hazmi", "شهراني": "Shahrani",
+	"قرني": "Qarni", "خالدي": "Khalidi", "تميمي": "Tamimi", "سهلي": "Sahli", "بقمي": "Buqami",
+	"ظفيري": "Dhafeeri", "عجمي": "Ajmi", "هاجري": "Hajri", "مري": "Marri", "شيخ": "Sheikh",
+}
+
+var consonants = map[rune]string{
+	'ب': "b", 'ت': "t", 'ث': "th", 'ج': "j", 'ح': "h", 'خ': "kh", 'د': "d", 'ذ': "th",
+	'ر': "r", 'ز': "z", 'س': "s", 'ش': "sh", 'ص': "s", 'ض': "d", 'ط': "t", 'ظ': "z",
+	'غ': "gh", 'ف': "f", 'ق': "q", 'ك': "k", 'ل': "l", 'م': "m", 'ن': "n", 'ه': "h",
+}
+
+// Name returns the arabic name s in english, each word capitalized. latin words are kept,
+// "" if s has no word
+func Name(s string) string {
+	words := names.Words(s)
+	for i, w := range words {
+		words[i] = capitalize(word(w))
+	}
+	return strings.Join(words, " ")
+}
+
+// word transliterates a normalized word in lower case
+func word(w string) string {
+	if en, ok := common[w]; ok {
+		return strings.ToLower(en)
+	}
+	r := []rune(w)
+	if len(r) > 3 && string(r[:3]) == "عبد" {
+		rest := r[3:]
+		if len(rest) > 2 && string(rest[:2]) == "ال" {
+			rest = rest[2:]
+		}
+		return "abdul" + word(string(rest))
+	}
+	if len(r) > 4 && string(r[:2]) == "ال" {
+		return "al" + word(string(r[2:]))
+	}
+	return letters(r)
+}
+
+// token is a transliterated letter
+type token struct {
+	s     string
+	vowel bool
+	// long vowels are the letters alef, waw and yaa, the short ones are guessed
+	long bool
+}
+
+// letters transliterates w letter by letter, guessing the short vowels
+func letters(w []rune) string {
+	var toks []token
+	prevVowel := func() bool { return len(toks) == 0 || toks[len(toks)-1].vowel }
+	for i, r := range w {
+		last := i == len(w)-1
+		switch r {
+		case 'ا':
+			toks = append(toks, token{s: "a", vowel: true, long: true})
+		case 'و':
+			switch {
+			case i == 0 || prevVowel():
+				toks = append(toks, token{s: "w"})
+			case last:
+				toks = append(toks, token{s: "o", vowel: true, long: true})
+			default:
+				toks = append(toks, token{s: "ou", vowel: true, long: true})
+			}
+		case 'ي':
+			if i == 0 || prevVowel() {
+				toks = append(toks, token{s: "y"})
+			} else {
+				toks = append(toks, token{s: "i", vowel: true, long: true})
+			}
+		case 'ع':
+			// the ain isn't written, it's heard as an a
+			if !prevVowel() || i == 0 {
+				if i+1 < len(w) && w[i+1] == 'ا' {
+					continue
+				}
+				toks = append(toks, token{s: "a", vowel: true})
+			}
+		case 'ء':
+		case 'ه':
+			if last && !prevVowel() {
+				// the taa marbuta, normalized to haa
+				toks = append(toks, token{s: "a", vowel: true}, token{s: "h"})
+			} else {
+				toks = append(toks, token{s: "h"})
+			}
+		default:
+			if c, ok := consonants[r]; ok {
+				toks = append(toks, token{s: c})
+			} else {
+				// latin letters and digits
+				toks = append(toks, token{s: string(r), vowel: true})
+			}
+		}
+	}
+
+	var b strings.Builder
+	// run is the number of consonants since the last vowel, lastLong tells if that vowel was long
+	run, seenVowel, lastLong := 0, false, false
+	for _, t := range toks {
+		if t.vowel {
+			run, seenVowel, lastLong = 0, true, t.long
+			b.WriteString(t.s)
+			continue
+		}
+		switch {
+		case run == 1 && !seenVowel, run == 2:
+			b.WriteString("a")
+			run, seenVowel, lastLong = 0, true, false
+		case run == 1 && lastLong:
+			b.WriteString("i")
+			run, lastLong = 0, false
+		}
+		b.WriteString(t.s)
+		run++
+	}
+	return b.String()
+}
+
+func capitalize(w string) string {
+	r := []rune(w)
+	if len(r) == 0 {
+		return w
+	}
+	return strings.ToUpper(string(r[:1])) + string(r[1:])
+}
@@ -0,0 +1,29 @@
+package translit
+
+import "testing"
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"مُحَمَّد", "Mohammed"},
+		{"عبد الرحمن", "Abdulrahman"},
+		{"عبدالعزيز", "Abdulaziz"},
+		{"عبد الإله", "Abdulelah"},
+		{"القحطاني", "Alqahtani"},
+		{"آل سعود", "Alsaud"},
+		{"فاطمة", "Fatimah"},
+		{"خالد بن سلمان", "Khalid Bin Salman"},
+		{"الحارثي", "Alharithi"},
+		{"جميلة", "Jamilah"},
+		{"ماهر", "Mahir"},
+		{"", ""},
+		{"Ali", "Ali"},
+	}
+	for _, tt := range tests {
+		if got := Name(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}